@@ -103,7 +103,7 @@ func (rs *AccountResource) CreateHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	if !configuration.Configuration.Server.Debugging.Enabled {
-		err = sendConfirmEmailForUser(configuration.Configuration.Server.Email.From, newUser)
+		err = sendConfirmEmailForUser(rs.Stores, newUser)
 		if err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
@@ -113,13 +113,12 @@ func (rs *AccountResource) CreateHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // sendConfirmEmailForUser will send the confirmation email to activate the account.
-func sendConfirmEmailForUser(from string, user *model.User) error {
+func sendConfirmEmailForUser(stores *Stores, user *model.User) error {
 	// send email
 	// Send Email to User
-	msg, err := email.NewEmailFromTemplate(from,
-		user.Email,
-		"Confirm Account Instructions",
-		email.ConfirmEmailTemplateEN,
+	msg, err := NewTemplatedEmail(stores, 0,
+		email.ConfirmEmailTemplate,
+		user,
 		map[string]string{
 			"first_name":            user.FirstName,
 			"last_name":             user.LastName,
@@ -153,6 +152,8 @@ func sendConfirmEmailForUser(from string, user *model.User) error {
 // update fields which are non-empty. If both are given, it will update both fields.
 // If the email should be changed a new confirmation email will be sent and clicking
 // on the confirmation link is required to login again.
+// Changing the password revokes all other sessions, refresh tokens and personal
+// access tokens of the account.
 func (rs *AccountResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
@@ -209,9 +210,17 @@ func (rs *AccountResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// only the login which has changed the password stays valid
+	if passwordHasChanged {
+		if err := revokeLogins(rs.Stores, user.ID, accessClaims.SessionID); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
 	// make sure email is valid
 	if emailHasChanged {
-		err = sendConfirmEmailForUser(configuration.Configuration.Server.Email.From, user)
+		err = sendConfirmEmailForUser(rs.Stores, user)
 		if err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
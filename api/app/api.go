@@ -20,9 +20,12 @@
 package app
 
 import (
+	"time"
+
 	"github.com/alexedwards/scs"
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/database"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
@@ -37,6 +40,8 @@ type UserStore interface {
 	Create(p *model.User) (*model.User, error)
 	Delete(userID int64) error
 	FindByEmail(email string) (*model.User, error)
+	FindByIdentity(provider string, subject string) (*model.User, error)
+	LinkIdentity(userID int64, provider string, subject string) error
 	Find(query string) ([]model.User, error)
 	GetEnrollments(userID int64) ([]model.Enrollment, error)
 }
@@ -82,6 +87,7 @@ type CourseStore interface {
 	GetUserEnrollment(courseID int64, userID int64) (*model.UserCourse, error)
 	PointsForUser(userID int64, courseID int64) ([]model.SheetPoints, error)
 	RoleInCourse(userID int64, courseID int64) (authorize.CourseRole, error)
+	HighestRole(userID int64) (authorize.CourseRole, error)
 	UpdateRole(courseID, userID int64, role int) error
 }
 
@@ -114,6 +120,10 @@ type TaskStore interface {
 	CreateRating(p *model.TaskRating) (*model.TaskRating, error)
 	UpdateRating(p *model.TaskRating) error
 	GetAllMissingTasksForUser(userID int64) ([]model.MissingTask, error)
+	GetActiveDockerImages() ([]string, error)
+
+	UpdatePublicReferenceInfo(taskID int64, log string, state symbol.ReferenceState) error
+	UpdatePrivateReferenceInfo(taskID int64, log string, state symbol.ReferenceState) error
 }
 
 // GroupStore specifies required database queries for Task management.
@@ -162,6 +172,8 @@ type SubmissionStore interface {
 	Get(submissionID int64) (*model.Submission, error)
 	GetByUserAndTask(userID int64, taskID int64) (*model.Submission, error)
 	Create(p *model.Submission) (*model.Submission, error)
+	UpdateCreatedAt(submissionID int64, createdAt time.Time) error
+	SubmissionsOfTask(taskID int64) ([]model.Submission, error)
 	GetFiltered(filterCourseID, filterGroupID, filterUserID, filterSheetID, filterTaskID int64) ([]model.Submission, error)
 }
 
@@ -191,73 +203,304 @@ type GradeStore interface {
 	UpdatePrivateTestInfo(gradeID int64, log string, status symbol.TestingResult) error
 	UpdatePublicTestInfo(gradeID int64, log string, status symbol.TestingResult) error
 	IdentifyTaskOfGrade(gradeID int64) (*model.Task, error)
+	TutoredBy(gradeID int64, tutorID int64) (bool, error)
 	GetOverviewGrades(courseID int64, groupID int64) ([]model.OverviewGrade, error)
+	GetAllOfTask(taskID int64) ([]model.Grade, error)
+}
+
+// TestBatchStore defines queries for re-running the tests of a task
+type TestBatchStore interface {
+	Get(batchID int64) (*model.TestBatch, error)
+	BatchesOfTask(taskID int64) ([]model.TestBatch, error)
+	Create(p *model.TestBatch) (*model.TestBatch, error)
+	CreateRun(p *model.TestBatchRun) (*model.TestBatchRun, error)
+	RunsOfBatch(batchID int64) ([]model.TestBatchRun, error)
+	FinishRun(batchID int64, gradeID int64, visibility string, status symbol.TestingResult) error
+}
+
+// WorkerStore defines queries for the registry of background workers
+type WorkerStore interface {
+	Get(workerID int64) (*model.Worker, error)
+	GetAll() ([]model.Worker, error)
+	Heartbeat(p *model.Worker) error
+	Delete(workerID int64) error
+}
+
+// GradeArtifactStore defines queries for the files produced by unit tests
+type GradeArtifactStore interface {
+	Get(artifactID int64) (*model.GradeArtifact, error)
+	ArtifactsOfGrade(gradeID int64, onlyVisibleToStudents bool) ([]model.GradeArtifact, error)
+	Create(p *model.GradeArtifact) (*model.GradeArtifact, error)
+	Update(p *model.GradeArtifact) error
+	Delete(artifactID int64) error
+}
+
+// PersonalAccessTokenStore defines queries for the tokens users create for
+// their scripts
+type PersonalAccessTokenStore interface {
+	Get(tokenID int64) (*model.PersonalAccessToken, error)
+	FindByHash(tokenHash string) (*model.PersonalAccessToken, error)
+	TokensOfUser(userID int64) ([]model.PersonalAccessToken, error)
+	Create(p *model.PersonalAccessToken) (*model.PersonalAccessToken, error)
+	Delete(tokenID int64) error
+	DeleteAllOfUser(userID int64) error
+	Touch(tokenID int64) error
+}
+
+// SessionStore defines the registry of cookie sessions and refresh tokens
+type SessionStore interface {
+	Get(sessionID int64) (*model.Session, error)
+	SessionsOfUser(userID int64) ([]model.Session, error)
+	Create(p *model.Session) (*model.Session, error)
+	Delete(sessionID int64) error
+	DeleteAllOfUser(userID int64, keepID int64) error
+	Touch(sessionID int64, ip string) error
+}
+
+// AuthEventStore defines the log of logins and lockouts
+type AuthEventStore interface {
+	Create(p *model.AuthEvent) error
+	Recent(limit int) ([]model.AuthEvent, error)
+	RecentOfUser(userID int64, limit int) ([]model.AuthEvent, error)
+	KnownDevice(userID int64, ip string, userAgent string) (known bool, anyLogin bool, err error)
+}
+
+// LockoutStore defines queries for failed logins of accounts
+type LockoutStore interface {
+	Get(userID int64) (*model.Lockout, error)
+	CountFailure(userID int64) (int, error)
+	Lock(userID int64, until time.Time) error
+	Unlock(userID int64) error
+}
+
+// RoleStore defines the staff roles courses define as permission sets
+type RoleStore interface {
+	Get(roleID int64) (*model.Role, error)
+	RolesOfCourse(courseID int64) ([]model.Role, error)
+	Create(p *model.Role) (*model.Role, error)
+	Update(p *model.Role) error
+	Delete(roleID int64) error
+	RoleOfUserInCourse(userID int64, courseID int64) (*model.Role, error)
+	Assign(userID int64, p *model.Role) error
+}
+
+// AuditStore defines the append-only log of administrative actions
+type AuditStore interface {
+	Get(entryID int64) (*model.AuditEntry, error)
+	Create(p *model.AuditEntry) (*model.AuditEntry, error)
+	GetFiltered(
+		actorID int64,
+		targetType string,
+		targetID int64,
+		action string,
+		source string,
+		from time.Time,
+		to time.Time,
+		limit int,
+		offset int,
+	) ([]model.AuditEntry, error)
+}
+
+// OutgoingEmailStore defines queries for the queue of outgoing emails
+type OutgoingEmailStore interface {
+	Get(emailID int64) (*model.OutgoingEmail, error)
+	Create(p *model.OutgoingEmail) (*model.OutgoingEmail, error)
+	Update(p *model.OutgoingEmail) error
+	ClaimDue(now time.Time, claimedUntil time.Time, limit int) ([]model.OutgoingEmail, error)
+	GetFiltered(status string, limit int, offset int) ([]model.OutgoingEmail, error)
+}
+
+// EmailTemplateStore defines queries for customized translations of emails
+type EmailTemplateStore interface {
+	Get(templateID int64) (*model.EmailTemplate, error)
+	Find(courseID int64, name string, language string) (*model.EmailTemplate, error)
+	GetAll(courseID int64) ([]model.EmailTemplate, error)
+	Create(p *model.EmailTemplate) (*model.EmailTemplate, error)
+	Update(p *model.EmailTemplate) error
+	Delete(templateID int64) error
+}
+
+// DeadlineReminderStore defines queries for reminders of upcoming deadlines
+type DeadlineReminderStore interface {
+	DueSheets(from time.Time, to time.Time) ([]model.DueSheet, error)
+	Recipients(sheetID int64, courseID int64) ([]model.User, error)
+	Claim(sheetID int64, userID int64) (bool, error)
+	Enabled(courseID int64, userID int64) (bool, error)
+	SetEnabled(courseID int64, userID int64, enabled bool) error
+}
+
+// ImpersonationStore defines queries for root admins acting as other users
+type ImpersonationStore interface {
+	Get(impersonationID int64) (*model.Impersonation, error)
+	Recent(limit int) ([]model.Impersonation, error)
+	Create(p *model.Impersonation) (*model.Impersonation, error)
+	Stop(impersonationID int64) error
+	LogRequest(p *model.ImpersonationRequest) error
+	RequestsOf(impersonationID int64) ([]model.ImpersonationRequest, error)
+}
+
+// TwoFactorStore defines queries for the second factor of accounts
+type TwoFactorStore interface {
+	Get(userID int64) (*model.TwoFactor, error)
+	Create(p *model.TwoFactor) (*model.TwoFactor, error)
+	Update(p *model.TwoFactor) error
+	Delete(userID int64) error
+	UseCounter(userID int64, counter int64) (bool, error)
+	ReplaceRecoveryCodes(userID int64, codeHashes []string) error
+	UseRecoveryCode(userID int64, codeHash string) (bool, error)
+	UnusedRecoveryCodes(userID int64) (int, error)
 }
 
 // API provides application resources and handlers.
 type API struct {
-	User       *UserResource
-	Account    *AccountResource
-	Auth       *AuthResource
-	Course     *CourseResource
-	Sheet      *SheetResource
-	Task       *TaskResource
-	Group      *GroupResource
-	TaskRating *TaskRatingResource
-	Submission *SubmissionResource
-	Material   *MaterialResource
-	Grade      *GradeResource
-	Common     *CommonResource
-	Exam       *ExamResource
+	User          *UserResource
+	Account       *AccountResource
+	Auth          *AuthResource
+	Course        *CourseResource
+	Sheet         *SheetResource
+	Task          *TaskResource
+	Group         *GroupResource
+	TaskRating    *TaskRatingResource
+	Submission    *SubmissionResource
+	Material      *MaterialResource
+	Grade         *GradeResource
+	Common        *CommonResource
+	Exam          *ExamResource
+	TestBatch     *TestBatchResource
+	Worker        *WorkerResource
+	Artifact      *GradeArtifactResource
+	Token         *PersonalAccessTokenResource
+	TwoFactor     *TwoFactorResource
+	Session       *SessionResource
+	AuthEvent     *AuthEventResource
+	Impersonation *ImpersonationResource
+	Role          *RoleResource
+	Audit         *AuditResource
+	OutgoingEmail *OutgoingEmailResource
+	EmailTemplate *EmailTemplateResource
 }
 
 // Stores is the collection of stores. We use this struct to express a kind of
 // hierarchy of database queries, e.g. stores.User.Get(1)
 type Stores struct {
-	Course     CourseStore
-	User       UserStore
-	Sheet      SheetStore
-	Task       TaskStore
-	Group      GroupStore
-	Submission SubmissionStore
-	Material   MaterialStore
-	Grade      GradeStore
-	Exam       ExamStore
+	Course        CourseStore
+	User          UserStore
+	Sheet         SheetStore
+	Task          TaskStore
+	Group         GroupStore
+	Submission    SubmissionStore
+	Material      MaterialStore
+	Grade         GradeStore
+	Exam          ExamStore
+	TestBatch     TestBatchStore
+	Worker        WorkerStore
+	Artifact      GradeArtifactStore
+	Token         PersonalAccessTokenStore
+	TwoFactor     TwoFactorStore
+	Session       SessionStore
+	AuthEvent     AuthEventStore
+	Lockout       LockoutStore
+	Impersonation ImpersonationStore
+	Role          RoleStore
+	Audit         AuditStore
+	OutgoingEmail OutgoingEmailStore
+	EmailTemplate EmailTemplateStore
+	Reminder      DeadlineReminderStore
+
+	// nil within a transaction
+	db *sqlx.DB
 }
 
 // NewStores build all stores and connect them to a database.
 func NewStores(db *sqlx.DB) *Stores {
+	stores := newStores(db)
+	stores.db = db
+	return stores
+}
+
+func newStores(db database.Queryer) *Stores {
 	return &Stores{
-		Course:     database.NewCourseStore(db),
-		User:       database.NewUserStore(db),
-		Sheet:      database.NewSheetStore(db),
-		Task:       database.NewTaskStore(db),
-		Group:      database.NewGroupStore(db),
-		Submission: database.NewSubmissionStore(db),
-		Material:   database.NewMaterialStore(db),
-		Grade:      database.NewGradeStore(db),
-		Exam:       database.NewExamStore(db),
+		Course:        database.NewCourseStore(db),
+		User:          database.NewUserStore(db),
+		Sheet:         database.NewSheetStore(db),
+		Task:          database.NewTaskStore(db),
+		Group:         database.NewGroupStore(db),
+		Submission:    database.NewSubmissionStore(db),
+		Material:      database.NewMaterialStore(db),
+		Grade:         database.NewGradeStore(db),
+		Exam:          database.NewExamStore(db),
+		TestBatch:     database.NewTestBatchStore(db),
+		Worker:        database.NewWorkerStore(db),
+		Artifact:      database.NewGradeArtifactStore(db),
+		Token:         database.NewPersonalAccessTokenStore(db),
+		TwoFactor:     database.NewTwoFactorStore(db),
+		Session:       database.NewSessionStore(db),
+		AuthEvent:     database.NewAuthEventStore(db),
+		Lockout:       database.NewLockoutStore(db),
+		Impersonation: database.NewImpersonationStore(db),
+		Role:          database.NewRoleStore(db),
+		Audit:         database.NewAuditStore(db),
+		OutgoingEmail: database.NewOutgoingEmailStore(db),
+		EmailTemplate: database.NewEmailTemplateStore(db),
+		Reminder:      database.NewDeadlineReminderStore(db),
 	}
 }
 
+// Transaction runs fn with stores which share a single database transaction.
+// The transaction is committed if fn succeeds and rolled back otherwise.
+// Nested calls run within the outer transaction.
+func (s *Stores) Transaction(fn func(tx *Stores) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(newStores(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 // NewAPI configures and returns application API.
 func NewAPI(db *sqlx.DB, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager) (*API, error) {
 	stores := NewStores(db)
 
+	authenticator, err := authenticate.NewChain(&configuration.Configuration.Server.Authentication, stores.User)
+	if err != nil {
+		return nil, err
+	}
+
 	api := &API{
-		Account:    NewAccountResource(stores),
-		Auth:       NewAuthResource(stores, tokenAuth, sessionAuth),
-		User:       NewUserResource(stores),
-		Course:     NewCourseResource(stores),
-		Sheet:      NewSheetResource(stores),
-		Task:       NewTaskResource(stores),
-		Group:      NewGroupResource(stores),
-		TaskRating: NewTaskRatingResource(stores),
-		Submission: NewSubmissionResource(stores, tokenAuth),
-		Material:   NewMaterialResource(stores),
-		Grade:      NewGradeResource(stores),
-		Common:     NewCommonResource(stores),
-		Exam:       NewExamResource(stores),
+		Account:       NewAccountResource(stores),
+		Auth:          NewAuthResource(stores, tokenAuth, sessionAuth, authenticator),
+		User:          NewUserResource(stores),
+		Course:        NewCourseResource(stores),
+		Sheet:         NewSheetResource(stores),
+		Task:          NewTaskResource(stores, tokenAuth),
+		Group:         NewGroupResource(stores),
+		TaskRating:    NewTaskRatingResource(stores),
+		Submission:    NewSubmissionResource(stores, tokenAuth),
+		Material:      NewMaterialResource(stores),
+		Grade:         NewGradeResource(stores),
+		Common:        NewCommonResource(stores),
+		Exam:          NewExamResource(stores),
+		TestBatch:     NewTestBatchResource(stores, tokenAuth),
+		Worker:        NewWorkerResource(stores),
+		Artifact:      NewGradeArtifactResource(stores),
+		Token:         NewPersonalAccessTokenResource(stores),
+		TwoFactor:     NewTwoFactorResource(stores, sessionAuth),
+		Session:       NewSessionResource(stores),
+		AuthEvent:     NewAuthEventResource(stores),
+		Impersonation: NewImpersonationResource(stores, tokenAuth, sessionAuth),
+		Role:          NewRoleResource(stores),
+		Audit:         NewAuditResource(stores),
+		OutgoingEmail: NewOutgoingEmailResource(stores),
+		EmailTemplate: NewEmailTemplateResource(stores),
 	}
 	return api, nil
 }
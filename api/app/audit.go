@@ -0,0 +1,367 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// AuditResource specifies handler for the audit log.
+type AuditResource struct {
+	Stores *Stores
+}
+
+// NewAuditResource create and returns a AuditResource.
+func NewAuditResource(stores *Stores) *AuditResource {
+	return &AuditResource{
+		Stores: stores,
+	}
+}
+
+// auditEntriesFromURL returns the entries matching the filters of the query.
+func (rs *AuditResource) auditEntriesFromURL(r *http.Request, standardLimit int) ([]model.AuditEntry, error) {
+	var times [2]time.Time
+	for k, name := range []string{"from", "to"} {
+		if value := helper.StringFromURL(r, name, ""); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' must be a RFC 3339 timestamp", name)
+			}
+			times[k] = t
+		}
+	}
+
+	return rs.Stores.Audit.GetFiltered(
+		helper.Int64FromURL(r, "actor_id", 0),
+		helper.StringFromURL(r, "target_type", ""),
+		helper.Int64FromURL(r, "target_id", 0),
+		helper.StringFromURL(r, "action", ""),
+		helper.StringFromURL(r, "source", ""),
+		times[0],
+		times[1],
+		helper.IntFromURL(r, "limit", standardLimit),
+		helper.IntFromURL(r, "offset", 0),
+	)
+}
+
+// IndexHandler is public endpoint for
+// URL: /audit_log
+// QUERYPARAM: actor_id,integer
+// QUERYPARAM: target_type,string
+// QUERYPARAM: target_id,integer
+// QUERYPARAM: action,string
+// QUERYPARAM: source,string
+// QUERYPARAM: from,string
+// QUERYPARAM: to,string
+// QUERYPARAM: limit,integer
+// QUERYPARAM: offset,integer
+// METHOD: get
+// TAG: users
+// RESPONSE: 200,AuditEntryResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  administrative actions, the latest first (requires root)
+// DESCRIPTION:
+// 'target_type' is one of course, sheet, task, group, exam, material, grade,
+// user, enrollment or role. 'action' matches a part of the route like
+// "DELETE /api/v1/courses/{course_id}/sheets/{sheet_id}" or the console
+// command. 'source' is "api" or "console", 'from' and 'to' are RFC 3339
+// timestamps. At most 'limit' (default 100) entries are returned.
+func (rs *AuditResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	entries, err := rs.auditEntriesFromURL(r, 100)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newAuditEntryListResponse(entries)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// ExportHandler is public endpoint for
+// URL: /audit_log/export
+// QUERYPARAM: actor_id,integer
+// QUERYPARAM: target_type,string
+// QUERYPARAM: target_id,integer
+// QUERYPARAM: action,string
+// QUERYPARAM: source,string
+// QUERYPARAM: from,string
+// QUERYPARAM: to,string
+// QUERYPARAM: limit,integer
+// QUERYPARAM: offset,integer
+// METHOD: get
+// TAG: users
+// RESPONSE: 200,CSVFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  download the audit log as CSV (requires root)
+// DESCRIPTION:
+// Takes the same filters as the list of entries but returns up to 'limit'
+// (default 100000) entries.
+func (rs *AuditResource) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	entries, err := rs.auditEntriesFromURL(r, 100000)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"infomark-audit-log.csv\"")
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "created_at", "actor_id", "impersonation_id", "source", "action", "path", "status", "target_type", "target_id", "before", "after"})
+	for _, entry := range entries {
+		cw.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt.Format(time.RFC3339),
+			nullIntString(entry.ActorID),
+			nullIntString(entry.ImpersonationID),
+			entry.Source,
+			entry.Action,
+			entry.Path,
+			strconv.Itoa(entry.Status),
+			entry.TargetType,
+			nullIntString(entry.TargetID),
+			entry.Before.String,
+			entry.After.String,
+		})
+	}
+	cw.Flush()
+}
+
+// nullIntString formats an optional number for CSV.
+func nullIntString(v null.Int) string {
+	if !v.Valid {
+		return ""
+	}
+	return strconv.FormatInt(v.Int64, 10)
+}
+
+// .............................................................................
+
+// auditSecrets are columns which never go into the audit log.
+var auditSecrets = map[string]bool{
+	"encrypted_password":   true,
+	"reset_password_token": true,
+	"confirm_email_token":  true,
+}
+
+// auditSnapshot serializes a model into a JSON object keyed by its database
+// columns. Secrets are left out.
+func auditSnapshot(v interface{}) null.String {
+	if v == nil {
+		return null.String{}
+	}
+
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return null.String{}
+		}
+		value = value.Elem()
+	}
+
+	var snapshot interface{} = v
+	if value.Kind() == reflect.Struct {
+		columns := map[string]interface{}{}
+		for k := 0; k < value.NumField(); k++ {
+			name := strings.Split(value.Type().Field(k).Tag.Get("db"), ",")[0]
+			if name == "" || name == "-" || auditSecrets[name] {
+				continue
+			}
+			columns[name] = value.Field(k).Interface()
+		}
+		snapshot = columns
+	}
+
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return null.String{}
+	}
+	return null.StringFrom(string(raw))
+}
+
+// auditRecord collects what a mutating request acts on while it is served.
+type auditRecord struct {
+	targetType string
+	targetID   int64
+	before     null.String
+	reload     func() (interface{}, error)
+}
+
+// auditTarget remembers the entity a request acts on together with its state
+// before the request. The context middlewares call it for the entities they
+// load, so the innermost entity of a route wins. After the request, reload
+// gives the new state; it fails for deleted entities.
+func auditTarget(r *http.Request, targetType string, targetID int64, before interface{}, reload func() (interface{}, error)) {
+	record, ok := r.Context().Value(symbol.CtxKeyAudit).(*auditRecord)
+	if !ok {
+		return
+	}
+
+	record.targetType = targetType
+	record.targetID = targetID
+	record.before = auditSnapshot(before)
+	record.reload = reload
+}
+
+// auditEnrollment is the state of an enrollment in the audit log.
+type auditEnrollment struct {
+	CourseID   int64  `db:"course_id"`
+	UserID     int64  `db:"user_id"`
+	Role       int    `db:"role"`
+	CourseRole string `db:"course_role"`
+}
+
+// loadAuditEnrollment returns the enrollment of a user in a course. It fails
+// for users not enrolled.
+func loadAuditEnrollment(stores *Stores, courseID int64, userID int64) (interface{}, error) {
+	givenRole, err := stores.Course.RoleInCourse(userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+	if givenRole == authorize.NOCOURSEROLE {
+		return nil, sql.ErrNoRows
+	}
+
+	enrollment := &auditEnrollment{
+		CourseID: courseID,
+		UserID:   userID,
+		Role:     int(givenRole),
+	}
+	if role, err := stores.Role.RoleOfUserInCourse(userID, courseID); err == nil {
+		enrollment.CourseRole = role.Name
+	}
+	return enrollment, nil
+}
+
+// auditEnrollmentTarget makes the enrollment of a user the target of a
+// request instead of the user itself.
+func auditEnrollmentTarget(stores *Stores, r *http.Request, courseID int64, userID int64) {
+	// users not enrolled yet have no state before
+	before, _ := loadAuditEnrollment(stores, courseID, userID)
+	auditTarget(r, "enrollment", userID, before, func() (interface{}, error) {
+		return loadAuditEnrollment(stores, courseID, userID)
+	})
+}
+
+// RecordAudit middleware appends every successful mutating request of an
+// identity to the audit log.
+func RecordAudit(stores *Stores) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			record := &auditRecord{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ctx := context.WithValue(r.Context(), symbol.CtxKeyAudit, record)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusBadRequest {
+				return
+			}
+
+			entry := &model.AuditEntry{
+				Source: model.AuditSourceAPI,
+				Action: r.Method + " " + chi.RouteContext(r.Context()).RoutePattern(),
+				Path:   r.URL.Path,
+				Status: status,
+			}
+
+			if accessClaims, ok := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims); ok {
+				entry.ActorID = null.IntFrom(accessClaims.LoginID)
+				if accessClaims.ImpersonationID != 0 {
+					entry.ImpersonationID = null.IntFrom(accessClaims.ImpersonationID)
+				}
+			}
+
+			if record.targetType != "" {
+				entry.TargetType = record.targetType
+				entry.TargetID = null.IntFrom(record.targetID)
+				entry.Before = record.before
+				if after, err := record.reload(); err == nil {
+					entry.After = auditSnapshot(after)
+				}
+			}
+
+			// the entry is written after the response, a failure cannot be
+			// reported to the client anymore
+			stores.Audit.Create(entry)
+		})
+	}
+}
+
+// RecordConsoleAction appends a console command to the audit log.
+func RecordConsoleAction(stores *Stores, action string, targetType string, targetID int64, before interface{}, after interface{}) error {
+	_, err := stores.Audit.Create(&model.AuditEntry{
+		Source:     model.AuditSourceConsole,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   null.IntFrom(targetID),
+		Before:     auditSnapshot(before),
+		After:      auditSnapshot(after),
+	})
+	return err
+}
@@ -0,0 +1,117 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// AuditEntryResponse is the response payload for an administrative action.
+type AuditEntryResponse struct {
+	ID int64 `json:"id" example:"81"`
+	// null for console commands
+	ActorID         null.Int `json:"actor_id" example:"1"`
+	ImpersonationID null.Int `json:"impersonation_id" example:"null"`
+	Source          string   `json:"source" example:"api"`
+	Action          string   `json:"action" example:"PUT /api/v1/courses/{course_id}/enrollments/{user_id}"`
+	Path            string   `json:"path" example:"/api/v1/courses/1/enrollments/112"`
+	Status          int      `json:"status" example:"200"`
+	TargetType      string   `json:"target_type" example:"enrollment"`
+	TargetID        null.Int `json:"target_id" example:"112"`
+	// the state of the target before and after, null if it did not exist
+	Before json.RawMessage `json:"before" example:"{\"role\": 0}"`
+	After  json.RawMessage `json:"after" example:"{\"role\": 1}"`
+	// the columns which differ between before and after
+	Changes   []string  `json:"changes" example:"role"`
+	CreatedAt time.Time `json:"created_at" example:"auto"`
+}
+
+// Render post-processes a AuditEntryResponse.
+func (body *AuditEntryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// auditJSON returns a stored snapshot as raw JSON.
+func auditJSON(snapshot null.String) json.RawMessage {
+	if !snapshot.Valid {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(snapshot.String)
+}
+
+// auditChanges lists the columns which differ between two snapshots.
+func auditChanges(before null.String, after null.String) []string {
+	var old, updated map[string]json.RawMessage
+	json.Unmarshal([]byte(before.String), &old)
+	json.Unmarshal([]byte(after.String), &updated)
+
+	changes := []string{}
+	for name, value := range updated {
+		if name == "updated_at" {
+			continue
+		}
+		if string(old[name]) != string(value) {
+			changes = append(changes, name)
+		}
+	}
+	for name := range old {
+		if _, ok := updated[name]; !ok {
+			changes = append(changes, name)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// newAuditEntryResponse creates a response from a AuditEntry model.
+func newAuditEntryResponse(p *model.AuditEntry) *AuditEntryResponse {
+	return &AuditEntryResponse{
+		ID:              p.ID,
+		ActorID:         p.ActorID,
+		ImpersonationID: p.ImpersonationID,
+		Source:          p.Source,
+		Action:          p.Action,
+		Path:            p.Path,
+		Status:          p.Status,
+		TargetType:      p.TargetType,
+		TargetID:        p.TargetID,
+		Before:          auditJSON(p.Before),
+		After:           auditJSON(p.After),
+		Changes:         auditChanges(p.Before, p.After),
+		CreatedAt:       p.CreatedAt,
+	}
+}
+
+// newAuditEntryListResponse creates a response from a list of AuditEntry
+// models.
+func newAuditEntryListResponse(entries []model.AuditEntry) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range entries {
+		list = append(list, newAuditEntryResponse(&entries[k]))
+	}
+	return list
+}
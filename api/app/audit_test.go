@@ -0,0 +1,166 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+func TestAudit(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	adminJWT := tape.NewJWTRequest(1, true)
+
+	auditLog := func(query string) []AuditEntryResponse {
+		w := tape.Get("/api/v1/audit_log"+query, adminJWT)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		entries := []AuditEntryResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(&entries)).Equal(nil)
+		return entries
+	}
+
+	g.Describe("Audit", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Should record changes of a course", func() {
+			w := tape.Put("/api/v1/courses/1", tape.ToH(CourseRequest{
+				Name:               "Info2_update",
+				Description:        "Lorem Ipsum_update",
+				BeginsAt:           helper.Time(time.Now()),
+				EndsAt:             helper.Time(time.Now()),
+				RequiredPercentage: 99,
+			}), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// neither reading nor refused requests are recorded
+			w = tape.Get("/api/v1/courses/1", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			w = tape.Delete("/api/v1/courses/1", tape.NewJWTRequest(112, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			entries := auditLog("?target_type=course&target_id=1")
+			g.Assert(len(entries)).Equal(1)
+			g.Assert(entries[0].ActorID.Int64).Equal(int64(1))
+			g.Assert(entries[0].Source).Equal(model.AuditSourceAPI)
+			g.Assert(entries[0].Action).Equal("PUT /api/v1/courses/{course_id}")
+			g.Assert(entries[0].Path).Equal("/api/v1/courses/1")
+
+			after := map[string]interface{}{}
+			g.Assert(json.Unmarshal(entries[0].After, &after)).Equal(nil)
+			g.Assert(after["name"]).Equal("Info2_update")
+			g.Assert(after["required_percentage"]).Equal(float64(99))
+		})
+
+		g.It("Should record changes of enrollment roles", func() {
+			w := tape.Put("/api/v1/courses/1/enrollments/112", H{"role": 1}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entries := auditLog("?target_type=enrollment&actor_id=1")
+			g.Assert(len(entries)).Equal(1)
+			g.Assert(entries[0].TargetID.Int64).Equal(int64(112))
+			g.Assert(entries[0].Changes).Equal([]string{"role"})
+
+			before := map[string]interface{}{}
+			g.Assert(json.Unmarshal(entries[0].Before, &before)).Equal(nil)
+			g.Assert(before["role"]).Equal(float64(0))
+		})
+
+		g.It("Should record deletions without a state after", func() {
+			w := tape.Delete("/api/v1/courses/1/sheets/1", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entries := auditLog("?action=DELETE")
+			g.Assert(len(entries)).Equal(1)
+			g.Assert(entries[0].TargetType).Equal("sheet")
+			g.Assert(string(entries[0].Before) != "null").Equal(true)
+			g.Assert(string(entries[0].After)).Equal("null")
+		})
+
+		g.It("Should record console commands", func() {
+			user, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			before := *user
+			user.Root = true
+
+			err = RecordConsoleAction(stores, "console admin add", "user", user.ID, &before, user)
+			g.Assert(err).Equal(nil)
+
+			entries := auditLog("?source=console")
+			g.Assert(len(entries)).Equal(1)
+			g.Assert(entries[0].ActorID.Valid).Equal(false)
+			g.Assert(entries[0].Changes).Equal([]string{"root"})
+
+			// secrets never go into the log
+			after := map[string]interface{}{}
+			g.Assert(json.Unmarshal(entries[0].After, &after)).Equal(nil)
+			_, ok := after["encrypted_password"]
+			g.Assert(ok).Equal(false)
+		})
+
+		g.It("Should be exported by root only", func() {
+			w := tape.Put("/api/v1/courses/1/enrollments/112", H{"role": 1}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/audit_log", tape.NewJWTRequest(1, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/audit_log/export", tape.NewJWTRequest(1, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/audit_log/export", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Header().Get("Content-Type")).Equal("text/csv")
+
+			records, err := csv.NewReader(w.Body).ReadAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(records)).Equal(2)
+			g.Assert(records[0][0]).Equal("id")
+			g.Assert(records[1][8]).Equal("enrollment")
+		})
+
+		g.It("Should not change recorded entries", func() {
+			err := RecordConsoleAction(stores, "console user unlock", "user", 112, nil, nil)
+			g.Assert(err).Equal(nil)
+
+			_, err = tape.DB.Exec("UPDATE audit_log SET action = 'nothing happened'")
+			g.Assert(err != nil).Equal(true)
+		})
+
+		g.AfterEach(tape.AfterEach)
+	})
+}
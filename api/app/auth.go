@@ -29,8 +29,10 @@ import (
 	"github.com/go-chi/render"
 	"github.com/infomark-org/infomark/auth"
 	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/oidc"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
 	null "gopkg.in/guregu/null.v3"
 )
@@ -40,14 +42,20 @@ type AuthResource struct {
 	Stores      *Stores
 	TokenAuth   *authenticate.TokenAuth
 	SessionAuth *scs.Manager
+	// Authenticator checks email and password of a login.
+	Authenticator authenticate.Authenticator
+	// OIDC is the single sign-on provider, nil if disabled.
+	OIDC *oidc.Provider
 }
 
 // NewAuthResource create and returns a AuthResource.
-func NewAuthResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager) *AuthResource {
+func NewAuthResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager, authenticator authenticate.Authenticator) *AuthResource {
 	return &AuthResource{
-		Stores:      stores,
-		TokenAuth:   tokenAuth,
-		SessionAuth: sessionAuth,
+		Stores:        stores,
+		TokenAuth:     tokenAuth,
+		SessionAuth:   sessionAuth,
+		Authenticator: authenticator,
+		OIDC:          newOIDCProvider(&configuration.Configuration.Server.Authentication.OIDC),
 	}
 }
 
@@ -63,7 +71,8 @@ func NewAuthResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionA
 // SUMMARY:  Refresh or Generate Access token
 // DESCRIPTION:
 // This endpoint will generate the access token without login credentials
-// if the refresh token is given.
+// if the refresh token is given. Credentials of accounts with a second factor
+// need a "two_factor_code".
 func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
 	// Login with your username and password to get the generated JWT refresh and
 	// access tokens. Alternatively, if the refresh token is already present in
@@ -96,6 +105,12 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 		fmt.Println("refreshClaims.LoginID", refreshClaims.LoginID)
 		fmt.Println("refreshClaims.AccessNotRefresh", refreshClaims.AccessNotRefresh)
 
+		// the refresh token might have been revoked
+		if err := authenticate.ValidateSession(rs.Stores.Session, refreshClaims.SessionID, refreshClaims.LoginID, r); err != nil {
+			render.Render(w, r, ErrUnauthorizedWithDetails(err))
+			return
+		}
+
 		// everything ok
 		targetUser, err := rs.Stores.User.Get(refreshClaims.LoginID)
 		if err != nil {
@@ -104,7 +119,10 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 		}
 
 		// we just need to return an access-token
-		accessToken, err := tokenManager.CreateAccessJWT(authenticate.NewAccessClaims(targetUser.ID, targetUser.Root))
+		accessClaims := authenticate.NewAccessClaims(targetUser.ID, targetUser.Root)
+		accessClaims.SetupTwoFactor = refreshClaims.SetupTwoFactor
+		accessClaims.SessionID = refreshClaims.SessionID
+		accessToken, err := tokenManager.CreateAccessJWT(accessClaims)
 		if err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
@@ -130,20 +148,67 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 			return
 		}
 
-		// does such a user exists with request email address?
-		potentialUser, err := rs.Stores.User.FindByEmail(data.Email)
+		// locked accounts are rejected before the password is checked
+		locked, err := accountLocked(rs.Stores, data.Email)
 		if err != nil {
-			render.Render(w, r, ErrNotFound)
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if locked {
+			render.Render(w, r, ErrUnauthorizedWithDetails(errAccountLocked))
 			return
 		}
 
-		// does the password match?
-		if !auth.CheckPasswordHash(data.PlainPassword, potentialUser.EncryptedPassword) {
-			render.Render(w, r, ErrNotFound)
+		// do the credentials belong to a user (local password or directory)?
+		potentialUser, err := rs.Authenticator.Authenticate(data.Email, data.PlainPassword)
+		if err != nil {
+			if err == authenticate.ErrInvalidCredentials {
+				if err := recordFailedLogin(rs.Stores, r, data.Email); err != nil {
+					render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+					return
+				}
+			}
+			if err == authenticate.ErrInvalidCredentials || err == authenticate.ErrNoAccount {
+				render.Render(w, r, ErrNotFound)
+			} else {
+				render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			}
+			return
+		}
+
+		// accounts with a second factor need to send a code as well
+		setupTwoFactor, err := checkSecondFactor(rs.Stores, potentialUser, data.TwoFactorCode)
+		switch err {
+		case nil:
+		case errTwoFactorCodeRequired:
+			render.Render(w, r, ErrUnauthenticatedWithDetails(err))
+			return
+		case errInvalidTwoFactorCode:
+			if err := recordFailedLogin(rs.Stores, r, potentialUser.Email); err != nil {
+				render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+				return
+			}
+			render.Render(w, r, ErrBadRequestWithDetails(err))
+			return
+		default:
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		if err := recordLogin(rs.Stores, r, potentialUser); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		session, err := startSession(rs.Stores, r, potentialUser.ID, model.SessionKindToken)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
 		}
 
 		refreshClaims := authenticate.NewRefreshClaims(potentialUser.ID)
+		refreshClaims.SetupTwoFactor = setupTwoFactor
+		refreshClaims.SessionID = session.ID
 		refreshToken, err := tokenManager.CreateRefreshJWT(refreshClaims)
 
 		if err != nil {
@@ -152,6 +217,8 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 		}
 
 		accessClaims := authenticate.NewAccessClaims(potentialUser.ID, potentialUser.Root)
+		accessClaims.SetupTwoFactor = setupTwoFactor
+		accessClaims.SessionID = session.ID
 		accessToken, err := tokenManager.CreateAccessJWT(accessClaims)
 
 		if err != nil {
@@ -180,10 +247,16 @@ func (rs *AuthResource) RefreshAccessTokenHandler(w http.ResponseWriter, r *http
 // REQUEST: LoginRequest
 // RESPONSE: 200,LoginResponse
 // RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
 // SUMMARY:  Start a session
 // DESCRIPTION:
 // This endpoint will generate the access token without login credentials
 // if the refresh token is given.
+// Accounts with a second factor get a 401 until the request contains a
+// "two_factor_code". If the configuration requires a second factor which
+// has not been set up yet, the session can only be used to set it up.
+// Too many failed logins in a row lock the account for a while (403).
 func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// we are given email-password credentials
 
@@ -195,17 +268,34 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// does such a user exists with request email address?
-	potentialUser, err := rs.Stores.User.FindByEmail(data.Email)
+	// locked accounts are rejected before the password is checked
+	locked, err := accountLocked(rs.Stores, data.Email)
 	if err != nil {
-		render.Render(w, r, ErrBadRequest)
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if locked {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errAccountLocked))
 		return
 	}
 
-	// does the password match?
-	if !auth.CheckPasswordHash(data.PlainPassword, potentialUser.EncryptedPassword) {
+	// do the credentials belong to a user (local password or directory)?
+	potentialUser, err := rs.Authenticator.Authenticate(data.Email, data.PlainPassword)
+	switch err {
+	case nil:
+	case authenticate.ErrInvalidCredentials:
 		totalFailedLoginsVec.WithLabelValues().Inc()
-		render.Render(w, r, ErrBadRequestWithDetails(errors.New("credentials are wrong")))
+		if err := recordFailedLogin(rs.Stores, r, data.Email); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	case authenticate.ErrNoAccount:
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	default:
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
@@ -223,10 +313,43 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// accounts with a second factor need to send a code as well
+	setupTwoFactor, err := checkSecondFactor(rs.Stores, potentialUser, data.TwoFactorCode)
+	switch err {
+	case nil:
+	case errTwoFactorCodeRequired:
+		render.Render(w, r, ErrUnauthenticatedWithDetails(err))
+		return
+	case errInvalidTwoFactorCode:
+		totalFailedLoginsVec.WithLabelValues().Inc()
+		if err := recordFailedLogin(rs.Stores, r, potentialUser.Email); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	default:
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := recordLogin(rs.Stores, r, potentialUser); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	session, err := startSession(rs.Stores, r, potentialUser.ID, model.SessionKindCookie)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
 	// user passed all tests
 	accessClaims := &authenticate.AccessClaims{
-		LoginID: potentialUser.ID,
-		Root:    potentialUser.Root,
+		LoginID:        potentialUser.ID,
+		Root:           potentialUser.Root,
+		SetupTwoFactor: setupTwoFactor,
+		SessionID:      session.ID,
 	}
 
 	// fmt.Println("WRITE accessClaims.LoginID", accessClaims.LoginID)
@@ -234,7 +357,7 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	w = accessClaims.WriteToSession(rs.SessionAuth, w, r)
 
-	resp := &loginResponse{Root: potentialUser.Root}
+	resp := &loginResponse{Root: potentialUser.Root, SetupTwoFactor: setupTwoFactor}
 	// return access token only
 	if err := render.Render(w, r, resp); err != nil {
 		render.Render(w, r, ErrRender(err))
@@ -253,6 +376,15 @@ func (rs *AuthResource) LoginHandler(w http.ResponseWriter, r *http.Request) {
 // SUMMARY:  Destroy a session
 func (rs *AuthResource) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	// the registered session is gone as well, so a copy of the cookie is useless
+	if accessClaims.SessionID != 0 {
+		if err := rs.Stores.Session.Delete(accessClaims.SessionID); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
 	accessClaims.DestroyInSession(rs.SessionAuth, w, r)
 }
 
@@ -283,11 +415,9 @@ func (rs *AuthResource) RequestPasswordResetHandler(w http.ResponseWriter, r *ht
 
 	// Send Email to User
 	// https://infomark-staging.informatik.uni-tuebingen.de/#/password_reset/example@uni-tuebingen.de/af1ecf6f
-	msg, err := email.NewEmailFromTemplate(
-		configuration.Configuration.Server.Email.From,
-		user.Email,
-		"Password Reset Instructions",
-		email.RequestPasswordTokenTemailTemplateEN,
+	msg, err := NewTemplatedEmail(rs.Stores, 0,
+		email.RequestPasswordTokenTemplate,
+		user,
 		map[string]string{
 			"first_name":           user.FirstName,
 			"last_name":            user.LastName,
@@ -317,6 +447,9 @@ func (rs *AuthResource) RequestPasswordResetHandler(w http.ResponseWriter, r *ht
 // RESPONSE: 200,OK
 // RESPONSE: 400,BadRequest
 // SUMMARY:  sets a new password
+// DESCRIPTION:
+// All sessions, refresh tokens and personal access tokens of the account are
+// revoked.
 func (rs *AuthResource) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request) {
 	data := &UpdatePasswordRequest{}
 	if err := render.Bind(r, data); err != nil {
@@ -352,6 +485,12 @@ func (rs *AuthResource) UpdatePasswordHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// whoever knew the old password should not stay logged in
+	if err := revokeLogins(rs.Stores, user.ID, 0); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
 	render.Status(r, http.StatusOK)
 }
 
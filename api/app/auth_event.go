@@ -0,0 +1,89 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// AuthEventResource specifies handler for the log of logins and lockouts.
+type AuthEventResource struct {
+	Stores *Stores
+}
+
+// NewAuthEventResource create and returns a AuthEventResource.
+func NewAuthEventResource(stores *Stores) *AuthEventResource {
+	return &AuthEventResource{
+		Stores: stores,
+	}
+}
+
+// IndexHandler is public endpoint for
+// URL: /auth_events
+// QUERYPARAM: user_id,integer
+// QUERYPARAM: limit,integer
+// METHOD: get
+// TAG: users
+// RESPONSE: 200,AuthEventResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  recent logins, failed logins and lockouts (requires root)
+// DESCRIPTION:
+// Without 'user_id' the events of all accounts are listed. At most 'limit'
+// (default 100) events are returned, the latest first.
+func (rs *AuthEventResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	userID := helper.Int64FromURL(r, "user_id", 0)
+	limit := helper.IntFromURL(r, "limit", 100)
+
+	var (
+		events []model.AuthEvent
+		err    error
+	)
+
+	if userID != 0 {
+		events, err = rs.Stores.AuthEvent.RecentOfUser(userID, limit)
+	} else {
+		events, err = rs.Stores.AuthEvent.Recent(limit)
+	}
+
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newAuthEventListResponse(events)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
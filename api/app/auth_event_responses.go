@@ -0,0 +1,69 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// AuthEventResponse is the response payload for a login attempt or a change
+// of a lockout.
+type AuthEventResponse struct {
+	ID        int64     `json:"id" example:"81"`
+	CreatedAt time.Time `json:"created_at" example:"auto"`
+	UserID    null.Int  `json:"user_id" example:"1"`
+	Email     string    `json:"email" example:"test@uni-tuebingen.de"`
+	// "login", "login_failed", "locked" or "unlocked"
+	Kind      string `json:"kind" example:"login_failed"`
+	IP        string `json:"ip" example:"192.168.0.1"`
+	UserAgent string `json:"user_agent" example:"Mozilla/5.0 (X11; Linux x86_64)"`
+}
+
+// Render post-processes a AuthEventResponse.
+func (body *AuthEventResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newAuthEventResponse creates a response from a AuthEvent model.
+func newAuthEventResponse(p *model.AuthEvent) *AuthEventResponse {
+	return &AuthEventResponse{
+		ID:        p.ID,
+		CreatedAt: p.CreatedAt,
+		UserID:    p.UserID,
+		Email:     p.Email,
+		Kind:      p.Kind,
+		IP:        p.IP,
+		UserAgent: p.UserAgent,
+	}
+}
+
+// newAuthEventListResponse creates a response from a list of AuthEvent models.
+func newAuthEventListResponse(events []model.AuthEvent) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range events {
+		list = append(list, newAuthEventResponse(&events[k]))
+	}
+	return list
+}
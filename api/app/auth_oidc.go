@@ -0,0 +1,581 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/oidc"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// oidcCallbackPath is where the provider sends the browser back to.
+const oidcCallbackPath = "/api/v1/auth/oidc/callback"
+
+// oidcLogin is kept in the session between the redirect to the provider and
+// the callback.
+type oidcLogin struct {
+	State string
+	Nonce string
+}
+
+// oidcTwoFactorTimeout limits how long a single sign-on waits for the code of
+// the second factor.
+const oidcTwoFactorTimeout = 5 * time.Minute
+
+// oidcTwoFactor is kept in the session while the single sign-on of an account
+// with a second factor waits for the code.
+type oidcTwoFactor struct {
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+// newOIDCProvider returns the configured single sign-on provider or nil if
+// it is disabled.
+func newOIDCProvider(config *configuration.OIDCConfiguration) *oidc.Provider {
+	if !config.Enabled {
+		return nil
+	}
+	return oidc.NewProvider(
+		config.Issuer,
+		config.ClientID,
+		config.ClientSecret,
+		configuration.Configuration.Server.ExternalURL()+oidcCallbackPath,
+		config.Scopes,
+	)
+}
+
+// OIDCLoginHandler is public endpoint for
+// URL: /auth/oidc/login
+// METHOD: get
+// TAG: auth
+// RESPONSE: 302,Redirect
+// RESPONSE: 404,NotFound
+// SUMMARY:  Start a single sign-on
+// DESCRIPTION:
+// The browser is redirected to the login page of the identity provider, which
+// sends it back to /auth/oidc/callback.
+func (rs *AuthResource) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if rs.OIDC == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	login := &oidcLogin{
+		State: auth.GenerateToken(32),
+		Nonce: auth.GenerateToken(32),
+	}
+
+	authURL, err := rs.OIDC.AuthCodeURL(login.State, login.Nonce)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := rs.SessionAuth.Load(r).PutObject(w, "oidc_login", login); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler is public endpoint for
+// URL: /auth/oidc/callback
+// METHOD: get
+// TAG: auth
+// QUERYPARAM: code,string
+// QUERYPARAM: state,string
+// RESPONSE: 302,Redirect
+// RESPONSE: 400,BadRequest
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  Finish a single sign-on
+// DESCRIPTION:
+// The identity provider sends the browser to this endpoint after the login.
+// On success a session is started exactly as in POST /auth/sessions.
+// Accounts with a second factor are redirected with "two_factor=required"
+// and finish the login with POST /auth/oidc/two_factor.
+func (rs *AuthResource) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if rs.OIDC == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	// a state can only be used once
+	login := &oidcLogin{}
+	if err := rs.SessionAuth.Load(r).PopObject(w, "oidc_login", login); err != nil || login.State == "" {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("no single sign-on was started")))
+		return
+	}
+
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("identity provider rejected the login: "+reason)))
+		return
+	}
+	if query.Get("state") != login.State {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("state does not match")))
+		return
+	}
+
+	rawIDToken, err := rs.OIDC.Exchange(query.Get("code"))
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	claims, err := rs.OIDC.Verify(rawIDToken, login.Nonce)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user, err := rs.oidcUser(claims)
+	if err != nil {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
+
+	locked, err := accountLocked(rs.Stores, user.Email)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if locked {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errAccountLocked))
+		return
+	}
+
+	target := configuration.Configuration.Server.Authentication.OIDC.RedirectAfterLogin
+	if target == "" {
+		target = configuration.Configuration.Server.ExternalURL()
+	}
+
+	// the provider does not replace our second factor, the code is sent to
+	// POST /auth/oidc/two_factor
+	setupTwoFactor, err := checkSecondFactor(rs.Stores, user, "")
+	switch err {
+	case nil:
+	case errTwoFactorCodeRequired:
+		pending := &oidcTwoFactor{
+			UserID:    user.ID,
+			ExpiresAt: NowUTC().Add(oidcTwoFactorTimeout),
+		}
+		if err := rs.SessionAuth.Load(r).PutObject(w, "oidc_two_factor", pending); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		redirect, err := url.Parse(target)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		query := redirect.Query()
+		query.Set("two_factor", "required")
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+		return
+	default:
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := recordLogin(rs.Stores, r, user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	w, err = rs.startOIDCSession(w, r, user, setupTwoFactor)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCTwoFactorHandler is public endpoint for
+// URL: /auth/oidc/two_factor
+// METHOD: post
+// TAG: auth
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 200,LoginResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  Finish a single sign-on with a second factor
+// DESCRIPTION:
+// Accounts with a second factor are sent back from /auth/oidc/callback with
+// "two_factor=required" instead of being logged in. The session starts once
+// the code of the second factor is posted here within five minutes.
+func (rs *AuthResource) OIDCTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if rs.OIDC == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	session := rs.SessionAuth.Load(r)
+	pending := &oidcTwoFactor{}
+	if err := session.GetObject("oidc_two_factor", pending); err != nil || pending.UserID == 0 {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("no single sign-on waits for a second factor")))
+		return
+	}
+	if NowUTC().After(pending.ExpiresAt) {
+		session.Remove(w, "oidc_two_factor")
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("single sign-on has expired")))
+		return
+	}
+
+	user, err := rs.Stores.User.Get(pending.UserID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	setupTwoFactor, ok := rs.passSecondFactor(w, r, user, data.Code)
+	if !ok {
+		return
+	}
+
+	if err := session.Remove(w, "oidc_two_factor"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	w, err = rs.startOIDCSession(w, r, user, setupTwoFactor)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := &loginResponse{Root: user.Root, SetupTwoFactor: setupTwoFactor}
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// OIDCNonceHandler is public endpoint for
+// URL: /auth/oidc/nonce
+// METHOD: post
+// TAG: auth
+// RESPONSE: 200,OIDCNonceResponse
+// RESPONSE: 404,NotFound
+// SUMMARY:  Start a single sign-on of a client
+// DESCRIPTION:
+// Clients which run the login with the identity provider themselves pass
+// this nonce to the provider. The session cookie of the response has to be
+// sent along with the ID token to POST /auth/oidc/token.
+func (rs *AuthResource) OIDCNonceHandler(w http.ResponseWriter, r *http.Request) {
+	if rs.OIDC == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	resp := &OIDCNonceResponse{Nonce: auth.GenerateToken(32)}
+	if err := rs.SessionAuth.Load(r).PutString(w, "oidc_token_nonce", resp.Nonce); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// OIDCTokenHandler is public endpoint for
+// URL: /auth/oidc/token
+// METHOD: post
+// TAG: auth
+// REQUEST: OIDCTokenRequest
+// RESPONSE: 200,AuthResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// RESPONSE: 404,NotFound
+// SUMMARY:  Exchange an ID token for access and refresh tokens
+// DESCRIPTION:
+// Clients which run the login with the identity provider themselves
+// (e.g. a command line tool) trade the ID token for our JWTs here. The ID
+// token has to contain the nonce of POST /auth/oidc/nonce, whose session
+// cookie is sent along, and must have been issued within the last minutes.
+// Accounts with a second factor get a 401 until the request contains a
+// "two_factor_code".
+func (rs *AuthResource) OIDCTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if rs.OIDC == nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	data := &OIDCTokenRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	// the nonce binds the ID token to the client which requested it
+	session := rs.SessionAuth.Load(r)
+	nonce, err := session.GetString("oidc_token_nonce")
+	if err != nil || nonce == "" {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("no nonce has been requested")))
+		return
+	}
+
+	claims, err := rs.OIDC.Verify(data.IDToken, nonce)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user, err := rs.oidcUser(claims)
+	if err != nil {
+		render.Render(w, r, ErrUnauthorizedWithDetails(err))
+		return
+	}
+
+	setupTwoFactor, ok := rs.passSecondFactor(w, r, user, data.TwoFactorCode)
+	if !ok {
+		return
+	}
+
+	// the nonce is kept until the second factor has been passed
+	if err := session.Remove(w, "oidc_token_nonce"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	login, err := startSession(rs.Stores, r, user.ID, model.SessionKindToken)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	refreshClaims := authenticate.NewRefreshClaims(user.ID)
+	refreshClaims.SetupTwoFactor = setupTwoFactor
+	refreshClaims.SessionID = login.ID
+	refreshToken, err := rs.TokenAuth.CreateRefreshJWT(refreshClaims)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	accessClaims := authenticate.NewAccessClaims(user.ID, user.Root)
+	accessClaims.SetupTwoFactor = setupTwoFactor
+	accessClaims.SessionID = login.ID
+	accessToken, err := rs.TokenAuth.CreateAccessJWT(accessClaims)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := &AuthResponse{}
+	resp.Access.Token = accessToken
+	resp.Refresh.Token = refreshToken
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// passSecondFactor is the second step of a single sign-on. Like a password
+// login it requires the code of an enabled second factor and counts wrong
+// codes towards the lockout. It renders the error and returns false if the
+// login is refused.
+func (rs *AuthResource) passSecondFactor(w http.ResponseWriter, r *http.Request, user *model.User, code string) (bool, bool) {
+	locked, err := accountLocked(rs.Stores, user.Email)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return false, false
+	}
+	if locked {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errAccountLocked))
+		return false, false
+	}
+
+	setupTwoFactor, err := checkSecondFactor(rs.Stores, user, code)
+	switch err {
+	case nil:
+	case errTwoFactorCodeRequired:
+		render.Render(w, r, ErrUnauthenticatedWithDetails(err))
+		return false, false
+	case errInvalidTwoFactorCode:
+		totalFailedLoginsVec.WithLabelValues().Inc()
+		if err := recordFailedLogin(rs.Stores, r, user.Email); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return false, false
+		}
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return false, false
+	default:
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return false, false
+	}
+
+	if err := recordLogin(rs.Stores, r, user); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return false, false
+	}
+	return setupTwoFactor, true
+}
+
+// startOIDCSession starts a cookie session after a single sign-on.
+func (rs *AuthResource) startOIDCSession(w http.ResponseWriter, r *http.Request, user *model.User, setupTwoFactor bool) (http.ResponseWriter, error) {
+	session, err := startSession(rs.Stores, r, user.ID, model.SessionKindCookie)
+	if err != nil {
+		return w, err
+	}
+
+	accessClaims := &authenticate.AccessClaims{
+		LoginID:        user.ID,
+		Root:           user.Root,
+		SetupTwoFactor: setupTwoFactor,
+		SessionID:      session.ID,
+	}
+	return accessClaims.WriteToSession(rs.SessionAuth, w, r), nil
+}
+
+// oidcUser finds the account belonging to verified claims. Unknown identities
+// are linked to the account with the same verified email address or get a new
+// account if this is allowed.
+func (rs *AuthResource) oidcUser(claims oidc.Claims) (*model.User, error) {
+	config := &configuration.Configuration.Server.Authentication.OIDC
+	provider := "oidc:" + rs.OIDC.Issuer
+
+	user, err := rs.Stores.User.FindByIdentity(provider, claims.Subject())
+	switch {
+	case err == nil:
+		if applyOIDCClaims(user, claims, config) {
+			if err := rs.Stores.User.Update(user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	emailClaim := config.Claims.Email
+	if emailClaim == "" {
+		emailClaim = "email"
+	}
+	email := strings.ToLower(strings.TrimSpace(claims.String(emailClaim)))
+	if email == "" {
+		return nil, errors.New("identity provider did not send an email address")
+	}
+
+	user, err = rs.Stores.User.FindByEmail(email)
+	switch {
+	case err == nil:
+		// only an address verified by the provider proves that the account
+		// belongs to this identity
+		if !claims.Bool("email_verified") {
+			return nil, errors.New("email address is not verified by the identity provider")
+		}
+		applyOIDCClaims(user, claims, config)
+		user.ConfirmEmailToken = null.String{}
+		if err := rs.Stores.User.Update(user); err != nil {
+			return nil, err
+		}
+
+	case err == sql.ErrNoRows:
+		if !config.CreateAccounts {
+			return nil, errors.New("there is no account for this email address")
+		}
+
+		// the password is never used, the user logs in through the provider
+		// or resets it
+		encryptedPassword, err := auth.HashPassword(auth.GenerateToken(32))
+		if err != nil {
+			return nil, err
+		}
+
+		user = &model.User{
+			Email:             email,
+			Language:          "en",
+			EncryptedPassword: encryptedPassword,
+			ConfirmEmailToken: null.String{},
+			Root:              false,
+		}
+		applyOIDCClaims(user, claims, config)
+
+		user, err = rs.Stores.User.Create(user)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, err
+	}
+
+	if err := rs.Stores.User.LinkIdentity(user.ID, provider, claims.Subject()); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// applyOIDCClaims copies the mapped claims into the profile of a user and
+// reports whether anything changed. The email address is not synchronized.
+func applyOIDCClaims(user *model.User, claims oidc.Claims, config *configuration.OIDCConfiguration) bool {
+	changed := false
+
+	setString := func(field *string, name string) {
+		if name == "" {
+			return
+		}
+		if value := strings.TrimSpace(claims.String(name)); value != "" && value != *field {
+			*field = value
+			changed = true
+		}
+	}
+
+	setString(&user.FirstName, config.Claims.FirstName)
+	setString(&user.LastName, config.Claims.LastName)
+	setString(&user.StudentNumber, config.Claims.StudentNumber)
+	setString(&user.Subject, config.Claims.Subject)
+
+	if config.Claims.Semester != "" {
+		if value := claims.Int(config.Claims.Semester); value > 0 && value != user.Semester {
+			user.Semester = value
+			changed = true
+		}
+	}
+
+	return changed
+}
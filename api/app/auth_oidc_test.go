@@ -0,0 +1,386 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/oidc/oidctest"
+	"github.com/infomark-org/infomark/auth/totp"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+)
+
+// cookieRequest sends the cookies a previous response has set.
+type cookieRequest []*http.Cookie
+
+func (t cookieRequest) Modify(r *http.Request) {
+	for _, cookie := range t {
+		r.AddCookie(cookie)
+	}
+}
+
+// responseCookies returns the cookies of a response, later ones replace
+// earlier ones with the same name.
+func responseCookies(w *httptest.ResponseRecorder) cookieRequest {
+	latest := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		latest[cookie.Name] = cookie
+	}
+	cookies := cookieRequest{}
+	for _, cookie := range latest {
+		cookies = append(cookies, cookie)
+	}
+	return cookies
+}
+
+func TestAuthOIDC(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var w *httptest.ResponseRecorder
+	var stores *Stores
+
+	idp, err := oidctest.NewServer("infomark", "secret")
+	if err != nil {
+		panic(err)
+	}
+	defer idp.Close()
+
+	// the stand-in provider redirects immediately, we follow by hand
+	browser := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// login runs the authorization code flow and returns the response of the
+	// callback.
+	login := func(state func(string) string) *httptest.ResponseRecorder {
+		w := tape.Get("/api/v1/auth/oidc/login")
+		g.Assert(w.Code).Equal(http.StatusFound)
+		cookies := responseCookies(w)
+
+		resp, err := browser.Get(w.Header().Get("Location"))
+		g.Assert(err).Equal(nil)
+		resp.Body.Close()
+		g.Assert(resp.StatusCode).Equal(http.StatusFound)
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		g.Assert(err).Equal(nil)
+		g.Assert(callback.Path).Equal("/api/v1/auth/oidc/callback")
+
+		query := callback.Query()
+		query.Set("state", state(query.Get("state")))
+		return tape.Get("/api/v1/auth/oidc/callback?"+query.Encode(), cookies)
+	}
+	sameState := func(state string) string { return state }
+
+	// requestNonce starts the login of a client, which runs the flow with the
+	// provider itself, and returns the nonce along with the session cookie.
+	requestNonce := func() (string, cookieRequest) {
+		w := tape.Post("/api/v1/auth/oidc/nonce", H{})
+		g.Assert(w.Code).Equal(http.StatusOK)
+		resp := &OIDCNonceResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(resp)).Equal(nil)
+		g.Assert(resp.Nonce != "").IsTrue()
+		return resp.Nonce, responseCookies(w)
+	}
+
+	// idToken signs an ID token of the current user for a nonce
+	idToken := func(nonce string) string {
+		claims := map[string]interface{}{"nonce": nonce}
+		for name, value := range idp.Claims {
+			claims[name] = value
+		}
+		token, err := idp.IDToken(claims)
+		g.Assert(err).Equal(nil)
+		return token
+	}
+
+	// codeAt returns the code of the authenticator app some time steps from now
+	codeAt := func(secret string, steps int64) string {
+		code, err := totp.Code(secret, totp.Counter(time.Now())+steps)
+		g.Assert(err).Equal(nil)
+		return code
+	}
+
+	// enableTwoFactor sets up a second factor for the root user with id 1
+	enableTwoFactor := func() string {
+		w := tape.Post("/api/v1/account/two_factor", H{}, tape.NewJWTRequest(1, true))
+		g.Assert(w.Code).Equal(http.StatusCreated)
+		enrollment := &TwoFactorEnrollmentResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(enrollment)).Equal(nil)
+
+		w = tape.Post("/api/v1/account/two_factor/confirm", H{
+			"code": codeAt(enrollment.Secret, -1),
+		}, tape.NewJWTRequest(1, true))
+		g.Assert(w.Code).Equal(http.StatusOK)
+		return enrollment.Secret
+	}
+
+	g.Describe("Auth OIDC", func() {
+
+		g.BeforeEach(func() {
+			config := &configuration.Configuration.Server.Authentication.OIDC
+			config.Enabled = true
+			config.Issuer = idp.URL
+			config.ClientID = "infomark"
+			config.ClientSecret = "secret"
+			config.CreateAccounts = true
+			config.RedirectAfterLogin = "http://localhost/courses"
+			config.Claims.FirstName = "given_name"
+			config.Claims.LastName = "family_name"
+			config.Claims.Email = "email"
+			config.Claims.StudentNumber = "matriculation_number"
+
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+
+			idp.Claims = map[string]interface{}{
+				"sub":                  "campus-4711",
+				"email":                "Jane.Doe@uni-tuebingen.de",
+				"email_verified":       true,
+				"given_name":           "Jane",
+				"family_name":          "Doe",
+				"matriculation_number": "1234567",
+			}
+		})
+
+		g.It("Should not be available when disabled", func() {
+			configuration.Configuration.Server.Authentication.OIDC.Enabled = false
+			tape.BeforeEach()
+
+			w = tape.Get("/api/v1/auth/oidc/login")
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should create an account on first login", func() {
+			_, err := stores.User.FindByEmail("jane.doe@uni-tuebingen.de")
+			g.Assert(err == nil).Equal(false)
+
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusFound)
+			g.Assert(w.Header().Get("Location")).Equal("http://localhost/courses")
+
+			user, err := stores.User.FindByEmail("jane.doe@uni-tuebingen.de")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.FirstName).Equal("Jane")
+			g.Assert(user.LastName).Equal("Doe")
+			g.Assert(user.StudentNumber).Equal("1234567")
+			g.Assert(user.ConfirmEmailToken.Valid).Equal(false)
+			g.Assert(user.Root).Equal(false)
+
+			linked, err := stores.User.FindByIdentity("oidc:"+idp.URL, "campus-4711")
+			g.Assert(err).Equal(nil)
+			g.Assert(linked.ID).Equal(user.ID)
+
+			// the session works like a password login
+			w = tape.Get("/api/v1/account", responseCookies(w))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			account := &UserResponse{}
+			err = json.NewDecoder(w.Body).Decode(account)
+			g.Assert(err).Equal(nil)
+			g.Assert(account.ID).Equal(user.ID)
+		})
+
+		g.It("Should update the profile on later logins", func() {
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusFound)
+
+			idp.Claims["family_name"] = "Smith"
+			idp.Claims["email"] = "jane.smith@uni-tuebingen.de"
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusFound)
+
+			user, err := stores.User.FindByIdentity("oidc:"+idp.URL, "campus-4711")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.LastName).Equal("Smith")
+			g.Assert(user.Email).Equal("jane.doe@uni-tuebingen.de")
+		})
+
+		g.It("Should link an existing account by verified email", func() {
+			idp.Claims["email"] = "test@uni-tuebingen.de"
+
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusFound)
+
+			user, err := stores.User.FindByIdentity("oidc:"+idp.URL, "campus-4711")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.ID).Equal(int64(1))
+		})
+
+		g.It("Should not link an existing account by unverified email", func() {
+			idp.Claims["email"] = "test@uni-tuebingen.de"
+			idp.Claims["email_verified"] = false
+
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			_, err := stores.User.FindByIdentity("oidc:"+idp.URL, "campus-4711")
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("Should not create accounts when disabled", func() {
+			configuration.Configuration.Server.Authentication.OIDC.CreateAccounts = false
+
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			_, err := stores.User.FindByEmail("jane.doe@uni-tuebingen.de")
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("Should reject a wrong state", func() {
+			w = login(func(state string) string { return state + "x" })
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			_, err := stores.User.FindByEmail("jane.doe@uni-tuebingen.de")
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.It("Should reject a callback without login", func() {
+			w = tape.Get("/api/v1/auth/oidc/callback?code=code-1&state=abc")
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should exchange an ID token for JWTs", func() {
+			nonce, cookies := requestNonce()
+
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": idToken(nonce)}, cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			resp := &AuthResponse{}
+			err = json.NewDecoder(w.Body).Decode(resp)
+			g.Assert(err).Equal(nil)
+			g.Assert(resp.Access.Token != "").Equal(true)
+			g.Assert(resp.Refresh.Token != "").Equal(true)
+		})
+
+		g.It("Should exchange an ID token only once for the client which requested it", func() {
+			nonce, cookies := requestNonce()
+			token := idToken(nonce)
+
+			// without the session cookie of the nonce
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token})
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// with the nonce of another client
+			_, other := requestNonce()
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token}, other)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token}, cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// the session cookie does not carry the nonce any longer
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token}, responseCookies(w))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should reject an ID token without a nonce", func() {
+			_, cookies := requestNonce()
+
+			token, err := idp.IDToken(idp.Claims)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token}, cookies)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should reject a forged ID token", func() {
+			forged, err := oidctest.NewServer("infomark", "secret")
+			g.Assert(err).Equal(nil)
+			defer forged.Close()
+
+			nonce, cookies := requestNonce()
+			token, err := forged.IDToken(map[string]interface{}{
+				"iss":   idp.URL,
+				"sub":   "campus-4711",
+				"nonce": nonce,
+			})
+			g.Assert(err).Equal(nil)
+
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token}, cookies)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should require the second factor after the callback", func() {
+			secret := enableTwoFactor()
+			idp.Claims["email"] = "test@uni-tuebingen.de"
+
+			w = login(sameState)
+			g.Assert(w.Code).Equal(http.StatusFound)
+			g.Assert(w.Header().Get("Location")).Equal("http://localhost/courses?two_factor=required")
+			cookies := responseCookies(w)
+
+			// no session has been started yet
+			w = tape.Get("/api/v1/account", cookies)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/auth/oidc/two_factor", H{"code": "wrong"}, cookies)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/auth/oidc/two_factor", H{"code": codeAt(secret, 0)}, cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/account", responseCookies(w))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			account := &UserResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(account)).Equal(nil)
+			g.Assert(account.ID).Equal(int64(1))
+		})
+
+		g.It("Should reject the second factor without a single sign-on", func() {
+			w = tape.Post("/api/v1/auth/oidc/two_factor", H{"code": "123456"})
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should require the second factor for ID tokens", func() {
+			secret := enableTwoFactor()
+			idp.Claims["email"] = "test@uni-tuebingen.de"
+
+			nonce, cookies := requestNonce()
+			token := idToken(nonce)
+
+			w = tape.Post("/api/v1/auth/oidc/token", H{"id_token": token}, cookies)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/auth/oidc/token", H{
+				"id_token":        token,
+				"two_factor_code": codeAt(secret, 0),
+			}, cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.AfterEach(func() {
+			configuration.Configuration.Server.Authentication.OIDC = configuration.OIDCConfiguration{}
+			tape.AfterEach()
+		})
+	})
+}
@@ -32,12 +32,16 @@ import (
 type LoginRequest struct {
 	Email         string `json:"email" example:"test@uni-tuebingen.de"`
 	PlainPassword string `json:"plain_password" example:"test"`
+	// TwoFactorCode is either the current TOTP code or a recovery code. It is
+	// only required for accounts with a second factor.
+	TwoFactorCode string `json:"two_factor_code" example:"492039"`
 }
 
 // Bind preprocesses a loginRequest.
 func (body *LoginRequest) Bind(r *http.Request) error {
 	body.Email = strings.TrimSpace(body.Email)
 	body.Email = strings.ToLower(body.Email)
+	body.TwoFactorCode = strings.TrimSpace(body.TwoFactorCode)
 
 	return validation.ValidateStruct(body,
 		validation.Field(&body.Email, validation.Required, is.Email),
@@ -45,6 +49,24 @@ func (body *LoginRequest) Bind(r *http.Request) error {
 	)
 }
 
+// OIDCTokenRequest exchanges an ID token of the single sign-on provider
+// for our own tokens.
+type OIDCTokenRequest struct {
+	IDToken string `json:"id_token" example:"eyJhbGciOiJSUzI1...dD8jPqLHk0cY"`
+	// TwoFactorCode is only required for accounts with a second factor.
+	TwoFactorCode string `json:"two_factor_code" example:"492039"`
+}
+
+// Bind preprocesses a OIDCTokenRequest.
+func (body *OIDCTokenRequest) Bind(r *http.Request) error {
+	body.IDToken = strings.TrimSpace(body.IDToken)
+	body.TwoFactorCode = strings.TrimSpace(body.TwoFactorCode)
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.IDToken, validation.Required),
+	)
+}
+
 // -----------------------------------------------------------------------------
 // ResetPasswordRequest is the request whenever a user forgot his password and wants
 // to receive an email with a new one.
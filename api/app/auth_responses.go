@@ -36,9 +36,23 @@ func (body *AuthResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// .............................................................................
+// OIDCNonceResponse is the nonce a client passes to the single sign-on
+// provider.
+type OIDCNonceResponse struct {
+	Nonce string `json:"nonce" example:"Jv3kYq9sLbD2xW0pZ7uT4hNc8mRgEaFi"`
+}
+
+func (body *OIDCNonceResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
 // .............................................................................
 type loginResponse struct {
 	Root bool `json:"root" example:"false"`
+	// SetupTwoFactor is true if the account must set up a second factor
+	// before it can use anything else.
+	SetupTwoFactor bool `json:"setup_two_factor" example:"false"`
 }
 
 func (body *loginResponse) Render(w http.ResponseWriter, r *http.Request) error {
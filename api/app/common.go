@@ -121,6 +121,13 @@ func PublicYet(t time.Time) bool {
 	return NowUTC().Sub(t) > 0
 }
 
+// SheetPublic tests if students can access a sheet. Sheets whose tests broke
+// before the publication stay hidden until the reference solutions pass or
+// the check is overridden.
+func SheetPublic(sheet *model.Sheet) bool {
+	return PublicYet(sheet.PublishAt) && (!sheet.TestsBroken || sheet.IgnoreBrokenTests)
+}
+
 // OverTime tests if the deadline is missed (alias for publicyet)
 func OverTime(t time.Time) bool {
 	return NowUTC().Sub(t) > 0
@@ -21,10 +21,12 @@ package app
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -208,6 +210,53 @@ func (rs *CourseResource) DeleteHandler(w http.ResponseWriter, r *http.Request)
 	render.Status(r, http.StatusNoContent)
 }
 
+// CloneHandler is public endpoint for
+// URL: /courses/{course_id}/clone
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: courses
+// REQUEST: CourseCloneRequest
+// RESPONSE: 201,CourseResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  copy a course into a new semester
+// DESCRIPTION:
+// Sheets, tasks, materials, exams and all their files are copied. All dates
+// are shifted by 'offset_days'. Groups are copied without members if
+// 'with_groups' is set. Enrollments, submissions and grades are not copied,
+// but the request identity becomes admin of the new course.
+func (rs *CourseResource) CloneHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &CourseCloneRequest{}
+
+	// parse JSON request into struct
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	newCourse, err := CloneCourse(rs.Stores, course.ID, CourseCloneOptions{
+		Name:       data.Name,
+		Offset:     time.Duration(data.OffsetDays) * 24 * time.Hour,
+		WithGroups: data.WithGroups,
+		AdminID:    accessClaims.LoginID,
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+
+	if err := render.Render(w, r, rs.newCourseResponse(newCourse)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // IndexEnrollmentsHandler is public endpoint for
 // URL: /courses/{course_id}/enrollments
 // URLPARAM: course_id,integer
@@ -335,6 +384,8 @@ func (rs *CourseResource) DeleteUserEnrollmentHandler(w http.ResponseWriter, r *
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
 
+	auditEnrollmentTarget(rs.Stores, r, course.ID, user.ID)
+
 	// find role in the course
 
 	userEnrollment, err := rs.Stores.Course.GetUserEnrollment(course.ID, user.ID)
@@ -368,12 +419,17 @@ func (rs *CourseResource) DeleteUserEnrollmentHandler(w http.ResponseWriter, r *
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  change role of specific user
+// DESCRIPTION:
+// With 'role_id' the user becomes a member of a staff role of the course.
+// Otherwise the user has the fixed course role 'role' only.
 func (rs *CourseResource) ChangeRole(w http.ResponseWriter, r *http.Request) {
 	// /courses/1/enrollments?roles=0,1
 
 	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
 
+	auditEnrollmentTarget(rs.Stores, r, course.ID, user.ID)
+
 	data := &ChangeRoleInCourseRequest{}
 	// parse JSON request into struct
 	if err := render.Bind(r, data); err != nil {
@@ -381,6 +437,22 @@ func (rs *CourseResource) ChangeRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if data.RoleID != 0 {
+		role, err := rs.Stores.Role.Get(data.RoleID)
+		if err != nil || role.CourseID != course.ID {
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("the role does not exist in this course")))
+			return
+		}
+
+		if err := rs.Stores.Role.Assign(user.ID, role); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+
+		render.Status(r, http.StatusOK)
+		return
+	}
+
 	// update database entry
 	if err := rs.Stores.Course.UpdateRole(course.ID, user.ID, data.Role); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
@@ -522,7 +594,10 @@ func (rs *CourseResource) SendEmailHandler(w http.ResponseWriter, r *http.Reques
 			accessUser,
 		)
 
-		email.OutgoingEmailsChannel <- msg
+		if err := EnqueueEmail(rs.Stores, msg); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
 	}
 
 }
@@ -602,6 +677,70 @@ func (rs *CourseResource) BidsHandler(w http.ResponseWriter, r *http.Request) {
 	render.Status(r, http.StatusOK)
 }
 
+// GetDeadlineRemindersHandler is public endpoint for
+// URL: /courses/{course_id}/deadline_reminders
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: courses
+// RESPONSE: 200,DeadlineRemindersResponse
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  whether the request identity gets emails before deadlines in a course
+func (rs *CourseResource) GetDeadlineRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	enabled, err := rs.Stores.Reminder.Enabled(course.ID, accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, &DeadlineRemindersResponse{Enabled: enabled}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// EditDeadlineRemindersHandler is public endpoint for
+// URL: /courses/{course_id}/deadline_reminders
+// URLPARAM: course_id,integer
+// METHOD: put
+// TAG: courses
+// REQUEST: DeadlineRemindersRequest
+// RESPONSE: 200,DeadlineRemindersResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  opt in or out of emails before deadlines in a course
+// DESCRIPTION:
+// Students get an email before the deadline of a sheet if they have not
+// uploaded a solution for all of its tasks yet.
+func (rs *CourseResource) EditDeadlineRemindersHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &DeadlineRemindersRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	if err := rs.Stores.Reminder.SetEnabled(course.ID, accessClaims.LoginID, *data.Enabled); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, &DeadlineRemindersResponse{Enabled: *data.Enabled}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
 // .............................................................................
 
 // Context middleware is used to load an Course object from
@@ -628,6 +767,10 @@ func (rs *CourseResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "course", course.ID, course, func() (interface{}, error) {
+			return rs.Stores.Course.Get(course.ID)
+		})
+
 		// serve next
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyCourse, course)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -651,8 +794,24 @@ func (rs *CourseResource) RoleContext(next http.Handler) http.Handler {
 			courseRole = authorize.ADMIN
 		}
 
+		// members having a role of the course get its permissions, all others
+		// those of their fixed course role
+		permissions := courseRole.Permissions()
+		if courseRole != authorize.NOCOURSEROLE && !accessClaims.Root {
+			role, err := rs.Stores.Role.RoleOfUserInCourse(accessClaims.LoginID, course.ID)
+			switch err {
+			case nil:
+				permissions = authorize.NewPermissionSet(role.Permissions)
+			case sql.ErrNoRows:
+			default:
+				render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+				return
+			}
+		}
+
 		// serve next
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyCourseRole, courseRole)
+		ctx = context.WithValue(ctx, symbol.CtxKeyCoursePermissions, permissions)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,889 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// CourseArchiveVersion is the version of the archive layout. Archives with a
+// different version are rejected during the import.
+const CourseArchiveVersion = 1
+
+// CourseArchiveManifest is stored as "manifest.json" in every course archive.
+type CourseArchiveManifest struct {
+	Version         int       `json:"version"`
+	InfoMarkVersion string    `json:"infomark_version"`
+	ExportedAt      time.Time `json:"exported_at"`
+	CourseID        int64     `json:"course_id"`
+	Files           []string  `json:"files"`
+}
+
+// CourseArchiveImportOptions controls which data of an archive is imported.
+type CourseArchiveImportOptions struct {
+	// Anonymize replaces all personal data of students by placeholders.
+	Anonymize bool
+	// WithoutStudents skips all students including their enrollments, group
+	// memberships, exam enrollments, submissions and grades.
+	WithoutStudents bool
+	// KeepRoles enrolls users with their roles from the archive. Otherwise
+	// everybody is enrolled as student, as the archive might be forged.
+	KeepRoles bool
+}
+
+type archiveCourse struct {
+	ID                 int64     `json:"id"`
+	Name               string    `json:"name"`
+	Description        string    `json:"description"`
+	BeginsAt           time.Time `json:"begins_at"`
+	EndsAt             time.Time `json:"ends_at"`
+	RequiredPercentage int       `json:"required_percentage"`
+}
+
+type archiveUser struct {
+	ID            int64  `json:"id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Email         string `json:"email"`
+	StudentNumber string `json:"student_number"`
+	Semester      int    `json:"semester"`
+	Subject       string `json:"subject"`
+	Language      string `json:"language"`
+}
+
+type archiveEnrollment struct {
+	UserID int64 `json:"user_id"`
+	Role   int64 `json:"role"`
+}
+
+type archiveSheet struct {
+	ID                int64     `json:"id"`
+	Name              string    `json:"name"`
+	PublishAt         time.Time `json:"publish_at"`
+	DueAt             time.Time `json:"due_at"`
+	IgnoreBrokenTests bool      `json:"ignore_broken_tests"`
+}
+
+type archiveTask struct {
+	ID                 int64       `json:"id"`
+	SheetID            int64       `json:"sheet_id"`
+	Name               string      `json:"name"`
+	MaxPoints          int         `json:"max_points"`
+	PublicDockerImage  null.String `json:"public_docker_image"`
+	PrivateDockerImage null.String `json:"private_docker_image"`
+	CPULimit           float64     `json:"cpu_limit,omitempty"`
+	MemoryLimit        int64       `json:"memory_limit,omitempty"`
+
+	ReferencePublicState  int    `json:"reference_public_state"`
+	ReferencePrivateState int    `json:"reference_private_state"`
+	ReferencePublicLog    string `json:"reference_public_log"`
+	ReferencePrivateLog   string `json:"reference_private_log"`
+}
+
+type archiveMaterial struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Kind         int       `json:"kind"`
+	Filename     string    `json:"filename"`
+	PublishAt    time.Time `json:"publish_at"`
+	LectureAt    time.Time `json:"lecture_at"`
+	RequiredRole int       `json:"required_role"`
+	// Extension of the stored file (".zip" or ".pdf").
+	Extension string `json:"extension"`
+}
+
+type archiveExam struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ExamTime    time.Time `json:"exam_time"`
+}
+
+type archiveExamEnrollment struct {
+	ExamID int64  `json:"exam_id"`
+	UserID int64  `json:"user_id"`
+	Status int    `json:"status"`
+	Mark   string `json:"mark"`
+}
+
+type archiveGroup struct {
+	ID          int64   `json:"id"`
+	TutorID     int64   `json:"tutor_id"`
+	Description string  `json:"description"`
+	MemberIDs   []int64 `json:"member_ids"`
+}
+
+type archiveSubmission struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	TaskID    int64     `json:"task_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type archiveGrade struct {
+	ID                    int64  `json:"id"`
+	SubmissionID          int64  `json:"submission_id"`
+	TutorID               int64  `json:"tutor_id"`
+	AcquiredPoints        int    `json:"acquired_points"`
+	Feedback              string `json:"feedback"`
+	PublicExecutionState  int    `json:"public_execution_state"`
+	PrivateExecutionState int    `json:"private_execution_state"`
+	PublicTestLog         string `json:"public_test_log"`
+	PrivateTestLog        string `json:"private_test_log"`
+	PublicTestStatus      int    `json:"public_test_status"`
+	PrivateTestStatus     int    `json:"private_test_status"`
+}
+
+// courseArchive is the in-memory representation of all JSON documents
+// of a course archive.
+type courseArchive struct {
+	Course          archiveCourse
+	Users           []archiveUser
+	Enrollments     []archiveEnrollment
+	Sheets          []archiveSheet
+	Tasks           []archiveTask
+	Materials       []archiveMaterial
+	Exams           []archiveExam
+	ExamEnrollments []archiveExamEnrollment
+	Groups          []archiveGroup
+	Submissions     []archiveSubmission
+	Grades          []archiveGrade
+}
+
+// documents lists the JSON documents of an archive in the order they are
+// written and read.
+func (a *courseArchive) documents() []struct {
+	Name  string
+	Value interface{}
+} {
+	return []struct {
+		Name  string
+		Value interface{}
+	}{
+		{"course.json", &a.Course},
+		{"users.json", &a.Users},
+		{"enrollments.json", &a.Enrollments},
+		{"sheets.json", &a.Sheets},
+		{"tasks.json", &a.Tasks},
+		{"materials.json", &a.Materials},
+		{"exams.json", &a.Exams},
+		{"exam_enrollments.json", &a.ExamEnrollments},
+		{"groups.json", &a.Groups},
+		{"submissions.json", &a.Submissions},
+		{"grades.json", &a.Grades},
+	}
+}
+
+// Names of the files within an archive.
+func archiveSheetFile(id int64) string       { return fmt.Sprintf("files/sheets/%d.zip", id) }
+func archivePublicTestFile(id int64) string  { return fmt.Sprintf("files/tasks/%d-public.zip", id) }
+func archivePrivateTestFile(id int64) string { return fmt.Sprintf("files/tasks/%d-private.zip", id) }
+func archiveReferenceFile(id int64) string   { return fmt.Sprintf("files/tasks/%d-reference.zip", id) }
+func archiveSubmissionFile(id int64) string  { return fmt.Sprintf("files/submissions/%d.zip", id) }
+func archiveMaterialFile(id int64, ext string) string {
+	return fmt.Sprintf("files/materials/%d%s", id, ext)
+}
+
+// ExportCourseArchive writes a self-contained zip archive of a course
+// including sheets, tasks, materials, exams, groups, enrollments,
+// submissions, grades and all referenced files.
+func ExportCourseArchive(stores *Stores, courseID int64, w io.Writer) error {
+	archive, files, err := collectCourseArchive(stores, courseID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+
+	for _, doc := range archive.documents() {
+		if err := writeArchiveJSON(zw, doc.Name, doc.Value); err != nil {
+			return err
+		}
+	}
+
+	manifest := &CourseArchiveManifest{
+		Version:         CourseArchiveVersion,
+		InfoMarkVersion: symbol.Version.String(),
+		ExportedAt:      NowUTC(),
+		CourseID:        courseID,
+		Files:           []string{},
+	}
+
+	for name, hnd := range files {
+		if !hnd.Exists() {
+			continue
+		}
+		if err := writeArchiveFile(zw, name, hnd); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	if err := writeArchiveJSON(zw, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v interface{}) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeArchiveFile(zw *zip.Writer, name string, hnd *helper.FileHandle) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	in, err := hnd.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(fw, in)
+	return err
+}
+
+// collectCourseArchive gathers all data of a course and the files which
+// should be part of the archive.
+func collectCourseArchive(stores *Stores, courseID int64) (*courseArchive, map[string]*helper.FileHandle, error) {
+	archive := &courseArchive{}
+	files := make(map[string]*helper.FileHandle)
+
+	course, err := stores.Course.Get(courseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	archive.Course = archiveCourse{
+		ID:                 course.ID,
+		Name:               course.Name,
+		Description:        course.Description,
+		BeginsAt:           course.BeginsAt,
+		EndsAt:             course.EndsAt,
+		RequiredPercentage: course.RequiredPercentage,
+	}
+
+	// users are collected from enrollments, groups, submissions and grades
+	users := make(map[int64]bool)
+	addUser := func(userID int64) error {
+		if users[userID] {
+			return nil
+		}
+		user, err := stores.User.Get(userID)
+		if err != nil {
+			return err
+		}
+		users[userID] = true
+		archive.Users = append(archive.Users, archiveUser{
+			ID:            user.ID,
+			FirstName:     user.FirstName,
+			LastName:      user.LastName,
+			Email:         user.Email,
+			StudentNumber: user.StudentNumber,
+			Semester:      user.Semester,
+			Subject:       user.Subject,
+			Language:      user.Language,
+		})
+		return nil
+	}
+
+	enrolledUsers, err := stores.Course.EnrolledUsers(course.ID,
+		[]string{"0", "1", "2"}, "%%", "%%", "%%", "%%", "%%")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, enrollment := range enrolledUsers {
+		if err := addUser(enrollment.UserID); err != nil {
+			return nil, nil, err
+		}
+		archive.Enrollments = append(archive.Enrollments, archiveEnrollment{
+			UserID: enrollment.UserID,
+			Role:   enrollment.Role,
+		})
+	}
+
+	sheets, err := stores.Sheet.SheetsOfCourse(course.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks := []model.Task{}
+	for _, sheet := range sheets {
+		archive.Sheets = append(archive.Sheets, archiveSheet{
+			ID:                sheet.ID,
+			Name:              sheet.Name,
+			PublishAt:         sheet.PublishAt,
+			DueAt:             sheet.DueAt,
+			IgnoreBrokenTests: sheet.IgnoreBrokenTests,
+		})
+		files[archiveSheetFile(sheet.ID)] = helper.NewSheetFileHandle(sheet.ID)
+
+		tasksOfSheet, err := stores.Task.TasksOfSheet(sheet.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, t := range tasksOfSheet {
+			// the listing of a sheet does not contain all columns
+			task, err := stores.Task.Get(t.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			tasks = append(tasks, *task)
+			archive.Tasks = append(archive.Tasks, archiveTask{
+				ID:                 task.ID,
+				SheetID:            sheet.ID,
+				Name:               task.Name,
+				MaxPoints:          task.MaxPoints,
+				PublicDockerImage:  task.PublicDockerImage,
+				PrivateDockerImage: task.PrivateDockerImage,
+				CPULimit:           task.CPULimit,
+				MemoryLimit:        task.MemoryLimit,
+
+				ReferencePublicState:  task.ReferencePublicState,
+				ReferencePrivateState: task.ReferencePrivateState,
+				ReferencePublicLog:    task.ReferencePublicLog,
+				ReferencePrivateLog:   task.ReferencePrivateLog,
+			})
+			files[archivePublicTestFile(task.ID)] = helper.NewPublicTestFileHandle(task.ID)
+			files[archivePrivateTestFile(task.ID)] = helper.NewPrivateTestFileHandle(task.ID)
+			files[archiveReferenceFile(task.ID)] = helper.NewReferenceSolutionFileHandle(task.ID)
+		}
+	}
+
+	// admins see all materials
+	materials, err := stores.Material.MaterialsOfCourse(course.ID, 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, material := range materials {
+		hnd := helper.NewMaterialFileHandle(material.ID)
+		ext := path.Ext(hnd.Path())
+		archive.Materials = append(archive.Materials, archiveMaterial{
+			ID:           material.ID,
+			Name:         material.Name,
+			Kind:         material.Kind,
+			Filename:     material.Filename,
+			PublishAt:    material.PublishAt,
+			LectureAt:    material.LectureAt,
+			RequiredRole: material.RequiredRole,
+			Extension:    ext,
+		})
+		if ext != "" {
+			files[archiveMaterialFile(material.ID, ext)] = hnd
+		}
+	}
+
+	exams, err := stores.Exam.ExamsOfCourse(course.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, exam := range exams {
+		archive.Exams = append(archive.Exams, archiveExam{
+			ID:          exam.ID,
+			Name:        exam.Name,
+			Description: exam.Description,
+			ExamTime:    exam.ExamTime,
+		})
+
+		enrollments, err := stores.Exam.GetEnrollmentsInCourseOfExam(course.ID, exam.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, enrollment := range enrollments {
+			if err := addUser(enrollment.UserID); err != nil {
+				return nil, nil, err
+			}
+			archive.ExamEnrollments = append(archive.ExamEnrollments, archiveExamEnrollment{
+				ExamID: exam.ID,
+				UserID: enrollment.UserID,
+				Status: enrollment.Status,
+				Mark:   enrollment.Mark,
+			})
+		}
+	}
+
+	groups, err := stores.Group.GroupsOfCourse(course.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, group := range groups {
+		if err := addUser(group.TutorID); err != nil {
+			return nil, nil, err
+		}
+		members, err := stores.Group.GetMembers(group.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		memberIDs := []int64{}
+		for _, member := range members {
+			if err := addUser(member.ID); err != nil {
+				return nil, nil, err
+			}
+			memberIDs = append(memberIDs, member.ID)
+		}
+		archive.Groups = append(archive.Groups, archiveGroup{
+			ID:          group.ID,
+			TutorID:     group.TutorID,
+			Description: group.Description,
+			MemberIDs:   memberIDs,
+		})
+	}
+
+	for _, task := range tasks {
+		// includes submissions of users who left the course
+		submissions, err := stores.Submission.SubmissionsOfTask(task.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, submission := range submissions {
+			if err := addUser(submission.UserID); err != nil {
+				return nil, nil, err
+			}
+			archive.Submissions = append(archive.Submissions, archiveSubmission{
+				ID:        submission.ID,
+				UserID:    submission.UserID,
+				TaskID:    submission.TaskID,
+				CreatedAt: submission.CreatedAt,
+			})
+			files[archiveSubmissionFile(submission.ID)] = helper.NewSubmissionFileHandle(submission.ID)
+
+			grade, err := stores.Grade.GetForSubmission(submission.ID)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if grade.TutorID != 0 {
+				if err := addUser(grade.TutorID); err != nil {
+					return nil, nil, err
+				}
+			}
+			archive.Grades = append(archive.Grades, archiveGrade{
+				ID:                    grade.ID,
+				SubmissionID:          submission.ID,
+				TutorID:               grade.TutorID,
+				AcquiredPoints:        grade.AcquiredPoints,
+				Feedback:              grade.Feedback,
+				PublicExecutionState:  grade.PublicExecutionState,
+				PrivateExecutionState: grade.PrivateExecutionState,
+				PublicTestLog:         grade.PublicTestLog,
+				PrivateTestLog:        grade.PrivateTestLog,
+				PublicTestStatus:      grade.PublicTestStatus,
+				PrivateTestStatus:     grade.PrivateTestStatus,
+			})
+		}
+	}
+
+	return archive, files, nil
+}
+
+// ImportCourseArchive creates a new course from an archive written by
+// ExportCourseArchive. All IDs are remapped. Users are matched by their email
+// address and created if they do not exist yet. Either the whole archive is
+// imported or nothing at all.
+func ImportCourseArchive(stores *Stores, zr *zip.Reader, opts CourseArchiveImportOptions) (*model.Course, error) {
+	entries := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	manifest := &CourseArchiveManifest{}
+	if err := readArchiveJSON(entries, "manifest.json", manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != CourseArchiveVersion {
+		return nil, fmt.Errorf("archive version %d is not supported (expected %d)",
+			manifest.Version, CourseArchiveVersion)
+	}
+
+	archive := &courseArchive{}
+	for _, doc := range archive.documents() {
+		if err := readArchiveJSON(entries, doc.Name, doc.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	var course *model.Course
+	files := &copiedFiles{}
+
+	err := stores.Transaction(func(tx *Stores) error {
+		var err error
+		course, err = importCourseArchive(tx, files, entries, archive, opts)
+		return err
+	})
+	if err != nil {
+		files.remove()
+		return nil, err
+	}
+
+	return course, nil
+}
+
+func importCourseArchive(
+	stores *Stores,
+	files *copiedFiles,
+	entries map[string]*zip.File,
+	archive *courseArchive,
+	opts CourseArchiveImportOptions,
+) (*model.Course, error) {
+	// users without an enrollment (e.g. former tutors) are treated as staff
+	// unless they submitted solutions
+	isStudent := make(map[int64]bool)
+	for _, enrollment := range archive.Enrollments {
+		isStudent[enrollment.UserID] = enrollment.Role == int64(authorize.STUDENT)
+	}
+	for _, submission := range archive.Submissions {
+		if _, enrolled := isStudent[submission.UserID]; !enrolled {
+			isStudent[submission.UserID] = true
+		}
+	}
+
+	userIDs, err := importArchiveUsers(stores, archive.Users, isStudent, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	course, err := stores.Course.Create(&model.Course{
+		Name:               archive.Course.Name,
+		Description:        archive.Course.Description,
+		BeginsAt:           archive.Course.BeginsAt,
+		EndsAt:             archive.Course.EndsAt,
+		RequiredPercentage: archive.Course.RequiredPercentage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, enrollment := range archive.Enrollments {
+		userID, ok := userIDs[enrollment.UserID]
+		if !ok {
+			continue
+		}
+		// the roles of a foreign archive must not grant any privileges
+		role := int64(authorize.STUDENT)
+		if opts.KeepRoles {
+			role = enrollment.Role
+		}
+		if err := stores.Course.Enroll(course.ID, userID, role); err != nil {
+			return nil, err
+		}
+	}
+
+	sheetIDs := make(map[int64]int64)
+	for _, sheet := range archive.Sheets {
+		newSheet, err := stores.Sheet.Create(&model.Sheet{
+			Name:              sheet.Name,
+			PublishAt:         sheet.PublishAt,
+			DueAt:             sheet.DueAt,
+			IgnoreBrokenTests: sheet.IgnoreBrokenTests,
+		}, course.ID)
+		if err != nil {
+			return nil, err
+		}
+		sheetIDs[sheet.ID] = newSheet.ID
+
+		if err := readArchiveFile(files, entries, archiveSheetFile(sheet.ID),
+			helper.NewSheetFileHandle(newSheet.ID), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	taskIDs := make(map[int64]int64)
+	for _, task := range archive.Tasks {
+		sheetID, ok := sheetIDs[task.SheetID]
+		if !ok {
+			return nil, fmt.Errorf("task %d references unknown sheet %d", task.ID, task.SheetID)
+		}
+		newTask, err := stores.Task.Create(&model.Task{
+			Name:               task.Name,
+			MaxPoints:          task.MaxPoints,
+			PublicDockerImage:  task.PublicDockerImage,
+			PrivateDockerImage: task.PrivateDockerImage,
+			CPULimit:           task.CPULimit,
+			MemoryLimit:        task.MemoryLimit,
+
+			ReferencePublicState:  task.ReferencePublicState,
+			ReferencePrivateState: task.ReferencePrivateState,
+			ReferencePublicLog:    task.ReferencePublicLog,
+			ReferencePrivateLog:   task.ReferencePrivateLog,
+		}, sheetID)
+		if err != nil {
+			return nil, err
+		}
+		taskIDs[task.ID] = newTask.ID
+
+		if err := readArchiveFile(files, entries, archivePublicTestFile(task.ID),
+			helper.NewPublicTestFileHandle(newTask.ID), ""); err != nil {
+			return nil, err
+		}
+		if err := readArchiveFile(files, entries, archivePrivateTestFile(task.ID),
+			helper.NewPrivateTestFileHandle(newTask.ID), ""); err != nil {
+			return nil, err
+		}
+		if err := readArchiveFile(files, entries, archiveReferenceFile(task.ID),
+			helper.NewReferenceSolutionFileHandle(newTask.ID), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, material := range archive.Materials {
+		newMaterial, err := stores.Material.Create(&model.Material{
+			Name:         material.Name,
+			Kind:         material.Kind,
+			Filename:     material.Filename,
+			PublishAt:    material.PublishAt,
+			LectureAt:    material.LectureAt,
+			RequiredRole: material.RequiredRole,
+		}, course.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := readArchiveFile(files, entries, archiveMaterialFile(material.ID, material.Extension),
+			helper.NewMaterialFileHandle(newMaterial.ID), material.Extension); err != nil {
+			return nil, err
+		}
+	}
+
+	examIDs := make(map[int64]int64)
+	for _, exam := range archive.Exams {
+		newExam, err := stores.Exam.Create(&model.Exam{
+			Name:        exam.Name,
+			Description: exam.Description,
+			ExamTime:    exam.ExamTime,
+			CourseID:    course.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		examIDs[exam.ID] = newExam.ID
+	}
+
+	for _, enrollment := range archive.ExamEnrollments {
+		userID, ok := userIDs[enrollment.UserID]
+		if !ok {
+			continue
+		}
+		examID := examIDs[enrollment.ExamID]
+		if err := stores.Exam.Enroll(examID, userID); err != nil {
+			return nil, err
+		}
+		userExam, err := stores.Exam.GetEnrollmentOfUser(examID, userID)
+		if err != nil {
+			return nil, err
+		}
+		userExam.Status = enrollment.Status
+		userExam.Mark = enrollment.Mark
+		if err := stores.Exam.UpdateUserExam(userExam); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, group := range archive.Groups {
+		newGroup, err := stores.Group.Create(&model.Group{
+			TutorID:     userIDs[group.TutorID],
+			CourseID:    course.ID,
+			Description: group.Description,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, memberID := range group.MemberIDs {
+			userID, ok := userIDs[memberID]
+			if !ok {
+				continue
+			}
+			if _, err := stores.Group.CreateGroupEnrollmentOfUserInCourse(&model.GroupEnrollment{
+				UserID:  userID,
+				GroupID: newGroup.ID,
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	submissionIDs := make(map[int64]int64)
+	for _, submission := range archive.Submissions {
+		userID, ok := userIDs[submission.UserID]
+		if !ok {
+			continue
+		}
+		newSubmission, err := stores.Submission.Create(&model.Submission{
+			UserID: userID,
+			TaskID: taskIDs[submission.TaskID],
+		})
+		if err != nil {
+			return nil, err
+		}
+		submissionIDs[submission.ID] = newSubmission.ID
+
+		if err := stores.Submission.UpdateCreatedAt(newSubmission.ID, submission.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if err := readArchiveFile(files, entries, archiveSubmissionFile(submission.ID),
+			helper.NewSubmissionFileHandle(newSubmission.ID), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, grade := range archive.Grades {
+		submissionID, ok := submissionIDs[grade.SubmissionID]
+		if !ok {
+			continue
+		}
+		if _, err := stores.Grade.Create(&model.Grade{
+			SubmissionID:          submissionID,
+			TutorID:               userIDs[grade.TutorID],
+			AcquiredPoints:        grade.AcquiredPoints,
+			Feedback:              grade.Feedback,
+			PublicExecutionState:  grade.PublicExecutionState,
+			PrivateExecutionState: grade.PrivateExecutionState,
+			PublicTestLog:         grade.PublicTestLog,
+			PrivateTestLog:        grade.PrivateTestLog,
+			PublicTestStatus:      grade.PublicTestStatus,
+			PrivateTestStatus:     grade.PrivateTestStatus,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return course, nil
+}
+
+// importArchiveUsers maps the users of an archive to users of this instance.
+func importArchiveUsers(
+	stores *Stores,
+	users []archiveUser,
+	isStudent map[int64]bool,
+	opts CourseArchiveImportOptions,
+) (map[int64]int64, error) {
+	userIDs := make(map[int64]int64)
+
+	anonymous := 0
+	for _, user := range users {
+		student := isStudent[user.ID]
+		if student && opts.WithoutStudents {
+			continue
+		}
+
+		if student && opts.Anonymize {
+			anonymous++
+			user = archiveUser{
+				FirstName: "Anonymous",
+				LastName:  fmt.Sprintf("Student %d", anonymous),
+				Email:     fmt.Sprintf("anonymous-%s@infomark.invalid", auth.GenerateToken(8)),
+				Language:  user.Language,
+			}
+		} else {
+			existing, err := stores.User.FindByEmail(user.Email)
+			if err == nil {
+				userIDs[user.ID] = existing.ID
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return nil, err
+			}
+		}
+
+		// imported accounts need to reset their password before they can log in
+		password, err := auth.HashPassword(auth.GenerateToken(32))
+		if err != nil {
+			return nil, err
+		}
+
+		language := user.Language
+		if language == "" {
+			language = "en"
+		}
+
+		newUser, err := stores.User.Create(&model.User{
+			FirstName:         user.FirstName,
+			LastName:          user.LastName,
+			Email:             user.Email,
+			StudentNumber:     user.StudentNumber,
+			Semester:          user.Semester,
+			Subject:           user.Subject,
+			Language:          language,
+			EncryptedPassword: password,
+		})
+		if err != nil {
+			return nil, err
+		}
+		userIDs[user.ID] = newUser.ID
+	}
+
+	return userIDs, nil
+}
+
+func readArchiveJSON(entries map[string]*zip.File, name string, v interface{}) error {
+	f, ok := entries[name]
+	if !ok {
+		return fmt.Errorf("archive does not contain %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// readArchiveFile extracts a file of the archive to the location of a handle.
+// Missing files are skipped as they have been missing in the exported course.
+func readArchiveFile(files *copiedFiles, entries map[string]*zip.File, name string, hnd *helper.FileHandle, ext string) error {
+	f, ok := entries[name]
+	if !ok {
+		return nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := hnd.WriteFromReader(rc, ext); err != nil {
+		return err
+	}
+	*files = append(*files, hnd)
+	return nil
+}
@@ -0,0 +1,288 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/model"
+)
+
+// CourseCloneOptions describes how a course should be copied into a new
+// semester.
+type CourseCloneOptions struct {
+	// Name of the new course. The name of the source course is used if empty.
+	Name string
+	// Offset is added to all dates (publish, due, lecture and exam times).
+	Offset time.Duration
+	// WithGroups copies the exercise groups (including tutors) without members.
+	WithGroups bool
+	// AdminID is enrolled as admin of the new course if not 0.
+	AdminID int64
+}
+
+// CloneCourse deep-copies a course including sheets, tasks, materials, exams
+// and all associated files. Enrollments, submissions and grades are never
+// copied. Either the whole course is copied or nothing at all.
+func CloneCourse(stores *Stores, courseID int64, opts CourseCloneOptions) (*model.Course, error) {
+	var course *model.Course
+	files := &copiedFiles{}
+
+	err := stores.Transaction(func(tx *Stores) error {
+		var err error
+		course, err = cloneCourse(tx, files, courseID, opts)
+		return err
+	})
+	if err != nil {
+		files.remove()
+		return nil, err
+	}
+
+	return course, nil
+}
+
+func cloneCourse(stores *Stores, files *copiedFiles, courseID int64, opts CourseCloneOptions) (*model.Course, error) {
+	source, err := stores.Course.Get(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = source.Name
+	}
+
+	course, err := stores.Course.Create(&model.Course{
+		Name:               name,
+		Description:        source.Description,
+		BeginsAt:           source.BeginsAt.Add(opts.Offset),
+		EndsAt:             source.EndsAt.Add(opts.Offset),
+		RequiredPercentage: source.RequiredPercentage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cloneSheets(stores, files, source.ID, course.ID, opts.Offset); err != nil {
+		return nil, err
+	}
+
+	if err := cloneMaterials(stores, files, source.ID, course.ID, opts.Offset); err != nil {
+		return nil, err
+	}
+
+	if err := cloneExams(stores, source.ID, course.ID, opts.Offset); err != nil {
+		return nil, err
+	}
+
+	if opts.WithGroups {
+		if err := cloneGroups(stores, source.ID, course.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.AdminID != 0 {
+		if err := stores.Course.Enroll(course.ID, opts.AdminID, int64(authorize.ADMIN)); err != nil {
+			return nil, err
+		}
+	}
+
+	return course, nil
+}
+
+// copiedFiles remembers all copies of a clone to remove them again if the
+// clone fails.
+type copiedFiles []*helper.FileHandle
+
+// copy copies a file between two handles if the source exists.
+func (c *copiedFiles) copy(src *helper.FileHandle, dst *helper.FileHandle) error {
+	if !src.Exists() {
+		return nil
+	}
+	if err := src.CopyTo(dst); err != nil {
+		return fmt.Errorf("cannot copy %s: %s", src.Path(), err)
+	}
+	*c = append(*c, dst)
+	return nil
+}
+
+func (c *copiedFiles) remove() {
+	for _, file := range *c {
+		file.Delete()
+	}
+	*c = nil
+}
+
+func cloneSheets(stores *Stores, files *copiedFiles, sourceCourseID int64, courseID int64, offset time.Duration) error {
+	sheets, err := stores.Sheet.SheetsOfCourse(sourceCourseID)
+	if err != nil {
+		return err
+	}
+
+	for _, sheet := range sheets {
+		newSheet, err := stores.Sheet.Create(&model.Sheet{
+			Name:              sheet.Name,
+			PublishAt:         sheet.PublishAt.Add(offset),
+			DueAt:             sheet.DueAt.Add(offset),
+			IgnoreBrokenTests: sheet.IgnoreBrokenTests,
+		}, courseID)
+		if err != nil {
+			return err
+		}
+
+		if err := files.copy(
+			helper.NewSheetFileHandle(sheet.ID),
+			helper.NewSheetFileHandle(newSheet.ID)); err != nil {
+			return err
+		}
+
+		tasks, err := stores.Task.TasksOfSheet(sheet.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, t := range tasks {
+			// the listing of a sheet does not contain all columns
+			task, err := stores.Task.Get(t.ID)
+			if err != nil {
+				return err
+			}
+
+			// identical frameworks and images give identical results for the
+			// reference solution
+			newTask, err := stores.Task.Create(&model.Task{
+				Name:                  task.Name,
+				MaxPoints:             task.MaxPoints,
+				PublicDockerImage:     task.PublicDockerImage,
+				PrivateDockerImage:    task.PrivateDockerImage,
+				CPULimit:              task.CPULimit,
+				MemoryLimit:           task.MemoryLimit,
+				ReferencePublicState:  task.ReferencePublicState,
+				ReferencePrivateState: task.ReferencePrivateState,
+				ReferencePublicLog:    task.ReferencePublicLog,
+				ReferencePrivateLog:   task.ReferencePrivateLog,
+			}, newSheet.ID)
+			if err != nil {
+				return err
+			}
+
+			if err := files.copy(
+				helper.NewPublicTestFileHandle(task.ID),
+				helper.NewPublicTestFileHandle(newTask.ID)); err != nil {
+				return err
+			}
+
+			if err := files.copy(
+				helper.NewPrivateTestFileHandle(task.ID),
+				helper.NewPrivateTestFileHandle(newTask.ID)); err != nil {
+				return err
+			}
+
+			if err := files.copy(
+				helper.NewReferenceSolutionFileHandle(task.ID),
+				helper.NewReferenceSolutionFileHandle(newTask.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func cloneMaterials(stores *Stores, files *copiedFiles, sourceCourseID int64, courseID int64, offset time.Duration) error {
+	// admins see all materials
+	materials, err := stores.Material.MaterialsOfCourse(sourceCourseID, 2)
+	if err != nil {
+		return err
+	}
+
+	for _, material := range materials {
+		newMaterial, err := stores.Material.Create(&model.Material{
+			Name:         material.Name,
+			Kind:         material.Kind,
+			Filename:     material.Filename,
+			PublishAt:    material.PublishAt.Add(offset),
+			LectureAt:    material.LectureAt.Add(offset),
+			RequiredRole: material.RequiredRole,
+		}, courseID)
+		if err != nil {
+			return err
+		}
+
+		if err := files.copy(
+			helper.NewMaterialFileHandle(material.ID),
+			helper.NewMaterialFileHandle(newMaterial.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cloneExams(stores *Stores, sourceCourseID int64, courseID int64, offset time.Duration) error {
+	exams, err := stores.Exam.ExamsOfCourse(sourceCourseID)
+	if err != nil {
+		return err
+	}
+
+	for _, exam := range exams {
+		if _, err := stores.Exam.Create(&model.Exam{
+			Name:        exam.Name,
+			Description: exam.Description,
+			ExamTime:    exam.ExamTime.Add(offset),
+			CourseID:    courseID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cloneGroups(stores *Stores, sourceCourseID int64, courseID int64) error {
+	groups, err := stores.Group.GroupsOfCourse(sourceCourseID)
+	if err != nil {
+		return err
+	}
+
+	enrolled := make(map[int64]bool)
+	for _, group := range groups {
+		// the tutors come along with their groups
+		if !enrolled[group.TutorID] {
+			if err := stores.Course.Enroll(courseID, group.TutorID, int64(authorize.TUTOR)); err != nil {
+				return err
+			}
+			enrolled[group.TutorID] = true
+		}
+
+		if _, err := stores.Group.Create(&model.Group{
+			TutorID:     group.TutorID,
+			CourseID:    courseID,
+			Description: group.Description,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -78,8 +78,39 @@ func (body *CourseRequest) Validate() error {
 
 type ChangeRoleInCourseRequest struct {
 	Role int `json:"role" example:"0"`
+	// a staff role of the course, which replaces "role" by its base role
+	RoleID int64 `json:"role_id" example:"0"`
 }
 
 func (body *ChangeRoleInCourseRequest) Bind(r *http.Request) error {
 	return nil
 }
+
+// CourseCloneRequest is the request payload to copy a course into a new semester.
+type CourseCloneRequest struct {
+	Name       string `json:"name" example:"Info 2 (next semester)"`
+	OffsetDays int    `json:"offset_days" example:"182"`
+	WithGroups bool   `json:"with_groups" example:"false"`
+}
+
+// Bind preprocesses a CourseCloneRequest.
+func (body *CourseCloneRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"clone\" data")
+	}
+	return nil
+}
+
+// DeadlineRemindersRequest is the request payload to opt in or out of
+// reminders of deadlines.
+type DeadlineRemindersRequest struct {
+	Enabled *bool `json:"enabled" example:"false"`
+}
+
+// Bind preprocesses a DeadlineRemindersRequest.
+func (body *DeadlineRemindersRequest) Bind(r *http.Request) error {
+	if body == nil || body.Enabled == nil {
+		return errors.New("missing \"enabled\" data")
+	}
+	return nil
+}
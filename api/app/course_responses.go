@@ -188,3 +188,14 @@ func newEnrollmentListResponse(enrollments []model.UserCourse) []render.Renderer
 
 	return list
 }
+
+// DeadlineRemindersResponse is the response payload for the reminders of
+// deadlines of the request identity.
+type DeadlineRemindersResponse struct {
+	Enabled bool `json:"enabled" example:"true"`
+}
+
+// Render post-processes a DeadlineRemindersResponse.
+func (body *DeadlineRemindersResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -20,6 +20,8 @@
 package app
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -48,7 +50,6 @@ func TestCourse(t *testing.T) {
 	g := goblin.Goblin(t)
 	email.DefaultMail = email.VoidMail
 	// email.DefaultMail = email.TerminalMail
-	go email.BackgroundSend(email.OutgoingEmailsChannel)
 
 	tape := NewTape()
 
@@ -567,6 +568,152 @@ func TestCourse(t *testing.T) {
 
 		})
 
+		g.It("Should clone a course", func() {
+			url := "/api/v1/courses/1/clone"
+
+			w := tape.Post(url, H{"offset_days": 7}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post(url, H{"name": "Info2 next", "offset_days": 7}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			courseReturn := &CourseResponse{}
+			err := json.NewDecoder(w.Body).Decode(&courseReturn)
+			g.Assert(err).Equal(nil)
+			g.Assert(courseReturn.Name).Equal("Info2 next")
+
+			courseSource, err := stores.Course.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(courseReturn.BeginsAt.Equal(courseSource.BeginsAt.Add(7 * 24 * time.Hour))).Equal(true)
+
+			for _, stmt := range []string{
+				"SELECT count(*) FROM sheet_course WHERE course_id = $1;",
+				"SELECT count(*) FROM task_sheet ts INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id WHERE sc.course_id = $1;",
+				"SELECT count(*) FROM material_course WHERE course_id = $1;",
+				"SELECT count(*) FROM exams WHERE course_id = $1;",
+			} {
+				numberSource, err := DBGetInt(tape, stmt, 1)
+				g.Assert(err).Equal(nil)
+				numberCloned, err := DBGetInt(tape, stmt, courseReturn.ID)
+				g.Assert(err).Equal(nil)
+				g.Assert(numberCloned).Equal(numberSource)
+			}
+
+			// only the requesting admin is enrolled
+			numberEnrollments, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1;", courseReturn.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberEnrollments).Equal(1)
+
+			numberGroups, err := DBGetInt(tape, "SELECT count(*) FROM groups WHERE course_id = $1;", courseReturn.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberGroups).Equal(0)
+		})
+
+		g.It("Should enroll the tutors of cloned groups", func() {
+			course, err := CloneCourse(stores, 1, CourseCloneOptions{WithGroups: true})
+			g.Assert(err).Equal(nil)
+
+			numberGroups, err := DBGetInt(tape, "SELECT count(*) FROM groups WHERE course_id = $1;", 1)
+			g.Assert(err).Equal(nil)
+			numberCloned, err := DBGetInt(tape, "SELECT count(*) FROM groups WHERE course_id = $1;", course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberCloned).Equal(numberGroups)
+
+			numberWithoutTutor, err := DBGetInt(tape, `
+SELECT count(*) FROM groups g
+WHERE g.course_id = $1
+AND NOT EXISTS (
+  SELECT 1 FROM user_course uc
+  WHERE uc.course_id = g.course_id AND uc.user_id = g.tutor_id AND uc.role = 1
+);`, course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberWithoutTutor).Equal(0)
+		})
+
+		g.It("Should export and import a course archive", func() {
+			buf := new(bytes.Buffer)
+			err := ExportCourseArchive(stores, 1, buf)
+			g.Assert(err).Equal(nil)
+
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			g.Assert(err).Equal(nil)
+
+			course, err := ImportCourseArchive(stores, zr, CourseArchiveImportOptions{WithoutStudents: true, KeepRoles: true})
+			g.Assert(err).Equal(nil)
+
+			for _, stmt := range []string{
+				"SELECT count(*) FROM sheet_course WHERE course_id = $1;",
+				"SELECT count(*) FROM material_course WHERE course_id = $1;",
+				"SELECT count(*) FROM exams WHERE course_id = $1;",
+				"SELECT count(*) FROM groups WHERE course_id = $1;",
+				"SELECT count(*) FROM user_course WHERE course_id = $1 and role > 0;",
+			} {
+				numberSource, err := DBGetInt(tape, stmt, 1)
+				g.Assert(err).Equal(nil)
+				numberImported, err := DBGetInt(tape, stmt, course.ID)
+				g.Assert(err).Equal(nil)
+				g.Assert(numberImported).Equal(numberSource)
+			}
+
+			numberStudents, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1 and role = 0;", course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberStudents).Equal(0)
+
+			// anonymized students are new accounts
+			usersBefore, err := DBGetInt(tape, "SELECT count(*) FROM users WHERE id > $1;", 0)
+			g.Assert(err).Equal(nil)
+			studentsSource, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1 and role = 0;", 1)
+			g.Assert(err).Equal(nil)
+
+			course, err = ImportCourseArchive(stores, zr, CourseArchiveImportOptions{Anonymize: true})
+			g.Assert(err).Equal(nil)
+
+			usersAfter, err := DBGetInt(tape, "SELECT count(*) FROM users WHERE id > $1;", 0)
+			g.Assert(err).Equal(nil)
+			g.Assert(usersAfter).Equal(usersBefore + studentsSource)
+
+			numberStudents, err = DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1 and role = 0;", course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberStudents).Equal(studentsSource)
+		})
+
+		g.It("Should import a course archive without trusting its roles", func() {
+			buf := new(bytes.Buffer)
+			err := ExportCourseArchive(stores, 1, buf)
+			g.Assert(err).Equal(nil)
+
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			g.Assert(err).Equal(nil)
+
+			course, err := ImportCourseArchive(stores, zr, CourseArchiveImportOptions{})
+			g.Assert(err).Equal(nil)
+
+			numberStaff, err := DBGetInt(tape, "SELECT count(*) FROM user_course WHERE course_id = $1 and role > 0;", course.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(numberStaff).Equal(0)
+
+			// submissions keep their time
+			submissionsSource, err := DBGetInt(tape, `
+SELECT count(*) FROM submissions s
+INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+WHERE sc.course_id = $1;`, 1)
+			g.Assert(err).Equal(nil)
+			submissionsImported, err := DBGetInt2(tape, `
+SELECT count(*) FROM submissions s
+INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+WHERE sc.course_id = $1
+AND s.created_at IN (
+  SELECT s2.created_at FROM submissions s2
+  INNER JOIN task_sheet ts2 ON ts2.task_id = s2.task_id
+  INNER JOIN sheet_course sc2 ON sc2.sheet_id = ts2.sheet_id
+  WHERE sc2.course_id = $2
+);`, course.ID, 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(submissionsImported).Equal(submissionsSource)
+		})
+
 		g.It("Permission test", func() {
 			url := "/api/v1/courses/1"
 
@@ -0,0 +1,165 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+)
+
+func TestDeadlineReminder(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	studentJWT := tape.NewJWTRequest(112, false)
+
+	remindersEnabled := func() bool {
+		w := tape.Get("/api/v1/courses/1/deadline_reminders", studentJWT)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		remindersActual := &DeadlineRemindersResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(remindersActual)).Equal(nil)
+		return remindersActual.Enabled
+	}
+
+	hasRecipient := func(sheetID int64, userID int64) bool {
+		students, err := stores.Reminder.Recipients(sheetID, 1)
+		g.Assert(err).Equal(nil)
+		for _, student := range students {
+			if student.ID == userID {
+				return true
+			}
+		}
+		return false
+	}
+
+	g.Describe("DeadlineReminder", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Students should be able to opt out", func() {
+			g.Assert(remindersEnabled()).IsTrue()
+			g.Assert(hasRecipient(1, 112)).IsTrue()
+
+			w := tape.Put("/api/v1/courses/1/deadline_reminders", H{"enabled": false}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(remindersEnabled()).IsFalse()
+			g.Assert(hasRecipient(1, 112)).IsFalse()
+
+			w = tape.Put("/api/v1/courses/1/deadline_reminders", H{"enabled": true}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(remindersEnabled()).IsTrue()
+
+			w = tape.Put("/api/v1/courses/1/deadline_reminders", H{}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should find sheets due soon", func() {
+			_, err := tape.DB.Exec("UPDATE sheets SET publish_at = NOW() - INTERVAL '1 day', due_at = NOW() + INTERVAL '2 hours' WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			now := NowUTC()
+			sheets, err := stores.Reminder.DueSheets(now, now.Add(3*time.Hour))
+			g.Assert(err).Equal(nil)
+
+			found := false
+			for _, sheet := range sheets {
+				if sheet.SheetID == 1 {
+					found = true
+					g.Assert(sheet.CourseID).Equal(int64(1))
+				}
+			}
+			g.Assert(found).IsTrue()
+
+			sheets, err = stores.Reminder.DueSheets(now, now.Add(time.Hour))
+			g.Assert(err).Equal(nil)
+			for _, sheet := range sheets {
+				g.Assert(sheet.SheetID == 1).IsFalse()
+			}
+		})
+
+		g.It("Should not find sheets with broken tests", func() {
+			_, err := tape.DB.Exec("UPDATE sheets SET publish_at = NOW() - INTERVAL '1 day', due_at = NOW() + INTERVAL '2 hours' WHERE id = 1")
+			g.Assert(err).Equal(nil)
+			_, err = tape.DB.Exec("UPDATE tasks SET reference_public_state = 3, reference_blocked_at = NULL WHERE id IN (SELECT task_id FROM task_sheet WHERE sheet_id = 1)")
+			g.Assert(err).Equal(nil)
+
+			dueSoon := func() bool {
+				now := NowUTC()
+				sheets, err := stores.Reminder.DueSheets(now, now.Add(3*time.Hour))
+				g.Assert(err).Equal(nil)
+				for _, sheet := range sheets {
+					if sheet.SheetID == 1 {
+						return true
+					}
+				}
+				return false
+			}
+
+			// students cannot access the sheet yet
+			g.Assert(dueSoon()).IsFalse()
+
+			_, err = tape.DB.Exec("UPDATE sheets SET ignore_broken_tests = TRUE WHERE id = 1")
+			g.Assert(err).Equal(nil)
+			g.Assert(dueSoon()).IsTrue()
+		})
+
+		g.It("Should remind every student only once", func() {
+			claimed, err := stores.Reminder.Claim(1, 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(claimed).IsTrue()
+			g.Assert(hasRecipient(1, 112)).IsFalse()
+
+			claimed, err = stores.Reminder.Claim(1, 112)
+			g.Assert(err).Equal(nil)
+			g.Assert(claimed).IsFalse()
+		})
+
+		g.It("Should render reminders in the language of the student", func() {
+			user, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			user.Language = "de"
+
+			msg, err := NewTemplatedEmail(stores, 1, email.DeadlineReminderTemplate, user, map[string]string{
+				"course_name": "Info2",
+				"sheet_name":  "Blatt 3",
+			})
+			g.Assert(err).Equal(nil)
+			g.Assert(msg.Subject).Equal("[Info2] Abgabe von Blatt 3 bald fällig")
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+	})
+
+}
@@ -0,0 +1,342 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// languagePattern matches the two-letter codes of User.Language.
+var languagePattern = regexp.MustCompile("^[a-z]{2}$")
+
+// EmailTemplateResource specifies handler for the translations of emails
+// customized for the instance or a course.
+type EmailTemplateResource struct {
+	Stores *Stores
+}
+
+// NewEmailTemplateResource create and returns a EmailTemplateResource.
+func NewEmailTemplateResource(stores *Stores) *EmailTemplateResource {
+	return &EmailTemplateResource{
+		Stores: stores,
+	}
+}
+
+// emailTemplateOverrides looks up the customized translations for the
+// template registry.
+type emailTemplateOverrides struct {
+	Stores *Stores
+}
+
+// FindTemplate implements email.TemplateOverrides.
+func (o *emailTemplateOverrides) FindTemplate(courseID int64, name string, language string) (*email.Template, error) {
+	p, err := o.Stores.EmailTemplate.Find(courseID, name, language)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &email.Template{
+		Name:     p.Name,
+		Language: p.Language,
+		Subject:  p.Subject,
+		Text:     p.TextBody,
+		HTML:     p.HTMLBody,
+	}, nil
+}
+
+// NewTemplatedEmail renders a registered email in the language of the
+// recipient. Customized translations of the course (if courseID is not 0) or
+// the instance take precedence over the built-in ones.
+func NewTemplatedEmail(stores *Stores, courseID int64, name string, recipient *model.User, data map[string]string) (*email.Email, error) {
+	t, err := email.Templates.Find(&emailTemplateOverrides{Stores: stores}, courseID, name, recipient.Language)
+	if err != nil {
+		return nil, err
+	}
+	return t.NewEmail(configuration.Configuration.Server.Email.From, recipient.Email, data)
+}
+
+// templateCourseID returns the course of the request, 0 for the instance.
+func templateCourseID(r *http.Request) int64 {
+	if course, ok := r.Context().Value(symbol.CtxKeyCourse).(*model.Course); ok {
+		return course.ID
+	}
+	return 0
+}
+
+// effectiveTemplate returns the translation used for recipients of the given
+// language at the level of the request and whether it is customized at this
+// level.
+func (rs *EmailTemplateResource) effectiveTemplate(r *http.Request, name string, language string) (*email.Template, bool, error) {
+	courseID := templateCourseID(r)
+
+	override, err := (&emailTemplateOverrides{Stores: rs.Stores}).FindTemplate(courseID, name, language)
+	if err != nil {
+		return nil, false, err
+	}
+	if override != nil {
+		return override, true, nil
+	}
+
+	t, err := email.Templates.Find(&emailTemplateOverrides{Stores: rs.Stores}, courseID, name, language)
+	return t, false, err
+}
+
+// IndexHandler is public endpoint for
+// URL: /email_templates
+// METHOD: get
+// TAG: email
+// RESPONSE: 200,EmailTemplateResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  all emails in all available languages as used for the instance
+// DESCRIPTION:
+// The same list is available for a course at
+// /courses/{course_id}/email_templates. 'customized' tells whether the
+// translation has been changed at this level.
+func (rs *EmailTemplateResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	overrides, err := rs.Stores.EmailTemplate.GetAll(templateCourseID(r))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	list := []render.Renderer{}
+	for _, name := range email.Templates.Names() {
+		languages := email.Templates.Languages(name)
+		for _, override := range overrides {
+			if override.Name == name && email.Templates.Builtin(name, override.Language) == nil {
+				languages = append(languages, override.Language)
+			}
+		}
+
+		for _, language := range languages {
+			t, customized, err := rs.effectiveTemplate(r, name, language)
+			if err != nil {
+				render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+				return
+			}
+			list = append(list, newEmailTemplateResponse(t, language, customized))
+		}
+	}
+
+	// render JSON reponse
+	if err := render.RenderList(w, r, list); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// GetHandler is public endpoint for
+// URL: /email_templates/{template_name}/{language}
+// URLPARAM: template_name,string
+// URLPARAM: language,string
+// METHOD: get
+// TAG: email
+// RESPONSE: 200,EmailTemplateResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  the translation of an email used for recipients of a language
+// DESCRIPTION:
+// Without a translation into the language, the one of the default language
+// "en" is returned. The same is available for a course at
+// /courses/{course_id}/email_templates/{template_name}/{language}.
+func (rs *EmailTemplateResource) GetHandler(w http.ResponseWriter, r *http.Request) {
+	language := chi.URLParam(r, "language")
+
+	t, customized, err := rs.effectiveTemplate(r, chi.URLParam(r, "template_name"), language)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err := render.Render(w, r, newEmailTemplateResponse(t, language, customized)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// EditHandler is public endpoint for
+// URL: /email_templates/{template_name}/{language}
+// URLPARAM: template_name,string
+// URLPARAM: language,string
+// METHOD: put
+// TAG: email
+// REQUEST: EmailTemplateRequest
+// RESPONSE: 200,EmailTemplateResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  customize the translation of an email
+// DESCRIPTION:
+// Subject and text are text templates, html is an optional HTML template.
+// Placeholders like {{.first_name}} are those of the built-in translations.
+// For a course use /courses/{course_id}/email_templates/{template_name}/{language}.
+func (rs *EmailTemplateResource) EditHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "template_name")
+	language := chi.URLParam(r, "language")
+	courseID := templateCourseID(r)
+
+	data := &EmailTemplateRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	t := &email.Template{Name: name, Language: language, Subject: data.Subject, Text: data.Text, HTML: data.HTML}
+	if err := t.Validate(); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	p, err := rs.Stores.EmailTemplate.Find(courseID, name, language)
+	switch {
+	case err == sql.ErrNoRows:
+		p = &model.EmailTemplate{Name: name, Language: language}
+		if courseID != 0 {
+			p.CourseID = null.IntFrom(courseID)
+		}
+		p.Subject, p.TextBody, p.HTMLBody = data.Subject, data.Text, data.HTML
+		_, err = rs.Stores.EmailTemplate.Create(p)
+	case err == nil:
+		p.Subject, p.TextBody, p.HTMLBody = data.Subject, data.Text, data.HTML
+		err = rs.Stores.EmailTemplate.Update(p)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err := render.Render(w, r, newEmailTemplateResponse(t, language, true)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// DeleteHandler is public endpoint for
+// URL: /email_templates/{template_name}/{language}
+// URLPARAM: template_name,string
+// URLPARAM: language,string
+// METHOD: delete
+// TAG: email
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  restore the translation of an email
+// DESCRIPTION:
+// The translation of the instance (for a course) or the built-in one is used
+// again. For a course use
+// /courses/{course_id}/email_templates/{template_name}/{language}.
+func (rs *EmailTemplateResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := rs.Stores.EmailTemplate.Find(templateCourseID(r), chi.URLParam(r, "template_name"), chi.URLParam(r, "language"))
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := rs.Stores.EmailTemplate.Delete(p.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// PreviewHandler is public endpoint for
+// URL: /email_templates/{template_name}/{language}/preview
+// URLPARAM: template_name,string
+// URLPARAM: language,string
+// METHOD: get
+// TAG: email
+// RESPONSE: 200,EmailPreviewResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  render the translation of an email with sample data
+// DESCRIPTION:
+// For a course use
+// /courses/{course_id}/email_templates/{template_name}/{language}/preview.
+func (rs *EmailTemplateResource) PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "template_name")
+
+	t, _, err := rs.effectiveTemplate(r, name, chi.URLParam(r, "language"))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	subject, text, html, err := t.Render(email.Templates.Sample(name))
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err := render.Render(w, r, &EmailPreviewResponse{Subject: subject, Text: text, HTML: html}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// .............................................................................
+
+// Context middleware checks the URL parameters `template_name` and `language`
+// passed through as the request. In case the email is not registered or the
+// language is no two-letter code, we stop here and return a 404.
+func (rs *EmailTemplateResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !email.Templates.Has(chi.URLParam(r, "template_name")) {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		if !languagePattern.MatchString(chi.URLParam(r, "language")) {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		next.ServeHTTP(w, r)
+	})
+}
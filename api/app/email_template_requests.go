@@ -0,0 +1,49 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// EmailTemplateRequest is the request payload for a customized translation of
+// an email.
+type EmailTemplateRequest struct {
+	Subject string `json:"subject" example:"[{{.course_name}}] Welcome"`
+	Text    string `json:"text" example:"Hi {{.first_name}}, ..."`
+	// optional HTML variant
+	HTML string `json:"html" example:"<p>Hi {{.first_name}}, ...</p>"`
+}
+
+// Bind preprocesses a EmailTemplateRequest.
+func (body *EmailTemplateRequest) Bind(r *http.Request) error {
+
+	if body == nil {
+		return errors.New("missing \"email_template\" data")
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Subject, validation.Required),
+		validation.Field(&body.Text, validation.Required),
+	)
+}
@@ -0,0 +1,73 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+
+	"github.com/infomark-org/infomark/email"
+)
+
+// EmailTemplateResponse is the response payload for the translation of an
+// email.
+type EmailTemplateResponse struct {
+	Name string `json:"name" example:"confirm_email"`
+	// the requested language
+	Language string `json:"language" example:"de"`
+	// the language of the translation, the default language if there is no
+	// translation into the requested one
+	TemplateLanguage string `json:"template_language" example:"de"`
+	Subject          string `json:"subject" example:"Bestätigung Ihres Kontos"`
+	Text             string `json:"text" example:"Hallo {{.first_name}} {{.last_name}}! ..."`
+	HTML             string `json:"html" example:""`
+	// changed at the level of the request (instance or course)
+	Customized bool `json:"customized" example:"false"`
+}
+
+// Render post-processes a EmailTemplateResponse.
+func (body *EmailTemplateResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newEmailTemplateResponse creates a response from an email template.
+func newEmailTemplateResponse(t *email.Template, language string, customized bool) *EmailTemplateResponse {
+	return &EmailTemplateResponse{
+		Name:             t.Name,
+		Language:         language,
+		TemplateLanguage: t.Language,
+		Subject:          t.Subject,
+		Text:             t.Text,
+		HTML:             t.HTML,
+		Customized:       customized,
+	}
+}
+
+// EmailPreviewResponse is the response payload for an email rendered with
+// sample data.
+type EmailPreviewResponse struct {
+	Subject string `json:"subject" example:"Bestätigung Ihres Kontos"`
+	Text    string `json:"text" example:"Hallo Max Mustermann! ..."`
+	HTML    string `json:"html" example:""`
+}
+
+// Render post-processes a EmailPreviewResponse.
+func (body *EmailPreviewResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,174 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+)
+
+func TestEmailTemplate(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	rootJWT := tape.NewJWTRequest(1, true)
+	adminJWT := tape.NewJWTRequest(1, false)
+	tutorJWT := tape.NewJWTRequest(2, false)
+
+	getTemplate := func(url string) *EmailTemplateResponse {
+		w := tape.Get(url, rootJWT)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		templateActual := &EmailTemplateResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(templateActual)).Equal(nil)
+		return templateActual
+	}
+
+	g.Describe("EmailTemplate", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Instance templates should require root", func() {
+			w := tape.Get("/api/v1/email_templates", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/email_templates", rootJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			templatesActual := []EmailTemplateResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&templatesActual)).Equal(nil)
+			g.Assert(len(templatesActual) > 0).IsTrue()
+		})
+
+		g.It("Course templates should require permission to edit the course", func() {
+			w := tape.Get("/api/v1/courses/1/email_templates", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/courses/1/email_templates", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should return the translation of a language", func() {
+			templateActual := getTemplate("/api/v1/email_templates/confirm_email/de")
+			g.Assert(templateActual.TemplateLanguage).Equal("de")
+			g.Assert(templateActual.Customized).IsFalse()
+
+			// falls back to the default language
+			templateActual = getTemplate("/api/v1/email_templates/confirm_email/fr")
+			g.Assert(templateActual.Language).Equal("fr")
+			g.Assert(templateActual.TemplateLanguage).Equal("en")
+
+			w := tape.Get("/api/v1/email_templates/unknown/en", rootJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+			w = tape.Get("/api/v1/email_templates/confirm_email/english", rootJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should customize templates of the instance and a course", func() {
+			w := tape.Put("/api/v1/email_templates/new_login/de", H{
+				"subject": "Neue Anmeldung bei InfoMark",
+				"text":    "Hallo {{.first_name}}!",
+				"html":    "<p>Hallo {{.first_name}}!</p>",
+			}, rootJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			templateActual := getTemplate("/api/v1/email_templates/new_login/de")
+			g.Assert(templateActual.Subject).Equal("Neue Anmeldung bei InfoMark")
+			g.Assert(templateActual.Customized).IsTrue()
+
+			// courses inherit the template of the instance
+			templateActual = getTemplate("/api/v1/courses/1/email_templates/new_login/de")
+			g.Assert(templateActual.Subject).Equal("Neue Anmeldung bei InfoMark")
+			g.Assert(templateActual.Customized).IsFalse()
+
+			w = tape.Put("/api/v1/courses/1/email_templates/new_login/de", H{
+				"subject": "Neue Anmeldung in Info2",
+				"text":    "Hallo {{.first_name}}!",
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			templateActual = getTemplate("/api/v1/courses/1/email_templates/new_login/de")
+			g.Assert(templateActual.Subject).Equal("Neue Anmeldung in Info2")
+			g.Assert(templateActual.Customized).IsTrue()
+
+			templateActual = getTemplate("/api/v1/courses/2/email_templates/new_login/de")
+			g.Assert(templateActual.Subject).Equal("Neue Anmeldung bei InfoMark")
+
+			w = tape.Delete("/api/v1/email_templates/new_login/de", rootJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			templateActual = getTemplate("/api/v1/email_templates/new_login/de")
+			g.Assert(templateActual.Subject).Equal(email.Templates.Builtin(email.NewLoginTemplate, "de").Subject)
+
+			w = tape.Delete("/api/v1/email_templates/new_login/de", rootJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.It("Should reject invalid templates", func() {
+			w := tape.Put("/api/v1/email_templates/new_login/de", H{
+				"subject": "Neue Anmeldung",
+				"text":    "Hallo {{.first_name",
+			}, rootJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Put("/api/v1/email_templates/new_login/de", H{
+				"text": "Hallo",
+			}, rootJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should preview templates with sample data", func() {
+			w := tape.Get("/api/v1/email_templates/confirm_email/de/preview", rootJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			previewActual := &EmailPreviewResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(previewActual)).Equal(nil)
+			g.Assert(previewActual.Subject).Equal("Bestätigung Ihres Kontos")
+			g.Assert(previewActual.Text[:len("Hallo Max Mustermann!")]).Equal("Hallo Max Mustermann!")
+		})
+
+		g.It("Should send emails in the language of the recipient", func() {
+			user, err := stores.User.Get(112)
+			g.Assert(err).Equal(nil)
+			user.Language = "de"
+
+			msg, err := NewTemplatedEmail(stores, 0, email.NewLoginTemplate, user, map[string]string{"first_name": "Max"})
+			g.Assert(err).Equal(nil)
+			g.Assert(msg.To).Equal(user.Email)
+			g.Assert(msg.Subject).Equal("Neue Anmeldung bei Ihrem Konto")
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+	})
+
+}
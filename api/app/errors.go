@@ -83,6 +83,17 @@ func ErrTimeoutWithDetails(err error) *ErrResponse {
 	}
 }
 
+// ErrUnauthenticatedWithDetails returns status 401 with a text
+// e.g. "two-factor code required"
+func ErrUnauthenticatedWithDetails(err error) *ErrResponse {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnauthorized,
+		StatusText:     http.StatusText(http.StatusUnauthorized),
+		ErrorText:      err.Error(),
+	}
+}
+
 // ErrUnauthorizedWithDetails returns status 403 with a text
 // e.g. "User doesn't have enough privilege"
 func ErrUnauthorizedWithDetails(err error) *ErrResponse {
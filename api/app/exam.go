@@ -375,6 +375,10 @@ func (rs *ExamResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "exam", exam.ID, exam, func() (interface{}, error) {
+			return rs.Stores.Exam.Get(exam.ID)
+		})
+
 		// serve next
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyExam, exam)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -59,10 +59,25 @@ func NewGradeResource(stores *Stores) *GradeResource {
 // RESPONSE: 401,Unauthenticated
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  edit a grade
+// DESCRIPTION:
+// Members allowed to edit only the grades of their own groups get a 403 for
+// all other grades.
 func (rs *GradeResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
 
 	currentGrade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
+
+	if !authorize.HasCoursePermission(authorize.PermissionGradesEdit, r) {
+		tutored, err := rs.Stores.Grade.TutoredBy(currentGrade.ID, accessClaims.LoginID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if !tutored {
+			render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("the grade does not belong to one of your groups")))
+			return
+		}
+	}
 	data := &GradeRequest{}
 	// parse JSON request into struct
 	if err := render.Bind(r, data); err != nil {
@@ -132,65 +147,7 @@ func (rs *GradeResource) GetByIDHandler(w http.ResponseWriter, r *http.Request)
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  update information for grade from background worker
 func (rs *GradeResource) PublicResultEditHandler(w http.ResponseWriter, r *http.Request) {
-
-	data := &GradeFromWorkerRequest{}
-	// parse JSON request into struct
-	if err := render.Bind(r, data); err != nil {
-		render.Render(w, r, ErrBadRequestWithDetails(err))
-		return
-	}
-
-	currentGrade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
-
-	submission, err := rs.Stores.Submission.Get(currentGrade.SubmissionID)
-	if err != nil {
-		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-		return
-	}
-
-	if data.Status != symbol.TestingResultSuccess {
-		totalDockerFailExitCounterVec.WithLabelValues(
-			fmt.Sprintf("%d", submission.TaskID),
-			"public",
-		).Inc()
-
-	} else {
-		totalDockerSuccessExitCounterVec.WithLabelValues(
-			fmt.Sprintf("%d", submission.TaskID),
-			"public",
-		).Inc()
-	}
-
-	totalTime := data.FinishedAt.Sub(data.EnqueuedAt)
-	runTime := data.FinishedAt.Sub(data.StartedAt)
-	waitTime := data.StartedAt.Sub(data.EnqueuedAt)
-
-	totalDockerTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"public",
-	).Observe(totalTime.Seconds())
-
-	totalDockerRunTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"public",
-	).Observe(runTime.Seconds())
-
-	totalDockerWaitTimeHist.WithLabelValues(
-		fmt.Sprintf("%d", submission.TaskID),
-		"public",
-	).Observe(waitTime.Seconds())
-	// currentGrade.PublicTestLog = data.Log
-	// currentGrade.PublicTestStatus = data.Status
-	// currentGrade.PublicExecutionState = 2
-
-	render.Status(r, http.StatusNoContent)
-
-	// update database entry
-	if err := rs.Stores.Grade.UpdatePublicTestInfo(currentGrade.ID, data.Log, data.Status); err != nil {
-		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-		return
-	}
-
+	rs.resultEdit(w, r, "public")
 }
 
 // PrivateResultEditHandler is public endpoint for
@@ -206,7 +163,11 @@ func (rs *GradeResource) PublicResultEditHandler(w http.ResponseWriter, r *http.
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  update information for grade from background worker
 func (rs *GradeResource) PrivateResultEditHandler(w http.ResponseWriter, r *http.Request) {
+	rs.resultEdit(w, r, "private")
+}
 
+// resultEdit stores the result of the public or private tests of a grade.
+func (rs *GradeResource) resultEdit(w http.ResponseWriter, r *http.Request, visibility string) {
 	data := &GradeFromWorkerRequest{}
 	// parse JSON request into struct
 	if err := render.Bind(r, data); err != nil {
@@ -215,23 +176,36 @@ func (rs *GradeResource) PrivateResultEditHandler(w http.ResponseWriter, r *http
 	}
 
 	currentGrade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
+	batchID := helper.Int64FromURL(r, "test_batch_id", 0)
 
-	submission, err := rs.Stores.Submission.Get(currentGrade.SubmissionID)
-	if err != nil {
+	if err := applyTestResult(rs.Stores, currentGrade, visibility, batchID, data); err != nil {
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
 
+	render.Status(r, http.StatusNoContent)
+}
+
+// applyTestResult stores the result of the public or private tests of a grade,
+// which a worker has sent.
+func applyTestResult(stores *Stores, grade *model.Grade, visibility string, batchID int64, data *GradeFromWorkerRequest) error {
+	submission, err := stores.Submission.Get(grade.SubmissionID)
+	if err != nil {
+		return err
+	}
+
 	if data.Status != symbol.TestingResultSuccess {
 		totalDockerFailExitCounterVec.WithLabelValues(
 			fmt.Sprintf("%d", submission.TaskID),
-			"private",
+			visibility,
+			workerLabel(data.Worker),
 		).Inc()
 
 	} else {
 		totalDockerSuccessExitCounterVec.WithLabelValues(
 			fmt.Sprintf("%d", submission.TaskID),
-			"private",
+			visibility,
+			workerLabel(data.Worker),
 		).Inc()
 	}
 
@@ -241,35 +215,33 @@ func (rs *GradeResource) PrivateResultEditHandler(w http.ResponseWriter, r *http
 
 	totalDockerTimeHist.WithLabelValues(
 		fmt.Sprintf("%d", submission.TaskID),
-		"private",
+		visibility,
+		workerLabel(data.Worker),
 	).Observe(totalTime.Seconds())
 
 	totalDockerRunTimeHist.WithLabelValues(
 		fmt.Sprintf("%d", submission.TaskID),
-		"private",
+		visibility,
+		workerLabel(data.Worker),
 	).Observe(runTime.Seconds())
 
 	totalDockerWaitTimeHist.WithLabelValues(
 		fmt.Sprintf("%d", submission.TaskID),
-		"private",
+		visibility,
+		workerLabel(data.Worker),
 	).Observe(waitTime.Seconds())
 
-	// currentGrade.PrivateTestLog = data.Log
-	// currentGrade.PrivateTestStatus = data.Status
-	// currentGrade.PrivateExecutionState = 2
-
-	// fmt.Println(currentGrade.ID)
-	// fmt.Println(currentGrade.PrivateTestLog)
-	// fmt.Println(currentGrade.PrivateTestStatus)
-
-	render.Status(r, http.StatusNoContent)
-
 	// update database entry
-	if err := rs.Stores.Grade.UpdatePrivateTestInfo(currentGrade.ID, data.Log, data.Status); err != nil {
-		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-		return
+	if visibility == "public" {
+		err = stores.Grade.UpdatePublicTestInfo(grade.ID, data.Log, data.Status)
+	} else {
+		err = stores.Grade.UpdatePrivateTestInfo(grade.ID, data.Log, data.Status)
+	}
+	if err != nil {
+		return err
 	}
 
+	return finishTestBatchRun(stores, batchID, grade.ID, visibility, data.Status)
 }
 
 // IndexHandler is public endpoint for
@@ -444,6 +416,10 @@ func (rs *GradeResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "grade", grade.ID, grade, func() (interface{}, error) {
+			return rs.Stores.Grade.Get(grade.ID)
+		})
+
 		// serve next
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyGrade, grade)
 
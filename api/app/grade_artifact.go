@@ -0,0 +1,487 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// ArtifactsForStudentsDirectory is the directory within /data/output whose
+// files are visible to students. All other files are only visible to tutors.
+const ArtifactsForStudentsDirectory = "student/"
+
+// GradeArtifactResource specifies handler for the files produced by the
+// unit tests of a grade.
+type GradeArtifactResource struct {
+	Stores *Stores
+}
+
+// NewGradeArtifactResource create and returns a GradeArtifactResource.
+func NewGradeArtifactResource(stores *Stores) *GradeArtifactResource {
+	return &GradeArtifactResource{
+		Stores: stores,
+	}
+}
+
+// gradeArtifactsRoute is the route of the artifacts of a grade.
+func gradeArtifactsRoute(courseID int64, gradeID int64) string {
+	return fmt.Sprintf("/api/v1/courses/%d/grades/%d/artifacts", courseID, gradeID)
+}
+
+// IndexHandler is public endpoint for
+// URL: /courses/{course_id}/grades/{grade_id}/artifacts
+// URLPARAM: course_id,integer
+// URLPARAM: grade_id,integer
+// METHOD: get
+// TAG: grades
+// RESPONSE: 200,GradeArtifactResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list all files the unit tests have produced for a grade
+func (rs *GradeArtifactResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	grade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	artifacts, err := rs.Stores.Artifact.ArtifactsOfGrade(grade.ID, false)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err = render.RenderList(w, r, newGradeArtifactListResponse(artifacts, gradeArtifactsRoute(course.ID, grade.ID))); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// GetHandler is public endpoint for
+// URL: /courses/{course_id}/grades/{grade_id}/artifacts/{artifact_id}
+// URLPARAM: course_id,integer
+// URLPARAM: grade_id,integer
+// URLPARAM: artifact_id,integer
+// METHOD: get
+// TAG: grades
+// RESPONSE: 200,GradeArtifactResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get a file the unit tests have produced
+func (rs *GradeArtifactResource) GetHandler(w http.ResponseWriter, r *http.Request) {
+	artifact := r.Context().Value(symbol.CtxKeyArtifact).(*model.GradeArtifact)
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	// render JSON reponse
+	if err := render.Render(w, r, newGradeArtifactResponse(artifact, gradeArtifactsRoute(course.ID, artifact.GradeID))); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// EditHandler is public endpoint for
+// URL: /courses/{course_id}/grades/{grade_id}/artifacts/{artifact_id}
+// URLPARAM: course_id,integer
+// URLPARAM: grade_id,integer
+// URLPARAM: artifact_id,integer
+// METHOD: put
+// TAG: grades
+// REQUEST: GradeArtifactRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  change whether students can download a file the unit tests have produced
+// DESCRIPTION:
+// Members allowed to edit only the grades of their own groups get a 403 for
+// the files of all other grades.
+func (rs *GradeArtifactResource) EditHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	artifact := r.Context().Value(symbol.CtxKeyArtifact).(*model.GradeArtifact)
+
+	if !authorize.HasCoursePermission(authorize.PermissionGradesEdit, r) {
+		tutored, err := rs.Stores.Grade.TutoredBy(artifact.GradeID, accessClaims.LoginID)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if !tutored {
+			render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("the grade does not belong to one of your groups")))
+			return
+		}
+	}
+
+	data := &GradeArtifactRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	artifact.VisibleToStudents = data.VisibleToStudents
+
+	if err := rs.Stores.Artifact.Update(artifact); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// GetFileHandler is public endpoint for
+// URL: /courses/{course_id}/grades/{grade_id}/artifacts/{artifact_id}/file
+// URLPARAM: course_id,integer
+// URLPARAM: grade_id,integer
+// URLPARAM: artifact_id,integer
+// METHOD: get
+// TAG: grades
+// RESPONSE: 200,File
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  download a file the unit tests have produced
+func (rs *GradeArtifactResource) GetFileHandler(w http.ResponseWriter, r *http.Request) {
+	artifact := r.Context().Value(symbol.CtxKeyArtifact).(*model.GradeArtifact)
+	writeArtifactFile(w, r, artifact)
+}
+
+// PublicUploadHandler is public endpoint for
+// URL: /courses/{course_id}/grades/{grade_id}/public_artifacts
+// URLPARAM: course_id,integer
+// URLPARAM: grade_id,integer
+// METHOD: post
+// TAG: internal
+// REQUEST: Zipfile
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  upload the files the public unit tests have produced
+// DESCRIPTION:
+// The zip archive contains all files the tests have written to /data/output.
+// They replace the files of the previous run. Files within the directory
+// "student" are visible to students.
+func (rs *GradeArtifactResource) PublicUploadHandler(w http.ResponseWriter, r *http.Request) {
+	rs.upload(w, r, "public")
+}
+
+// PrivateUploadHandler is public endpoint for
+// URL: /courses/{course_id}/grades/{grade_id}/private_artifacts
+// URLPARAM: course_id,integer
+// URLPARAM: grade_id,integer
+// METHOD: post
+// TAG: internal
+// REQUEST: Zipfile
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  upload the files the private unit tests have produced
+// DESCRIPTION:
+// The zip archive contains all files the tests have written to /data/output.
+// They replace the files of the previous run. Like the private test log,
+// these files are only visible to tutors.
+func (rs *GradeArtifactResource) PrivateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	rs.upload(w, r, "private")
+}
+
+// upload stores the files of a zip archive as artifacts of the grade.
+func (rs *GradeArtifactResource) upload(w http.ResponseWriter, r *http.Request, visibility string) {
+	grade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
+
+	maxBytes := int64(configuration.Configuration.Server.HTTP.Limits.MaxArtifacts)
+	if maxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	file, header, err := r.FormFile("file_data")
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+	defer file.Close()
+
+	archive, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	entries, err := artifactEntries(archive, maxBytes)
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	if err := replaceArtifacts(rs.Stores, grade.ID, visibility, entries); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// replaceArtifacts stores the files of an archive as the artifacts of a
+// grade. The files of the previous run are outdated.
+func replaceArtifacts(stores *Stores, gradeID int64, visibility string, entries []*zip.File) error {
+	previous, err := stores.Artifact.ArtifactsOfGrade(gradeID, false)
+	if err != nil {
+		return err
+	}
+
+	for _, artifact := range previous {
+		if artifact.Visibility != visibility {
+			continue
+		}
+		if err := stores.Artifact.Delete(artifact.ID); err != nil {
+			return err
+		}
+		helper.NewGradeArtifactFileHandle(artifact.ID).Delete()
+	}
+
+	for _, entry := range entries {
+		name := path.Clean(entry.Name)
+
+		artifact, err := stores.Artifact.Create(&model.GradeArtifact{
+			GradeID:           gradeID,
+			Visibility:        visibility,
+			Name:              name,
+			Size:              int64(entry.UncompressedSize64),
+			VisibleToStudents: visibility == "public" && strings.HasPrefix(name, ArtifactsForStudentsDirectory),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := writeArtifactEntry(entry, artifact); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// artifactEntries returns the files within an uploaded archive. The archive
+// is rejected if it contains paths outside of the output directory or if
+// the unpacked files exceed the limit.
+func artifactEntries(archive *zip.Reader, maxBytes int64) ([]*zip.File, error) {
+	entries := []*zip.File{}
+	total := uint64(0)
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || entry.UncompressedSize64 == 0 {
+			continue
+		}
+
+		name := path.Clean(entry.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("artifact %s is outside of the output directory", entry.Name)
+		}
+
+		total += entry.UncompressedSize64
+		if maxBytes > 0 && total > uint64(maxBytes) {
+			return nil, fmt.Errorf("artifacts exceed the limit of %d bytes", maxBytes)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// writeArtifactEntry unpacks a single file of the archive to the location of
+// the artifact.
+func writeArtifactEntry(entry *zip.File, artifact *model.GradeArtifact) error {
+	in, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return helper.NewGradeArtifactFileHandle(artifact.ID).WriteFromReader(in, "")
+}
+
+// writeArtifactFile sends an artifact as download.
+func writeArtifactFile(w http.ResponseWriter, r *http.Request, artifact *model.GradeArtifact) {
+	hnd := helper.NewGradeArtifactFileHandle(artifact.ID)
+	if !hnd.Exists() {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := hnd.WriteToBodyWithName(path.Base(artifact.Name), w); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+	}
+}
+
+// IndexOwnHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/artifacts
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,GradeArtifactResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list the files the unit tests have produced for the submission of the request identity
+// DESCRIPTION:
+// Only files which are visible to students are listed.
+func (rs *GradeArtifactResource) IndexOwnHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	grade, ok := rs.ownGrade(w, r)
+	if !ok {
+		return
+	}
+
+	artifacts, err := rs.Stores.Artifact.ArtifactsOfGrade(grade.ID, true)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	route := fmt.Sprintf("/api/v1/courses/%d/tasks/%d/artifacts", course.ID, task.ID)
+
+	// render JSON reponse
+	if err = render.RenderList(w, r, newGradeArtifactListResponse(artifacts, route)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// GetOwnFileHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/artifacts/{artifact_id}/file
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// URLPARAM: artifact_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,File
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  download a file the unit tests have produced for the submission of the request identity
+func (rs *GradeArtifactResource) GetOwnFileHandler(w http.ResponseWriter, r *http.Request) {
+	grade, ok := rs.ownGrade(w, r)
+	if !ok {
+		return
+	}
+
+	artifactID, err := strconv.ParseInt(chi.URLParam(r, "artifact_id"), 10, 64)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	artifact, err := rs.Stores.Artifact.Get(artifactID)
+	if err != nil || artifact.GradeID != grade.ID || !artifact.VisibleToStudents {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	writeArtifactFile(w, r, artifact)
+}
+
+// ownGrade finds the grade of the submission of a student for the task in
+// the context. It renders the error itself.
+func (rs *GradeArtifactResource) ownGrade(w http.ResponseWriter, r *http.Request) (*model.Grade, bool) {
+	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
+	if givenRole != authorize.STUDENT {
+		render.Render(w, r, ErrBadRequest)
+		return nil, false
+	}
+
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	submission, err := rs.Stores.Submission.GetByUserAndTask(accessClaims.LoginID, task.ID)
+	if err != nil {
+		render.Render(w, r, ErrNotFound)
+		return nil, false
+	}
+
+	grade, err := rs.Stores.Grade.GetForSubmission(submission.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return nil, false
+	}
+
+	return grade, true
+}
+
+// .............................................................................
+
+// Context middleware is used to load an artifact object from
+// the URL parameter `artifact_id` passed through as the request. In case
+// the artifact could not be found or belongs to another grade, we stop here
+// and return a 404.
+func (rs *GradeArtifactResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grade := r.Context().Value(symbol.CtxKeyGrade).(*model.Grade)
+
+		var artifactID int64
+		var err error
+
+		// try to get id from URL
+		if artifactID, err = strconv.ParseInt(chi.URLParam(r, "artifact_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// find specific artifact in database
+		artifact, err := rs.Stores.Artifact.Get(artifactID)
+		if err != nil || artifact.GradeID != grade.ID {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyArtifact, artifact)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,39 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+)
+
+// GradeArtifactRequest is the request payload for changing the visibility
+// of an artifact.
+type GradeArtifactRequest struct {
+	VisibleToStudents bool `json:"visible_to_students" example:"true"`
+}
+
+// Bind preprocesses a GradeArtifactRequest.
+func (body *GradeArtifactRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"artifact\" data")
+	}
+	return nil
+}
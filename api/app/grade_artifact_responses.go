@@ -0,0 +1,71 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+)
+
+// GradeArtifactResponse is the response payload for a file produced by unit
+// tests.
+type GradeArtifactResponse struct {
+	ID                int64     `json:"id" example:"7"`
+	GradeID           int64     `json:"grade_id" example:"31"`
+	Visibility        string    `json:"visibility" example:"public"`
+	Name              string    `json:"name" example:"student/coverage.html"`
+	Size              int64     `json:"size" example:"4096"`
+	VisibleToStudents bool      `json:"visible_to_students" example:"true"`
+	FileURL           string    `json:"file_url" example:"/api/v1/courses/1/grades/31/artifacts/7/file"`
+	CreatedAt         time.Time `json:"created_at" example:"auto"`
+}
+
+// Render post-processes a GradeArtifactResponse.
+func (body *GradeArtifactResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newGradeArtifactResponse creates a response from a GradeArtifact model.
+// Tutors and students download artifacts from different routes.
+func newGradeArtifactResponse(p *model.GradeArtifact, routePrefix string) *GradeArtifactResponse {
+	return &GradeArtifactResponse{
+		ID:                p.ID,
+		GradeID:           p.GradeID,
+		Visibility:        p.Visibility,
+		Name:              p.Name,
+		Size:              p.Size,
+		VisibleToStudents: p.VisibleToStudents,
+		FileURL:           fmt.Sprintf("%s/%d/file", routePrefix, p.ID),
+		CreatedAt:         p.CreatedAt,
+	}
+}
+
+// newGradeArtifactListResponse creates a response from a list of GradeArtifact models.
+func newGradeArtifactListResponse(artifacts []model.GradeArtifact, routePrefix string) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range artifacts {
+		list = append(list, newGradeArtifactResponse(&artifacts[k], routePrefix))
+	}
+	return list
+}
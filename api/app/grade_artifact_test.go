@@ -0,0 +1,242 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+// createArtifactsArchive writes a zip archive with the given files and returns
+// its path.
+func createArtifactsArchive(files map[string]string) (string, error) {
+	out, err := ioutil.TempFile("", "artifacts-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	archive := zip.NewWriter(out)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			return "", err
+		}
+	}
+	return out.Name(), archive.Close()
+}
+
+func TestGradeArtifact(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+	var grade *model.Grade
+
+	studentJWT := tape.NewJWTRequest(112, false)
+	tutorJWT := tape.NewJWTRequest(2, false)
+	noAdminJWT := tape.NewJWTRequest(1, false)
+
+	upload := func(visibility string, files map[string]string) int {
+		filename, err := createArtifactsArchive(files)
+		g.Assert(err).Equal(nil)
+		defer os.Remove(filename)
+
+		url := fmt.Sprintf("/api/v1/courses/1/grades/%d/%s_artifacts", grade.ID, visibility)
+		w, err := tape.Upload(url, filename, "application/zip", noAdminJWT)
+		g.Assert(err).Equal(nil)
+		return w.Code
+	}
+
+	listArtifacts := func(url string, modifier JWTRequest) []GradeArtifactResponse {
+		w := tape.Get(url, modifier)
+		g.Assert(w.Code).Equal(http.StatusOK)
+
+		artifacts := []GradeArtifactResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(&artifacts)).Equal(nil)
+		return artifacts
+	}
+
+	g.Describe("GradeArtifact", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+
+			submission, err := stores.Submission.GetByUserAndTask(112, 1)
+			g.Assert(err).Equal(nil)
+			grade, err = stores.Grade.GetForSubmission(submission.ID)
+			g.Assert(err).Equal(nil)
+		})
+
+		g.It("Uploads should require a job token or root", func() {
+			filename, err := createArtifactsArchive(map[string]string{"report.xml": "<testsuite/>"})
+			g.Assert(err).Equal(nil)
+			defer os.Remove(filename)
+
+			url := fmt.Sprintf("/api/v1/courses/1/grades/%d/public_artifacts", grade.ID)
+
+			w, err := tape.Upload(url, filename, "application/zip", studentJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w, err = tape.Upload(url, filename, "application/zip", tutorJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w, err = tape.Upload(url, filename, "application/zip", tape.NewJobJWTRequest("POST "+url))
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should store artifacts and replace those of the previous run", func() {
+			g.Assert(upload("public", map[string]string{
+				"junit.xml":           "<testsuite/>",
+				"student/plot.svg":    "<svg/>",
+				"coverage/index.html": "<html/>",
+			})).Equal(http.StatusOK)
+			g.Assert(upload("private", map[string]string{
+				"student/hidden.txt": "private tests are hidden",
+			})).Equal(http.StatusOK)
+
+			url := fmt.Sprintf("/api/v1/courses/1/grades/%d/artifacts", grade.ID)
+			artifacts := listArtifacts(url, tutorJWT)
+			g.Assert(len(artifacts)).Equal(4)
+
+			visible := map[string]bool{}
+			for _, artifact := range artifacts {
+				visible[artifact.Visibility+":"+artifact.Name] = artifact.VisibleToStudents
+			}
+			g.Assert(visible["public:student/plot.svg"]).IsTrue()
+			g.Assert(visible["public:junit.xml"]).IsFalse()
+			g.Assert(visible["public:coverage/index.html"]).IsFalse()
+			g.Assert(visible["private:student/hidden.txt"]).IsFalse()
+
+			// a new run replaces the artifacts of the same tests only
+			g.Assert(upload("public", map[string]string{
+				"junit.xml": "<testsuite tests=\"2\"/>",
+			})).Equal(http.StatusOK)
+
+			artifacts = listArtifacts(url, tutorJWT)
+			g.Assert(len(artifacts)).Equal(2)
+
+			w := tape.Get(url, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should reject artifacts outside of the output directory", func() {
+			g.Assert(upload("public", map[string]string{
+				"../../etc/passwd": "root",
+			})).Equal(http.StatusBadRequest)
+
+			artifacts, err := stores.Artifact.ArtifactsOfGrade(grade.ID, false)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(artifacts)).Equal(0)
+		})
+
+		g.It("Tutors should download artifacts and change their visibility", func() {
+			g.Assert(upload("public", map[string]string{
+				"junit.xml": "<testsuite/>",
+			})).Equal(http.StatusOK)
+
+			url := fmt.Sprintf("/api/v1/courses/1/grades/%d/artifacts", grade.ID)
+			artifacts := listArtifacts(url, tutorJWT)
+			g.Assert(len(artifacts)).Equal(1)
+
+			artifactURL := fmt.Sprintf("%s/%d", url, artifacts[0].ID)
+
+			w := tape.Get(artifactURL+"/file", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Body.String()).Equal("<testsuite/>")
+
+			// students only see visible artifacts of their own submission
+			ownURL := "/api/v1/courses/1/tasks/1/artifacts"
+			g.Assert(len(listArtifacts(ownURL, studentJWT))).Equal(0)
+
+			w = tape.Get(fmt.Sprintf("%s/%d/file", ownURL, artifacts[0].ID), studentJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			w = tape.Put(artifactURL, H{"visible_to_students": true}, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Put(artifactURL, H{"visible_to_students": true}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			own := listArtifacts(ownURL, studentJWT)
+			g.Assert(len(own)).Equal(1)
+			g.Assert(own[0].FileURL).Equal(fmt.Sprintf("%s/%d/file", ownURL, artifacts[0].ID))
+
+			w = tape.Get(own[0].FileURL, studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(w.Body.String()).Equal("<testsuite/>")
+		})
+
+		g.It("Should store artifacts received over the result queue", func() {
+			resultURL := fmt.Sprintf("/api/v1/courses/1/grades/%d/public_result", grade.ID)
+			artifactsURL := fmt.Sprintf("/api/v1/courses/1/grades/%d/public_artifacts", grade.ID)
+			jobToken, err := tape.TokenAuth.CreateJobJWT(authenticate.NewJobClaims("POST "+resultURL, "POST "+artifactsURL))
+			g.Assert(err).Equal(nil)
+
+			filename, err := createArtifactsArchive(map[string]string{"student/plot.svg": "<svg/>"})
+			g.Assert(err).Equal(nil)
+			defer os.Remove(filename)
+
+			archive, err := ioutil.ReadFile(filename)
+			g.Assert(err).Equal(nil)
+
+			body, err := json.Marshal(&shared.SubmissionAMQPWorkerResult{
+				AccessToken:          jobToken,
+				ResultEndpointURL:    "http://localhost" + resultURL,
+				ArtifactsEndpointURL: "http://localhost" + artifactsURL,
+				Artifacts:            archive,
+				Log:                  "some queued logs",
+			})
+			g.Assert(err).Equal(nil)
+			g.Assert(NewWorkerResultHandler(stores).Handle(body)).Equal(nil)
+
+			artifacts, err := stores.Artifact.ArtifactsOfGrade(grade.ID, true)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(artifacts)).Equal(1)
+			g.Assert(artifacts[0].Name).Equal("student/plot.svg")
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+	})
+
+}
@@ -67,6 +67,7 @@ type GradeFromWorkerRequest struct {
 	EnqueuedAt time.Time            `json:"enqueued_at"`
 	StartedAt  time.Time            `json:"started_at"`
 	FinishedAt time.Time            `json:"finished_at"`
+	Worker     string               `json:"worker" example:"worker-1"`
 }
 
 // Bind preprocesses a GradeRequest.
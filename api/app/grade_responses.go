@@ -276,7 +276,7 @@ func newGradeOverviewResponse(collection []model.OverviewGrade, sheets []model.S
 			// other student
 			if entry.UserID != oldUser.ID {
 
-				if role == authorize.TUTOR {
+				if role != authorize.ADMIN {
 					oldUser.StudentNumber = ""
 				}
 
@@ -299,6 +299,9 @@ func newGradeOverviewResponse(collection []model.OverviewGrade, sheets []model.S
 
 		// add the last student
 		if len(collection) > 0 {
+			if role != authorize.ADMIN {
+				oldUser.StudentNumber = ""
+			}
 			obj.Achievements = append(obj.Achievements, AchievementInfo{oldUser, currentPoints})
 		}
 	}
@@ -30,9 +30,12 @@ import (
 
 	"github.com/franela/goblin"
 	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
 
 	null "gopkg.in/guregu/null.v3"
 )
@@ -388,6 +391,67 @@ func TestGrade(t *testing.T) {
 			}
 		})
 
+		g.It("Should accept job tokens only for the resources of the job", func() {
+			url := "/api/v1/courses/1/grades/1/public_result"
+			jobJWT := tape.NewJobJWTRequest("POST " + url)
+
+			data := H{
+				"log":    "some job logs",
+				"status": 0,
+			}
+
+			w := tape.Post(url, data, jobJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			entryAfter, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.PublicTestLog).Equal("some job logs")
+
+			// other endpoints reject the token
+			w = tape.Post("/api/v1/courses/1/grades/1/private_result", data, jobJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/grades/2/public_result", data, jobJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/courses/1/grades/1", jobJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/me", jobJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should apply worker results received over the result queue", func() {
+			url := "/api/v1/courses/1/grades/1/private_result"
+			jobToken, err := tape.TokenAuth.CreateJobJWT(authenticate.NewJobClaims("POST " + url))
+			g.Assert(err).Equal(nil)
+
+			body, err := json.Marshal(&shared.SubmissionAMQPWorkerResult{
+				AccessToken:       jobToken,
+				ResultEndpointURL: "http://localhost" + url,
+				Log:               "some queued logs",
+				Status:            symbol.TestingResultFailed,
+			})
+			g.Assert(err).Equal(nil)
+
+			handler := NewWorkerResultHandler(stores)
+			g.Assert(handler.Handle(body)).Equal(nil)
+
+			entryAfter, err := stores.Grade.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(entryAfter.PrivateTestLog).Equal("some queued logs")
+			g.Assert(entryAfter.PrivateTestStatus).Equal(int(symbol.TestingResultFailed))
+
+			// results for other grades are rejected
+			body, err = json.Marshal(&shared.SubmissionAMQPWorkerResult{
+				AccessToken:       jobToken,
+				ResultEndpointURL: "http://localhost/api/v1/courses/1/grades/2/private_result",
+				Log:               "some queued logs",
+			})
+			g.Assert(err).Equal(nil)
+			g.Assert(handler.Handle(body) != nil).IsTrue()
+		})
+
 		g.It("Should handle feedback from public tests", func() {
 
 			url := "/api/v1/courses/1/grades/1/public_result"
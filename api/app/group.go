@@ -497,7 +497,10 @@ func (rs *GroupResource) SendEmailHandler(w http.ResponseWriter, r *http.Request
 		data.Body,
 		accessUser,
 	)
-	email.OutgoingEmailsChannel <- msgOwn
+	if err := EnqueueEmail(rs.Stores, msgOwn); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
 
 	for _, recipient := range recipients {
 		msg := email.NewEmailFromUser(
@@ -508,7 +511,10 @@ func (rs *GroupResource) SendEmailHandler(w http.ResponseWriter, r *http.Request
 			accessUser,
 		)
 
-		email.OutgoingEmailsChannel <- msg
+		if err := EnqueueEmail(rs.Stores, msg); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
 	}
 
 }
@@ -539,6 +545,10 @@ func (rs *GroupResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "group", group.ID, group, func() (interface{}, error) {
+			return rs.Stores.Group.Get(group.ID)
+		})
+
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyGroup, group)
 
 		// when there is a groupID in the url, there is NOT a courseID in the url,
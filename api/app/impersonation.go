@@ -0,0 +1,281 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// ImpersonationResource specifies handler for root admins acting as other
+// users.
+type ImpersonationResource struct {
+	Stores      *Stores
+	TokenAuth   *authenticate.TokenAuth
+	SessionAuth *scs.Manager
+}
+
+// NewImpersonationResource create and returns a ImpersonationResource.
+func NewImpersonationResource(stores *Stores, tokenAuth *authenticate.TokenAuth, sessionAuth *scs.Manager) *ImpersonationResource {
+	return &ImpersonationResource{
+		Stores:      stores,
+		TokenAuth:   tokenAuth,
+		SessionAuth: sessionAuth,
+	}
+}
+
+// impersonationDuration returns how long an impersonation asked for the given
+// number of minutes lasts. Without minutes or beyond the configured maximum it
+// lasts as long as allowed.
+func impersonationDuration(minutes int) time.Duration {
+	maxDuration := configuration.Configuration.Server.Authentication.Impersonation.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = time.Hour
+	}
+
+	duration := time.Duration(minutes) * time.Minute
+	if duration <= 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+	return duration
+}
+
+// StartHandler is public endpoint for
+// URL: /users/{user_id}/impersonation
+// URLPARAM: user_id,integer
+// METHOD: post
+// TAG: users
+// REQUEST: ImpersonationRequest
+// RESPONSE: 201,ImpersonationResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  act as the user for a limited time (requires root)
+// DESCRIPTION:
+// The impersonation is bound to the session of the root admin. Requests using
+// a cookie continue as the user right away, otherwise the response contains
+// an access token for the user. Every request made as the user is logged and
+// changes to the account of the user are refused.
+func (rs *ImpersonationResource) StartHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+
+	if !accessClaims.Root || accessClaims.ImpersonationID != 0 {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	if user.Root || user.ID == accessClaims.LoginID {
+		render.Render(w, r, ErrUnauthorizedWithDetails(errors.New("root admins cannot be impersonated")))
+		return
+	}
+
+	data := &ImpersonationRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	impersonation, err := rs.Stores.Impersonation.Create(&model.Impersonation{
+		RootID:    accessClaims.LoginID,
+		UserID:    user.ID,
+		Reason:    data.Reason,
+		ExpiresAt: time.Now().Add(impersonationDuration(data.Minutes)),
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	userClaims := &authenticate.AccessClaims{
+		LoginID:         user.ID,
+		Root:            false,
+		SessionID:       accessClaims.SessionID,
+		ImpersonationID: impersonation.ID,
+	}
+
+	resp := newImpersonationResponse(impersonation)
+
+	if authenticate.HasHeaderToken(r) {
+		resp.AccessToken, err = rs.TokenAuth.CreateAccessJWT(*userClaims)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	} else {
+		w = userClaims.WriteToSession(rs.SessionAuth, w, r)
+	}
+
+	render.Status(r, http.StatusCreated)
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// StopHandler is public endpoint for
+// URL: /auth/impersonation
+// METHOD: delete
+// TAG: auth
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  stop acting as another user
+// DESCRIPTION:
+// Requests using a cookie continue as the root admin afterwards. Access tokens
+// of the impersonation are no longer accepted.
+func (rs *ImpersonationResource) StopHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if accessClaims.ImpersonationID == 0 {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("there is no impersonation to stop")))
+		return
+	}
+
+	impersonation, err := rs.Stores.Impersonation.Get(accessClaims.ImpersonationID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := rs.Stores.Impersonation.Stop(impersonation.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if !authenticate.HasHeaderToken(r) {
+		rootClaims := &authenticate.AccessClaims{
+			LoginID:   impersonation.RootID,
+			Root:      true,
+			SessionID: accessClaims.SessionID,
+		}
+		w = rootClaims.WriteToSession(rs.SessionAuth, w, r)
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// IndexHandler is public endpoint for
+// URL: /impersonations
+// QUERYPARAM: limit,integer
+// METHOD: get
+// TAG: users
+// RESPONSE: 200,ImpersonationResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  recent impersonations (requires root)
+// DESCRIPTION:
+// At most 'limit' (default 100) impersonations are returned, the latest first.
+func (rs *ImpersonationResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	impersonations, err := rs.Stores.Impersonation.Recent(helper.IntFromURL(r, "limit", 100))
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newImpersonationListResponse(impersonations)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RequestsHandler is public endpoint for
+// URL: /impersonations/{impersonation_id}/requests
+// URLPARAM: impersonation_id,integer
+// METHOD: get
+// TAG: users
+// RESPONSE: 200,ImpersonationRequestResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  all requests made during an impersonation (requires root)
+func (rs *ImpersonationResource) RequestsHandler(w http.ResponseWriter, r *http.Request) {
+	impersonation := r.Context().Value(symbol.CtxKeyImpersonation).(*model.Impersonation)
+
+	requests, err := rs.Stores.Impersonation.RequestsOf(impersonation.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newImpersonationRequestListResponse(requests)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// .............................................................................
+
+// Context middleware is used to load an impersonation from the URL parameter
+// `impersonationID` passed through as the request. In case the impersonation
+// could not be found, we stop here and return a 404. Only root admins see
+// impersonations.
+func (rs *ImpersonationResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+		if !accessClaims.Root {
+			render.Render(w, r, ErrUnauthorized)
+			return
+		}
+
+		var impersonationID int64
+		var err error
+
+		// try to get id from URL
+		if impersonationID, err = strconv.ParseInt(chi.URLParam(r, "impersonation_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// find specific impersonation in database
+		impersonation, err := rs.Stores.Impersonation.Get(impersonationID)
+		if err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyImpersonation, impersonation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,51 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// ImpersonationRequest is the request payload to act as another user.
+type ImpersonationRequest struct {
+	// why the admin needs to act as the user, kept in the audit trail
+	Reason string `json:"reason" example:"user reports a missing submission"`
+	// how long the impersonation lasts, at most the configured maximum
+	Minutes int `json:"minutes" example:"15"`
+}
+
+// Bind preprocesses a ImpersonationRequest.
+func (body *ImpersonationRequest) Bind(r *http.Request) error {
+
+	if body == nil {
+		return errors.New("missing \"reason\" data")
+	}
+
+	body.Reason = strings.TrimSpace(body.Reason)
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Reason, validation.Required),
+		validation.Field(&body.Minutes, validation.Min(0)),
+	)
+}
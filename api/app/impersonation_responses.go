@@ -0,0 +1,107 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// ImpersonationResponse is the response payload for an impersonation.
+type ImpersonationResponse struct {
+	ID        int64     `json:"id" example:"3"`
+	RootID    int64     `json:"root_id" example:"1"`
+	UserID    int64     `json:"user_id" example:"112"`
+	Reason    string    `json:"reason" example:"user reports a missing submission"`
+	ExpiresAt time.Time `json:"expires_at" example:"auto"`
+	StoppedAt null.Time `json:"stopped_at" example:"auto"`
+	CreatedAt time.Time `json:"created_at" example:"auto"`
+	// only when the impersonation was started with an access token
+	AccessToken string `json:"access_token,omitempty" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// Render post-processes a ImpersonationResponse.
+func (body *ImpersonationResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newImpersonationResponse creates a response from a Impersonation model.
+func newImpersonationResponse(p *model.Impersonation) *ImpersonationResponse {
+	return &ImpersonationResponse{
+		ID:        p.ID,
+		RootID:    p.RootID,
+		UserID:    p.UserID,
+		Reason:    p.Reason,
+		ExpiresAt: p.ExpiresAt,
+		StoppedAt: p.StoppedAt,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// newImpersonationListResponse creates a response from a list of
+// Impersonation models.
+func newImpersonationListResponse(impersonations []model.Impersonation) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range impersonations {
+		list = append(list, newImpersonationResponse(&impersonations[k]))
+	}
+	return list
+}
+
+// ImpersonationRequestResponse is the response payload for a request made
+// during an impersonation.
+type ImpersonationRequestResponse struct {
+	ID        int64     `json:"id" example:"41"`
+	Method    string    `json:"method" example:"GET"`
+	Path      string    `json:"path" example:"/api/v1/courses"`
+	Status    int       `json:"status" example:"200"`
+	CreatedAt time.Time `json:"created_at" example:"auto"`
+}
+
+// Render post-processes a ImpersonationRequestResponse.
+func (body *ImpersonationRequestResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newImpersonationRequestResponse creates a response from a
+// ImpersonationRequest model.
+func newImpersonationRequestResponse(p *model.ImpersonationRequest) *ImpersonationRequestResponse {
+	return &ImpersonationRequestResponse{
+		ID:        p.ID,
+		Method:    p.Method,
+		Path:      p.Path,
+		Status:    p.Status,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// newImpersonationRequestListResponse creates a response from a list of
+// ImpersonationRequest models.
+func newImpersonationRequestListResponse(requests []model.ImpersonationRequest) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range requests {
+		list = append(list, newImpersonationRequestResponse(&requests[k]))
+	}
+	return list
+}
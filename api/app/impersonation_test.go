@@ -0,0 +1,165 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+	otape "github.com/infomark-org/infomark/tape"
+)
+
+func TestImpersonation(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var w *httptest.ResponseRecorder
+	var stores *Stores
+
+	// cookieLogin logs in the root user 1 and returns the session cookies
+	cookieLogin := func() cookieRequest {
+		w := tape.Post("/api/v1/auth/sessions", H{
+			"email":          "test@uni-tuebingen.de",
+			"plain_password": "test",
+		})
+		g.Assert(w.Code).Equal(http.StatusOK)
+		return responseCookies(w)
+	}
+
+	whoAmI := func(modifier otape.RequestModifier) int64 {
+		w := tape.Get("/api/v1/me", modifier)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		me := &UserResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(me)).Equal(nil)
+		return me.ID
+	}
+
+	start := func(modifier otape.RequestModifier) (*ImpersonationResponse, *httptest.ResponseRecorder) {
+		w := tape.Post("/api/v1/users/112/impersonation", H{"reason": "missing submission", "minutes": 10}, modifier)
+		g.Assert(w.Code).Equal(http.StatusCreated)
+		resp := &ImpersonationResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(resp)).Equal(nil)
+		return resp, w
+	}
+
+	g.Describe("Impersonation", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+			resetLoginLimit()
+		})
+
+		g.It("Should be started by root only", func() {
+			w = tape.Post("/api/v1/users/112/impersonation", H{"reason": "test"}, tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/users/112/impersonation", H{}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/users/1/impersonation", H{"reason": "test"}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			list, err := stores.Impersonation.Recent(10)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(list)).Equal(0)
+		})
+
+		g.It("Should act as the user with a cookie and switch back", func() {
+			cookies := cookieLogin()
+
+			resp, w := start(cookies)
+			g.Assert(resp.UserID).Equal(int64(112))
+			g.Assert(resp.RootID).Equal(int64(1))
+			g.Assert(resp.AccessToken).Equal("")
+
+			cookies = responseCookies(w)
+			g.Assert(whoAmI(cookies)).Equal(int64(112))
+
+			// the account of the user cannot be changed
+			w = tape.Patch("/api/v1/account", H{"email": "hijacked@uni-tuebingen.de"}, cookies)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Delete("/api/v1/auth/impersonation", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			cookies = responseCookies(w)
+			g.Assert(whoAmI(cookies)).Equal(int64(1))
+
+			// every request as the user is in the audit trail
+			url := fmt.Sprintf("/api/v1/impersonations/%d/requests", resp.ID)
+			w = tape.Get(url, cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			requests := []ImpersonationRequestResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&requests)).Equal(nil)
+			g.Assert(len(requests)).Equal(3)
+			g.Assert(requests[0].Method).Equal("GET")
+			g.Assert(requests[0].Path).Equal("/api/v1/me")
+			g.Assert(requests[1].Status).Equal(http.StatusForbidden)
+			g.Assert(requests[2].Path).Equal("/api/v1/auth/impersonation")
+
+			w = tape.Get(url, tape.NewJWTRequest(112, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should hand out an access token which stops working", func() {
+			resp, _ := start(tape.NewJWTRequest(1, true))
+			g.Assert(resp.AccessToken != "").Equal(true)
+
+			token := bearerRequest(resp.AccessToken)
+			g.Assert(whoAmI(token)).Equal(int64(112))
+
+			// an impersonation cannot be nested
+			w = tape.Post("/api/v1/users/2/impersonation", H{"reason": "test"}, token)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Delete("/api/v1/auth/impersonation", token)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/me", token)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			list, err := stores.Impersonation.Recent(10)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(list)).Equal(1)
+			g.Assert(list[0].StoppedAt.Valid).Equal(true)
+		})
+
+		g.It("Should expire", func() {
+			resp, _ := start(tape.NewJWTRequest(1, true))
+			token := bearerRequest(resp.AccessToken)
+			g.Assert(whoAmI(token)).Equal(int64(112))
+
+			_, err := tape.DB.Exec("UPDATE impersonations SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1", resp.ID)
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/me", token)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.AfterEach(tape.AfterEach)
+	})
+}
@@ -0,0 +1,172 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+var errAccountLocked = errors.New("account is locked after too many failed logins, try again later")
+
+// lockoutDuration is the lockout after a number of failed logins in a row. It
+// doubles with every further failed login. Zero means no lockout.
+func lockoutDuration(failures int) time.Duration {
+	config := configuration.Configuration.Server.Authentication.Lockout
+	if config.MaxFailedLogins <= 0 || failures < config.MaxFailedLogins {
+		return 0
+	}
+
+	duration := config.Duration
+	for k := config.MaxFailedLogins; k < failures && duration < config.MaxDuration; k++ {
+		duration *= 2
+	}
+	if config.MaxDuration > 0 && duration > config.MaxDuration {
+		duration = config.MaxDuration
+	}
+	return duration
+}
+
+// accountLocked tells whether the account of an email address is locked right
+// now. Logins to locked accounts are rejected before checking the password.
+func accountLocked(stores *Stores, emailAddress string) (bool, error) {
+	user, err := stores.User.FindByEmail(emailAddress)
+	if err != nil {
+		// there is nothing to lock
+		return false, nil
+	}
+
+	lockout, err := stores.Lockout.Get(user.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return lockout.LockedUntil.Valid && lockout.LockedUntil.Time.After(NowUTC()), nil
+}
+
+// newAuthEvent describes an event caused by a request.
+func newAuthEvent(r *http.Request, kind string, emailAddress string, userID null.Int) *model.AuthEvent {
+	return &model.AuthEvent{
+		UserID:    userID,
+		Email:     emailAddress,
+		Kind:      kind,
+		IP:        authenticate.NewLoginLimiterKeyFromIP(r).Key(),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// recordFailedLogin logs a failed login and locks the account after too many
+// failed logins in a row. The owner gets an email about the lockout.
+func recordFailedLogin(stores *Stores, r *http.Request, emailAddress string) error {
+	user, err := stores.User.FindByEmail(emailAddress)
+	if err != nil {
+		// somebody guesses email addresses
+		return stores.AuthEvent.Create(newAuthEvent(r, model.AuthEventLoginFailed, emailAddress, null.Int{}))
+	}
+
+	event := newAuthEvent(r, model.AuthEventLoginFailed, user.Email, null.IntFrom(user.ID))
+	if err := stores.AuthEvent.Create(event); err != nil {
+		return err
+	}
+
+	failures, err := stores.Lockout.CountFailure(user.ID)
+	if err != nil {
+		return err
+	}
+
+	duration := lockoutDuration(failures)
+	if duration == 0 {
+		return nil
+	}
+
+	lockedUntil := NowUTC().Add(duration)
+	if err := stores.Lockout.Lock(user.ID, lockedUntil); err != nil {
+		return err
+	}
+	if err := stores.AuthEvent.Create(newAuthEvent(r, model.AuthEventLocked, user.Email, null.IntFrom(user.ID))); err != nil {
+		return err
+	}
+
+	msg, err := NewTemplatedEmail(stores, 0,
+		email.AccountLockedTemplate,
+		user,
+		map[string]string{
+			"first_name":    user.FirstName,
+			"last_name":     user.LastName,
+			"failed_logins": strconv.Itoa(failures),
+			"ip":            event.IP,
+			"user_agent":    event.UserAgent,
+			"locked_until":  lockedUntil.Format(time.RFC1123),
+		})
+	if err != nil {
+		return err
+	}
+	return EnqueueEmail(stores, msg)
+}
+
+// recordLogin logs a successful login and forgets previous failed logins. The
+// owner gets an email if the IP address or the browser is new.
+func recordLogin(stores *Stores, r *http.Request, user *model.User) error {
+	if err := stores.Lockout.Unlock(user.ID); err != nil {
+		return err
+	}
+
+	event := newAuthEvent(r, model.AuthEventLogin, user.Email, null.IntFrom(user.ID))
+
+	known, anyLogin, err := stores.AuthEvent.KnownDevice(user.ID, event.IP, event.UserAgent)
+	if err != nil {
+		return err
+	}
+
+	if err := stores.AuthEvent.Create(event); err != nil {
+		return err
+	}
+
+	// the very first login is not an anomaly
+	if known || !anyLogin {
+		return nil
+	}
+
+	msg, err := NewTemplatedEmail(stores, 0,
+		email.NewLoginTemplate,
+		user,
+		map[string]string{
+			"first_name": user.FirstName,
+			"last_name":  user.LastName,
+			"ip":         event.IP,
+			"user_agent": event.UserAgent,
+			"time":       NowUTC().Format(time.RFC1123),
+		})
+	if err != nil {
+		return err
+	}
+	return EnqueueEmail(stores, msg)
+}
@@ -0,0 +1,164 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+// userAgentRequest sends a request from a specific browser.
+type userAgentRequest string
+
+func (t userAgentRequest) Modify(r *http.Request) {
+	r.Header.Set("User-Agent", string(t))
+}
+
+// queuedEmails returns the emails in the outgoing queue, the latest first.
+func queuedEmails(tape *Tape) []model.OutgoingEmail {
+	emails, err := NewStores(tape.DB).OutgoingEmail.GetFiltered("", 100, 0)
+	if err != nil {
+		panic(err)
+	}
+	return emails
+}
+
+func TestLockout(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var w *httptest.ResponseRecorder
+	var queued int
+
+	login := func(password string, modifiers ...userAgentRequest) *httptest.ResponseRecorder {
+		r := H{
+			"email":          "test@uni-tuebingen.de",
+			"plain_password": password,
+		}
+		if len(modifiers) > 0 {
+			return tape.Post("/api/v1/auth/sessions", r, modifiers[0])
+		}
+		return tape.Post("/api/v1/auth/sessions", r)
+	}
+
+	g.Describe("Lockout", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			resetLoginLimit()
+			queued = len(queuedEmails(tape))
+
+			config := &configuration.Configuration.Server.Authentication.Lockout
+			config.MaxFailedLogins = 3
+			config.Duration = time.Minute
+			config.MaxDuration = 10 * time.Minute
+		})
+
+		g.It("Should double the lockout up to the maximum", func() {
+			g.Assert(lockoutDuration(2)).Equal(time.Duration(0))
+			g.Assert(lockoutDuration(3)).Equal(time.Minute)
+			g.Assert(lockoutDuration(4)).Equal(2 * time.Minute)
+			g.Assert(lockoutDuration(5)).Equal(4 * time.Minute)
+			g.Assert(lockoutDuration(8)).Equal(10 * time.Minute)
+
+			configuration.Configuration.Server.Authentication.Lockout.MaxFailedLogins = 0
+			g.Assert(lockoutDuration(100)).Equal(time.Duration(0))
+		})
+
+		g.It("Should lock an account after failed logins in a row", func() {
+			for i := 0; i < 3; i++ {
+				w = login("wrong")
+				g.Assert(w.Code).Equal(http.StatusBadRequest)
+			}
+
+			emails := queuedEmails(tape)
+			g.Assert(len(emails)).Equal(queued + 1)
+			msg := emails[0]
+			g.Assert(msg.Recipient).Equal("test@uni-tuebingen.de")
+			g.Assert(msg.Subject).Equal("Your account has been locked")
+
+			// even the correct password is rejected now
+			w = login("test")
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Delete("/api/v1/users/1/lockout", tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Delete("/api/v1/users/1/lockout", tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = login("test")
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should forget failed logins after a successful one", func() {
+			g.Assert(login("wrong").Code).Equal(http.StatusBadRequest)
+			g.Assert(login("wrong").Code).Equal(http.StatusBadRequest)
+			g.Assert(login("test").Code).Equal(http.StatusOK)
+			g.Assert(login("wrong").Code).Equal(http.StatusBadRequest)
+			g.Assert(login("wrong").Code).Equal(http.StatusBadRequest)
+			g.Assert(login("test").Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should list authentication events for root only", func() {
+			g.Assert(login("wrong").Code).Equal(http.StatusBadRequest)
+			g.Assert(login("test").Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/auth_events?user_id=1", tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/auth_events?user_id=1", tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			events := []AuthEventResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&events)).Equal(nil)
+			g.Assert(len(events)).Equal(2)
+			g.Assert(events[0].Kind).Equal(model.AuthEventLogin)
+			g.Assert(events[1].Kind).Equal(model.AuthEventLoginFailed)
+		})
+
+		g.It("Should send an email on a login from a new device", func() {
+			g.Assert(login("test", "Firefox").Code).Equal(http.StatusOK)
+			g.Assert(login("test", "Firefox").Code).Equal(http.StatusOK)
+			g.Assert(len(queuedEmails(tape))).Equal(queued)
+
+			g.Assert(login("test", "Chrome").Code).Equal(http.StatusOK)
+			emails := queuedEmails(tape)
+			g.Assert(len(emails)).Equal(queued + 1)
+			msg := emails[0]
+			g.Assert(msg.Subject).Equal("New login to your account")
+		})
+
+		g.AfterEach(func() {
+			configuration.Configuration.Server.Authentication.Lockout.MaxFailedLogins = 0
+			tape.AfterEach()
+		})
+	})
+}
@@ -334,6 +334,10 @@ func (rs *MaterialResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "material", material.ID, material, func() (interface{}, error) {
+			return rs.Stores.Material.Get(material.ID)
+		})
+
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyMaterial, material)
 
 		// when there is a sheetID in the url, there is NOT a courseID in the url,
@@ -0,0 +1,192 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// OutgoingEmailResource specifies handler for the queue of outgoing emails.
+type OutgoingEmailResource struct {
+	Stores *Stores
+}
+
+// NewOutgoingEmailResource create and returns a OutgoingEmailResource.
+func NewOutgoingEmailResource(stores *Stores) *OutgoingEmailResource {
+	return &OutgoingEmailResource{
+		Stores: stores,
+	}
+}
+
+// EnqueueEmail stores an email in the queue of outgoing emails before the
+// request finishes, such that a restart of the server cannot lose it.
+func EnqueueEmail(stores *Stores, msg *email.Email) error {
+	if _, err := email.Persist(stores.OutgoingEmail, msg); err != nil {
+		return err
+	}
+	if email.DefaultQueue != nil {
+		email.DefaultQueue.Wake()
+	}
+	return nil
+}
+
+// IndexHandler is public endpoint for
+// URL: /outgoing_emails
+// QUERYPARAM: status,string
+// QUERYPARAM: limit,integer
+// QUERYPARAM: offset,integer
+// METHOD: get
+// TAG: email
+// RESPONSE: 200,OutgoingEmailResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  emails within the queue of the mailer, the latest first
+// DESCRIPTION:
+// The status "pending", "sent" or "failed" restricts the list. Pending emails
+// wait for their first delivery or a retry, failed emails have been given up
+// after too many attempts. At most 'limit' (default 100) emails are returned.
+func (rs *OutgoingEmailResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	status := helper.StringFromURL(r, "status", "")
+	switch status {
+	case "", model.OutgoingEmailPending, model.OutgoingEmailSent, model.OutgoingEmailFailed:
+	default:
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("status must be one of pending, sent or failed")))
+		return
+	}
+
+	emails, err := rs.Stores.OutgoingEmail.GetFiltered(
+		status,
+		helper.IntFromURL(r, "limit", 100),
+		helper.IntFromURL(r, "offset", 0),
+	)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err = render.RenderList(w, r, newOutgoingEmailListResponse(emails)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// GetHandler is public endpoint for
+// URL: /outgoing_emails/{outgoing_email_id}
+// URLPARAM: outgoing_email_id,integer
+// METHOD: get
+// TAG: email
+// RESPONSE: 200,OutgoingEmailResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get an email of the queue including its body
+func (rs *OutgoingEmailResource) GetHandler(w http.ResponseWriter, r *http.Request) {
+	outgoing := r.Context().Value(symbol.CtxKeyOutgoingEmail).(*model.OutgoingEmail)
+
+	// render JSON reponse
+	if err := render.Render(w, r, newOutgoingEmailResponse(outgoing)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// ResendHandler is public endpoint for
+// URL: /outgoing_emails/{outgoing_email_id}/resend
+// URLPARAM: outgoing_email_id,integer
+// METHOD: post
+// TAG: email
+// RESPONSE: 200,OutgoingEmailResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  queue an email for an immediate delivery
+// DESCRIPTION:
+// The email becomes pending again with all attempts available, no matter
+// whether it has failed or has been sent already.
+func (rs *OutgoingEmailResource) ResendHandler(w http.ResponseWriter, r *http.Request) {
+	outgoing := r.Context().Value(symbol.CtxKeyOutgoingEmail).(*model.OutgoingEmail)
+
+	outgoing.Status = model.OutgoingEmailPending
+	outgoing.Attempts = 0
+	outgoing.NextAttemptAt = time.Now()
+
+	if err := rs.Stores.OutgoingEmail.Update(outgoing); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if email.DefaultQueue != nil {
+		email.DefaultQueue.Wake()
+	}
+
+	// render JSON reponse
+	if err := render.Render(w, r, newOutgoingEmailResponse(outgoing)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// .............................................................................
+
+// Context middleware is used to load an OutgoingEmail object from
+// the URL parameter `outgoing_email_id` passed through as the request. In case
+// the OutgoingEmail could not be found, we stop here and return a 404.
+func (rs *OutgoingEmailResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var emailID int64
+		var err error
+
+		// try to get id from URL
+		if emailID, err = strconv.ParseInt(chi.URLParam(r, "outgoing_email_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// find specific OutgoingEmail in database
+		outgoing, err := rs.Stores.OutgoingEmail.Get(emailID)
+		if err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyOutgoingEmail, outgoing)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,79 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// OutgoingEmailResponse is the response payload for an email of the queue.
+type OutgoingEmailResponse struct {
+	ID        int64  `json:"id" example:"412"`
+	Sender    string `json:"sender" example:"no-reply@sub.domain.com"`
+	Recipient string `json:"recipient" example:"max.mustermann@uni-tuebingen.de"`
+	Subject   string `json:"subject" example:"[Info2] New sheet"`
+	Body      string `json:"body" example:"Hi all, ..."`
+	HTMLBody  string `json:"html_body" example:""`
+	Status    string `json:"status" example:"failed"`
+	// failed deliveries so far
+	Attempts      int       `json:"attempts" example:"5"`
+	LastError     string    `json:"last_error" example:"dial tcp: connection refused"`
+	NextAttemptAt time.Time `json:"next_attempt_at" example:"auto"`
+	SentAt        null.Time `json:"sent_at" example:"null"`
+	CreatedAt     time.Time `json:"created_at" example:"auto"`
+}
+
+// Render post-processes a OutgoingEmailResponse.
+func (body *OutgoingEmailResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newOutgoingEmailResponse creates a response from a OutgoingEmail model.
+func newOutgoingEmailResponse(p *model.OutgoingEmail) *OutgoingEmailResponse {
+	return &OutgoingEmailResponse{
+		ID:            p.ID,
+		Sender:        p.Sender,
+		Recipient:     p.Recipient,
+		Subject:       p.Subject,
+		Body:          p.Body,
+		HTMLBody:      p.HTMLBody,
+		Status:        p.Status,
+		Attempts:      p.Attempts,
+		LastError:     p.LastError,
+		NextAttemptAt: p.NextAttemptAt,
+		SentAt:        p.SentAt,
+		CreatedAt:     p.CreatedAt,
+	}
+}
+
+// newOutgoingEmailListResponse creates a response from a list of
+// OutgoingEmail models.
+func newOutgoingEmailListResponse(emails []model.OutgoingEmail) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range emails {
+		list = append(list, newOutgoingEmailResponse(&emails[k]))
+	}
+	return list
+}
@@ -0,0 +1,147 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+func TestOutgoingEmail(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	tutorJWT := tape.NewJWTRequest(2, false)
+	adminJWT := tape.NewJWTRequest(1, true)
+
+	enqueue := func(recipient string, status string) *model.OutgoingEmail {
+		p, err := stores.OutgoingEmail.Create(&model.OutgoingEmail{
+			Sender:        "no-reply@info2.de",
+			Recipient:     recipient,
+			Subject:       "[Info2] New sheet",
+			Body:          "Hi all",
+			Status:        status,
+			NextAttemptAt: time.Now(),
+		})
+		g.Assert(err).Equal(nil)
+		return p
+	}
+
+	g.Describe("OutgoingEmail", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Query should require root", func() {
+			w := tape.Get("/api/v1/outgoing_emails")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/outgoing_emails", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/outgoing_emails", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should list emails by status", func() {
+			enqueue("a@uni-tuebingen.de", model.OutgoingEmailSent)
+			enqueue("b@uni-tuebingen.de", model.OutgoingEmailFailed)
+			enqueue("c@uni-tuebingen.de", model.OutgoingEmailPending)
+
+			w := tape.Get("/api/v1/outgoing_emails", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			emailsActual := []OutgoingEmailResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&emailsActual)).Equal(nil)
+			g.Assert(len(emailsActual)).Equal(3)
+			g.Assert(emailsActual[0].Recipient).Equal("c@uni-tuebingen.de")
+
+			w = tape.Get("/api/v1/outgoing_emails?status=failed", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			emailsActual = []OutgoingEmailResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(&emailsActual)).Equal(nil)
+			g.Assert(len(emailsActual)).Equal(1)
+			g.Assert(emailsActual[0].Recipient).Equal("b@uni-tuebingen.de")
+
+			w = tape.Get("/api/v1/outgoing_emails?status=lost", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should resend a failed email", func() {
+			p := enqueue("b@uni-tuebingen.de", model.OutgoingEmailFailed)
+			p.Attempts = 5
+			p.LastError = "connection refused"
+			g.Assert(stores.OutgoingEmail.Update(p)).Equal(nil)
+
+			w := tape.Post(fmt.Sprintf("/api/v1/outgoing_emails/%d/resend", p.ID), H{}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post(fmt.Sprintf("/api/v1/outgoing_emails/%d/resend", p.ID), H{}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			p, err := stores.OutgoingEmail.Get(p.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(p.Status).Equal(model.OutgoingEmailPending)
+			g.Assert(p.Attempts).Equal(0)
+
+			due, err := stores.OutgoingEmail.ClaimDue(time.Now().Add(time.Second), time.Now().Add(time.Hour), 10)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(due)).Equal(1)
+
+			// a claimed email is not handed out twice
+			claimed, err := stores.OutgoingEmail.ClaimDue(time.Now().Add(time.Second), time.Now().Add(time.Hour), 10)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(claimed)).Equal(0)
+
+			queue := email.NewQueue(stores.OutgoingEmail)
+			g.Assert(queue.Deliver(&due[0])).Equal(nil)
+
+			w = tape.Get(fmt.Sprintf("/api/v1/outgoing_emails/%d", p.ID), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			emailActual := &OutgoingEmailResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(emailActual)).Equal(nil)
+			g.Assert(emailActual.Status).Equal(model.OutgoingEmailSent)
+			g.Assert(emailActual.SentAt.Valid).IsTrue()
+		})
+
+		g.It("Should return 404 for unknown emails", func() {
+			w := tape.Get("/api/v1/outgoing_emails/4711", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+	})
+
+}
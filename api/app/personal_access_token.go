@@ -0,0 +1,207 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// PersonalAccessTokenResource specifies handler for the tokens users create
+// for their scripts.
+type PersonalAccessTokenResource struct {
+	Stores *Stores
+}
+
+// NewPersonalAccessTokenResource create and returns a PersonalAccessTokenResource.
+func NewPersonalAccessTokenResource(stores *Stores) *PersonalAccessTokenResource {
+	return &PersonalAccessTokenResource{
+		Stores: stores,
+	}
+}
+
+// authenticationTokens looks up personal access tokens for the
+// authentication. Tokens of users who still have to set up a second factor
+// are restricted like their logins.
+type authenticationTokens struct {
+	Stores *Stores
+}
+
+func (t *authenticationTokens) FindByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	token, err := t.Stores.Token.FindByHash(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	token.SetupTwoFactor, err = twoFactorSetupPending(t.Stores, &model.User{ID: token.UserID, Root: token.Root})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (t *authenticationTokens) Touch(tokenID int64) error {
+	return t.Stores.Token.Touch(tokenID)
+}
+
+// IndexHandler is public endpoint for
+// URL: /account/tokens
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,PersonalAccessTokenResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list the personal access tokens of the request identity
+func (rs *PersonalAccessTokenResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	tokens, err := rs.Stores.Token.TokensOfUser(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newPersonalAccessTokenListResponse(tokens)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CreateHandler is public endpoint for
+// URL: /account/tokens
+// METHOD: post
+// TAG: account
+// REQUEST: PersonalAccessTokenRequest
+// RESPONSE: 201,PersonalAccessTokenResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  create a personal access token
+// DESCRIPTION:
+// The token is only part of this response. Scripts send it as
+// "Authorization: Bearer <token>". Tokens limited to a course can only access
+// the routes below /courses/{course_id}.
+func (rs *PersonalAccessTokenResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &PersonalAccessTokenRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	if data.CourseID.Valid && !accessClaims.Root {
+		role, err := rs.Stores.Course.RoleInCourse(accessClaims.LoginID, data.CourseID.Int64)
+		if err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+		if role == authorize.NOCOURSEROLE {
+			render.Render(w, r, ErrBadRequestWithDetails(errors.New("you are not enrolled in this course")))
+			return
+		}
+	}
+
+	plainToken, tokenHash := authenticate.NewPersonalAccessToken()
+
+	token, err := rs.Stores.Token.Create(&model.PersonalAccessToken{
+		UserID:    accessClaims.LoginID,
+		Name:      data.Name,
+		TokenHash: tokenHash,
+		ReadOnly:  data.ReadOnly,
+		CourseID:  data.CourseID,
+		ExpiresAt: data.ExpiresAt,
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := newPersonalAccessTokenResponse(token)
+	resp.Token = plainToken
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteHandler is public endpoint for
+// URL: /account/tokens/{token_id}
+// URLPARAM: token_id,integer
+// METHOD: delete
+// TAG: account
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  revoke a personal access token
+func (rs *PersonalAccessTokenResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value(symbol.CtxKeyAccessToken).(*model.PersonalAccessToken)
+
+	if err := rs.Stores.Token.Delete(token.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// .............................................................................
+
+// Context middleware is used to load a token of the request identity from
+// the URL parameter `tokenID` passed through as the request. In case the
+// token could not be found, we stop here and return a 404.
+func (rs *PersonalAccessTokenResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+		var tokenID int64
+		var err error
+
+		// try to get id from URL
+		if tokenID, err = strconv.ParseInt(chi.URLParam(r, "token_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// users only see their own tokens
+		token, err := rs.Stores.Token.Get(tokenID)
+		if err != nil || token.UserID != accessClaims.LoginID {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyAccessToken, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,67 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// PersonalAccessTokenRequest is the request payload for creating a token.
+type PersonalAccessTokenRequest struct {
+	Name      string    `json:"name" example:"export grades"`
+	ExpiresAt time.Time `json:"expires_at" example:"auto"`
+	// only GET requests are allowed
+	ReadOnly bool `json:"read_only" example:"true"`
+	// only requests to this course are allowed
+	CourseID null.Int `json:"course_id" example:"1"`
+}
+
+// Bind preprocesses a PersonalAccessTokenRequest.
+func (body *PersonalAccessTokenRequest) Bind(r *http.Request) error {
+
+	if body == nil {
+		return errors.New("missing \"token\" data")
+	}
+
+	err := validation.ValidateStruct(body,
+		validation.Field(
+			&body.Name,
+			validation.Required,
+			validation.Length(1, 100),
+		),
+		validation.Field(
+			&body.ExpiresAt,
+			validation.Required,
+		),
+	)
+
+	if err == nil {
+		if !body.ExpiresAt.After(NowUTC()) {
+			return errors.New("expires_at should be in the future")
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,69 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// PersonalAccessTokenResponse is the response payload for a token. The
+// token itself is only part of the response to its creation.
+type PersonalAccessTokenResponse struct {
+	ID         int64     `json:"id" example:"3"`
+	Name       string    `json:"name" example:"export grades"`
+	Token      string    `json:"token,omitempty" example:"infomark_0f3c...9a1b"`
+	ReadOnly   bool      `json:"read_only" example:"true"`
+	CourseID   null.Int  `json:"course_id" example:"1"`
+	ExpiresAt  time.Time `json:"expires_at" example:"auto"`
+	LastUsedAt null.Time `json:"last_used_at" example:"auto"`
+	CreatedAt  time.Time `json:"created_at" example:"auto"`
+}
+
+// Render post-processes a PersonalAccessTokenResponse.
+func (body *PersonalAccessTokenResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newPersonalAccessTokenResponse creates a response from a PersonalAccessToken model.
+func newPersonalAccessTokenResponse(p *model.PersonalAccessToken) *PersonalAccessTokenResponse {
+	return &PersonalAccessTokenResponse{
+		ID:         p.ID,
+		Name:       p.Name,
+		ReadOnly:   p.ReadOnly,
+		CourseID:   p.CourseID,
+		ExpiresAt:  p.ExpiresAt,
+		LastUsedAt: p.LastUsedAt,
+		CreatedAt:  p.CreatedAt,
+	}
+}
+
+// newPersonalAccessTokenListResponse creates a response from a list of PersonalAccessToken models.
+func newPersonalAccessTokenListResponse(tokens []model.PersonalAccessToken) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range tokens {
+		list = append(list, newPersonalAccessTokenResponse(&tokens[k]))
+	}
+	return list
+}
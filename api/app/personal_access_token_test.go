@@ -0,0 +1,218 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+// bearerRequest sends a personal access token.
+type bearerRequest string
+
+func (t bearerRequest) Modify(r *http.Request) {
+	r.Header.Add("Authorization", "Bearer "+string(t))
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var w *httptest.ResponseRecorder
+	var stores *Stores
+
+	// createToken creates a token for the tutor with id 2
+	createToken := func(data H) *PersonalAccessTokenResponse {
+		data["name"] = "export grades"
+		if _, ok := data["expires_at"]; !ok {
+			data["expires_at"] = time.Now().Add(24 * time.Hour)
+		}
+		w := tape.Post("/api/v1/account/tokens", data, tape.NewJWTRequest(2, false))
+		g.Assert(w.Code).Equal(http.StatusCreated)
+
+		resp := &PersonalAccessTokenResponse{}
+		err := json.NewDecoder(w.Body).Decode(resp)
+		g.Assert(err).Equal(nil)
+		return resp
+	}
+
+	g.Describe("PersonalAccessToken", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Query should require access claims", func() {
+			w = tape.Get("/api/v1/account/tokens")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/account/tokens", tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should create a token and only show it once", func() {
+			created := createToken(H{"read_only": true})
+			g.Assert(created.Token[:len(authenticate.PersonalAccessTokenPrefix)]).Equal(authenticate.PersonalAccessTokenPrefix)
+			g.Assert(created.ReadOnly).Equal(true)
+			g.Assert(created.CourseID.Valid).Equal(false)
+
+			// only the hash is stored
+			token, err := stores.Token.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(token.TokenHash).Equal(authenticate.HashPersonalAccessToken(created.Token))
+
+			w = tape.Get("/api/v1/account/tokens", tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			list := []PersonalAccessTokenResponse{}
+			err = json.NewDecoder(w.Body).Decode(&list)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(list)).Equal(1)
+			g.Assert(list[0].ID).Equal(created.ID)
+			g.Assert(list[0].Token).Equal("")
+
+			// other users do not see the token
+			w = tape.Get("/api/v1/account/tokens", tape.NewJWTRequest(112, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			err = json.NewDecoder(w.Body).Decode(&list)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(list)).Equal(0)
+		})
+
+		g.It("Should validate new tokens", func() {
+			w = tape.Post("/api/v1/account/tokens", H{
+				"name":       "",
+				"expires_at": time.Now().Add(time.Hour),
+			}, tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/account/tokens", H{
+				"name":       "past",
+				"expires_at": time.Now().Add(-time.Hour),
+			}, tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/account/tokens", H{
+				"name":       "foreign course",
+				"expires_at": time.Now().Add(time.Hour),
+				"course_id":  9999,
+			}, tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should authenticate requests with a token", func() {
+			created := createToken(H{})
+
+			token, err := stores.Token.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(token.LastUsedAt.Valid).Equal(false)
+
+			w = tape.Get("/api/v1/me", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			me := &UserResponse{}
+			err = json.NewDecoder(w.Body).Decode(me)
+			g.Assert(err).Equal(nil)
+			g.Assert(me.ID).Equal(int64(2))
+
+			token, err = stores.Token.Get(created.ID)
+			g.Assert(err).Equal(nil)
+			g.Assert(token.LastUsedAt.Valid).Equal(true)
+
+			w = tape.Get("/api/v1/me", bearerRequest(created.Token+"x"))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should only allow reading with a read-only token", func() {
+			created := createToken(H{"read_only": true})
+
+			w = tape.Get("/api/v1/courses/1", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/account/tokens", H{
+				"name":       "escalation",
+				"expires_at": time.Now().Add(time.Hour),
+			}, bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should only allow the course of a course-limited token", func() {
+			created := createToken(H{"course_id": 1})
+			g.Assert(created.CourseID.Int64).Equal(int64(1))
+
+			w = tape.Get("/api/v1/courses/1", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/sheets", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/2", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/courses/10", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/me", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should reject expired tokens", func() {
+			plainToken, tokenHash := authenticate.NewPersonalAccessToken()
+			_, err := stores.Token.Create(&model.PersonalAccessToken{
+				UserID:    2,
+				Name:      "expired",
+				TokenHash: tokenHash,
+				ExpiresAt: time.Now().Add(-time.Minute),
+			})
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/me", bearerRequest(plainToken))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should revoke tokens", func() {
+			created := createToken(H{})
+
+			// only the owner can revoke a token
+			w = tape.Delete(fmt.Sprintf("/api/v1/account/tokens/%d", created.ID), tape.NewJWTRequest(112, false))
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			w = tape.Delete(fmt.Sprintf("/api/v1/account/tokens/%d", created.ID), tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/me", bearerRequest(created.Token))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+	})
+}
@@ -54,7 +54,7 @@ var (
 			Help:      "Total number of submissions where docker has unsuccessful exit status",
 		},
 		//
-		[]string{"task_id", "kind"},
+		[]string{"task_id", "kind", "worker"},
 	)
 
 	totalDockerSuccessExitCounterVec = prometheus.NewCounterVec(
@@ -65,7 +65,7 @@ var (
 			Help:      "Total number of submissions where docker has successful exit status",
 		},
 		//
-		[]string{"task_id", "kind"},
+		[]string{"task_id", "kind", "worker"},
 	)
 
 	totalDockerTimeHist = prometheus.NewHistogramVec(
@@ -76,7 +76,7 @@ var (
 			Help:      "Total time in seconds taken from received upload to finished docker run",
 		},
 		//
-		[]string{"task_id", "kind"},
+		[]string{"task_id", "kind", "worker"},
 	)
 
 	totalDockerRunTimeHist = prometheus.NewHistogramVec(
@@ -87,7 +87,7 @@ var (
 			Help:      "Total time in seconds taken spent inside docker when running tests",
 		},
 		//
-		[]string{"task_id", "kind"},
+		[]string{"task_id", "kind", "worker"},
 	)
 
 	totalDockerWaitTimeHist = prometheus.NewHistogramVec(
@@ -98,7 +98,29 @@ var (
 			Help:      "Total time waited between uploading and fetched from worker",
 		},
 		//
-		[]string{"task_id", "kind"},
+		[]string{"task_id", "kind", "worker"},
+	)
+
+	workerCapacityGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "worker",
+			Subsystem: "registry",
+			Name:      "capacity",
+			Help:      "Number of jobs a worker can run at the same time as reported by its last heartbeat",
+		},
+		//
+		[]string{"worker"},
+	)
+
+	workerRunningJobsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "worker",
+			Subsystem: "registry",
+			Name:      "running_jobs",
+			Help:      "Number of jobs a worker is running as reported by its last heartbeat",
+		},
+		//
+		[]string{"worker"},
 	)
 )
 
@@ -114,6 +136,8 @@ func InitPrometheus() {
 		prometheus.MustRegister(totalDockerTimeHist)
 		prometheus.MustRegister(totalDockerRunTimeHist)
 		prometheus.MustRegister(totalDockerWaitTimeHist)
+		prometheus.MustRegister(workerCapacityGauge)
+		prometheus.MustRegister(workerRunningJobsGauge)
 		prometheusIsRegistered = true
 	}
 }
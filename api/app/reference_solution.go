@@ -0,0 +1,103 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/service"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// EnqueueReferenceSolution puts the reference solution of a task into the
+// testing queue for the public and the private tests. This should be called
+// whenever a testing framework or a docker image of the task changes. Tests
+// without docker image or framework are marked as not available. Both runs
+// share the priority of private tests, such that students are served first.
+func EnqueueReferenceSolution(stores *Stores, tokenAuth *authenticate.TokenAuth, courseID int64, task *model.Task) error {
+	hnd := helper.NewReferenceSolutionFileHandle(task.ID)
+	if !hnd.Exists() {
+		return nil
+	}
+
+	sha256, err := hnd.Sha256()
+	if err != nil {
+		return err
+	}
+
+	runs := []struct {
+		visibility string
+		image      string
+		framework  *helper.FileHandle
+		available  bool
+		update     func(taskID int64, log string, state symbol.ReferenceState) error
+	}{
+		{
+			visibility: "public",
+			image:      task.PublicDockerImage.String,
+			framework:  helper.NewPublicTestFileHandle(task.ID),
+			available:  task.PublicDockerImage.Valid && helper.NewPublicTestFileHandle(task.ID).Exists(),
+			update:     stores.Task.UpdatePublicReferenceInfo,
+		},
+		{
+			visibility: "private",
+			image:      task.PrivateDockerImage.String,
+			framework:  helper.NewPrivateTestFileHandle(task.ID),
+			available:  task.PrivateDockerImage.Valid && helper.NewPrivateTestFileHandle(task.ID).Exists(),
+			update:     stores.Task.UpdatePrivateReferenceInfo,
+		},
+	}
+
+	for _, run := range runs {
+		if !run.available {
+			if err := run.update(task.ID, "no unit tests for this task are available", symbol.ReferenceStateNone); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := run.update(task.ID, "reference solution will be tested", symbol.ReferenceStatePending); err != nil {
+			return err
+		}
+
+		request := shared.NewReferenceAMQPWorkerRequest(
+			courseID, task.ID,
+			configuration.Configuration.Server.ExternalURL(), run.image, sha256, run.visibility)
+		request.LimitResources(task)
+
+		if err := PublishJob(DefaultSubmissionProducer, tokenAuth, request, hnd, run.framework, service.PrivatePriority); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// referenceStateFromWorker maps the result of a worker to the state of the
+// reference solution.
+func referenceStateFromWorker(status symbol.TestingResult) symbol.ReferenceState {
+	if status == symbol.TestingResultSuccess {
+		return symbol.ReferenceStatePassed
+	}
+	return symbol.ReferenceStateFailed
+}
@@ -0,0 +1,202 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// RoleResource specifies handler for the staff roles of a course.
+type RoleResource struct {
+	Stores *Stores
+}
+
+// NewRoleResource create and returns a RoleResource.
+func NewRoleResource(stores *Stores) *RoleResource {
+	return &RoleResource{
+		Stores: stores,
+	}
+}
+
+// IndexHandler is public endpoint for
+// URL: /courses/{course_id}/roles
+// URLPARAM: course_id,integer
+// METHOD: get
+// TAG: enrollments
+// RESPONSE: 200,RoleResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list the staff roles of a course
+func (rs *RoleResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	roles, err := rs.Stores.Role.RolesOfCourse(course.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newRoleListResponse(roles)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// CreateHandler is public endpoint for
+// URL: /courses/{course_id}/roles
+// URLPARAM: course_id,integer
+// METHOD: post
+// TAG: enrollments
+// REQUEST: RoleRequest
+// RESPONSE: 201,RoleResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  define a staff role as a set of permissions
+// DESCRIPTION:
+// Instead of listing the permissions, a role can start from one of the presets
+// "head_tutor", "grader" or "observer". Members of the role count as the
+// fixed course role 'base_role' (student or tutor, the default) wherever no
+// permission applies.
+func (rs *RoleResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+	data := &RoleRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	role, err := rs.Stores.Role.Create(&model.Role{
+		CourseID:    course.ID,
+		Name:        data.Name,
+		BaseRole:    *data.BaseRole,
+		Permissions: data.Permissions,
+	})
+	if err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+
+	if err := render.Render(w, r, newRoleResponse(role)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// EditHandler is public endpoint for
+// URL: /courses/{course_id}/roles/{role_id}
+// URLPARAM: course_id,integer
+// URLPARAM: role_id,integer
+// METHOD: put
+// TAG: enrollments
+// REQUEST: RoleRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  change the permissions of a staff role
+func (rs *RoleResource) EditHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.Context().Value(symbol.CtxKeyRole).(*model.Role)
+
+	data := &RoleRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	role.Name = data.Name
+	role.BaseRole = *data.BaseRole
+	role.Permissions = data.Permissions
+
+	if err := rs.Stores.Role.Update(role); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// DeleteHandler is public endpoint for
+// URL: /courses/{course_id}/roles/{role_id}
+// URLPARAM: course_id,integer
+// URLPARAM: role_id,integer
+// METHOD: delete
+// TAG: enrollments
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  delete a staff role, its members keep their base role
+func (rs *RoleResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.Context().Value(symbol.CtxKeyRole).(*model.Role)
+
+	if err := rs.Stores.Role.Delete(role.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// .............................................................................
+
+// Context middleware is used to load a role from the URL parameter `roleID`
+// passed through as the request. In case the role could not be found in the
+// course, we stop here and return a 404.
+func (rs *RoleResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+
+		var roleID int64
+		var err error
+
+		// try to get id from URL
+		if roleID, err = strconv.ParseInt(chi.URLParam(r, "role_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// find specific role in database
+		role, err := rs.Stores.Role.Get(roleID)
+		if err != nil || role.CourseID != course.ID {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		auditTarget(r, "role", role.ID, role, func() (interface{}, error) {
+			return rs.Stores.Role.Get(role.ID)
+		})
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyRole, role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
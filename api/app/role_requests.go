@@ -0,0 +1,83 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/infomark-org/infomark/auth/authorize"
+)
+
+// RoleRequest is the request payload for a staff role of a course.
+type RoleRequest struct {
+	Name string `json:"name" example:"grader"`
+	// 0: student, 1: tutor (default, students for the preset "observer"),
+	// admins cannot be appointed by a role
+	BaseRole *int `json:"base_role" example:"1"`
+	// see the list of permissions in the documentation
+	Permissions []string `json:"permissions" example:"grades.view,grades.edit_own"`
+	// "head_tutor", "grader" or "observer" to use their permissions
+	Preset string `json:"preset" example:"grader"`
+}
+
+// Bind preprocesses a RoleRequest.
+func (body *RoleRequest) Bind(r *http.Request) error {
+
+	if body == nil {
+		return errors.New("missing \"role\" data")
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+
+	baseRole := int(authorize.TUTOR)
+	if body.Preset != "" {
+		preset, ok := authorize.RolePresets[body.Preset]
+		if !ok {
+			return fmt.Errorf("unknown preset %q", body.Preset)
+		}
+		if len(body.Permissions) == 0 {
+			body.Permissions = preset.Strings()
+		}
+		baseRole = int(authorize.RolePresetBaseRoles[body.Preset])
+	}
+
+	if body.BaseRole == nil {
+		body.BaseRole = &baseRole
+	}
+
+	if body.Permissions == nil {
+		body.Permissions = []string{}
+	}
+
+	for _, name := range body.Permissions {
+		if !authorize.ValidPermission(name) {
+			return fmt.Errorf("unknown permission %q", name)
+		}
+	}
+
+	return validation.ValidateStruct(body,
+		validation.Field(&body.Name, validation.Required),
+		validation.Field(body.BaseRole, validation.Min(int(authorize.STUDENT)), validation.Max(int(authorize.TUTOR))),
+	)
+}
@@ -0,0 +1,59 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+)
+
+// RoleResponse is the response payload for a staff role of a course.
+type RoleResponse struct {
+	ID          int64    `json:"id" example:"4"`
+	Name        string   `json:"name" example:"grader"`
+	BaseRole    int      `json:"base_role" example:"1"`
+	Permissions []string `json:"permissions" example:"grades.view,grades.edit_own"`
+}
+
+// Render post-processes a RoleResponse.
+func (body *RoleResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newRoleResponse creates a response from a Role model.
+func newRoleResponse(p *model.Role) *RoleResponse {
+	return &RoleResponse{
+		ID:          p.ID,
+		Name:        p.Name,
+		BaseRole:    p.BaseRole,
+		Permissions: p.Permissions,
+	}
+}
+
+// newRoleListResponse creates a response from a list of Role models.
+func newRoleListResponse(roles []model.Role) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range roles {
+		list = append(list, newRoleResponse(&roles[k]))
+	}
+	return list
+}
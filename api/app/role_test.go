@@ -0,0 +1,227 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+func TestRole(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	adminJWT := tape.NewJWTRequest(1, false)
+	tutorJWT := tape.NewJWTRequest(2, false)
+
+	// createRole defines a role in course 1 and makes the tutor 2 a member
+	createRole := func(data H) *RoleResponse {
+		w := tape.Post("/api/v1/courses/1/roles", data, adminJWT)
+		g.Assert(w.Code).Equal(http.StatusCreated)
+		role := &RoleResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(role)).Equal(nil)
+
+		w = tape.Put("/api/v1/courses/1/enrollments/2", H{"role_id": role.ID}, adminJWT)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		return role
+	}
+
+	// gradeOfTutor returns a grade in course 1 which belongs to a group the
+	// tutor 2 is responsible for or not
+	gradeOfTutor := func(own bool) int64 {
+		var gradeID int64
+		err := tape.DB.Get(&gradeID, `
+SELECT
+  g.id
+FROM
+  grades g
+INNER JOIN submissions s ON s.id = g.submission_id
+INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+INNER JOIN user_group ug ON ug.user_id = s.user_id
+INNER JOIN groups gr ON gr.id = ug.group_id AND gr.course_id = sc.course_id
+WHERE
+  sc.course_id = 1
+AND
+  (gr.tutor_id = 2) = $1
+ORDER BY
+  g.id ASC
+LIMIT 1`, own)
+		g.Assert(err).Equal(nil)
+		return gradeID
+	}
+
+	grade := H{
+		"acquired_points": 1,
+		"feedback":        "Lorem Ipsum",
+	}
+
+	g.Describe("Role", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Should be defined by course admins only", func() {
+			w := tape.Post("/api/v1/courses/1/roles", H{"name": "grader", "preset": "grader"}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/roles", H{"name": "grader", "permissions": []string{"everything"}}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/courses/1/roles", H{"name": "grader", "preset": "grader"}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+
+			role := &RoleResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(role)).Equal(nil)
+			g.Assert(role.BaseRole).Equal(int(authorize.TUTOR))
+			g.Assert(role.Permissions).Equal(authorize.RolePresets["grader"].Strings())
+
+			roles, err := stores.Role.RolesOfCourse(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(roles)).Equal(1)
+		})
+
+		g.It("Should let graders only edit grades of their groups", func() {
+			createRole(H{"name": "grader", "preset": "grader"})
+
+			w := tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradeOfTutor(true)), grade, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradeOfTutor(false)), grade, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/courses/1/grades?group_id=1", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should let graders only change artifacts of their groups", func() {
+			createRole(H{"name": "grader", "preset": "grader"})
+
+			for _, own := range []bool{true, false} {
+				gradeID := gradeOfTutor(own)
+				artifact, err := stores.Artifact.Create(&model.GradeArtifact{
+					GradeID:    gradeID,
+					Visibility: "public",
+					Name:       "junit.xml",
+				})
+				g.Assert(err).Equal(nil)
+
+				url := fmt.Sprintf("/api/v1/courses/1/grades/%d/artifacts/%d", gradeID, artifact.ID)
+				w := tape.Put(url, H{"visible_to_students": true}, tutorJWT)
+				if own {
+					g.Assert(w.Code).Equal(http.StatusOK)
+				} else {
+					g.Assert(w.Code).Equal(http.StatusForbidden)
+				}
+			}
+		})
+
+		g.It("Should not appoint course admins", func() {
+			w := tape.Post("/api/v1/courses/1/roles", H{"name": "co-admin", "base_role": int(authorize.ADMIN)}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should let observers only read", func() {
+			createRole(H{"name": "examination office", "preset": "observer"})
+
+			w := tape.Get("/api/v1/courses/1/grades?group_id=1", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradeOfTutor(true)), grade, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Post("/api/v1/courses/1/groups/1/emails", H{"subject": "subj", "body": "text"}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should not let observers read what tutors can", func() {
+			// studentRoles counts the students among the enrollments the tutor sees
+			studentRoles := func() int {
+				w := tape.Get("/api/v1/courses/1/enrollments?roles=0", tutorJWT)
+				g.Assert(w.Code).Equal(http.StatusOK)
+				enrollments := []EnrollmentResponse{}
+				g.Assert(json.NewDecoder(w.Body).Decode(&enrollments)).Equal(nil)
+
+				students := 0
+				for _, enrollment := range enrollments {
+					if enrollment.Role == int64(authorize.STUDENT) {
+						students++
+					}
+				}
+				return students
+			}
+
+			g.Assert(studentRoles() > 0).IsTrue()
+
+			role := createRole(H{"name": "examination office", "preset": "observer"})
+			g.Assert(role.BaseRole).Equal(int(authorize.STUDENT))
+
+			// observers do not see other students like tutors do
+			g.Assert(studentRoles()).Equal(0)
+
+			// but keep their permissions
+			w := tape.Get("/api/v1/courses/1/tasks/1/groups/1", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should keep head tutors away from tasks", func() {
+			createRole(H{"name": "head tutor", "preset": "head_tutor"})
+
+			w := tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradeOfTutor(false)), grade, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Put("/api/v1/courses/1/tasks/1", H{"name": "new name"}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should fall back to the base role when the role is deleted", func() {
+			role := createRole(H{"name": "grader", "preset": "grader"})
+
+			w := tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradeOfTutor(false)), grade, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Delete(fmt.Sprintf("/api/v1/courses/1/roles/%d", role.ID), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// tutors edit all grades
+			w = tape.Put(fmt.Sprintf("/api/v1/courses/1/grades/%d", gradeOfTutor(false)), grade, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			givenRole, err := stores.Course.RoleInCourse(2, 1)
+			g.Assert(err).Equal(nil)
+			g.Assert(givenRole).Equal(authorize.TUTOR)
+		})
+
+		g.AfterEach(tape.AfterEach)
+	})
+}
@@ -166,7 +166,7 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 
 	InitPrometheus()
 
-	tokenAuth := authenticate.NewTokenAuth(&config.Authentication)
+	tokenAuth := authenticate.NewTokenAuth(&config.Authentication, configuration.Configuration.Worker.Docker.Timeout)
 	sessionAuth := authenticate.NewSessionAuth(&config.Authentication)
 
 	if err := db.Ping(); err != nil {
@@ -223,6 +223,11 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 
 				r.Post("/auth/token", appAPI.Auth.RefreshAccessTokenHandler)
 				r.Post("/auth/sessions", appAPI.Auth.LoginHandler)
+				r.Get("/auth/oidc/login", appAPI.Auth.OIDCLoginHandler)
+				r.Get("/auth/oidc/callback", appAPI.Auth.OIDCCallbackHandler)
+				r.Post("/auth/oidc/nonce", appAPI.Auth.OIDCNonceHandler)
+				r.Post("/auth/oidc/token", appAPI.Auth.OIDCTokenHandler)
+				r.Post("/auth/oidc/two_factor", appAPI.Auth.OIDCTwoFactorHandler)
 				r.Post("/auth/request_password_reset", appAPI.Auth.RequestPasswordResetHandler)
 				r.Post("/auth/update_password", appAPI.Auth.UpdatePasswordHandler)
 				r.Post("/auth/confirm_email", appAPI.Auth.ConfirmEmailHandler)
@@ -234,7 +239,8 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 
 			// protected routes
 			r.Group(func(r chi.Router) {
-				r.Use(authenticate.RequiredValidAccessClaims(sessionAuth, config))
+				r.Use(authenticate.RequiredValidAccessClaims(sessionAuth, &authenticationTokens{Stores: appAPI.Token.Stores}, appAPI.Session.Stores.Session, appAPI.Impersonation.Stores.Impersonation, config))
+				r.Use(RecordAudit(appAPI.Audit.Stores))
 
 				r.Get("/me", appAPI.User.GetMeHandler)
 				r.Put("/me", appAPI.User.EditMeHandler)
@@ -250,10 +256,60 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 						r.Put("/", appAPI.User.EditHandler)
 						r.Delete("/", appAPI.User.DeleteHandler)
 						r.Post("/emails", appAPI.User.SendEmailHandler)
+						r.Delete("/lockout", appAPI.User.UnlockHandler)
+						r.Post("/impersonation", appAPI.Impersonation.StartHandler)
 					})
 					r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Get("/find", appAPI.User.Find)
 				})
 
+				r.Get("/auth_events", appAPI.AuthEvent.IndexHandler)
+
+				r.Get("/audit_log", appAPI.Audit.IndexHandler)
+				r.Get("/audit_log/export", appAPI.Audit.ExportHandler)
+
+				r.Route("/impersonations", func(r chi.Router) {
+					r.Get("/", appAPI.Impersonation.IndexHandler)
+					r.With(appAPI.Impersonation.Context).Get("/{impersonation_id}/requests", appAPI.Impersonation.RequestsHandler)
+				})
+
+				r.Route("/email_templates", func(r chi.Router) {
+					r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+					r.Get("/", appAPI.EmailTemplate.IndexHandler)
+
+					r.Route("/{template_name}/{language}", func(r chi.Router) {
+						r.Use(appAPI.EmailTemplate.Context)
+
+						r.Get("/", appAPI.EmailTemplate.GetHandler)
+						r.Put("/", appAPI.EmailTemplate.EditHandler)
+						r.Delete("/", appAPI.EmailTemplate.DeleteHandler)
+						r.Get("/preview", appAPI.EmailTemplate.PreviewHandler)
+					})
+				})
+
+				r.Route("/outgoing_emails", func(r chi.Router) {
+					r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+					r.Get("/", appAPI.OutgoingEmail.IndexHandler)
+
+					r.Route("/{outgoing_email_id}", func(r chi.Router) {
+						r.Use(appAPI.OutgoingEmail.Context)
+
+						r.Get("/", appAPI.OutgoingEmail.GetHandler)
+						r.Post("/resend", appAPI.OutgoingEmail.ResendHandler)
+					})
+				})
+
+				r.Route("/workers", func(r chi.Router) {
+					r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+					r.Get("/", appAPI.Worker.IndexHandler)
+
+					r.Route("/{worker_id}", func(r chi.Router) {
+						r.Use(appAPI.Worker.Context)
+
+						r.Get("/", appAPI.Worker.GetHandler)
+						r.Delete("/", appAPI.Worker.DeleteHandler)
+					})
+				})
+
 				r.Route("/courses", func(r chi.Router) {
 					r.Get("/", appAPI.Course.IndexHandler)
 					r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Course.CreateHandler)
@@ -270,20 +326,39 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 							r.Get("/", appAPI.Course.GetHandler)
 
 							r.Route("/", func(r chi.Router) {
-								r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionCourseEmail)).Post("/emails", appAPI.Course.SendEmailHandler)
+
+								r.Route("/", func(r chi.Router) {
+									r.Use(authorize.RequiresCoursePermission(authorize.PermissionCourseEdit))
+
+									r.Post("/clone", appAPI.Course.CloneHandler)
+									r.Put("/", appAPI.Course.EditHandler)
+									r.Delete("/", appAPI.Course.DeleteHandler)
+
+									r.Route("/email_templates", func(r chi.Router) {
+										r.Get("/", appAPI.EmailTemplate.IndexHandler)
+
+										r.Route("/{template_name}/{language}", func(r chi.Router) {
+											r.Use(appAPI.EmailTemplate.Context)
 
-								r.Post("/emails", appAPI.Course.SendEmailHandler)
-								r.Put("/", appAPI.Course.EditHandler)
-								r.Delete("/", appAPI.Course.DeleteHandler)
+											r.Get("/", appAPI.EmailTemplate.GetHandler)
+											r.Put("/", appAPI.EmailTemplate.EditHandler)
+											r.Delete("/", appAPI.EmailTemplate.DeleteHandler)
+											r.Get("/preview", appAPI.EmailTemplate.PreviewHandler)
+										})
+									})
+								})
 							})
 
 							r.Get("/enrollments", appAPI.Course.IndexEnrollmentsHandler)
 							r.Delete("/enrollments", appAPI.Course.DisenrollHandler)
 							r.Get("/points", appAPI.Course.PointsHandler)
+							r.Get("/deadline_reminders", appAPI.Course.GetDeadlineRemindersHandler)
+							r.Put("/deadline_reminders", appAPI.Course.EditDeadlineRemindersHandler)
 							r.Get("/bids", appAPI.Course.BidsHandler)
 
 							r.Route("/enrollments/{user_id}", func(r chi.Router) {
-								r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+								r.Use(authorize.RequiresCoursePermission(authorize.PermissionEnrollmentsEdit))
 								r.Use(appAPI.User.Context)
 
 								r.Get("/", appAPI.Course.GetUserEnrollmentHandler)
@@ -291,9 +366,23 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 								r.Put("/", appAPI.Course.ChangeRole)
 							})
 
+							r.Route("/roles", func(r chi.Router) {
+								r.Use(authorize.RequiresCoursePermission(authorize.PermissionRolesEdit))
+
+								r.Get("/", appAPI.Role.IndexHandler)
+								r.Post("/", appAPI.Role.CreateHandler)
+
+								r.Route("/{role_id}", func(r chi.Router) {
+									r.Use(appAPI.Role.Context)
+
+									r.Put("/", appAPI.Role.EditHandler)
+									r.Delete("/", appAPI.Role.DeleteHandler)
+								})
+							})
+
 							r.Route("/sheets", func(r chi.Router) {
 								r.Get("/", appAPI.Sheet.IndexHandler)
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Sheet.CreateHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionSheetsEdit)).Post("/", appAPI.Sheet.CreateHandler)
 
 								r.Route("/{sheet_id}", func(r chi.Router) {
 									r.Use(appAPI.Sheet.Context)
@@ -301,14 +390,14 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 									r.Get("/", appAPI.Sheet.GetHandler)
 									r.Route("/tasks", func(r chi.Router) {
 										r.Get("/", appAPI.Task.IndexHandler)
-										r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Task.CreateHandler)
+										r.With(authorize.RequiresCoursePermission(authorize.PermissionTasksEdit)).Post("/", appAPI.Task.CreateHandler)
 									})
 
 									r.Get("/file", appAPI.Sheet.GetFileHandler)
 									r.Get("/points", appAPI.Sheet.PointsHandler)
 
 									r.Route("/", func(r chi.Router) {
-										r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+										r.Use(authorize.RequiresCoursePermission(authorize.PermissionSheetsEdit))
 
 										r.Put("/", appAPI.Sheet.EditHandler)
 										r.Delete("/", appAPI.Sheet.DeleteHandler)
@@ -320,19 +409,19 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 							r.Route("/groups", func(r chi.Router) {
 								r.Get("/own", appAPI.Group.GetMineHandler)
 								r.Get("/", appAPI.Group.IndexHandler)
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Group.CreateHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionGroupsEdit)).Post("/", appAPI.Group.CreateHandler)
 
 								r.Route("/{group_id}", func(r chi.Router) {
 									r.Use(appAPI.Group.Context)
 
 									r.Post("/bids", appAPI.Group.ChangeBidHandler)
-									r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Post("/emails", appAPI.Group.SendEmailHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGroupsEmail)).Post("/emails", appAPI.Group.SendEmailHandler)
 									r.Get("/enrollments", appAPI.Group.IndexEnrollmentsHandler)
-									r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/enrollments", appAPI.Group.EditGroupEnrollmentHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGroupsEdit)).Post("/enrollments", appAPI.Group.EditGroupEnrollmentHandler)
 									r.Get("/", appAPI.Group.GetHandler)
 
 									r.Route("/", func(r chi.Router) {
-										r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+										r.Use(authorize.RequiresCoursePermission(authorize.PermissionGroupsEdit))
 
 										r.Put("/", appAPI.Group.EditHandler)
 										r.Delete("/", appAPI.Group.DeleteHandler)
@@ -342,14 +431,14 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 
 							r.Route("/exams", func(r chi.Router) {
 								r.Get("/", appAPI.Exam.IndexHandler)
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Exam.CreateHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionExamsEdit)).Post("/", appAPI.Exam.CreateHandler)
 
 								r.Route("/{exam_id}", func(r chi.Router) {
 									r.Use(appAPI.Exam.Context)
 
 									r.Get("/", appAPI.Exam.GetHandler)
 									r.Route("/", func(r chi.Router) {
-										r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+										r.Use(authorize.RequiresCoursePermission(authorize.PermissionExamsEdit))
 
 										r.Put("/", appAPI.Exam.EditHandler)
 										r.Delete("/", appAPI.Exam.DeleteHandler)
@@ -358,32 +447,46 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 									r.Route("/enrollments", func(r chi.Router) {
 										r.Post("/", appAPI.Exam.EnrollExamHandler)
 										r.Delete("/", appAPI.Exam.DisenrollExamHandler)
-										r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Put("/", appAPI.Exam.UpdateEnrollExamHandler)
-										r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Get("/", appAPI.Exam.GetExamEnrollmentsHandler)
+										r.With(authorize.RequiresCoursePermission(authorize.PermissionExamsEdit)).Put("/", appAPI.Exam.UpdateEnrollExamHandler)
+										r.With(authorize.RequiresCoursePermission(authorize.PermissionExamsEdit)).Get("/", appAPI.Exam.GetExamEnrollmentsHandler)
 									})
 
 								})
 							})
 
 							r.Route("/grades", func(r chi.Router) {
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/", appAPI.Grade.IndexHandler)
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/summary", appAPI.Grade.IndexSummaryHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesView)).Get("/", appAPI.Grade.IndexHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesView)).Get("/summary", appAPI.Grade.IndexSummaryHandler)
 								r.Get("/missing", appAPI.Grade.IndexMissingHandler)
 
 								r.Route("/{grade_id}", func(r chi.Router) {
 									r.Use(appAPI.Grade.Context)
-									r.Use(authorize.RequiresAtLeastCourseRole(authorize.TUTOR))
+									r.Use(authorize.RequiresCoursePermission(authorize.PermissionGradesView))
 
-									r.Put("/", appAPI.Grade.EditHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesEdit, authorize.PermissionGradesEditOwn)).Put("/", appAPI.Grade.EditHandler)
 									r.Get("/", appAPI.Grade.GetByIDHandler)
-									r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/public_result", appAPI.Grade.PublicResultEditHandler)
-									r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/private_result", appAPI.Grade.PrivateResultEditHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesResults)).Post("/public_result", appAPI.Grade.PublicResultEditHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesResults)).Post("/private_result", appAPI.Grade.PrivateResultEditHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesResults)).Post("/public_artifacts", appAPI.Artifact.PublicUploadHandler)
+									r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesResults)).Post("/private_artifacts", appAPI.Artifact.PrivateUploadHandler)
+
+									r.Route("/artifacts", func(r chi.Router) {
+										r.Get("/", appAPI.Artifact.IndexHandler)
+
+										r.Route("/{artifact_id}", func(r chi.Router) {
+											r.Use(appAPI.Artifact.Context)
+
+											r.Get("/", appAPI.Artifact.GetHandler)
+											r.With(authorize.RequiresCoursePermission(authorize.PermissionGradesEdit, authorize.PermissionGradesEditOwn)).Put("/", appAPI.Artifact.EditHandler)
+											r.Get("/file", appAPI.Artifact.GetFileHandler)
+										})
+									})
 								})
 							})
 
 							r.Route("/materials", func(r chi.Router) {
 								r.Get("/", appAPI.Material.IndexHandler)
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.ADMIN)).Post("/", appAPI.Material.CreateHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionMaterialsEdit)).Post("/", appAPI.Material.CreateHandler)
 
 								r.Route("/{material_id}", func(r chi.Router) {
 									r.Use(appAPI.Material.Context)
@@ -392,7 +495,7 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 									r.Get("/file", appAPI.Material.GetFileHandler)
 
 									r.Route("/", func(r chi.Router) {
-										r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+										r.Use(authorize.RequiresCoursePermission(authorize.PermissionMaterialsEdit))
 
 										r.Put("/", appAPI.Material.EditHandler)
 										r.Delete("/", appAPI.Material.DeleteHandler)
@@ -402,7 +505,7 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 							})
 
 							r.Route("/submissions", func(r chi.Router) {
-								r.With(authorize.RequiresAtLeastCourseRole(authorize.TUTOR)).Get("/", appAPI.Submission.IndexHandler)
+								r.With(authorize.RequiresCoursePermission(authorize.PermissionSubmissionsView)).Get("/", appAPI.Submission.IndexHandler)
 
 								r.Route("/{submission_id}", func(r chi.Router) {
 									r.Use(appAPI.Submission.Context)
@@ -423,9 +526,11 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 									r.Get("/submission", appAPI.Submission.GetFileHandler)
 									r.Post("/submission", appAPI.Submission.UploadFileHandler)
 									r.Get("/result", appAPI.Task.GetSubmissionResultHandler)
+									r.Get("/artifacts", appAPI.Artifact.IndexOwnHandler)
+									r.Get("/artifacts/{artifact_id}/file", appAPI.Artifact.GetOwnFileHandler)
 
 									r.Route("/", func(r chi.Router) {
-										r.Use(authorize.RequiresAtLeastCourseRole(authorize.ADMIN))
+										r.Use(authorize.RequiresCoursePermission(authorize.PermissionTasksEdit))
 
 										r.Put("/", appAPI.Task.EditHandler)
 										r.Delete("/", appAPI.Task.DeleteHandler)
@@ -433,10 +538,21 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 										r.Get("/private_file", appAPI.Task.GetPrivateTestFileHandler)
 										r.Post("/public_file", appAPI.Task.ChangePublicTestFileHandler)
 										r.Post("/private_file", appAPI.Task.ChangePrivateTestFileHandler)
+										r.Get("/reference", appAPI.Task.GetReferenceHandler)
+										r.Get("/reference_file", appAPI.Task.GetReferenceFileHandler)
+										r.Post("/reference_file", appAPI.Task.ChangeReferenceFileHandler)
+										r.Post("/reference_public_result", appAPI.Task.PublicReferenceResultHandler)
+										r.Post("/reference_private_result", appAPI.Task.PrivateReferenceResultHandler)
+
+										r.Route("/test_batches", func(r chi.Router) {
+											r.Get("/", appAPI.TestBatch.IndexHandler)
+											r.Post("/", appAPI.TestBatch.CreateHandler)
+											r.With(appAPI.TestBatch.Context).Get("/{test_batch_id}", appAPI.TestBatch.GetHandler)
+										})
 									})
 
 									r.Route("/groups/{group_id}", func(r chi.Router) {
-										r.Use(authorize.RequiresAtLeastCourseRole(authorize.TUTOR))
+										r.Use(authorize.RequiresCoursePermission(authorize.PermissionSubmissionsView))
 										r.Use(appAPI.Group.Context)
 
 										r.Get("/file", appAPI.Submission.GetCollectionFileHandler)
@@ -455,7 +571,19 @@ func New(db *sqlx.DB, promhttp http.Handler, log bool) (*chi.Mux, error) {
 				r.Post("/account/avatar", appAPI.Account.ChangeAvatarHandler)
 				r.Delete("/account/avatar", appAPI.Account.DeleteAvatarHandler)
 				r.Patch("/account", appAPI.Account.EditHandler)
+				r.Get("/account/tokens", appAPI.Token.IndexHandler)
+				r.Post("/account/tokens", appAPI.Token.CreateHandler)
+				r.With(appAPI.Token.Context).Delete("/account/tokens/{token_id}", appAPI.Token.DeleteHandler)
+				r.Get("/account/sessions", appAPI.Session.IndexHandler)
+				r.Delete("/account/sessions", appAPI.Session.DeleteAllHandler)
+				r.With(appAPI.Session.Context).Delete("/account/sessions/{session_id}", appAPI.Session.DeleteHandler)
+				r.Get("/account/two_factor", appAPI.TwoFactor.GetHandler)
+				r.Post("/account/two_factor", appAPI.TwoFactor.EnrollHandler)
+				r.Delete("/account/two_factor", appAPI.TwoFactor.DeleteHandler)
+				r.Post("/account/two_factor/confirm", appAPI.TwoFactor.ConfirmHandler)
+				r.Post("/account/two_factor/recovery_codes", appAPI.TwoFactor.RecoveryCodesHandler)
 				r.Delete("/auth/sessions", appAPI.Auth.LogoutHandler)
+				r.Delete("/auth/impersonation", appAPI.Impersonation.StopHandler)
 
 			})
 
@@ -0,0 +1,171 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// SessionResource specifies handler for the active logins of the request
+// identity.
+type SessionResource struct {
+	Stores *Stores
+}
+
+// NewSessionResource create and returns a SessionResource.
+func NewSessionResource(stores *Stores) *SessionResource {
+	return &SessionResource{
+		Stores: stores,
+	}
+}
+
+// IndexHandler is public endpoint for
+// URL: /account/sessions
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,SessionResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list the active sessions and refresh tokens of the request identity
+func (rs *SessionResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	sessions, err := rs.Stores.Session.SessionsOfUser(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.RenderList(w, r, newSessionListResponse(sessions, accessClaims.SessionID)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteHandler is public endpoint for
+// URL: /account/sessions/{session_id}
+// URLPARAM: session_id,integer
+// METHOD: delete
+// TAG: account
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  revoke a session or refresh token
+func (rs *SessionResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	session := r.Context().Value(symbol.CtxKeySession).(*model.Session)
+
+	if err := rs.Stores.Session.Delete(session.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// DeleteAllHandler is public endpoint for
+// URL: /account/sessions
+// METHOD: delete
+// TAG: account
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  revoke all sessions and refresh tokens except the current one
+func (rs *SessionResource) DeleteAllHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if err := rs.Stores.Session.DeleteAllOfUser(accessClaims.LoginID, accessClaims.SessionID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// .............................................................................
+
+// Context middleware is used to load a session of the request identity from
+// the URL parameter `sessionID` passed through as the request. In case the
+// session could not be found, we stop here and return a 404.
+func (rs *SessionResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+		var sessionID int64
+		var err error
+
+		// try to get id from URL
+		if sessionID, err = strconv.ParseInt(chi.URLParam(r, "session_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// users only see their own sessions
+		session, err := rs.Stores.Session.Get(sessionID)
+		if err != nil || session.UserID != accessClaims.LoginID {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeySession, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// startSession registers a new login of a user. Cookie sessions and refresh
+// tokens keep its id to be revocable.
+func startSession(stores *Stores, r *http.Request, userID int64, kind string) (*model.Session, error) {
+	expiry := configuration.Configuration.Server.Authentication.JWT.RefreshExpiry
+	if kind == model.SessionKindCookie {
+		expiry = configuration.Configuration.Server.Authentication.Session.Cookies.Lifetime
+	}
+
+	now := NowUTC()
+	return stores.Session.Create(&model.Session{
+		UserID:     userID,
+		Kind:       kind,
+		UserAgent:  r.UserAgent(),
+		IP:         authenticate.NewLoginLimiterKeyFromIP(r).Key(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(expiry),
+	})
+}
+
+// revokeLogins revokes all sessions, refresh tokens and personal access tokens
+// of a user, e.g. after the password has been changed. The session given by
+// keepID survives, 0 revokes all.
+func revokeLogins(stores *Stores, userID int64, keepID int64) error {
+	if err := stores.Session.DeleteAllOfUser(userID, keepID); err != nil {
+		return err
+	}
+	return stores.Token.DeleteAllOfUser(userID)
+}
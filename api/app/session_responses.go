@@ -0,0 +1,70 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+)
+
+// SessionResponse is the response payload for an active login.
+type SessionResponse struct {
+	ID int64 `json:"id" example:"12"`
+	// "session" for the web interface, "token" for refresh tokens
+	Kind       string    `json:"kind" example:"session"`
+	UserAgent  string    `json:"user_agent" example:"Mozilla/5.0 (X11; Linux x86_64)"`
+	IP         string    `json:"ip" example:"192.168.0.1"`
+	LastSeenAt time.Time `json:"last_seen_at" example:"auto"`
+	ExpiresAt  time.Time `json:"expires_at" example:"auto"`
+	CreatedAt  time.Time `json:"created_at" example:"auto"`
+	// the session of this request
+	Current bool `json:"current" example:"true"`
+}
+
+// Render post-processes a SessionResponse.
+func (body *SessionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newSessionResponse creates a response from a Session model.
+func newSessionResponse(p *model.Session, currentID int64) *SessionResponse {
+	return &SessionResponse{
+		ID:         p.ID,
+		Kind:       p.Kind,
+		UserAgent:  p.UserAgent,
+		IP:         p.IP,
+		LastSeenAt: p.LastSeenAt,
+		ExpiresAt:  p.ExpiresAt,
+		CreatedAt:  p.CreatedAt,
+		Current:    p.ID == currentID,
+	}
+}
+
+// newSessionListResponse creates a response from a list of Session models.
+func newSessionListResponse(sessions []model.Session, currentID int64) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range sessions {
+		list = append(list, newSessionResponse(&sessions[k], currentID))
+	}
+	return list
+}
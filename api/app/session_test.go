@@ -0,0 +1,202 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	otape "github.com/infomark-org/infomark/tape"
+)
+
+func TestSession(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var w *httptest.ResponseRecorder
+	var stores *Stores
+
+	credentials := H{
+		"email":          "test@uni-tuebingen.de",
+		"plain_password": "test",
+	}
+
+	// tokenLogin logs in user 1 and returns the JWTs
+	tokenLogin := func() *AuthResponse {
+		w := tape.Post("/api/v1/auth/token", credentials)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		resp := &AuthResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(resp)).Equal(nil)
+		return resp
+	}
+
+	// cookieLogin logs in user 1 and returns the session cookies
+	cookieLogin := func() cookieRequest {
+		w := tape.Post("/api/v1/auth/sessions", credentials)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		return responseCookies(w)
+	}
+
+	listSessions := func(modifier otape.RequestModifier) []SessionResponse {
+		w := tape.Get("/api/v1/account/sessions", modifier)
+		g.Assert(w.Code).Equal(http.StatusOK)
+		list := []SessionResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(&list)).Equal(nil)
+		return list
+	}
+
+	g.Describe("Session", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+			resetLoginLimit()
+		})
+
+		g.It("Should list logins of the request identity", func() {
+			tokens := tokenLogin()
+			cookies := cookieLogin()
+
+			list := listSessions(bearerRequest(tokens.Access.Token))
+			g.Assert(len(list)).Equal(2)
+			g.Assert(list[0].Current || list[1].Current).Equal(true)
+			g.Assert(list[0].Current && list[1].Current).Equal(false)
+
+			kinds := map[string]bool{list[0].Kind: true, list[1].Kind: true}
+			g.Assert(kinds[model.SessionKindCookie]).Equal(true)
+			g.Assert(kinds[model.SessionKindToken]).Equal(true)
+
+			g.Assert(len(listSessions(cookies))).Equal(2)
+			// the test login of another user has its own session
+			g.Assert(len(listSessions(tape.NewJWTRequest(2, false)))).Equal(1)
+		})
+
+		g.It("Should revoke a refresh token", func() {
+			tokens := tokenLogin()
+			list := listSessions(bearerRequest(tokens.Access.Token))
+			g.Assert(len(list)).Equal(1)
+
+			// refreshing works before
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest(tokens.Refresh.Token))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// only the owner sees the session
+			url := fmt.Sprintf("/api/v1/account/sessions/%d", list[0].ID)
+			w = tape.Delete(url, tape.NewJWTRequest(2, false))
+			g.Assert(w.Code).Equal(http.StatusNotFound)
+
+			w = tape.Delete(url, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest(tokens.Refresh.Token))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/me", bearerRequest(tokens.Access.Token))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should not accept a cookie after logout", func() {
+			cookies := cookieLogin()
+
+			w = tape.Get("/api/v1/me", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Delete("/api/v1/auth/sessions", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/me", cookies)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should revoke all other logins at once", func() {
+			tokens := tokenLogin()
+			other := cookieLogin()
+			cookies := cookieLogin()
+
+			w = tape.Delete("/api/v1/account/sessions", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/me", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/me", other)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest(tokens.Refresh.Token))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+		})
+
+		g.It("Should revoke logins when the password changes", func() {
+			tokens := tokenLogin()
+			cookies := cookieLogin()
+
+			_, err := stores.Token.Create(&model.PersonalAccessToken{
+				UserID:    1,
+				Name:      "export grades",
+				TokenHash: "hash",
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			g.Assert(err).Equal(nil)
+
+			w = tape.Patch("/api/v1/account", H{
+				"account": H{
+					"plain_password": "new_pass",
+				},
+				"old_plain_password": "test",
+			}, cookies)
+			g.Assert(w.Code).Equal(http.StatusNoContent)
+
+			w = tape.Get("/api/v1/me", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/auth/token", H{}, bearerRequest(tokens.Refresh.Token))
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			personal, err := stores.Token.TokensOfUser(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(personal)).Equal(0)
+		})
+
+		g.It("Should revoke logins when the account is deleted", func() {
+			tokens := tokenLogin()
+			g.Assert(len(listSessions(bearerRequest(tokens.Access.Token)))).Equal(1)
+
+			sessions, err := stores.Session.SessionsOfUser(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(sessions)).Equal(1)
+
+			g.Assert(stores.User.Delete(1)).Equal(nil)
+
+			_, err = stores.Session.Get(sessions[0].ID)
+			g.Assert(err == nil).Equal(false)
+		})
+
+		g.AfterEach(tape.AfterEach)
+	})
+}
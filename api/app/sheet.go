@@ -105,9 +105,10 @@ func (rs *SheetResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sheet := &model.Sheet{
-		Name:      data.Name,
-		PublishAt: data.PublishAt,
-		DueAt:     data.DueAt,
+		Name:              data.Name,
+		PublishAt:         data.PublishAt,
+		DueAt:             data.DueAt,
+		IgnoreBrokenTests: data.IgnoreBrokenTests,
 	}
 
 	// create Sheet entry in database
@@ -178,6 +179,7 @@ func (rs *SheetResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 	sheet.Name = data.Name
 	sheet.PublishAt = data.PublishAt
 	sheet.DueAt = data.DueAt
+	sheet.IgnoreBrokenTests = data.IgnoreBrokenTests
 
 	// update database entry
 	if err := rs.Stores.Sheet.Update(sheet); err != nil {
@@ -319,11 +321,15 @@ func (rs *SheetResource) Context(next http.Handler) http.Handler {
 		}
 
 		// public yet?
-		if r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole) == authorize.STUDENT && !PublicYet(sheet.PublishAt) {
+		if r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole) == authorize.STUDENT && !SheetPublic(sheet) {
 			render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("sheet not published yet")))
 			return
 		}
 
+		auditTarget(r, "sheet", sheet.ID, sheet, func() (interface{}, error) {
+			return rs.Stores.Sheet.Get(sheet.ID)
+		})
+
 		ctx := context.WithValue(r.Context(), symbol.CtxKeySheet, sheet)
 
 		// when there is a sheetID in the url, there is NOT a courseID in the url,
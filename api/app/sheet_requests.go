@@ -32,6 +32,9 @@ type SheetRequest struct {
 	Name      string    `json:"name" example:"Blatt 42"`
 	PublishAt time.Time `json:"publish_at" example:"auto"`
 	DueAt     time.Time `json:"due_at" example:"auto"`
+	// IgnoreBrokenTests publishes the sheet even if the reference solution
+	// of a task does not pass the tests.
+	IgnoreBrokenTests bool `json:"ignore_broken_tests" example:"false"`
 }
 
 // Bind preprocesses a SheetRequest.
@@ -37,6 +37,9 @@ type SheetResponse struct {
 	FileURL   string    `json:"file_url" example:"/api/v1/sheets/13/file"`
 	PublishAt time.Time `json:"publish_at" example:"auto"`
 	DueAt     time.Time `json:"due_at" example:"auto"`
+
+	IgnoreBrokenTests bool `json:"ignore_broken_tests" example:"false"`
+	TestsBroken       bool `json:"tests_broken" example:"false"`
 }
 
 // Render post-processes a SheetResponse.
@@ -52,6 +55,9 @@ func (rs *SheetResource) newSheetResponse(p *model.Sheet) *SheetResponse {
 		PublishAt: p.PublishAt,
 		DueAt:     p.DueAt,
 		FileURL:   fmt.Sprintf("/api/v1/sheets/%s/file", strconv.FormatInt(p.ID, 10)),
+
+		IgnoreBrokenTests: p.IgnoreBrokenTests,
+		TestsBroken:       p.TestsBroken,
 	}
 }
 
@@ -59,7 +65,7 @@ func (rs *SheetResource) newSheetResponse(p *model.Sheet) *SheetResponse {
 func (rs *SheetResource) newSheetListResponse(givenRole authorize.CourseRole, Sheets []model.Sheet) []render.Renderer {
 	list := []render.Renderer{}
 	for k := range Sheets {
-		if givenRole == authorize.STUDENT && !PublicYet(Sheets[k].PublishAt) {
+		if givenRole == authorize.STUDENT && !SheetPublic(&Sheets[k]) {
 			continue
 		}
 		list = append(list, rs.newSheetResponse(&Sheets[k]))
@@ -21,7 +21,6 @@ package app
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -34,6 +33,7 @@ import (
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/service"
 	"github.com/infomark-org/infomark/symbol"
 )
 
@@ -110,9 +110,7 @@ func (rs *SubmissionResource) GetFileHandler(w http.ResponseWriter, r *http.Requ
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get the path to the zip file containing all submissions for a given task and a given group if exists
 func (rs *SubmissionResource) GetCollectionHandler(w http.ResponseWriter, r *http.Request) {
-	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
-
-	if givenRole == authorize.STUDENT {
+	if !authorize.HasCoursePermission(authorize.PermissionSubmissionsView, r) {
 		render.Render(w, r, ErrUnauthorized)
 		return
 	}
@@ -171,9 +169,7 @@ func (rs *SubmissionResource) GetCollectionHandler(w http.ResponseWriter, r *htt
 // RESPONSE: 403,Unauthorized
 // SUMMARY:  get the zip file containing all submissions for a given task and a given group
 func (rs *SubmissionResource) GetCollectionFileHandler(w http.ResponseWriter, r *http.Request) {
-	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
-
-	if givenRole == authorize.STUDENT {
+	if !authorize.HasCoursePermission(authorize.PermissionSubmissionsView, r) {
 		render.Render(w, r, ErrUnauthorized)
 		return
 	}
@@ -231,7 +227,6 @@ func (rs *SubmissionResource) GetFileByIDHandler(w http.ResponseWriter, r *http.
 
 	submission := r.Context().Value(symbol.CtxKeySubmission).(*model.Submission)
 	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
-	givenRole := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 
 	submission, err := rs.Stores.Submission.Get(submission.ID)
 	if err != nil {
@@ -241,7 +236,7 @@ func (rs *SubmissionResource) GetFileByIDHandler(w http.ResponseWriter, r *http.
 
 	// students can only access their own files
 	if submission.UserID != accessClaims.LoginID {
-		if givenRole == authorize.STUDENT {
+		if !authorize.HasCoursePermission(authorize.PermissionSubmissionsView, r) {
 			render.Render(w, r, ErrUnauthorized)
 			return
 		}
@@ -281,7 +276,7 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 
 	course_role := r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole)
 
-	if course_role == authorize.STUDENT && !PublicYet(sheet.PublishAt) {
+	if course_role == authorize.STUDENT && !SheetPublic(sheet) {
 		render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("sheet not published yet")))
 		return
 	}
@@ -378,33 +373,17 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 	}
 
 	// enqueue file into testing queue
-	// By definition user with id 1 is the system itself with root access
-	tokenManager := rs.TokenAuth
-	if err != nil {
-		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-		return
-	}
-	accessToken, err := tokenManager.CreateAccessJWT(
-		authenticate.NewAccessClaims(1, true))
-	if err != nil {
-		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-		return
-	}
-
+	// each job gets its own token, which is only valid for this job
 	if task.PublicDockerImage.Valid && helper.NewPublicTestFileHandle(task.ID).Exists() {
 		// enqueue public test
 
 		request := shared.NewSubmissionAMQPWorkerRequest(
 			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public")
-
-		body, err := json.Marshal(request)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
+			configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public")
+		request.LimitResources(task)
 
-		err = DefaultSubmissionProducer.Publish(body)
+		err = PublishJob(DefaultSubmissionProducer, rs.TokenAuth, request,
+			helper.NewSubmissionFileHandle(submission.ID), helper.NewPublicTestFileHandle(task.ID), service.PublicPriority)
 		if err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
@@ -423,15 +402,11 @@ func (rs *SubmissionResource) UploadFileHandler(w http.ResponseWriter, r *http.R
 
 		request := shared.NewSubmissionAMQPWorkerRequest(
 			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private")
-
-		body, err := json.Marshal(request)
-		if err != nil {
-			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
-			return
-		}
+			configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private")
+		request.LimitResources(task)
 
-		err = DefaultSubmissionProducer.Publish(body)
+		err = PublishJob(DefaultSubmissionProducer, rs.TokenAuth, request,
+			helper.NewSubmissionFileHandle(submission.ID), helper.NewPrivateTestFileHandle(task.ID), service.PrivatePriority)
 		if err != nil {
 			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 			return
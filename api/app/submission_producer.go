@@ -27,6 +27,7 @@ import (
 // Producer is interface to pipe the workload over AMPQ to the backend workers
 type Producer interface {
 	Publish(body []byte) error
+	PublishJob(body []byte, image string, priority uint8) error
 }
 
 // DefaultSubmissionProducer is the producer which broadcasts all submissions
@@ -40,6 +41,9 @@ type VoidProducer struct{}
 // Publish of VoidProducer does nothing on purpose (used in unit tests).
 func (t *VoidProducer) Publish(body []byte) error { return nil }
 
+// PublishJob of VoidProducer does nothing on purpose (used in unit tests).
+func (t *VoidProducer) PublishJob(body []byte, image string, priority uint8) error { return nil }
+
 func InitSubmissionProducer() {
 	var err error
 
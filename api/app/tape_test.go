@@ -23,9 +23,11 @@ import (
 	"net/http"
 
 	txdb "github.com/DATA-DOG/go-txdb"
+	redis "github.com/go-redis/redis"
 
 	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
 	otape "github.com/infomark-org/infomark/tape"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" // need for Postgres
@@ -34,10 +36,21 @@ import (
 type JWTRequest struct {
 	Claims    authenticate.AccessClaims
 	TokenAuth *authenticate.TokenAuth
+	Tape      *Tape
 }
 
 func (t JWTRequest) Modify(r *http.Request) {
-	accessToken, err := t.TokenAuth.CreateAccessJWT(t.Claims)
+	claims := t.Claims
+	// access tokens are only accepted within a registered session
+	if claims.SessionID == 0 {
+		session, err := startSession(NewStores(t.Tape.DB), r, claims.LoginID, model.SessionKindToken)
+		if err != nil {
+			panic(err)
+		}
+		claims.SessionID = session.ID
+	}
+
+	accessToken, err := t.TokenAuth.CreateAccessJWT(claims)
 	if err != nil {
 		panic(err)
 	}
@@ -49,6 +62,27 @@ func (t *Tape) NewJWTRequest(loginID int64, root bool) JWTRequest {
 	return JWTRequest{
 		Claims:    authenticate.NewAccessClaims(loginID, root),
 		TokenAuth: t.TokenAuth,
+		Tape:      t,
+	}
+}
+
+type JobJWTRequest struct {
+	Claims    authenticate.JobClaims
+	TokenAuth *authenticate.TokenAuth
+}
+
+func (t JobJWTRequest) Modify(r *http.Request) {
+	jobToken, err := t.TokenAuth.CreateJobJWT(t.Claims)
+	if err != nil {
+		panic(err)
+	}
+	r.Header.Add("Authorization", "Bearer "+jobToken)
+}
+
+func (t *Tape) NewJobJWTRequest(resources ...string) JobJWTRequest {
+	return JobJWTRequest{
+		Claims:    authenticate.NewJobClaims(resources...),
+		TokenAuth: t.TokenAuth,
 	}
 }
 
@@ -76,7 +110,22 @@ func NewTape() *Tape {
 	}
 
 	return &Tape{
-		TokenAuth: authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication),
+		TokenAuth: authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication, configuration.Configuration.Worker.Docker.Timeout),
+	}
+}
+
+// resetLoginLimit forgets the logins of previous tests, as all tests share the
+// rate limit of the same client address.
+func resetLoginLimit() {
+	option, err := redis.ParseURL(configuration.Configuration.Server.RedisURL())
+	if err != nil {
+		panic(err)
+	}
+	redisClient := redis.NewClient(option)
+	defer redisClient.Close()
+
+	if err := redisClient.Set("infomark-logins:1.2.3.4-infomark-logins", "0", 0).Err(); err != nil {
+		panic(err)
 	}
 }
 
@@ -37,13 +37,15 @@ import (
 
 // TaskResource specifies Task management handler.
 type TaskResource struct {
-	Stores *Stores
+	Stores    *Stores
+	TokenAuth *authenticate.TokenAuth
 }
 
 // NewTaskResource create and returns a TaskResource.
-func NewTaskResource(stores *Stores) *TaskResource {
+func NewTaskResource(stores *Stores, tokenAuth *authenticate.TokenAuth) *TaskResource {
 	return &TaskResource{
-		Stores: stores,
+		Stores:    stores,
+		TokenAuth: tokenAuth,
 	}
 }
 
@@ -136,6 +138,8 @@ func (rs *TaskResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
 		MaxPoints:          data.MaxPoints,
 		PublicDockerImage:  null.StringFrom(data.PublicDockerImage),
 		PrivateDockerImage: null.StringFrom(data.PrivateDockerImage),
+		CPULimit:           data.CPULimit,
+		MemoryLimit:        data.MemoryLimit,
 	}
 
 	// create Task entry in database
@@ -201,11 +205,18 @@ func (rs *TaskResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	imagesChanged := task.PublicDockerImage.String != data.PublicDockerImage ||
+		task.PrivateDockerImage.String != data.PrivateDockerImage
+
 	task.Name = data.Name
 	task.MaxPoints = data.MaxPoints
 	task.PublicDockerImage = null.StringFrom(data.PublicDockerImage)
 	task.PrivateDockerImage = null.StringFrom(data.PrivateDockerImage)
+	task.CPULimit = data.CPULimit
+	task.MemoryLimit = data.MemoryLimit
 
 	// update database entry
 	if err := rs.Stores.Task.Update(task); err != nil {
@@ -213,6 +224,13 @@ func (rs *TaskResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if imagesChanged {
+		if err := EnqueueReferenceSolution(rs.Stores, rs.TokenAuth, course.ID, task); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
 	render.Status(r, http.StatusNoContent)
 }
 
@@ -307,6 +325,7 @@ func (rs *TaskResource) GetPrivateTestFileHandler(w http.ResponseWriter, r *http
 // SUMMARY:  change the zip with the testing framework for the public tests
 func (rs *TaskResource) ChangePublicTestFileHandler(w http.ResponseWriter, r *http.Request) {
 	// will always be a POST
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
 
 	// the file will be located
@@ -314,6 +333,11 @@ func (rs *TaskResource) ChangePublicTestFileHandler(w http.ResponseWriter, r *ht
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
+
+	if err := EnqueueReferenceSolution(rs.Stores, rs.TokenAuth, course.ID, task); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
 	render.Status(r, http.StatusOK)
 }
 
@@ -331,6 +355,7 @@ func (rs *TaskResource) ChangePublicTestFileHandler(w http.ResponseWriter, r *ht
 // SUMMARY:  change the zip with the testing framework for the private tests
 func (rs *TaskResource) ChangePrivateTestFileHandler(w http.ResponseWriter, r *http.Request) {
 	// will always be a POST
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
 	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
 
 	// the file will be located
@@ -338,9 +363,163 @@ func (rs *TaskResource) ChangePrivateTestFileHandler(w http.ResponseWriter, r *h
 		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
 		return
 	}
+
+	if err := EnqueueReferenceSolution(rs.Stores, rs.TokenAuth, course.ID, task); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	render.Status(r, http.StatusOK)
+}
+
+// GetReferenceFileHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/reference_file
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,ZipFile
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get the zip with the reference solution
+func (rs *TaskResource) GetReferenceFileHandler(w http.ResponseWriter, r *http.Request) {
+
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+	hnd := helper.NewReferenceSolutionFileHandle(task.ID)
+
+	if !hnd.Exists() {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	if err := hnd.WriteToBody(w); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+	}
+
+}
+
+// ChangeReferenceFileHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/reference_file
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: post
+// TAG: tasks
+// REQUEST: Zipfile
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  change the zip with the reference solution
+// DESCRIPTION:
+// The reference solution is tested against the public and private tests
+// whenever the testing frameworks or docker images change. Sheets containing
+// tasks whose reference solutions were pending or failed before the
+// publication are not published to students until they pass, unless
+// 'ignore_broken_tests' is set for the sheet.
+// Sheets which are published already stay published.
+func (rs *TaskResource) ChangeReferenceFileHandler(w http.ResponseWriter, r *http.Request) {
+	// will always be a POST
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	// the file will be located
+	if _, err := helper.NewReferenceSolutionFileHandle(task.ID).WriteToDisk(r, "file_data"); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := EnqueueReferenceSolution(rs.Stores, rs.TokenAuth, course.ID, task); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
 	render.Status(r, http.StatusOK)
 }
 
+// GetReferenceHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/reference
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,TaskReferenceResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get the test results of the reference solution
+func (rs *TaskResource) GetReferenceHandler(w http.ResponseWriter, r *http.Request) {
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	// render JSON response
+	if err := render.Render(w, r, newTaskReferenceResponse(task)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// PublicReferenceResultHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/reference_public_result
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: post
+// TAG: internal
+// REQUEST: GradeFromWorkerRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  update the public test result of the reference solution from background worker
+func (rs *TaskResource) PublicReferenceResultHandler(w http.ResponseWriter, r *http.Request) {
+	data := &GradeFromWorkerRequest{}
+	// parse JSON request into struct
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	// update database entry
+	if err := rs.Stores.Task.UpdatePublicReferenceInfo(task.ID, data.Log, referenceStateFromWorker(data.Status)); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// PrivateReferenceResultHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/reference_private_result
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: post
+// TAG: internal
+// REQUEST: GradeFromWorkerRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  update the private test result of the reference solution from background worker
+func (rs *TaskResource) PrivateReferenceResultHandler(w http.ResponseWriter, r *http.Request) {
+	data := &GradeFromWorkerRequest{}
+	// parse JSON request into struct
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	// update database entry
+	if err := rs.Stores.Task.UpdatePrivateReferenceInfo(task.ID, data.Log, referenceStateFromWorker(data.Status)); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
 // GetSubmissionResultHandler is public endpoint for
 // URL: /courses/{course_id}/tasks/{task_id}/result
 // URLPARAM: course_id,integer
@@ -415,6 +594,10 @@ func (rs *TaskResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "task", task.ID, task, func() (interface{}, error) {
+			return rs.Stores.Task.Get(task.ID)
+		})
+
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyTask, task)
 
 		// find sheet
@@ -434,7 +617,7 @@ func (rs *TaskResource) Context(next http.Handler) http.Handler {
 		}
 
 		// public yet?
-		if r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole) == authorize.STUDENT && !PublicYet(sheet.PublishAt) {
+		if r.Context().Value(symbol.CtxKeyCourseRole).(authorize.CourseRole) == authorize.STUDENT && !SheetPublic(sheet) {
 			render.Render(w, r, ErrBadRequestWithDetails(fmt.Errorf("sheet not published yet")))
 			return
 		}
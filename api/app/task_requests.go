@@ -32,6 +32,9 @@ type TaskRequest struct {
 	Name               string `json:"name" example:"Task 1"`
 	PublicDockerImage  string `json:"public_docker_image" example:"DefaultJavaTestingImage"`
 	PrivateDockerImage string `json:"private_docker_image" example:"DefaultJavaTestingImage"`
+	// resources of a single test run, zero values use the defaults of the worker
+	CPULimit    float64 `json:"cpu_limit" example:"1.5"`
+	MemoryLimit int64   `json:"memory_limit" example:"524288000"`
 }
 
 // Bind preprocesses a TaskRequest.
@@ -53,5 +56,13 @@ func (body *TaskRequest) Validate() error {
 			&body.Name,
 			validation.Required,
 		),
+		validation.Field(
+			&body.CPULimit,
+			validation.Min(0.0),
+		),
+		validation.Field(
+			&body.MemoryLimit,
+			validation.Min(0),
+		),
 	)
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/go-chi/render"
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
 	null "gopkg.in/guregu/null.v3"
 )
 
@@ -37,6 +38,8 @@ type TaskResponse struct {
 	MaxPoints          int         `json:"max_points" example:"23"`
 	PublicDockerImage  null.String `json:"public_docker_image" example:"DefaultJavaTestingImage"`
 	PrivateDockerImage null.String `json:"private_docker_image" example:"DefaultJavaTestingImage"`
+	CPULimit           float64     `json:"cpu_limit" example:"1.5"`
+	MemoryLimit        int64       `json:"memory_limit" example:"524288000"`
 }
 
 // newTaskResponse creates a response from a Task model.
@@ -47,6 +50,8 @@ func newTaskResponse(p *model.Task) *TaskResponse {
 		MaxPoints:          p.MaxPoints,
 		PublicDockerImage:  p.PublicDockerImage,
 		PrivateDockerImage: p.PrivateDockerImage,
+		CPULimit:           p.CPULimit,
+		MemoryLimit:        p.MemoryLimit,
 	}
 }
 
@@ -125,3 +130,36 @@ func newMissingTaskListResponse(Tasks []model.MissingTask, givenRole authorize.C
 	}
 	return list
 }
+
+// TaskReferenceResponse is the response payload for the test results of the
+// reference solution of a task.
+type TaskReferenceResponse struct {
+	TaskID       int64  `json:"task_id" example:"684"`
+	PublicState  int    `json:"public_state" example:"2"`
+	PrivateState int    `json:"private_state" example:"3"`
+	PublicLog    string `json:"public_log" example:"all tests passed"`
+	PrivateLog   string `json:"private_log" example:"failed in line ..."`
+	TestsBroken  bool   `json:"tests_broken" example:"true"`
+}
+
+// newTaskReferenceResponse creates a response from a Task model.
+func newTaskReferenceResponse(p *model.Task) *TaskReferenceResponse {
+	broken := func(state int) bool {
+		return symbol.ReferenceState(state) == symbol.ReferenceStatePending ||
+			symbol.ReferenceState(state) == symbol.ReferenceStateFailed
+	}
+
+	return &TaskReferenceResponse{
+		TaskID:       p.ID,
+		PublicState:  p.ReferencePublicState,
+		PrivateState: p.ReferencePrivateState,
+		PublicLog:    p.ReferencePublicLog,
+		PrivateLog:   p.ReferencePrivateLog,
+		TestsBroken:  broken(p.ReferencePublicState) || broken(p.ReferencePrivateState),
+	}
+}
+
+// Render post-processes a TaskReferenceResponse.
+func (body *TaskReferenceResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -23,12 +23,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"testing"
 
 	"github.com/franela/goblin"
 	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/symbol"
 )
 
 func TestTask(t *testing.T) {
@@ -219,6 +223,241 @@ func TestTask(t *testing.T) {
 			g.Assert(w.Code).Equal(http.StatusForbidden)
 		})
 
+		g.It("Should block publishing until the reference solution passes", func() {
+			defer helper.NewPublicTestFileHandle(1).Delete()
+			defer helper.NewReferenceSolutionFileHandle(1).Delete()
+
+			_, err := tape.DB.Exec("UPDATE tasks SET public_docker_image = 'test_image', private_docker_image = NULL WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			w := tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/public_file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// tutors cannot upload reference solutions
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/reference_file", filename, "application/zip", tutorJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/reference_file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			taskAfter, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(taskAfter.ReferencePublicState).Equal(int(symbol.ReferenceStatePending))
+			g.Assert(taskAfter.ReferencePrivateState).Equal(int(symbol.ReferenceStateNone))
+
+			// pending tests do not take the published sheet down
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/courses/1/tasks/1/reference_public_result", H{
+				"log":    "some failure",
+				"status": symbol.TestingResultFailed,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/tasks/1/reference", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			reference := &TaskReferenceResponse{}
+			err = json.NewDecoder(w.Body).Decode(reference)
+			g.Assert(err).Equal(nil)
+			g.Assert(reference.PublicState).Equal(int(symbol.ReferenceStateFailed))
+			g.Assert(reference.PublicLog).Equal("some failure")
+			g.Assert(reference.TestsBroken).Equal(true)
+
+			// neither do failures after the publication
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// the tests failed before the sheet has been published
+			_, err = tape.DB.Exec("UPDATE tasks SET reference_blocked_at = '2000-01-01' WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			// failing again does not publish the sheet
+			w = tape.Post("/api/v1/courses/1/tasks/1/reference_public_result", H{
+				"log":    "another failure",
+				"status": symbol.TestingResultFailed,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/courses/1/tasks/1/reference_public_result", H{
+				"log":    "all tests passed",
+				"status": symbol.TestingResultSuccess,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should block publishing while the reference solution is pending", func() {
+			defer helper.NewPublicTestFileHandle(1).Delete()
+			defer helper.NewReferenceSolutionFileHandle(1).Delete()
+
+			_, err := tape.DB.Exec("UPDATE tasks SET public_docker_image = 'test_image', private_docker_image = NULL WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/public_file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w, err = tape.Upload("/api/v1/courses/1/tasks/1/reference_file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// the reference solution has not run yet when the sheet is published
+			_, err = tape.DB.Exec("UPDATE tasks SET reference_blocked_at = '2000-01-01' WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			taskAfter, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(taskAfter.ReferencePublicState).Equal(int(symbol.ReferenceStatePending))
+
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/courses/1/tasks/1/reference_public_result", H{
+				"log":    "all tests passed",
+				"status": symbol.TestingResultSuccess,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			taskAfter, err = stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(taskAfter.ReferencePublicState).Equal(int(symbol.ReferenceStatePassed))
+			g.Assert(taskAfter.ReferenceBlockedAt.Valid).IsFalse()
+
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should publish sheets with broken tests when overridden", func() {
+			_, err := tape.DB.Exec("UPDATE tasks SET reference_public_state = 3 WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			w := tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			_, err = tape.DB.Exec("UPDATE sheets SET ignore_broken_tests = true WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses/1/sheets/1", studentJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should apply reference results received over the result queue", func() {
+			url := "/api/v1/courses/1/tasks/1/reference_public_result"
+			jobToken, err := tape.TokenAuth.CreateJobJWT(authenticate.NewJobClaims("POST " + url))
+			g.Assert(err).Equal(nil)
+
+			body, err := json.Marshal(&shared.SubmissionAMQPWorkerResult{
+				AccessToken:       jobToken,
+				ResultEndpointURL: "http://localhost" + url,
+				Log:               "all tests passed",
+				Status:            symbol.TestingResultSuccess,
+			})
+			g.Assert(err).Equal(nil)
+			g.Assert(NewWorkerResultHandler(stores).Handle(body)).Equal(nil)
+
+			taskAfter, err := stores.Task.Get(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(taskAfter.ReferencePublicState).Equal(int(symbol.ReferenceStatePassed))
+			g.Assert(taskAfter.ReferencePublicLog).Equal("all tests passed")
+
+			// the token does not grant the private result
+			body, err = json.Marshal(&shared.SubmissionAMQPWorkerResult{
+				AccessToken:       jobToken,
+				ResultEndpointURL: "http://localhost/api/v1/courses/1/tasks/1/reference_private_result",
+				Status:            symbol.TestingResultSuccess,
+			})
+			g.Assert(err).Equal(nil)
+			g.Assert(NewWorkerResultHandler(stores).Handle(body) != nil).IsTrue()
+		})
+
+		g.It("Should re-run the tests of all submissions of a task", func() {
+			defer helper.NewPublicTestFileHandle(1).Delete()
+
+			_, err := tape.DB.Exec("UPDATE tasks SET public_docker_image = 'test_image', private_docker_image = NULL WHERE id = 1")
+			g.Assert(err).Equal(nil)
+
+			filename := fmt.Sprintf("%s/empty.zip", configuration.Configuration.Server.Debugging.Fixtures)
+			w, err := tape.Upload("/api/v1/courses/1/tasks/1/public_file", filename, "application/zip", adminJWT)
+			g.Assert(err).Equal(nil)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// a single submission with a file, which passed the tests before
+			grades, err := stores.Grade.GetAllOfTask(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(grades) > 0).Equal(true)
+			grade := grades[0]
+
+			_, err = tape.DB.Exec("UPDATE grades SET public_execution_state = 2, public_test_status = 0 WHERE id = $1", grade.ID)
+			g.Assert(err).Equal(nil)
+
+			src, err := os.Open(filename)
+			g.Assert(err).Equal(nil)
+			defer src.Close()
+			submissionHnd := helper.NewSubmissionFileHandle(grade.SubmissionID)
+			defer submissionHnd.Delete()
+			g.Assert(submissionHnd.WriteFromReader(src, ".zip")).Equal(nil)
+
+			url := "/api/v1/courses/1/tasks/1/test_batches"
+
+			w = tape.Post(url, H{"public": true}, tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			// there are no private tests
+			w = tape.Post(url, H{"private": true}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post(url, H{"public": true}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			batch := &TestBatchResponse{}
+			err = json.NewDecoder(w.Body).Decode(batch)
+			g.Assert(err).Equal(nil)
+			g.Assert(batch.Total).Equal(1)
+			g.Assert(batch.Finished).Equal(0)
+			g.Assert(batch.Done).Equal(false)
+
+			w = tape.Post(fmt.Sprintf("/api/v1/courses/1/grades/%d/public_result?test_batch_id=%d", grade.ID, batch.ID), H{
+				"log":    "now failing",
+				"status": symbol.TestingResultFailed,
+			}, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Get(fmt.Sprintf("%s/%d", url, batch.ID), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			batch = &TestBatchResponse{}
+			err = json.NewDecoder(w.Body).Decode(batch)
+			g.Assert(err).Equal(nil)
+			g.Assert(batch.Finished).Equal(1)
+			g.Assert(batch.Done).Equal(true)
+			g.Assert(batch.PassedToFailed).Equal(1)
+			g.Assert(batch.FailedToPassed).Equal(0)
+			g.Assert(len(batch.Changes)).Equal(1)
+			g.Assert(batch.Changes[0].GradeID).Equal(grade.ID)
+
+			w = tape.Get(url, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			batches := []TestBatchResponse{}
+			err = json.NewDecoder(w.Body).Decode(&batches)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(batches)).Equal(1)
+		})
+
 		g.It("Changes should require claims", func() {
 			w := tape.Put("/api/v1/courses/1/sheets/1/tasks", H{})
 			g.Assert(w.Code).Equal(http.StatusUnauthorized)
@@ -230,6 +469,8 @@ func TestTask(t *testing.T) {
 				"name":                 "new blub",
 				"public_docker_image":  "new_public",
 				"private_docker_image": "new_private",
+				"cpu_limit":            1.5,
+				"memory_limit":         268435456,
 			}
 
 			w := tape.Put("/api/v1/courses/1/tasks/1", data, adminJWT)
@@ -243,6 +484,13 @@ func TestTask(t *testing.T) {
 			g.Assert(taskAfter.PublicDockerImage.String).Equal("new_public")
 			g.Assert(taskAfter.PrivateDockerImage.Valid).Equal(true)
 			g.Assert(taskAfter.PrivateDockerImage.String).Equal("new_private")
+			g.Assert(taskAfter.CPULimit).Equal(1.5)
+			g.Assert(taskAfter.MemoryLimit).Equal(int64(268435456))
+
+			data["cpu_limit"] = -1
+			w = tape.Put("/api/v1/courses/1/tasks/1", data, adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+			data["cpu_limit"] = 1.5
 
 			w = tape.Put("/api/v1/courses/1/tasks/1", data, tutorJWT)
 			g.Assert(w.Code).Equal(http.StatusForbidden)
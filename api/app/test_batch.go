@@ -0,0 +1,307 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/service"
+	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// TestBatchResource specifies handler for re-running the tests of a task.
+type TestBatchResource struct {
+	Stores    *Stores
+	TokenAuth *authenticate.TokenAuth
+}
+
+// NewTestBatchResource create and returns a TestBatchResource.
+func NewTestBatchResource(stores *Stores, tokenAuth *authenticate.TokenAuth) *TestBatchResource {
+	return &TestBatchResource{
+		Stores:    stores,
+		TokenAuth: tokenAuth,
+	}
+}
+
+// EnqueueTestBatch puts all existing submissions of a task again into the
+// testing queue. The jobs are published with a lower priority than fresh
+// uploads. Submissions without a file and tests without docker image or
+// framework are skipped.
+func EnqueueTestBatch(stores *Stores, tokenAuth *authenticate.TokenAuth, courseID int64, task *model.Task, public bool, private bool) (*model.TestBatch, error) {
+	grades, err := stores.Grade.GetAllOfTask(task.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := stores.TestBatch.Create(&model.TestBatch{
+		TaskID:  task.ID,
+		Public:  public,
+		Private: private,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []struct {
+		visibility string
+		image      string
+		framework  *helper.FileHandle
+		enabled    bool
+		state      func(g *model.Grade) (int, int)
+	}{
+		{
+			visibility: "public",
+			image:      task.PublicDockerImage.String,
+			framework:  helper.NewPublicTestFileHandle(task.ID),
+			enabled:    public && testsAvailable(task, "public"),
+			state: func(g *model.Grade) (int, int) {
+				return g.PublicExecutionState, g.PublicTestStatus
+			},
+		},
+		{
+			visibility: "private",
+			image:      task.PrivateDockerImage.String,
+			framework:  helper.NewPrivateTestFileHandle(task.ID),
+			enabled:    private && testsAvailable(task, "private"),
+			state: func(g *model.Grade) (int, int) {
+				return g.PrivateExecutionState, g.PrivateTestStatus
+			},
+		},
+	}
+
+	for k := range grades {
+		grade := &grades[k]
+
+		hnd := helper.NewSubmissionFileHandle(grade.SubmissionID)
+		if !hnd.Exists() {
+			continue
+		}
+
+		sha256, err := hnd.Sha256()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, run := range runs {
+			if !run.enabled {
+				continue
+			}
+
+			statusBefore := null.Int{}
+			if state, status := run.state(grade); state == int(symbol.TestingStateFinished) {
+				statusBefore = null.IntFrom(int64(status))
+			}
+
+			if _, err := stores.TestBatch.CreateRun(&model.TestBatchRun{
+				TestBatchID:  batch.ID,
+				GradeID:      grade.ID,
+				Visibility:   run.visibility,
+				StatusBefore: statusBefore,
+			}); err != nil {
+				return nil, err
+			}
+
+			request := shared.NewSubmissionAMQPWorkerRequest(
+				courseID, task.ID, grade.SubmissionID, grade.ID,
+				configuration.Configuration.Server.ExternalURL(), run.image, sha256, run.visibility)
+			request.LimitResources(task)
+			request.ResultEndpointURL = fmt.Sprintf("%s?test_batch_id=%d", request.ResultEndpointURL, batch.ID)
+
+			if err := PublishJob(DefaultSubmissionProducer, tokenAuth, request, hnd, run.framework, service.BulkPriority); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stores.TestBatch.Get(batch.ID)
+}
+
+// testsAvailable checks whether a task has a docker image and a framework
+// file for the given visibility.
+func testsAvailable(task *model.Task, visibility string) bool {
+	if visibility == "public" {
+		return task.PublicDockerImage.Valid && helper.NewPublicTestFileHandle(task.ID).Exists()
+	}
+	return task.PrivateDockerImage.Valid && helper.NewPrivateTestFileHandle(task.ID).Exists()
+}
+
+// finishTestBatchRun records the result of a worker when the test was part of
+// a test batch (given by the URL parameter "test_batch_id" of the result
+// endpoint).
+func finishTestBatchRun(stores *Stores, batchID int64, gradeID int64, visibility string, status symbol.TestingResult) error {
+	if batchID == 0 {
+		return nil
+	}
+	return stores.TestBatch.FinishRun(batchID, gradeID, visibility, status)
+}
+
+// IndexHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/test_batches
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,TestBatchResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list all re-runs of the tests of a task
+func (rs *TestBatchResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	batches, err := rs.Stores.TestBatch.BatchesOfTask(task.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err = render.RenderList(w, r, newTestBatchListResponse(batches)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// CreateHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/test_batches
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// METHOD: post
+// TAG: tasks
+// REQUEST: TestBatchRequest
+// RESPONSE: 201,TestBatchResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  re-run the tests of all existing submissions of a task
+// DESCRIPTION:
+// This is useful after the testing framework of a task has been changed. The
+// submissions are enqueued with a lower priority than fresh uploads. The
+// returned batch reports the progress and the changes of the results.
+func (rs *TestBatchResource) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	course := r.Context().Value(symbol.CtxKeyCourse).(*model.Course)
+	task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+	data := &TestBatchRequest{}
+	// parse JSON request into struct
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	if data.Public && !testsAvailable(task, "public") {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("task has no public tests")))
+		return
+	}
+
+	if data.Private && !testsAvailable(task, "private") {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("task has no private tests")))
+		return
+	}
+
+	batch, err := EnqueueTestBatch(rs.Stores, rs.TokenAuth, course.ID, task, data.Public, data.Private)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+
+	if err := render.Render(w, r, newTestBatchResponse(batch, nil)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// GetHandler is public endpoint for
+// URL: /courses/{course_id}/tasks/{task_id}/test_batches/{test_batch_id}
+// URLPARAM: course_id,integer
+// URLPARAM: task_id,integer
+// URLPARAM: test_batch_id,integer
+// METHOD: get
+// TAG: tasks
+// RESPONSE: 200,TestBatchResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get the progress and the changed results of a re-run
+func (rs *TestBatchResource) GetHandler(w http.ResponseWriter, r *http.Request) {
+	batch := r.Context().Value(symbol.CtxKeyTestBatch).(*model.TestBatch)
+
+	runs, err := rs.Stores.TestBatch.RunsOfBatch(batch.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// render JSON reponse
+	if err := render.Render(w, r, newTestBatchResponse(batch, runs)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// .............................................................................
+
+// Context middleware is used to load a TestBatch object from
+// the URL parameter `test_batch_id` passed through as the request. In case
+// the TestBatch could not be found or belongs to another task, we stop here
+// and return a 404.
+func (rs *TestBatchResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		task := r.Context().Value(symbol.CtxKeyTask).(*model.Task)
+
+		var batchID int64
+		var err error
+
+		// try to get id from URL
+		if batchID, err = strconv.ParseInt(chi.URLParam(r, "test_batch_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// find specific TestBatch in database
+		batch, err := rs.Stores.TestBatch.Get(batchID)
+		if err != nil || batch.TaskID != task.ID {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyTestBatch, batch)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
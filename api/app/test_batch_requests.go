@@ -0,0 +1,47 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"errors"
+	"net/http"
+)
+
+// TestBatchRequest is the request payload for re-running the tests of a task.
+type TestBatchRequest struct {
+	Public  bool `json:"public" example:"true"`
+	Private bool `json:"private" example:"false"`
+}
+
+// Bind preprocesses a TestBatchRequest.
+func (body *TestBatchRequest) Bind(r *http.Request) error {
+	if body == nil {
+		return errors.New("missing \"test_batch\" data")
+	}
+	return body.Validate()
+}
+
+// Validate validates a TestBatchRequest.
+func (body *TestBatchRequest) Validate() error {
+	if !body.Public && !body.Private {
+		return errors.New("at least one of \"public\" and \"private\" is required")
+	}
+	return nil
+}
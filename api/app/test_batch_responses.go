@@ -0,0 +1,97 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/model"
+)
+
+// TestBatchChangeResponse describes a test whose result has changed by a
+// re-run.
+type TestBatchChangeResponse struct {
+	GradeID      int64  `json:"grade_id" example:"31"`
+	Visibility   string `json:"visibility" example:"public"`
+	StatusBefore int64  `json:"status_before" example:"0"`
+	StatusAfter  int64  `json:"status_after" example:"1"`
+}
+
+// TestBatchResponse is the response payload for a re-run of the tests of a
+// task.
+type TestBatchResponse struct {
+	ID             int64                     `json:"id" example:"4"`
+	CreatedAt      time.Time                 `json:"created_at" example:"auto"`
+	TaskID         int64                     `json:"task_id" example:"12"`
+	Public         bool                      `json:"public" example:"true"`
+	Private        bool                      `json:"private" example:"false"`
+	Total          int                       `json:"total" example:"120"`
+	Finished       int                       `json:"finished" example:"87"`
+	Done           bool                      `json:"done" example:"false"`
+	PassedToFailed int                       `json:"passed_to_failed" example:"3"`
+	FailedToPassed int                       `json:"failed_to_passed" example:"1"`
+	Changes        []TestBatchChangeResponse `json:"changes,omitempty"`
+}
+
+// Render post-processes a TestBatchResponse.
+func (body *TestBatchResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newTestBatchResponse creates a response from a TestBatch model. If the runs
+// are given, all finished tests with a changed result are listed.
+func newTestBatchResponse(p *model.TestBatch, runs []model.TestBatchRun) *TestBatchResponse {
+	changes := []TestBatchChangeResponse{}
+	for _, run := range runs {
+		if run.StatusBefore.Valid && run.StatusAfter.Valid && run.StatusBefore.Int64 != run.StatusAfter.Int64 {
+			changes = append(changes, TestBatchChangeResponse{
+				GradeID:      run.GradeID,
+				Visibility:   run.Visibility,
+				StatusBefore: run.StatusBefore.Int64,
+				StatusAfter:  run.StatusAfter.Int64,
+			})
+		}
+	}
+
+	return &TestBatchResponse{
+		ID:             p.ID,
+		CreatedAt:      p.CreatedAt,
+		TaskID:         p.TaskID,
+		Public:         p.Public,
+		Private:        p.Private,
+		Total:          p.Total,
+		Finished:       p.Finished,
+		Done:           p.Finished == p.Total,
+		PassedToFailed: p.PassedToFailed,
+		FailedToPassed: p.FailedToPassed,
+		Changes:        changes,
+	}
+}
+
+// newTestBatchListResponse creates a response from a list of TestBatch models.
+func newTestBatchListResponse(batches []model.TestBatch) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range batches {
+		list = append(list, newTestBatchResponse(&batches[k], nil))
+	}
+	return list
+}
@@ -0,0 +1,448 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alexedwards/scs"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/auth/totp"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// numRecoveryCodes is the number of one-time codes handed out when the second
+// factor is enabled.
+const numRecoveryCodes = 10
+
+var (
+	errTwoFactorCodeRequired = errors.New("two-factor code required")
+	errInvalidTwoFactorCode  = errors.New("invalid two-factor code")
+)
+
+// TwoFactorResource specifies handler for the TOTP second factor of the
+// request identity.
+type TwoFactorResource struct {
+	Stores      *Stores
+	SessionAuth *scs.Manager
+}
+
+// NewTwoFactorResource create and returns a TwoFactorResource.
+func NewTwoFactorResource(stores *Stores, sessionAuth *scs.Manager) *TwoFactorResource {
+	return &TwoFactorResource{
+		Stores:      stores,
+		SessionAuth: sessionAuth,
+	}
+}
+
+// GetHandler is public endpoint for
+// URL: /account/two_factor
+// METHOD: get
+// TAG: account
+// RESPONSE: 200,TwoFactorResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  state of the second factor of the request identity
+func (rs *TwoFactorResource) GetHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	required, err := twoFactorRequired(rs.Stores, user)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	resp := &TwoFactorResponse{Required: required}
+
+	twoFactor, err := rs.Stores.TwoFactor.Get(user.ID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	case twoFactor.Enabled:
+		resp.Enabled = true
+		if resp.RecoveryCodesLeft, err = rs.Stores.TwoFactor.UnusedRecoveryCodes(user.ID); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// EnrollHandler is public endpoint for
+// URL: /account/two_factor
+// METHOD: post
+// TAG: account
+// RESPONSE: 201,TwoFactorEnrollmentResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  start to set up a second factor
+// DESCRIPTION:
+// The provisioning URI should be shown as QR code to be scanned by an
+// authenticator app. The second factor is not active before a code of the
+// app has been sent to /account/two_factor/confirm.
+func (rs *TwoFactorResource) EnrollHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	// a previous enrollment which has never been confirmed is started over
+	twoFactor, err := rs.Stores.TwoFactor.Get(user.ID)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = rs.Stores.TwoFactor.Create(&model.TwoFactor{
+			UserID: user.ID,
+			Secret: secret,
+		})
+	case err != nil:
+	case twoFactor.Enabled:
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is already enabled")))
+		return
+	default:
+		twoFactor.Secret = secret
+		twoFactor.LastCounter = 0
+		err = rs.Stores.TwoFactor.Update(twoFactor)
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	issuer := configuration.Configuration.Server.Authentication.TwoFactor.Issuer
+	resp := &TwoFactorEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(issuer, user.Email, secret),
+	}
+
+	render.Status(r, http.StatusCreated)
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// ConfirmHandler is public endpoint for
+// URL: /account/two_factor/confirm
+// METHOD: post
+// TAG: account
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 200,TwoFactorRecoveryCodesResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  enable the second factor
+// DESCRIPTION:
+// The code of the authenticator app proves the secret has been stored.
+// The response contains recovery codes, each can be used once instead of a
+// code of the app. A session which was restricted to set up the second factor
+// is lifted, clients using tokens have to log in again.
+func (rs *TwoFactorResource) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	twoFactor, err := rs.Stores.TwoFactor.Get(accessClaims.LoginID)
+	if err == sql.ErrNoRows {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication has not been set up")))
+		return
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if twoFactor.Enabled {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is already enabled")))
+		return
+	}
+
+	// recovery codes do not exist yet, so only the app can confirm
+	counter, ok := totp.Validate(twoFactor.Secret, data.Code, NowUTC())
+	if !ok {
+		render.Render(w, r, ErrBadRequestWithDetails(errInvalidTwoFactorCode))
+		return
+	}
+
+	twoFactor.Enabled = true
+	twoFactor.LastCounter = counter
+	if err := rs.Stores.TwoFactor.Update(twoFactor); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(rs.Stores, twoFactor.UserID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if accessClaims.SetupTwoFactor && !authenticate.HasHeaderToken(r) {
+		accessClaims.SetupTwoFactor = false
+		w = accessClaims.WriteToSession(rs.SessionAuth, w, r)
+	}
+
+	if err := render.Render(w, r, &TwoFactorRecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// RecoveryCodesHandler is public endpoint for
+// URL: /account/two_factor/recovery_codes
+// METHOD: post
+// TAG: account
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 200,TwoFactorRecoveryCodesResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  replace all recovery codes by new ones
+func (rs *TwoFactorResource) RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	twoFactor, ok := rs.verify(w, r, accessClaims.LoginID, data.Code)
+	if !ok {
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(rs.Stores, twoFactor.UserID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	if err := render.Render(w, r, &TwoFactorRecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// DeleteHandler is public endpoint for
+// URL: /account/two_factor
+// METHOD: delete
+// TAG: account
+// REQUEST: TwoFactorCodeRequest
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  disable the second factor
+// DESCRIPTION:
+// This is not possible if the configuration requires a second factor for the
+// account.
+func (rs *TwoFactorResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	data := &TwoFactorCodeRequest{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, ErrBadRequestWithDetails(err))
+		return
+	}
+
+	user, err := rs.Stores.User.Get(accessClaims.LoginID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	required, err := twoFactorRequired(rs.Stores, user)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+	if required {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is required for this account")))
+		return
+	}
+
+	if _, ok := rs.verify(w, r, user.ID, data.Code); !ok {
+		return
+	}
+
+	if err := rs.Stores.TwoFactor.Delete(user.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// verify loads the enabled second factor of a user and checks the code. It
+// renders the error response itself.
+func (rs *TwoFactorResource) verify(w http.ResponseWriter, r *http.Request, userID int64, code string) (*model.TwoFactor, bool) {
+	twoFactor, err := rs.Stores.TwoFactor.Get(userID)
+	if err == sql.ErrNoRows || (err == nil && !twoFactor.Enabled) {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("two-factor authentication is not enabled")))
+		return nil, false
+	}
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return nil, false
+	}
+
+	ok, err := verifySecondFactor(rs.Stores, twoFactor, code)
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return nil, false
+	}
+	if !ok {
+		render.Render(w, r, ErrBadRequestWithDetails(errInvalidTwoFactorCode))
+		return nil, false
+	}
+	return twoFactor, true
+}
+
+// .............................................................................
+
+// twoFactorRequired tells whether the configuration requires a second factor
+// for a user.
+func twoFactorRequired(stores *Stores, user *model.User) (bool, error) {
+	for _, group := range configuration.Configuration.Server.Authentication.TwoFactor.RequiredFor {
+		switch group {
+		case "root":
+			if user.Root {
+				return true, nil
+			}
+		case "admin", "tutor":
+			role, err := stores.Course.HighestRole(user.ID)
+			if err != nil {
+				return false, err
+			}
+			if role == authorize.ADMIN || (group == "tutor" && role == authorize.TUTOR) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// twoFactorSetupPending tells whether a user has to set up a second factor,
+// which the configuration requires, before the account can be used.
+func twoFactorSetupPending(stores *Stores, user *model.User) (bool, error) {
+	twoFactor, err := stores.TwoFactor.Get(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if err == nil && twoFactor.Enabled {
+		return false, nil
+	}
+	return twoFactorRequired(stores, user)
+}
+
+// checkSecondFactor is the second step of a password login. It returns
+// whether the login has to set up a second factor before it can be used.
+func checkSecondFactor(stores *Stores, user *model.User, code string) (bool, error) {
+	twoFactor, err := stores.TwoFactor.Get(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+
+	if err == sql.ErrNoRows || !twoFactor.Enabled {
+		return twoFactorRequired(stores, user)
+	}
+
+	if code == "" {
+		return false, errTwoFactorCodeRequired
+	}
+
+	ok, err := verifySecondFactor(stores, twoFactor, code)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, errInvalidTwoFactorCode
+	}
+	return false, nil
+}
+
+// verifySecondFactor accepts a code of the authenticator app or an unused
+// recovery code. Both can only be used once.
+func verifySecondFactor(stores *Stores, twoFactor *model.TwoFactor, code string) (bool, error) {
+	if counter, ok := totp.Validate(twoFactor.Secret, code, NowUTC()); ok {
+		return stores.TwoFactor.UseCounter(twoFactor.UserID, counter)
+	}
+	return stores.TwoFactor.UseRecoveryCode(twoFactor.UserID, hashRecoveryCode(code))
+}
+
+// replaceRecoveryCodes creates new recovery codes for a user and returns them
+// in plain text.
+func replaceRecoveryCodes(stores *Stores, userID int64) ([]string, error) {
+	codes := make([]string, numRecoveryCodes)
+	hashes := make([]string, numRecoveryCodes)
+	for k := range codes {
+		plain := auth.GenerateToken(5)
+		codes[k] = fmt.Sprintf("%s-%s", plain[:5], plain[5:])
+		hashes[k] = hashRecoveryCode(codes[k])
+	}
+
+	if err := stores.TwoFactor.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case and separators users might type differently.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(code)))
+}
@@ -0,0 +1,60 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"net/http"
+)
+
+// TwoFactorResponse is the state of the second factor of an account.
+type TwoFactorResponse struct {
+	Enabled bool `json:"enabled" example:"true"`
+	// the configuration requires a second factor for this account
+	Required          bool `json:"required" example:"true"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left" example:"10"`
+}
+
+// Render post-processes a TwoFactorResponse.
+func (body *TwoFactorResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TwoFactorEnrollmentResponse contains the secret an authenticator app
+// needs. The provisioning URI is meant to be shown as QR code.
+type TwoFactorEnrollmentResponse struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/InfoMark:test@uni-tuebingen.de?secret=JBSWY3DPEHPK3PXP&issuer=InfoMark"`
+}
+
+// Render post-processes a TwoFactorEnrollmentResponse.
+func (body *TwoFactorEnrollmentResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TwoFactorRecoveryCodesResponse contains new recovery codes. They are only
+// part of this response.
+type TwoFactorRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"3f9a1-c07d2"`
+}
+
+// Render post-processes a TwoFactorRecoveryCodesResponse.
+func (body *TwoFactorRecoveryCodesResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,241 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/totp"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+	otape "github.com/infomark-org/infomark/tape"
+)
+
+func TestTwoFactor(t *testing.T) {
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var w *httptest.ResponseRecorder
+	var stores *Stores
+
+	login := func(code string) *httptest.ResponseRecorder {
+		return tape.Post("/api/v1/auth/sessions", H{
+			"email":           "test@uni-tuebingen.de",
+			"plain_password":  "test",
+			"two_factor_code": code,
+		})
+	}
+
+	// codeAt returns the code of the authenticator app some time steps from now
+	codeAt := func(secret string, steps int64) string {
+		code, err := totp.Code(secret, totp.Counter(time.Now())+steps)
+		g.Assert(err).Equal(nil)
+		return code
+	}
+
+	// enable sets up a second factor for the root user with id 1
+	enable := func() (string, []string) {
+		w := tape.Post("/api/v1/account/two_factor", H{}, tape.NewJWTRequest(1, true))
+		g.Assert(w.Code).Equal(http.StatusCreated)
+		enrollment := &TwoFactorEnrollmentResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(enrollment)).Equal(nil)
+
+		w = tape.Post("/api/v1/account/two_factor/confirm", H{
+			"code": codeAt(enrollment.Secret, -1),
+		}, tape.NewJWTRequest(1, true))
+		g.Assert(w.Code).Equal(http.StatusOK)
+		codes := &TwoFactorRecoveryCodesResponse{}
+		g.Assert(json.NewDecoder(w.Body).Decode(codes)).Equal(nil)
+		return enrollment.Secret, codes.RecoveryCodes
+	}
+
+	g.Describe("TwoFactor", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+			resetLoginLimit()
+		})
+
+		g.It("Should enroll with a provisioning URI", func() {
+			w = tape.Post("/api/v1/account/two_factor", H{}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			enrollment := &TwoFactorEnrollmentResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(enrollment)).Equal(nil)
+			g.Assert(enrollment.ProvisioningURI).Equal(totp.ProvisioningURI(
+				configuration.Configuration.Server.Authentication.TwoFactor.Issuer,
+				"test@uni-tuebingen.de", enrollment.Secret))
+
+			// not active before confirmation
+			w = login("")
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/account/two_factor/confirm", H{"code": "000000"}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should require the code after enabling", func() {
+			secret, codes := enable()
+			g.Assert(len(codes)).Equal(numRecoveryCodes)
+
+			w = tape.Get("/api/v1/account/two_factor", tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusOK)
+			status := &TwoFactorResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(status)).Equal(nil)
+			g.Assert(status.Enabled).Equal(true)
+			g.Assert(status.RecoveryCodesLeft).Equal(numRecoveryCodes)
+
+			w = tape.Post("/api/v1/account/two_factor", H{}, tape.NewJWTRequest(1, true))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = login("")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = login("123456")
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = login(codeAt(secret, 0))
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// a code cannot be replayed
+			w = login(codeAt(secret, 0))
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			w = tape.Post("/api/v1/auth/token", H{
+				"email":           "test@uni-tuebingen.de",
+				"plain_password":  "test",
+				"two_factor_code": "",
+			})
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should accept recovery codes once", func() {
+			_, codes := enable()
+
+			w = login(codes[0])
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = login(codes[0])
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+
+			left, err := stores.TwoFactor.UnusedRecoveryCodes(1)
+			g.Assert(err).Equal(nil)
+			g.Assert(left).Equal(numRecoveryCodes - 1)
+		})
+
+		g.It("Should disable with a code", func() {
+			secret, _ := enable()
+
+			r := otape.BuildDataRequest("DELETE", "/api/v1/account/two_factor", H{"code": codeAt(secret, 0)})
+			tape.NewJWTRequest(1, true).Modify(r)
+			w = tape.PlayRequest(r)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = login("")
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should restrict logins which have to set up a second factor", func() {
+			configuration.Configuration.Server.Authentication.TwoFactor.RequiredFor = []string{"root"}
+
+			w = login("")
+			g.Assert(w.Code).Equal(http.StatusOK)
+			resp := &loginResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(resp)).Equal(nil)
+			g.Assert(resp.SetupTwoFactor).Equal(true)
+			cookies := responseCookies(w)
+
+			w = tape.Get("/api/v1/courses", cookies)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/me", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			w = tape.Post("/api/v1/account/two_factor", H{}, cookies)
+			g.Assert(w.Code).Equal(http.StatusCreated)
+			enrollment := &TwoFactorEnrollmentResponse{}
+			g.Assert(json.NewDecoder(w.Body).Decode(enrollment)).Equal(nil)
+
+			w = tape.Post("/api/v1/account/two_factor/confirm", H{
+				"code": codeAt(enrollment.Secret, 0),
+			}, cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			cookies = responseCookies(w)
+
+			w = tape.Get("/api/v1/courses", cookies)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			// cannot be disabled while it is required
+			r := otape.BuildDataRequest("DELETE", "/api/v1/account/two_factor", H{"code": codeAt(enrollment.Secret, 1)})
+			tape.NewJWTRequest(1, true).Modify(r)
+			w = tape.PlayRequest(r)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should restrict personal access tokens until a second factor is set up", func() {
+			configuration.Configuration.Server.Authentication.TwoFactor.RequiredFor = []string{"root"}
+
+			plainToken, tokenHash := authenticate.NewPersonalAccessToken()
+			_, err := stores.Token.Create(&model.PersonalAccessToken{
+				UserID:    1,
+				Name:      "export grades",
+				TokenHash: tokenHash,
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			g.Assert(err).Equal(nil)
+
+			w = tape.Get("/api/v1/courses", bearerRequest(plainToken))
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			enable()
+
+			w = tape.Get("/api/v1/courses", bearerRequest(plainToken))
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should require a second factor for course roles", func() {
+			configuration.Configuration.Server.Authentication.TwoFactor.RequiredFor = []string{"tutor"}
+
+			// tutor
+			required, err := twoFactorRequired(stores, &model.User{ID: 2})
+			g.Assert(err).Equal(nil)
+			g.Assert(required).Equal(true)
+
+			// student
+			required, err = twoFactorRequired(stores, &model.User{ID: 112})
+			g.Assert(err).Equal(nil)
+			g.Assert(required).Equal(false)
+		})
+
+		g.AfterEach(func() {
+			configuration.Configuration.Server.Authentication.TwoFactor.RequiredFor = []string{}
+			tape.AfterEach()
+		})
+	})
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
+	null "gopkg.in/guregu/null.v3"
 )
 
 // UserResource specifies user management handler.
@@ -284,6 +285,14 @@ func (rs *UserResource) EditHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// a new password logs the user out everywhere
+	if data.PlainPassword != "" {
+		if err := revokeLogins(rs.Stores, user.ID, 0); err != nil {
+			render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+			return
+		}
+	}
+
 	render.Status(r, http.StatusNoContent)
 }
 
@@ -321,7 +330,10 @@ func (rs *UserResource) SendEmailHandler(w http.ResponseWriter, r *http.Request)
 		accessUser,
 	)
 
-	email.OutgoingEmailsChannel <- msg
+	if err := EnqueueEmail(rs.Stores, msg); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
 
 }
 
@@ -347,6 +359,40 @@ func (rs *UserResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	render.Status(r, http.StatusNoContent)
 }
 
+// UnlockHandler is public endpoint for
+// URL: /users/{user_id}/lockout
+// URLPARAM: user_id,integer
+// METHOD: delete
+// TAG: users
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  unlock an account locked after failed logins (requires root)
+func (rs *UserResource) UnlockHandler(w http.ResponseWriter, r *http.Request) {
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+
+	if !accessClaims.Root {
+		render.Render(w, r, ErrUnauthorized)
+		return
+	}
+
+	user := r.Context().Value(symbol.CtxKeyUser).(*model.User)
+
+	if err := rs.Stores.Lockout.Unlock(user.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	event := newAuthEvent(r, model.AuthEventUnlocked, user.Email, null.IntFrom(user.ID))
+	if err := rs.Stores.AuthEvent.Create(event); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
 // .............................................................................
 
 // Context middleware is used to load an User object from
@@ -373,6 +419,10 @@ func (rs *UserResource) Context(next http.Handler) http.Handler {
 			return
 		}
 
+		auditTarget(r, "user", user.ID, user, func() (interface{}, error) {
+			return rs.Stores.User.Get(user.ID)
+		})
+
 		// serve next
 		ctx := context.WithValue(r.Context(), symbol.CtxKeyUser, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,253 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// DefaultWorkerTimeout is the time without heartbeat after which a worker is
+// considered to be stale.
+const DefaultWorkerTimeout = 2 * time.Minute
+
+// WorkerResource specifies handler for the registry of background workers.
+type WorkerResource struct {
+	Stores *Stores
+}
+
+// NewWorkerResource create and returns a WorkerResource.
+func NewWorkerResource(stores *Stores) *WorkerResource {
+	return &WorkerResource{
+		Stores: stores,
+	}
+}
+
+// workerTimeout returns the configured time after which a worker is stale.
+func workerTimeout() time.Duration {
+	if timeout := configuration.Configuration.Server.Jobs.WorkerTimeout; timeout > 0 {
+		return timeout
+	}
+	return DefaultWorkerTimeout
+}
+
+// workerLabel is the value of the "worker" label of metrics. Older workers
+// do not report their name.
+func workerLabel(name string) string {
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// IndexHandler is public endpoint for
+// URL: /workers
+// QUERYPARAM: state,string
+// METHOD: get
+// TAG: workers
+// RESPONSE: 200,WorkerResponseList
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  list all background workers which have sent a heartbeat
+// DESCRIPTION:
+// A worker is stale if it has not sent a heartbeat within the configured
+// worker timeout. The state "live" or "stale" restricts the list.
+func (rs *WorkerResource) IndexHandler(w http.ResponseWriter, r *http.Request) {
+	state := helper.StringFromURL(r, "state", "")
+	if state != "" && state != "live" && state != "stale" {
+		render.Render(w, r, ErrBadRequestWithDetails(errors.New("state must be either live or stale")))
+		return
+	}
+
+	workers, err := rs.Stores.Worker.GetAll()
+	if err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	now := time.Now()
+	filtered := []model.Worker{}
+	for _, worker := range workers {
+		live := isLiveWorker(&worker, now)
+		if state == "" || (state == "live") == live {
+			filtered = append(filtered, worker)
+		}
+	}
+
+	// render JSON reponse
+	if err = render.RenderList(w, r, newWorkerListResponse(filtered, now)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// GetHandler is public endpoint for
+// URL: /workers/{worker_id}
+// URLPARAM: worker_id,integer
+// METHOD: get
+// TAG: workers
+// RESPONSE: 200,WorkerResponse
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  get the last reported state of a background worker
+func (rs *WorkerResource) GetHandler(w http.ResponseWriter, r *http.Request) {
+	worker := r.Context().Value(symbol.CtxKeyWorker).(*model.Worker)
+
+	// render JSON reponse
+	if err := render.Render(w, r, newWorkerResponse(worker, time.Now())); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+}
+
+// DeleteHandler is public endpoint for
+// URL: /workers/{worker_id}
+// URLPARAM: worker_id,integer
+// METHOD: delete
+// TAG: workers
+// RESPONSE: 204,NoContent
+// RESPONSE: 400,BadRequest
+// RESPONSE: 401,Unauthenticated
+// RESPONSE: 403,Unauthorized
+// SUMMARY:  remove a worker from the registry
+// DESCRIPTION:
+// A worker which is still alive registers itself again with its next
+// heartbeat.
+func (rs *WorkerResource) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	worker := r.Context().Value(symbol.CtxKeyWorker).(*model.Worker)
+
+	if err := rs.Stores.Worker.Delete(worker.ID); err != nil {
+		render.Render(w, r, ErrInternalServerErrorWithDetails(err))
+		return
+	}
+
+	workerCapacityGauge.DeleteLabelValues(worker.Name)
+	workerRunningJobsGauge.DeleteLabelValues(worker.Name)
+
+	render.Status(r, http.StatusNoContent)
+}
+
+// .............................................................................
+
+// Context middleware is used to load a Worker object from
+// the URL parameter `worker_id` passed through as the request. In case
+// the Worker could not be found, we stop here and return a 404.
+func (rs *WorkerResource) Context(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var workerID int64
+		var err error
+
+		// try to get id from URL
+		if workerID, err = strconv.ParseInt(chi.URLParam(r, "worker_id"), 10, 64); err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// find specific Worker in database
+		worker, err := rs.Stores.Worker.Get(workerID)
+		if err != nil {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+
+		// serve next
+		ctx := context.WithValue(r.Context(), symbol.CtxKeyWorker, worker)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isLiveWorker tells whether a worker has sent a heartbeat recently.
+func isLiveWorker(worker *model.Worker, now time.Time) bool {
+	return now.Sub(worker.LastSeenAt) <= workerTimeout()
+}
+
+// WorkerHeartbeatHandler stores the heartbeats of workers in the registry.
+type WorkerHeartbeatHandler struct {
+	Stores *Stores
+}
+
+// NewWorkerHeartbeatHandler creates a WorkerHeartbeatHandler.
+func NewWorkerHeartbeatHandler(stores *Stores) *WorkerHeartbeatHandler {
+	return &WorkerHeartbeatHandler{Stores: stores}
+}
+
+// Handle applies a single heartbeat message.
+func (h *WorkerHeartbeatHandler) Handle(body []byte) error {
+	msg := &shared.WorkerHeartbeat{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return err
+	}
+
+	if msg.Name == "" {
+		return errors.New("heartbeat without the name of the worker")
+	}
+
+	if msg.Jobs == nil {
+		msg.Jobs = []shared.WorkerJob{}
+	}
+
+	jobs, err := json.Marshal(msg.Jobs)
+	if err != nil {
+		return err
+	}
+
+	images := msg.Images
+	if images == nil {
+		images = []string{}
+	}
+
+	if err := h.Stores.Worker.Heartbeat(&model.Worker{
+		Name:        msg.Name,
+		Hostname:    msg.Hostname,
+		Version:     msg.Version,
+		Capacity:    msg.Capacity,
+		CPUs:        msg.CPUs,
+		Memory:      msg.Memory,
+		CurrentJobs: len(msg.Jobs),
+		Jobs:        string(jobs),
+		Images:      images,
+		StartedAt:   msg.StartedAt,
+	}); err != nil {
+		return err
+	}
+
+	workerCapacityGauge.WithLabelValues(msg.Name).Set(float64(msg.Capacity))
+	workerRunningJobsGauge.WithLabelValues(msg.Name).Set(float64(len(msg.Jobs)))
+
+	return nil
+}
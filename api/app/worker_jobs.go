@@ -0,0 +1,264 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/service"
+)
+
+// PublishJob hands a job over to the workers. The job gets a token, which is
+// only valid for this job. The checksum of the framework allows workers to
+// cache it. Depending on the configuration, the files are staged in a
+// directory shared with the workers and the result is returned over AMQP.
+func PublishJob(
+	producer Producer, tokenAuth *authenticate.TokenAuth, request *shared.SubmissionAMQPWorkerRequest,
+	submission *helper.FileHandle, framework *helper.FileHandle, priority uint8) error {
+
+	if err := request.Authorize(tokenAuth); err != nil {
+		return err
+	}
+
+	config := configuration.Configuration.Server
+
+	if config.ResultsOverAMQP() {
+		request.ResultQueue = service.ResultQueue
+	}
+
+	frameworkSha256, err := framework.Sha256()
+	if err != nil {
+		return err
+	}
+	request.FrameworkSha256 = frameworkSha256
+
+	if config.Jobs.StagingDirectory != "" {
+		// frameworks are shared by many jobs, submissions are removed by the worker
+		request.StagedFrameworkFile = fmt.Sprintf("framework-%s.zip", frameworkSha256)
+		if err := stageFile(framework, request.StagedFrameworkFile); err != nil {
+			return err
+		}
+
+		request.StagedSubmissionFile = fmt.Sprintf("submission-%s.zip", uuid.New())
+		if err := stageFile(submission, request.StagedSubmissionFile); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	return producer.PublishJob(body, request.DockerImage, priority)
+}
+
+// stageFile copies a file into the staging directory unless it is already
+// there. The file appears atomically, such that workers never read partial
+// files. Staged files are removed once no job can use them anymore, hence
+// reusing a file marks it as recent.
+func stageFile(src *helper.FileHandle, name string) error {
+	dst := filepath.Join(configuration.Configuration.Server.Jobs.StagingDirectory, name)
+	now := time.Now()
+	if os.Chtimes(dst, now, now) == nil {
+		return nil
+	}
+
+	in, err := src.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// concurrent publishes of the same file write to their own temporary file
+	// like "framework-<sha>-123456.zip.tmp"
+	pattern := strings.TrimSuffix(name, filepath.Ext(name)) + "-*" + filepath.Ext(name) + ".tmp"
+	out, err := ioutil.TempFile(filepath.Dir(dst), pattern)
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// workers might run as a different user
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// WorkerResultHandler applies results, which workers return over AMQP. The
+// job token must grant the request the worker would have sent over HTTP,
+// such that a result is only accepted for its own job.
+type WorkerResultHandler struct {
+	Stores *Stores
+}
+
+// NewWorkerResultHandler creates a WorkerResultHandler writing results into
+// the given stores.
+func NewWorkerResultHandler(stores *Stores) *WorkerResultHandler {
+	return &WorkerResultHandler{Stores: stores}
+}
+
+// Endpoints of the results of workers.
+var (
+	gradeResultPath     = regexp.MustCompile(`^/api/v1/courses/\d+/grades/(\d+)/(public|private)_(result|artifacts)$`)
+	referenceResultPath = regexp.MustCompile(`^/api/v1/courses/\d+/tasks/(\d+)/reference_(public|private)_result$`)
+)
+
+// Handle applies a single result message. Artifacts are stored before the
+// result, such that they are complete once the result is visible. Failures of
+// the database are transient, anything else means the message is malformed.
+func (h *WorkerResultHandler) Handle(body []byte) error {
+	msg := &shared.SubmissionAMQPWorkerResult{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return err
+	}
+
+	if len(msg.Artifacts) > 0 && msg.ArtifactsEndpointURL != "" {
+		endpoint, err := authorizeWorkerResult(msg.AccessToken, msg.ArtifactsEndpointURL)
+		if err != nil {
+			return err
+		}
+		if err := h.applyArtifacts(endpoint, msg.Artifacts); err != nil {
+			return err
+		}
+	}
+
+	endpoint, err := authorizeWorkerResult(msg.AccessToken, msg.ResultEndpointURL)
+	if err != nil {
+		return err
+	}
+
+	data := &GradeFromWorkerRequest{
+		Log:        msg.Log,
+		Status:     msg.Status,
+		EnqueuedAt: msg.EnqueuedAt,
+		StartedAt:  msg.StartedAt,
+		FinishedAt: msg.FinishedAt,
+		Worker:     msg.Worker,
+	}
+
+	if match := referenceResultPath.FindStringSubmatch(endpoint.Path); match != nil {
+		taskID, _ := strconv.ParseInt(match[1], 10, 64)
+		state := referenceStateFromWorker(data.Status)
+		if match[2] == "public" {
+			err = h.Stores.Task.UpdatePublicReferenceInfo(taskID, data.Log, state)
+		} else {
+			err = h.Stores.Task.UpdatePrivateReferenceInfo(taskID, data.Log, state)
+		}
+		return transientStoreError(err)
+	}
+
+	match := gradeResultPath.FindStringSubmatch(endpoint.Path)
+	if match == nil || match[3] != "result" {
+		return fmt.Errorf("%s is no result endpoint", endpoint.Path)
+	}
+
+	gradeID, _ := strconv.ParseInt(match[1], 10, 64)
+	grade, err := h.Stores.Grade.Get(gradeID)
+	if err != nil {
+		return transientStoreError(err)
+	}
+
+	batchID, _ := strconv.ParseInt(endpoint.Query().Get("test_batch_id"), 10, 64)
+	return transientStoreError(applyTestResult(h.Stores, grade, match[2], batchID, data))
+}
+
+// applyArtifacts stores the artifacts of a job.
+func (h *WorkerResultHandler) applyArtifacts(endpoint *url.URL, artifacts []byte) error {
+	match := gradeResultPath.FindStringSubmatch(endpoint.Path)
+	if match == nil || match[3] != "artifacts" {
+		return fmt.Errorf("%s is no artifacts endpoint", endpoint.Path)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(artifacts), int64(len(artifacts)))
+	if err != nil {
+		return err
+	}
+
+	entries, err := artifactEntries(archive, int64(configuration.Configuration.Server.HTTP.Limits.MaxArtifacts))
+	if err != nil {
+		return err
+	}
+
+	gradeID, _ := strconv.ParseInt(match[1], 10, 64)
+	if _, err := h.Stores.Grade.Get(gradeID); err != nil {
+		return transientStoreError(err)
+	}
+
+	return transientStoreError(replaceArtifacts(h.Stores, gradeID, match[2], entries))
+}
+
+// authorizeWorkerResult checks that the job token grants posting to the
+// endpoint.
+func authorizeWorkerResult(accessToken string, rawurl string) (*url.URL, error) {
+	endpoint, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &authenticate.JobClaims{}
+	if err := claims.ParseJobClaimsFromToken(configuration.Configuration.Server.Authentication.JWT.Secret, accessToken); err != nil {
+		return nil, err
+	}
+
+	if !claims.Permits(&http.Request{Method: http.MethodPost, URL: endpoint}) {
+		return nil, fmt.Errorf("job token does not grant posting to %s", endpoint.Path)
+	}
+	return endpoint, nil
+}
+
+// transientStoreError marks failures of the database as transient. Missing
+// entries will not appear by retrying.
+func transientStoreError(err error) error {
+	if err == nil || err == sql.ErrNoRows {
+		return err
+	}
+	return service.Transient(err)
+}
@@ -0,0 +1,89 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/model"
+)
+
+// WorkerResponse is the response payload for a background worker.
+type WorkerResponse struct {
+	ID          int64              `json:"id" example:"3"`
+	Name        string             `json:"name" example:"worker-1"`
+	Hostname    string             `json:"hostname" example:"node-7"`
+	Version     string             `json:"version" example:"0.0.1-beta-1"`
+	Capacity    int                `json:"capacity" example:"4"`
+	CPUs        float64            `json:"cpus" example:"4"`
+	Memory      int64              `json:"memory" example:"2147483648"`
+	CurrentJobs int                `json:"current_jobs" example:"1"`
+	Jobs        []shared.WorkerJob `json:"jobs"`
+	Images      []string           `json:"images" example:"python:3.7"`
+	Live        bool               `json:"live" example:"true"`
+	StartedAt   time.Time          `json:"started_at" example:"auto"`
+	LastSeenAt  time.Time          `json:"last_seen_at" example:"auto"`
+}
+
+// Render post-processes a WorkerResponse.
+func (body *WorkerResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newWorkerResponse creates a response from a Worker model.
+func newWorkerResponse(p *model.Worker, now time.Time) *WorkerResponse {
+	jobs := []shared.WorkerJob{}
+	// the jobs are written by the heartbeat handler and are always valid
+	json.Unmarshal([]byte(p.Jobs), &jobs)
+
+	images := []string(p.Images)
+	if images == nil {
+		images = []string{}
+	}
+
+	return &WorkerResponse{
+		ID:          p.ID,
+		Name:        p.Name,
+		Hostname:    p.Hostname,
+		Version:     p.Version,
+		Capacity:    p.Capacity,
+		CPUs:        p.CPUs,
+		Memory:      p.Memory,
+		CurrentJobs: p.CurrentJobs,
+		Jobs:        jobs,
+		Images:      images,
+		Live:        isLiveWorker(p, now),
+		StartedAt:   p.StartedAt,
+		LastSeenAt:  p.LastSeenAt,
+	}
+}
+
+// newWorkerListResponse creates a response from a list of Worker models.
+func newWorkerListResponse(workers []model.Worker, now time.Time) []render.Renderer {
+	list := []render.Renderer{}
+	for k := range workers {
+		list = append(list, newWorkerResponse(&workers[k], now))
+	}
+	return list
+}
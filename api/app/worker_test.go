@@ -0,0 +1,164 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/email"
+)
+
+func TestWorker(t *testing.T) {
+
+	g := goblin.Goblin(t)
+	email.DefaultMail = email.VoidMail
+
+	tape := NewTape()
+
+	var stores *Stores
+
+	tutorJWT := tape.NewJWTRequest(2, false)
+	adminJWT := tape.NewJWTRequest(1, true)
+
+	sendHeartbeat := func(name string, jobs int) {
+		heartbeat := shared.WorkerHeartbeat{
+			Name:      name,
+			Hostname:  "node-1",
+			Version:   "0.0.1",
+			Capacity:  4,
+			CPUs:      2,
+			Memory:    1 << 30,
+			Jobs:      []shared.WorkerJob{},
+			Images:    []string{"python:3.7"},
+			StartedAt: time.Now(),
+			SentAt:    time.Now(),
+		}
+		for k := 0; k < jobs; k++ {
+			heartbeat.Jobs = append(heartbeat.Jobs, shared.WorkerJob{SubmissionID: int64(k + 1)})
+		}
+
+		body, err := json.Marshal(&heartbeat)
+		g.Assert(err).Equal(nil)
+		g.Assert(NewWorkerHeartbeatHandler(stores).Handle(body)).Equal(nil)
+	}
+
+	g.Describe("Worker", func() {
+
+		g.BeforeEach(func() {
+			tape.BeforeEach()
+			stores = NewStores(tape.DB)
+		})
+
+		g.It("Query should require root", func() {
+			w := tape.Get("/api/v1/workers")
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			w = tape.Get("/api/v1/workers", tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Get("/api/v1/workers", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should register workers by their heartbeats", func() {
+			sendHeartbeat("worker-1", 0)
+			sendHeartbeat("worker-2", 0)
+			// a second heartbeat refreshes the entry
+			sendHeartbeat("worker-1", 2)
+
+			w := tape.Get("/api/v1/workers", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			workersActual := []WorkerResponse{}
+			err := json.NewDecoder(w.Body).Decode(&workersActual)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(workersActual)).Equal(2)
+
+			g.Assert(workersActual[0].Name).Equal("worker-1")
+			g.Assert(workersActual[0].Hostname).Equal("node-1")
+			g.Assert(workersActual[0].Capacity).Equal(4)
+			g.Assert(workersActual[0].CPUs).Equal(2.0)
+			g.Assert(workersActual[0].Memory).Equal(int64(1 << 30))
+			g.Assert(workersActual[0].CurrentJobs).Equal(2)
+			g.Assert(len(workersActual[0].Jobs)).Equal(2)
+			g.Assert(workersActual[0].Images).Equal([]string{"python:3.7"})
+			g.Assert(workersActual[0].Live).IsTrue()
+
+			g.Assert(workersActual[1].Name).Equal("worker-2")
+			g.Assert(workersActual[1].CurrentJobs).Equal(0)
+		})
+
+		g.It("Should distinguish live and stale workers", func() {
+			sendHeartbeat("worker-1", 0)
+			sendHeartbeat("worker-2", 0)
+
+			_, err := tape.DB.Exec("UPDATE workers SET last_seen_at = NOW() - INTERVAL '1 hour' WHERE name = 'worker-2'")
+			g.Assert(err).Equal(nil)
+
+			workersActual := []WorkerResponse{}
+
+			w := tape.Get("/api/v1/workers?state=live", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(json.NewDecoder(w.Body).Decode(&workersActual)).Equal(nil)
+			g.Assert(len(workersActual)).Equal(1)
+			g.Assert(workersActual[0].Name).Equal("worker-1")
+
+			w = tape.Get("/api/v1/workers?state=stale", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+			g.Assert(json.NewDecoder(w.Body).Decode(&workersActual)).Equal(nil)
+			g.Assert(len(workersActual)).Equal(1)
+			g.Assert(workersActual[0].Name).Equal("worker-2")
+			g.Assert(workersActual[0].Live).IsFalse()
+
+			w = tape.Get("/api/v1/workers?state=sleepy", adminJWT)
+			g.Assert(w.Code).Equal(http.StatusBadRequest)
+		})
+
+		g.It("Should remove workers from the registry", func() {
+			sendHeartbeat("worker-1", 0)
+
+			workers, err := stores.Worker.GetAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(workers)).Equal(1)
+
+			w := tape.Delete("/api/v1/workers/"+fmt.Sprintf("%d", workers[0].ID), tutorJWT)
+			g.Assert(w.Code).Equal(http.StatusForbidden)
+
+			w = tape.Delete("/api/v1/workers/"+fmt.Sprintf("%d", workers[0].ID), adminJWT)
+			g.Assert(w.Code).Equal(http.StatusOK)
+
+			workers, err = stores.Worker.GetAll()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(workers)).Equal(0)
+		})
+
+		g.AfterEach(func() {
+			tape.AfterEach()
+		})
+
+	})
+
+}
@@ -0,0 +1,123 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cronjob
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/infomark-org/infomark/api/app"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/email"
+	"github.com/infomark-org/infomark/model"
+)
+
+// DeadlineReminder emails students who have not uploaded a solution for all
+// tasks of a sheet which is due soon.
+type DeadlineReminder struct {
+	Stores *app.Stores
+	// remind of sheets due within this time
+	Before time.Duration
+}
+
+// Run sends the reminders for all sheets due within the configured time.
+// Every student gets at most one reminder per sheet, even across restarts.
+func (job *DeadlineReminder) Run() {
+	now := app.NowUTC()
+
+	sheets, err := job.Stores.Reminder.DueSheets(now, now.Add(job.Before))
+	if err != nil {
+		fmt.Println("deadline reminders:", err)
+		return
+	}
+
+	for _, sheet := range sheets {
+		if err := job.remindOfSheet(&sheet); err != nil {
+			fmt.Println("deadline reminders:", err)
+		}
+	}
+}
+
+// remindOfSheet sends the reminders for a sheet to all students without a
+// reminder so far.
+func (job *DeadlineReminder) remindOfSheet(sheet *model.DueSheet) error {
+	students, err := job.Stores.Reminder.Recipients(sheet.SheetID, sheet.CourseID)
+	if err != nil {
+		return err
+	}
+
+	for k := range students {
+		student := &students[k]
+
+		tasks, err := job.missingTasks(student, sheet)
+		if err != nil {
+			return err
+		}
+		// everything has been uploaded, no need to bother
+		if len(tasks) == 0 {
+			continue
+		}
+
+		// claim before sending, a crash in between loses a reminder instead
+		// of sending it twice
+		claimed, err := job.Stores.Reminder.Claim(sheet.SheetID, student.ID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		msg, err := app.NewTemplatedEmail(job.Stores, sheet.CourseID, email.DeadlineReminderTemplate, student, map[string]string{
+			"first_name":  student.FirstName,
+			"last_name":   student.LastName,
+			"course_name": sheet.CourseName,
+			"sheet_name":  sheet.SheetName,
+			"due_at":      sheet.DueAt.Format(time.RFC1123),
+			"tasks":       "   - " + strings.Join(tasks, "\n   - "),
+			"url":         configuration.Configuration.Server.ExternalURL(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := app.EnqueueEmail(job.Stores, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingTasks returns the names of the tasks of the sheet a student has not
+// uploaded any solution for.
+func (job *DeadlineReminder) missingTasks(student *model.User, sheet *model.DueSheet) ([]string, error) {
+	missing, err := job.Stores.Task.GetAllMissingTasksForUser(student.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := []string{}
+	for _, task := range missing {
+		if task.SheetID == sheet.SheetID {
+			tasks = append(tasks, task.Name)
+		}
+	}
+	return tasks, nil
+}
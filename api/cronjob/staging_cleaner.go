@@ -0,0 +1,68 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cronjob
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StagingCleaner removes files from the staging directory which no job uses
+// anymore. Frameworks are shared by all jobs of a task and are staged again
+// for every job. Submissions are removed by the worker, but remain if their
+// job has failed.
+type StagingCleaner struct {
+	Directory string
+	// files which have not been staged within this time are removed
+	MaxAge time.Duration
+}
+
+// Run removes all staged files older than MaxAge.
+func (job *StagingCleaner) Run() {
+	files, err := ioutil.ReadDir(job.Directory)
+	if err != nil {
+		fmt.Println("staging cleaner:", err)
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !isStagedFile(file.Name()) {
+			continue
+		}
+		if time.Since(file.ModTime()) < job.MaxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(job.Directory, file.Name())); err != nil {
+			fmt.Println("staging cleaner:", err)
+		}
+	}
+}
+
+// isStagedFile tells whether a file has been written by the server into the
+// staging directory, including leftovers of interrupted copies.
+func isStagedFile(name string) bool {
+	name = strings.TrimSuffix(name, ".tmp")
+	return strings.HasSuffix(name, ".zip") &&
+		(strings.HasPrefix(name, "framework-") || strings.HasPrefix(name, "submission-"))
+}
@@ -50,6 +50,8 @@ const (
 	MaterialCategory              FileCategory = 4
 	SubmissionCategory            FileCategory = 5
 	SubmissionsCollectionCategory FileCategory = 6
+	ReferenceSolutionCategory     FileCategory = 7
+	GradeArtifactCategory         FileCategory = 8
 )
 
 // FileManager contains all operations we need to handle files
@@ -114,6 +116,17 @@ func NewPrivateTestFileHandle(ID int64) *FileHandle {
 	}
 }
 
+// NewReferenceSolutionFileHandle will handle the reference solution of a
+// task which is used to validate the testing frameworks (zip files).
+func NewReferenceSolutionFileHandle(ID int64) *FileHandle {
+	return &FileHandle{
+		Category:   ReferenceSolutionCategory,
+		ID:         ID,
+		Extensions: []string{"zip"},
+		MaxBytes:   0,
+	}
+}
+
 // NewMaterialFileHandle will handle course slides or extra material (zip files).
 func NewMaterialFileHandle(ID int64) *FileHandle {
 	return &FileHandle{
@@ -134,6 +147,17 @@ func NewSubmissionFileHandle(ID int64) *FileHandle {
 	}
 }
 
+// NewGradeArtifactFileHandle will handle files produced by unit tests. They
+// can have any type.
+func NewGradeArtifactFileHandle(ID int64) *FileHandle {
+	return &FileHandle{
+		Category:   GradeArtifactCategory,
+		ID:         ID,
+		Extensions: []string{},
+		MaxBytes:   0,
+	}
+}
+
 // NewSubmissionsCollectionFileHandle will handle a collection of submissions.
 func NewSubmissionsCollectionFileHandle(courseID int64, sheetID int64,
 	taskID int64, groupID int64) *FileHandle {
@@ -186,6 +210,9 @@ func (f *FileHandle) Path() string {
 	case PrivateTestCategory:
 		return fmt.Sprintf("%s/tasks/%d-private.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
 
+	case ReferenceSolutionCategory:
+		return fmt.Sprintf("%s/tasks/%d-reference.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
+
 	case MaterialCategory:
 
 		for _, ext := range f.Extensions {
@@ -198,6 +225,8 @@ func (f *FileHandle) Path() string {
 
 	case SubmissionCategory:
 		return fmt.Sprintf("%s/submissions/%d.zip", configuration.Configuration.Server.Paths.Uploads, f.ID)
+	case GradeArtifactCategory:
+		return fmt.Sprintf("%s/artifacts/%d", configuration.Configuration.Server.Paths.Uploads, f.ID)
 	case SubmissionsCollectionCategory:
 		return fmt.Sprintf("%s/collection-course%d-sheet%d-task%d-group%d.zip",
 			configuration.Configuration.Server.Paths.GeneratedFiles, f.Infos[0], f.Infos[1], f.Infos[2], f.Infos[3])
@@ -231,6 +260,28 @@ func FileDelete(path string) error {
 	return os.Remove(path)
 }
 
+// FileCopy copies the file at src to dst
+func FileCopy(src string, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if lerr := out.Close(); lerr != nil && err == nil {
+			err = lerr
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
 // Exists checks if a file really exists.
 func (f *FileHandle) Exists() bool {
 	return FileExists(f.Path())
@@ -241,6 +292,56 @@ func (f *FileHandle) Delete() error {
 	return os.Remove(f.Path())
 }
 
+// Open opens the file on disk for reading.
+func (f *FileHandle) Open() (*os.File, error) {
+	return os.Open(f.Path())
+}
+
+// pathWithExtension returns the location of the handle. Categories which
+// store different extensions (avatars, materials) use the given extension
+// (including the leading dot) instead of searching for an existing file.
+func (f *FileHandle) pathWithExtension(ext string) string {
+	switch f.Category {
+	case AvatarCategory:
+		return fmt.Sprintf("%s/avatars/%d%s", configuration.Configuration.Server.Paths.Uploads, f.ID, ext)
+	case MaterialCategory:
+		return fmt.Sprintf("%s/materials/%d%s", configuration.Configuration.Server.Paths.Uploads, f.ID, ext)
+	}
+	return f.Path()
+}
+
+// WriteFromReader stores the content of a reader at the location of the handle.
+// The extension (including the leading dot) is only used by categories which
+// store different extensions (avatars, materials).
+func (f *FileHandle) WriteFromReader(src io.Reader, ext string) error {
+	out, err := os.OpenFile(f.pathWithExtension(ext), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
+}
+
+// CopyTo duplicates the file on disk into the location of another handle.
+// Categories which store different extensions (avatars, materials) keep
+// the extension of the source file.
+func (f *FileHandle) CopyTo(dst *FileHandle) error {
+	srcPath := f.Path()
+	if !FileExists(srcPath) {
+		return fmt.Errorf("file %s does not exist", srcPath)
+	}
+
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return dst.WriteFromReader(in, pathpkg.Ext(srcPath))
+}
+
 // GetContentType tries to predict the content type without reading the entire
 // file. There are some issues with this function as it cannot distinguish
 // between zip and octstream.
@@ -422,6 +523,7 @@ func (f *FileHandle) WriteToDisk(r *http.Request, fieldName string) (string, err
 	case SheetCategory,
 		PublicTestCategory,
 		PrivateTestCategory,
+		ReferenceSolutionCategory,
 		SubmissionCategory:
 		if !IsZipFile(fileMagic) {
 			return "", errors.New("We support ZIP files only. But the given file is no Zip file")
@@ -21,6 +21,7 @@ package api
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -31,6 +32,8 @@ import (
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/infomark-org/infomark/email"
 	"github.com/infomark-org/infomark/migration"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/service"
 	"github.com/jmoiron/sqlx"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/robfig/cron"
@@ -56,6 +59,9 @@ type Server struct {
 	Cron           *cron.Cron
 	Configuration  *configuration.ServerConfigurationSchema
 	Authentication *authenticate.TokenAuth
+	Results        *service.ResultConsumer
+	Heartbeats     *service.ResultConsumer
+	Emails         *email.Queue
 }
 
 // NewServer creates and configures an APIServer serving all application routes.
@@ -65,7 +71,18 @@ func NewServer(config *configuration.ServerConfigurationSchema) (*Server, error)
 	app.InitSubmissionProducer()
 	log.WithField("url", config.URL()).Info("configuring server...")
 
-	if config.SendEmail() {
+	if config.SendEmail() && config.SendEmailOverSMTP() {
+		log.WithFields(logrus.Fields{
+			"host":       config.Email.SMTP.Host,
+			"port":       config.Email.SMTP.Port,
+			"encryption": config.Email.SMTP.Encryption,
+		}).Info("using smtp server")
+		smtpMailer, err := email.NewSMTPMailerFromConfiguration(&config.Email.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		email.DefaultMail = smtpMailer
+	} else if config.SendEmail() {
 		log.WithFields(logrus.Fields{"path": config.Email.SendmailBinary}).Info("found sendmail")
 		email.SendMail = email.NewSendMailer(config.Email.SendmailBinary)
 		email.DefaultMail = email.SendMail
@@ -94,18 +111,71 @@ func NewServer(config *configuration.ServerConfigurationSchema) (*Server, error)
 		MaxHeaderBytes: int(config.HTTP.Limits.MaxHeader),
 	}
 
+	emails := email.NewQueue(app.NewStores(db).OutgoingEmail)
+	emails.RatePerMinute = config.Email.Queue.RatePerMinute
+	if config.Email.Queue.MaxAttempts > 0 {
+		emails.MaxAttempts = config.Email.Queue.MaxAttempts
+	}
+	if config.Email.Queue.RetryBackoff > 0 {
+		emails.Backoff = config.Email.Queue.RetryBackoff
+	}
+	if config.Email.Queue.PollInterval > 0 {
+		emails.PollInterval = config.Email.Queue.PollInterval
+	}
+	emails.Log = func(err error, p *model.OutgoingEmail) {
+		entry := log.WithField("module", "email")
+		if p != nil {
+			entry = entry.WithFields(logrus.Fields{"id": p.ID, "attempts": p.Attempts})
+		}
+		entry.Error(err)
+	}
+	email.DefaultQueue = emails
+
 	c := cron.New()
 	c.AddJob(config.CronjobsZipSubmissionsIntervall(), &cronjob.SubmissionFileZipper{
 		Stores:    app.NewStores(db),
 		DB:        db,
 		Directory: config.Paths.GeneratedFiles,
 	})
+	if config.Cronjobs.DeadlineReminderBefore > 0 && config.Cronjobs.DeadlineRemindersIntervall > 0 {
+		c.AddJob(config.CronjobsDeadlineRemindersIntervall(), &cronjob.DeadlineReminder{
+			Stores: app.NewStores(db),
+			Before: config.Cronjobs.DeadlineReminderBefore,
+		})
+	}
+
+	if config.Jobs.StagingDirectory != "" {
+		tokenAuth := authenticate.NewTokenAuth(&config.Authentication, configuration.Configuration.Worker.Docker.Timeout)
+		c.AddJob("@hourly", &cronjob.StagingCleaner{
+			Directory: config.Jobs.StagingDirectory,
+			MaxAge:    tokenAuth.JwtJobQueueExpiry + tokenAuth.JwtJobExpiry,
+		})
+	}
+
+	var results *service.ResultConsumer
+	if config.DistributeJobs && config.ResultsOverAMQP() {
+		results = service.NewResultConsumer(
+			service.NewConfig(&config.Services.RabbitMQ),
+			app.NewWorkerResultHandler(app.NewStores(db)).Handle,
+		)
+	}
+
+	var heartbeats *service.ResultConsumer
+	if config.DistributeJobs {
+		heartbeats = service.NewHeartbeatConsumer(
+			service.NewConfig(&config.Services.RabbitMQ),
+			app.NewWorkerHeartbeatHandler(app.NewStores(db)).Handle,
+		)
+	}
 
 	return &Server{
 		HTTP:           &srv,
 		Cron:           c,
 		Configuration:  config,
-		Authentication: authenticate.NewTokenAuth(&config.Authentication)}, nil
+		Authentication: authenticate.NewTokenAuth(&config.Authentication, configuration.Configuration.Worker.Docker.Timeout),
+		Results:        results,
+		Heartbeats:     heartbeats,
+		Emails:         emails}, nil
 }
 
 // Start runs ListenAndServe on the http.Server with graceful shutdown.
@@ -122,25 +192,63 @@ func (srv *Server) Start() {
 	}).Info("http is listening")
 
 	log.Info("starting background email sender...")
-	go email.BackgroundSend(email.OutgoingEmailsChannel)
+	emailsStop := make(chan struct{})
+	go srv.Emails.Run(emailsStop)
 
-	log.Info("starting cronjob for zipping submissions...")
+	log.Info("starting cronjobs for zipping submissions and deadline reminders...")
 	srv.Cron.Start()
 
+	if srv.Results != nil {
+		log.Info("starting consumer for worker results...")
+		deliveries, err := srv.Results.Setup()
+		if err != nil {
+			panic(err)
+		}
+		go srv.Results.HandleLoop(deliveries)
+	}
+
+	if srv.Heartbeats != nil {
+		log.Info("starting consumer for worker heartbeats...")
+		deliveries, err := srv.Heartbeats.Setup()
+		if err != nil {
+			panic(err)
+		}
+		go srv.Heartbeats.HandleLoop(deliveries)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	sig := <-quit
 	log.Info("Shutting down server... Reason:", sig)
 
 	// teardown logic...
+	// requests in flight still use everything below
+	if err := srv.HTTP.Shutdown(context.Background()); err != nil {
+		panic(err)
+	}
+	log.Info("Server gracefully stopped")
+
 	srv.Cron.Stop()
 	log.Info("Cronjobs gracefully stopped")
 
-	close(email.OutgoingEmailsChannel)
-	log.Info("Background email sender gracefully stopped")
+	if srv.Results != nil {
+		if err := srv.Results.Shutdown(); err != nil {
+			log.Error(err)
+		}
+		log.Info("Consumer for worker results gracefully stopped")
+	}
 
-	if err := srv.HTTP.Shutdown(context.Background()); err != nil {
-		panic(err)
+	if srv.Heartbeats != nil {
+		if err := srv.Heartbeats.Shutdown(); err != nil {
+			log.Error(err)
+		}
+		log.Info("Consumer for worker heartbeats gracefully stopped")
 	}
-	log.Info("Server gracefully stopped")
+
+	// undelivered emails stay in the store for the next start
+	close(emailsStop)
+	if mailer, ok := email.DefaultMail.(io.Closer); ok {
+		mailer.Close()
+	}
+	log.Info("Background email sender gracefully stopped")
 }
@@ -20,8 +20,15 @@
 package shared
 
 import (
+	"bytes"
 	"fmt"
+	"mime/multipart"
+	"net/http"
 	"time"
+
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
 )
 
 // SubmissionAMQPWorkerRequest is the message which is handed over to the background workers
@@ -33,27 +40,83 @@ type SubmissionAMQPWorkerRequest struct {
 	ResultEndpointURL string    `json:"result_endpoint_url"`
 	DockerImage       string    `json:"docker_image"`
 	Sha256            string    `json:"sha_256"`
+	FrameworkSha256   string    `json:"framework_sha_256,omitempty"`
 	EnqueuedAt        time.Time `json:"enqueued_at"`
+
+	// ResultQueue is set when the result should be published to this AMQP
+	// queue instead of being posted to ResultEndpointURL.
+	ResultQueue string `json:"result_queue,omitempty"`
+	// Files staged in a directory shared with the workers. They replace the
+	// downloads from FrameworkFileURL and SubmissionFileURL.
+	StagedFrameworkFile  string `json:"staged_framework_file,omitempty"`
+	StagedSubmissionFile string `json:"staged_submission_file,omitempty"`
+
+	// Resources the job needs on the worker. Zero values use the defaults of
+	// the worker.
+	CPULimit    float64 `json:"cpu_limit,omitempty"`
+	MemoryLimit int64   `json:"memory_limit,omitempty"`
+
+	// ArtifactsEndpointURL receives the files the tests have written to
+	// /data/output. Jobs without this URL do not collect any files.
+	ArtifactsEndpointURL string `json:"artifacts_endpoint_url,omitempty"`
+}
+
+// SubmissionAMQPWorkerResult is the message handed from the workers to the
+// server over AMQP. It carries the job token and the URL the result would
+// have been posted to.
+type SubmissionAMQPWorkerResult struct {
+	AccessToken       string               `json:"access_token"`
+	ResultEndpointURL string               `json:"result_endpoint_url"`
+	Worker            string               `json:"worker"`
+	Log               string               `json:"log"`
+	Status            symbol.TestingResult `json:"status"`
+	EnqueuedAt        time.Time            `json:"enqueued_at"`
+	StartedAt         time.Time            `json:"started_at"`
+	FinishedAt        time.Time            `json:"finished_at"`
+
+	// zip archive of the collected output files
+	ArtifactsEndpointURL string `json:"artifacts_endpoint_url,omitempty"`
+	Artifacts            []byte `json:"artifacts,omitempty"`
 }
 
-// // SubmissionWorkerResponse is the message handed from the workers to the server
-// type SubmissionWorkerResponse struct {
-// 	Log        string    `json:"log"`
-// 	Status     int       `json:"status"`
-// 	EnqueuedAt time.Time `json:"enqueued_at"`
-// 	StartedAt  time.Time `json:"started_at"`
-// 	FinishedAt time.Time `json:"finished_at"`
-// }
+// WorkerHeartbeat is published periodically by every worker process to
+// announce that it is alive and what it is doing.
+type WorkerHeartbeat struct {
+	Name      string      `json:"name"`
+	Hostname  string      `json:"hostname"`
+	Version   string      `json:"version"`
+	Capacity  int         `json:"capacity"`
+	CPUs      float64     `json:"cpus"`
+	Memory    int64       `json:"memory"`
+	Jobs      []WorkerJob `json:"jobs"`
+	Images    []string    `json:"images"`
+	StartedAt time.Time   `json:"started_at"`
+	SentAt    time.Time   `json:"sent_at"`
+}
+
+// WorkerBroadcast is a message sent to all workers at once.
+type WorkerBroadcast struct {
+	// docker images the workers should pull in advance
+	PullImages []string `json:"pull_images"`
+}
+
+// WorkerJob is a job a worker is currently running.
+type WorkerJob struct {
+	SubmissionID int64     `json:"submission_id"`
+	DockerImage  string    `json:"docker_image"`
+	CPUs         float64   `json:"cpus"`
+	Memory       int64     `json:"memory"`
+	StartedAt    time.Time `json:"started_at"`
+}
 
 // NewSubmissionAMQPWorkerRequest creates a new message for the workers
 func NewSubmissionAMQPWorkerRequest(
 	courseID int64, taskID int64, submissionID int64, gradeID int64,
-	accessToken string, url string, dockerimage string, sha256 string, visibility string) *SubmissionAMQPWorkerRequest {
+	url string, dockerimage string, sha256 string, visibility string) *SubmissionAMQPWorkerRequest {
 
 	return &SubmissionAMQPWorkerRequest{
 		SubmissionID: submissionID,
 		EnqueuedAt:   time.Now(),
-		AccessToken:  accessToken,
 		FrameworkFileURL: fmt.Sprintf("%s/api/v1/courses/%d/tasks/%d/%s_file",
 			url,
 			courseID,
@@ -68,7 +131,108 @@ func NewSubmissionAMQPWorkerRequest(
 			courseID,
 			gradeID,
 			visibility),
+		ArtifactsEndpointURL: fmt.Sprintf("%s/api/v1/courses/%d/grades/%d/%s_artifacts",
+			url,
+			courseID,
+			gradeID,
+			visibility),
 		DockerImage: dockerimage,
 		Sha256:      sha256,
 	}
 }
+
+// NewReferenceAMQPWorkerRequest creates a new message for the workers to test
+// the reference solution of a task.
+func NewReferenceAMQPWorkerRequest(
+	courseID int64, taskID int64,
+	url string, dockerimage string, sha256 string, visibility string) *SubmissionAMQPWorkerRequest {
+
+	return &SubmissionAMQPWorkerRequest{
+		EnqueuedAt: time.Now(),
+		FrameworkFileURL: fmt.Sprintf("%s/api/v1/courses/%d/tasks/%d/%s_file",
+			url,
+			courseID,
+			taskID,
+			visibility),
+		SubmissionFileURL: fmt.Sprintf("%s/api/v1/courses/%d/tasks/%d/reference_file",
+			url,
+			courseID,
+			taskID),
+		ResultEndpointURL: fmt.Sprintf("%s/api/v1/courses/%d/tasks/%d/reference_%s_result",
+			url,
+			courseID,
+			taskID,
+			visibility),
+		DockerImage: dockerimage,
+		Sha256:      sha256,
+	}
+}
+
+// Authorize attaches a job token to the message. The token is only valid for
+// downloading the submission and the framework file of this job and for
+// posting its result and artifacts.
+func (msg *SubmissionAMQPWorkerRequest) Authorize(tokenAuth *authenticate.TokenAuth) error {
+	type jobRequest struct {
+		method string
+		url    string
+	}
+
+	requests := []jobRequest{
+		{method: http.MethodGet, url: msg.FrameworkFileURL},
+		{method: http.MethodGet, url: msg.SubmissionFileURL},
+		{method: http.MethodPost, url: msg.ResultEndpointURL},
+	}
+	if msg.ArtifactsEndpointURL != "" {
+		requests = append(requests, jobRequest{method: http.MethodPost, url: msg.ArtifactsEndpointURL})
+	}
+
+	resources := []string{}
+	for _, request := range requests {
+		resource, err := authenticate.JobResource(request.method, request.url)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, resource)
+	}
+
+	accessToken, err := tokenAuth.CreateJobJWT(authenticate.NewJobClaims(resources...))
+	if err != nil {
+		return err
+	}
+
+	msg.AccessToken = accessToken
+	return nil
+}
+
+// NewArtifactsRequest creates the upload of the artifacts of a job. The zip
+// archive is sent as form field "file_data" like any other file upload.
+func NewArtifactsRequest(url string, accessToken string, artifacts []byte) (*http.Request, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file_data", "artifacts.zip")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(artifacts); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	return r, nil
+}
+
+// LimitResources declares the resources a single run of the tests of a task
+// needs on the worker.
+func (msg *SubmissionAMQPWorkerRequest) LimitResources(task *model.Task) {
+	msg.CPULimit = task.CPULimit
+	msg.MemoryLimit = task.MemoryLimit
+}
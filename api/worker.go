@@ -22,6 +22,8 @@ package api
 import (
 	"os"
 	"os/signal"
+	"path/filepath"
+	"time"
 
 	background "github.com/infomark-org/infomark/api/worker"
 	"github.com/infomark-org/infomark/configuration"
@@ -29,6 +31,10 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultHeartbeatInterval is the time between two heartbeats of a worker
+// if not configured otherwise.
+const DefaultHeartbeatInterval = 30 * time.Second
+
 // Worker provides a background worker
 type Worker struct {
 	NumInstances int
@@ -46,28 +52,104 @@ func (srv *Worker) Start() {
 	log.Println("starting Worker...")
 
 	cfg := service.NewConfig(&configuration.Configuration.Server.Services.RabbitMQ)
+	cfg.Images = configuration.Configuration.Worker.Images
+	if len(cfg.Images) > 0 {
+		log.WithFields(logrus.Fields{"images": cfg.Images}).Info("serve dedicated images only")
+	}
+
+	// the worker runs up to NumInstances jobs at the same time, as long as
+	// their declared resources fit into the budget
+	budget := background.Budget(srv.NumInstances)
+	scheduler := service.NewScheduler(budget, srv.NumInstances)
+	log.WithFields(logrus.Fields{
+		"slots":  srv.NumInstances,
+		"cpus":   budget.CPUs,
+		"memory": budget.Memory,
+	}).Info("start")
 
-	consumers := []*service.Consumer{}
+	background.DefaultStatus = background.NewStatus(srv.NumInstances, budget)
 
-	for i := 0; i < srv.NumInstances; i++ {
-		log.WithFields(logrus.Fields{"instance": i}).Info("start")
-		consumer, _ := service.NewConsumer(cfg, background.DefaultSubmissionHandler.Handle, i)
-		deliveries, err := consumer.Setup()
+	if size := int64(configuration.Configuration.Worker.FrameworkCacheSize); size > 0 {
+		directory := filepath.Join(configuration.Configuration.Worker.Workdir, "infomark-frameworks")
+		cache, err := background.NewFrameworkCache(directory, size)
 		if err != nil {
 			panic(err)
 		}
-		consumers = append(consumers, consumer)
-		go consumers[i].HandleLoop(deliveries)
+		log.WithFields(logrus.Fields{
+			"directory": directory,
+			"size":      cache.Size(),
+			"max_size":  size,
+		}).Info("cache test frameworks")
+		background.DefaultFrameworkCache = cache
 	}
 
+	consumer := service.NewScheduledConsumer(
+		cfg,
+		scheduler,
+		background.DefaultJobResources(),
+		background.JobResources,
+		background.DefaultStatus.Track(background.DefaultSubmissionHandler.Handle),
+	)
+	deliveries, err := consumer.Setup()
+	if err != nil {
+		panic(err)
+	}
+	go consumer.HandleLoop(deliveries)
+
+	broadcasts := service.NewBroadcastConsumer(cfg, background.HandleBroadcast)
+	broadcastDeliveries, err := broadcasts.Setup()
+	if err != nil {
+		panic(err)
+	}
+	go broadcasts.HandleLoop(broadcastDeliveries)
+
+	stopHeartbeats := make(chan struct{})
+	go srv.sendHeartbeats(cfg, stopHeartbeats)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	sig := <-quit
 	log.Println("Shutting down Worker... Reason:", sig)
 
-	for i := 0; i < srv.NumInstances; i++ {
-		consumers[i].Shutdown()
+	close(stopHeartbeats)
+
+	if err := broadcasts.Shutdown(); err != nil {
+		log.Error(err)
+	}
+
+	// running containers are finished before the process exits, waiting jobs
+	// are handed back to the queue
+	if err := consumer.Shutdown(); err != nil {
+		log.Error(err)
 	}
 
 	log.Println("Worker gracefully stopped")
 }
+
+// sendHeartbeats announces the worker to the server until it is stopped.
+func (srv *Worker) sendHeartbeats(cfg *service.Config, stop <-chan struct{}) {
+	interval := configuration.Configuration.Worker.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+
+	log.WithFields(logrus.Fields{
+		"name":     background.DefaultStatus.Name,
+		"interval": interval,
+	}).Info("sending heartbeats")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := background.DefaultStatus.SendHeartbeat(cfg, interval); err != nil {
+			log.WithFields(logrus.Fields{"action": "send heartbeat"}).Warn(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/sirupsen/logrus"
+)
+
+// collectsArtifacts tells whether the files the tests write to /data/output
+// are collected for a job.
+func collectsArtifacts(msg *shared.SubmissionAMQPWorkerRequest) bool {
+	return msg.ArtifactsEndpointURL != "" && configuration.Configuration.Worker.Artifacts.MaxSize > 0
+}
+
+// createOutputDirectory creates the directory mounted as /data/output.
+func createOutputDirectory(workdir string) (string, error) {
+	directory := filepath.Join(workdir, "output")
+	if err := os.Mkdir(directory, 0777); err != nil {
+		return "", err
+	}
+
+	// tests do not necessarily run as root within the container and the umask
+	// might have removed the permissions
+	if err := os.Chmod(directory, 0777); err != nil {
+		return "", err
+	}
+	return directory, nil
+}
+
+// collectArtifacts packs the regular files within the output directory into
+// a zip archive. Files beyond maxFiles (0 means no limit) or beyond a total
+// size of maxSize are skipped. It returns nil if there are no files.
+func collectArtifacts(directory string, maxSize int64, maxFiles int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+
+	files := 0
+	total := int64(0)
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// symlinks might point to files of the worker
+		if !info.Mode().IsRegular() || info.Size() == 0 {
+			return nil
+		}
+
+		name, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if maxFiles > 0 && files >= maxFiles {
+			DefaultLogger.WithFields(logrus.Fields{"artifact": name}).Warn("skip artifact, too many files")
+			return nil
+		}
+		if total+info.Size() > maxSize {
+			DefaultLogger.WithFields(logrus.Fields{"artifact": name, "size": info.Size()}).Warn("skip artifact, too large")
+			return nil
+		}
+
+		if err := addArtifact(archive, path, name, info.Size()); err != nil {
+			return err
+		}
+
+		files++
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	if files == 0 {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// addArtifact writes a single file into the archive. Only the size observed
+// during the walk is read, as the file cannot change anymore after the run.
+func addArtifact(archive *zip.Writer, path string, name string, size int64) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, io.LimitReader(in, size))
+	return err
+}
+
+// uploadArtifacts sends the collected files to the server.
+func uploadArtifacts(msg *shared.SubmissionAMQPWorkerRequest, artifacts []byte) error {
+	r, err := shared.NewArtifactsRequest(msg.ArtifactsEndpointURL, msg.AccessToken, artifacts)
+	if err != nil {
+		return err
+	}
+
+	client := newHTTPClientSingleRequest()
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("server rejected artifacts with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infomark-org/infomark/api/helper"
+)
+
+// DefaultFrameworkCache is the cache of test frameworks of this worker. It is
+// nil if caching is disabled.
+var DefaultFrameworkCache *FrameworkCache
+
+// FrameworkCache keeps test frameworks on disk by their sha256 checksum, such
+// that a framework is only downloaded once for all submissions of a task. The
+// least recently used frameworks are removed when the cache exceeds its size.
+type FrameworkCache struct {
+	Directory string
+	MaxSize   int64
+
+	mu      sync.Mutex
+	lru     *list.List // front is the most recently used
+	entries map[string]*list.Element
+	size    int64
+	// downloads in progress, other jobs wait for them
+	loading map[string]chan struct{}
+}
+
+// frameworkCacheEntry is a single framework within the cache.
+type frameworkCacheEntry struct {
+	sha256 string
+	size   int64
+}
+
+// NewFrameworkCache creates a cache in the given directory. Frameworks which
+// are already in the directory are taken over, such that the cache survives
+// restarts of the worker.
+func NewFrameworkCache(directory string, maxSize int64) (*FrameworkCache, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	c := &FrameworkCache{
+		Directory: directory,
+		MaxSize:   maxSize,
+		lru:       list.New(),
+		entries:   make(map[string]*list.Element),
+		loading:   make(map[string]chan struct{}),
+	}
+
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	// the modification time is updated on every hit
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(name, "download-") {
+			// left over from an interrupted download
+			os.Remove(filepath.Join(directory, name))
+			continue
+		}
+
+		sha256 := strings.TrimSuffix(name, ".zip")
+		if !isSha256(sha256) {
+			continue
+		}
+
+		c.entries[sha256] = c.lru.PushBack(&frameworkCacheEntry{sha256: sha256, size: file.Size()})
+		c.size += file.Size()
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// isSha256 checks that a key is a hex-encoded sha256 checksum and therefore
+// a safe filename.
+func isSha256(key string) bool {
+	b, err := hex.DecodeString(key)
+	return err == nil && len(b) == 32
+}
+
+func (c *FrameworkCache) path(sha256 string) string {
+	return filepath.Join(c.Directory, sha256+".zip")
+}
+
+// Get places the framework with the given checksum at dst. If the framework
+// is not cached yet, it is fetched and verified first.
+func (c *FrameworkCache) Get(sha256 string, dst string, fetch func(dst string) error) error {
+	sha256 = strings.ToLower(sha256)
+	if !isSha256(sha256) {
+		return fmt.Errorf("invalid framework checksum %q", sha256)
+	}
+
+	for {
+		c.mu.Lock()
+		if el, ok := c.entries[sha256]; ok {
+			c.lru.MoveToFront(el)
+			now := time.Now()
+			os.Chtimes(c.path(sha256), now, now)
+
+			// the entry cannot be evicted while the lock is held
+			err := linkOrCopy(c.path(sha256), dst)
+			c.mu.Unlock()
+			return err
+		}
+
+		if wait, ok := c.loading[sha256]; ok {
+			c.mu.Unlock()
+			<-wait
+			// if the download has failed, we try it ourselves
+			continue
+		}
+
+		done := make(chan struct{})
+		c.loading[sha256] = done
+		c.mu.Unlock()
+
+		err := c.load(sha256, fetch)
+
+		c.mu.Lock()
+		delete(c.loading, sha256)
+		close(done)
+		c.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// load fetches a framework into the cache.
+func (c *FrameworkCache) load(sha256 string, fetch func(dst string) error) error {
+	tmp, err := ioutil.TempFile(c.Directory, "download-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := fetch(tmp.Name()); err != nil {
+		return err
+	}
+
+	if err := verifySha256(tmp.Name(), sha256); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(sha256)); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[sha256] = c.lru.PushFront(&frameworkCacheEntry{sha256: sha256, size: info.Size()})
+	c.size += info.Size()
+	c.evict()
+
+	return nil
+}
+
+// evict removes the least recently used frameworks until the cache fits into
+// its size. The most recent framework is always kept. The caller must hold
+// the lock.
+func (c *FrameworkCache) evict() {
+	for c.size > c.MaxSize && c.lru.Len() > 1 {
+		el := c.lru.Back()
+		entry := el.Value.(*frameworkCacheEntry)
+
+		os.Remove(c.path(entry.sha256))
+		c.lru.Remove(el)
+		delete(c.entries, entry.sha256)
+		c.size -= entry.size
+	}
+}
+
+// Size returns the number of bytes of all cached frameworks.
+func (c *FrameworkCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// linkOrCopy hard-links src to dst, such that jobs keep their framework even
+// if it is evicted meanwhile. It falls back to a copy across file systems.
+func linkOrCopy(src string, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return helper.FileCopy(src, dst)
+}
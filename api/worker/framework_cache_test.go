@@ -0,0 +1,171 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/helper"
+)
+
+// frameworkServer serves frameworks to a cache and counts the downloads.
+type frameworkServer struct {
+	content   map[string]string
+	downloads int
+}
+
+func (s *frameworkServer) fetch(name string) func(dst string) error {
+	return func(dst string) error {
+		s.downloads++
+		content, ok := s.content[name]
+		if !ok {
+			return errors.New("not found")
+		}
+		return ioutil.WriteFile(dst, []byte(content), 0644)
+	}
+}
+
+func checksum(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+func TestFrameworkCache(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	var dir string
+	var server *frameworkServer
+
+	read := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		g.Assert(err).Equal(nil)
+		return string(content)
+	}
+
+	g.Describe("FrameworkCache", func() {
+
+		g.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "infomark-framework-cache")
+			g.Assert(err).Equal(nil)
+
+			server = &frameworkServer{content: map[string]string{
+				"a": "framework a",
+				"b": "framework b",
+				"c": "framework c",
+			}}
+		})
+
+		g.AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		g.It("Should download a framework only once", func() {
+			cache, err := NewFrameworkCache(filepath.Join(dir, "cache"), 1024)
+			g.Assert(err).Equal(nil)
+
+			for k := 0; k < 2; k++ {
+				dst := filepath.Join(dir, fmt.Sprintf("job%d.zip", k))
+				g.Assert(cache.Get(checksum("framework a"), dst, server.fetch("a"))).Equal(nil)
+				g.Assert(read(dst)).Equal("framework a")
+			}
+
+			g.Assert(server.downloads).Equal(1)
+			g.Assert(cache.Size()).Equal(int64(len("framework a")))
+		})
+
+		g.It("Should reject frameworks with a wrong checksum", func() {
+			cache, err := NewFrameworkCache(filepath.Join(dir, "cache"), 1024)
+			g.Assert(err).Equal(nil)
+
+			// the framework has changed since the job has been published
+			dst := filepath.Join(dir, "job.zip")
+			g.Assert(cache.Get(checksum("framework a"), dst, server.fetch("b")) != nil).IsTrue()
+			g.Assert(cache.Size()).Equal(int64(0))
+
+			files, err := ioutil.ReadDir(filepath.Join(dir, "cache"))
+			g.Assert(err).Equal(nil)
+			g.Assert(len(files)).Equal(0)
+
+			// the next job downloads it again
+			g.Assert(cache.Get(checksum("framework a"), dst, server.fetch("a"))).Equal(nil)
+			g.Assert(read(dst)).Equal("framework a")
+			g.Assert(server.downloads).Equal(2)
+		})
+
+		g.It("Should reject invalid checksums without downloading", func() {
+			cache, err := NewFrameworkCache(filepath.Join(dir, "cache"), 1024)
+			g.Assert(err).Equal(nil)
+
+			g.Assert(cache.Get("../../etc/passwd", filepath.Join(dir, "job.zip"), server.fetch("a")) != nil).IsTrue()
+			g.Assert(server.downloads).Equal(0)
+		})
+
+		g.It("Should evict the least recently used frameworks", func() {
+			size := int64(len("framework a"))
+			cache, err := NewFrameworkCache(filepath.Join(dir, "cache"), 2*size)
+			g.Assert(err).Equal(nil)
+
+			dst := filepath.Join(dir, "job.zip")
+			get := func(name string) {
+				os.Remove(dst)
+				g.Assert(cache.Get(checksum("framework "+name), dst, server.fetch(name))).Equal(nil)
+			}
+
+			get("a")
+			get("b")
+			get("a")
+			get("c")
+			g.Assert(cache.Size()).Equal(2 * size)
+			g.Assert(server.downloads).Equal(3)
+
+			// b has been evicted
+			g.Assert(helper.FileExists(filepath.Join(dir, "cache", checksum("framework a")+".zip"))).IsTrue()
+			g.Assert(helper.FileExists(filepath.Join(dir, "cache", checksum("framework b")+".zip"))).IsFalse()
+
+			get("b")
+			g.Assert(server.downloads).Equal(4)
+		})
+
+		g.It("Should keep the frameworks across restarts", func() {
+			cache, err := NewFrameworkCache(filepath.Join(dir, "cache"), 1024)
+			g.Assert(err).Equal(nil)
+			g.Assert(cache.Get(checksum("framework a"), filepath.Join(dir, "job.zip"), server.fetch("a"))).Equal(nil)
+
+			// left over from an interrupted download
+			g.Assert(ioutil.WriteFile(filepath.Join(dir, "cache", "download-123"), []byte("fram"), 0644)).Equal(nil)
+
+			cache, err = NewFrameworkCache(filepath.Join(dir, "cache"), 1024)
+			g.Assert(err).Equal(nil)
+			g.Assert(cache.Size()).Equal(int64(len("framework a")))
+			g.Assert(helper.FileExists(filepath.Join(dir, "cache", "download-123"))).IsFalse()
+
+			g.Assert(cache.Get(checksum("framework a"), filepath.Join(dir, "job2.zip"), server.fetch("a"))).Equal(nil)
+			g.Assert(server.downloads).Equal(1)
+		})
+
+	})
+}
@@ -0,0 +1,64 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"encoding/json"
+	"runtime"
+
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/service"
+)
+
+// DefaultJobResources are the resources of a job which has not declared
+// any: one core and the configured memory limit of a container.
+func DefaultJobResources() service.Resources {
+	return service.Resources{
+		CPUs:   1,
+		Memory: int64(configuration.Configuration.Worker.Docker.MaxMemory),
+	}
+}
+
+// Budget returns the resources a worker process with the given number of
+// slots hands out to its jobs. Unless configured otherwise, these are all
+// cores of the machine and the memory of a default job per slot.
+func Budget(slots int) service.Resources {
+	budget := service.Resources{
+		CPUs:   configuration.Configuration.Worker.Resources.CPUs,
+		Memory: int64(configuration.Configuration.Worker.Resources.Memory),
+	}
+	return budget.Or(service.Resources{
+		CPUs:   float64(runtime.NumCPU()),
+		Memory: int64(slots) * DefaultJobResources().Memory,
+	})
+}
+
+// JobResources returns the resources a job has declared.
+func JobResources(body []byte) service.Resources {
+	msg := &shared.SubmissionAMQPWorkerRequest{}
+	// broken messages are reported by the handler itself
+	json.Unmarshal(body, msg)
+
+	return service.Resources{
+		CPUs:   msg.CPULimit,
+		Memory: msg.MemoryLimit,
+	}.Or(DefaultJobResources())
+}
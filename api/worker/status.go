@@ -0,0 +1,156 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/service"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// Status keeps track of what a worker process is doing. It is announced to
+// the server by heartbeats.
+type Status struct {
+	Name      string
+	Hostname  string
+	Capacity  int
+	Budget    service.Resources
+	StartedAt time.Time
+
+	mu     sync.Mutex
+	nextID int
+	jobs   map[int]shared.WorkerJob
+}
+
+// DefaultStatus is the status of this worker process
+var DefaultStatus = NewStatus(1, service.Resources{})
+
+// NewStatus creates the status of a worker process running the given number
+// of jobs at the same time within a budget. The name is taken from the
+// configuration and defaults to the hostname.
+func NewStatus(capacity int, budget service.Resources) *Status {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	name := hostname
+	if configuration.Configuration != nil && configuration.Configuration.Worker.Name != "" {
+		name = configuration.Configuration.Worker.Name
+	}
+
+	return &Status{
+		Name:      name,
+		Hostname:  hostname,
+		Capacity:  capacity,
+		Budget:    budget,
+		StartedAt: time.Now(),
+		jobs:      make(map[int]shared.WorkerJob),
+	}
+}
+
+// Track wraps a handler such that the jobs are listed while they are running.
+func (s *Status) Track(handleFunc func(body []byte, resources service.Resources) error) func(body []byte, resources service.Resources) error {
+	return func(body []byte, resources service.Resources) error {
+		msg := &shared.SubmissionAMQPWorkerRequest{}
+		// broken messages are reported by the handler itself
+		json.Unmarshal(body, msg)
+
+		s.mu.Lock()
+		id := s.nextID
+		s.nextID++
+		s.jobs[id] = shared.WorkerJob{
+			SubmissionID: msg.SubmissionID,
+			DockerImage:  msg.DockerImage,
+			CPUs:         resources.CPUs,
+			Memory:       resources.Memory,
+			StartedAt:    time.Now(),
+		}
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			delete(s.jobs, id)
+			s.mu.Unlock()
+		}()
+
+		return handleFunc(body, resources)
+	}
+}
+
+// Heartbeat describes the current state of the worker.
+func (s *Status) Heartbeat() *shared.WorkerHeartbeat {
+	s.mu.Lock()
+	jobs := []shared.WorkerJob{}
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+
+	return &shared.WorkerHeartbeat{
+		Name:      s.Name,
+		Hostname:  s.Hostname,
+		Version:   symbol.Version.String(),
+		Capacity:  s.Capacity,
+		CPUs:      s.Budget.CPUs,
+		Memory:    s.Budget.Memory,
+		Jobs:      jobs,
+		Images:    cachedImages(),
+		StartedAt: s.StartedAt,
+		SentAt:    time.Now(),
+	}
+}
+
+// cachedImages lists the docker images which are available without pulling.
+func cachedImages() []string {
+	if configuration.Configuration.Worker.Void {
+		return []string{}
+	}
+
+	ds, err := service.NewDockerServiceWithTimeout(configuration.Configuration.Worker.Docker.Timeout)
+	if err != nil {
+		DefaultLogger.Warn(err)
+		return []string{}
+	}
+	defer ds.Client.Close()
+
+	images, err := ds.PulledImages()
+	if err != nil {
+		DefaultLogger.Warn(err)
+		return []string{}
+	}
+	return images
+}
+
+// SendHeartbeat publishes the current state of the worker to the server.
+// The heartbeat expires after three intervals.
+func (s *Status) SendHeartbeat(cfg *service.Config, interval time.Duration) error {
+	body, err := json.Marshal(s.Heartbeat())
+	if err != nil {
+		return err
+	}
+	return service.PublishHeartbeat(cfg, body, 3*interval)
+}
@@ -24,12 +24,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/infomark-org/infomark/api/app"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/api/shared"
@@ -42,7 +43,7 @@ import (
 
 // SubmissionHandler is any handler capable to work on submissions
 type SubmissionHandler interface {
-	Handle(body []byte) error
+	Handle(body []byte, resources service.Resources) error
 }
 
 // DummySubmissionHandler is doing nothing (for testing)
@@ -77,7 +78,7 @@ func init() {
 }
 
 // Handle reads message and does nothing
-func (h *DummySubmissionHandler) Handle(workerBody []byte) error {
+func (h *DummySubmissionHandler) Handle(workerBody []byte, resources service.Resources) error {
 	// decode incoming message from AMQP
 	msg := &shared.SubmissionAMQPWorkerRequest{}
 	err := json.Unmarshal(workerBody, msg)
@@ -136,16 +137,27 @@ func newHTTPClientSingleRequest() *http.Client {
 	}
 }
 
+// downloadFile stores the response of a request at dst. Failures of the
+// server are transient, such that the job is run again later. Any other
+// status means the job cannot succeed, e.g. because its token has expired.
 func downloadFile(r *http.Request, dst string) error {
 	client := newHTTPClientSingleRequest()
 
 	w, err := client.Do(r)
 	if err != nil {
 		DefaultLogger.Printf("error: %v\n", err)
-		return err
+		return service.Transient(err)
 	}
 	defer w.Body.Close()
 
+	if w.StatusCode != http.StatusOK {
+		err := fmt.Errorf("download of %s failed with status %d", r.URL, w.StatusCode)
+		if w.StatusCode >= http.StatusInternalServerError {
+			return service.Transient(err)
+		}
+		return err
+	}
+
 	out, err := os.Create(dst)
 	if err != nil {
 		DefaultLogger.Printf("error: %v\n", err)
@@ -171,8 +183,9 @@ func cleanDockerOutput(stdout string) string {
 	return stdout
 }
 
-// Handle reads message and test submission using docker
-func (h *RealSubmissionHandler) Handle(body []byte) error {
+// Handle reads message and test submission using docker. The container gets
+// the resources which have been reserved for the job.
+func (h *RealSubmissionHandler) Handle(body []byte, resources service.Resources) error {
 	// HandleSubmission is responsible to
 	// 1. parse request
 	msg := &shared.SubmissionAMQPWorkerRequest{}
@@ -192,42 +205,36 @@ func (h *RealSubmissionHandler) Handle(body []byte) error {
 		"Sha256": msg.Sha256,
 	}).Info("start processing")
 
-	uuid, err := uuid.NewRandom()
+	// each job has its own workdir, such that concurrent jobs cannot interfere
+	workdir, err := ioutil.TempDir(configuration.Configuration.Worker.Workdir, "infomark-job-")
 	if err != nil {
 		DefaultLogger.Printf("error: %v\n", err)
 		return err
 	}
-	submissionPath := fmt.Sprintf("%s/%s-submission.zip", configuration.Configuration.Worker.Workdir, uuid)
-	frameworkPath := fmt.Sprintf("%s/%s-framework.zip", configuration.Configuration.Worker.Workdir, uuid)
+	defer os.RemoveAll(workdir)
 
-	// 2. fetch submission file from server
-	r, err := http.NewRequest("GET", msg.SubmissionFileURL, nil)
-	if err != nil {
-		DefaultLogger.Printf("error: %v\n", err)
-		return err
-	}
+	submissionPath := filepath.Join(workdir, "submission.zip")
+	frameworkPath := filepath.Join(workdir, "framework.zip")
 
-	r.Header.Add("Authorization", "Bearer "+msg.AccessToken)
-	if err := downloadFile(r, submissionPath); err != nil {
-		DefaultLogger.Printf("error: %v\n", err)
-		return err
+	outputPath := ""
+	if collectsArtifacts(msg) {
+		if outputPath, err = createOutputDirectory(workdir); err != nil {
+			DefaultLogger.Printf("error: %v\n", err)
+			return err
+		}
 	}
 
-	defer helper.FileDelete(submissionPath)
-
-	// 3. fetch framework file from server
-	r, err = http.NewRequest("GET", msg.FrameworkFileURL, nil)
-	if err != nil {
+	// 2. fetch submission file from server
+	if err := fetchFile(msg.SubmissionFileURL, msg.StagedSubmissionFile, msg.AccessToken, submissionPath); err != nil {
 		DefaultLogger.Printf("error: %v\n", err)
 		return err
 	}
-	r.Header.Add("Authorization", "Bearer "+msg.AccessToken)
 
-	if err := downloadFile(r, frameworkPath); err != nil {
+	// 3. fetch framework file from the cache or from server
+	if err := fetchFramework(msg, frameworkPath); err != nil {
 		DefaultLogger.Printf("error: %v\n", err)
 		return err
 	}
-	defer helper.FileDelete(frameworkPath)
 
 	// Under circumstances there is no guarantee that the following request will be issues
 	// BEFORE the actual test result.
@@ -273,12 +280,15 @@ func (h *RealSubmissionHandler) Handle(body []byte) error {
 	workerResp := &app.GradeFromWorkerRequest{}
 	workerResp.EnqueuedAt = msg.EnqueuedAt
 	workerResp.StartedAt = time.Now()
+	workerResp.Worker = DefaultStatus.Name
 
 	stdout, exit, err = ds.Run(
 		msg.DockerImage,
 		submissionPath,
 		frameworkPath,
-		int64(configuration.Configuration.Worker.Docker.MaxMemory),
+		resources.CPUs,
+		resources.Memory,
+		outputPath,
 	)
 	if err != nil {
 		DefaultLogger.WithFields(logrus.Fields{
@@ -314,34 +324,137 @@ func (h *RealSubmissionHandler) Handle(body []byte) error {
 
 	}
 
-	// we use a HTTP Request to send the answer
-	r = tape.BuildDataRequest("POST", msg.ResultEndpointURL, tape.ToH(workerResp))
-	r.Header.Add("Authorization", "Bearer "+msg.AccessToken)
+	// missing artifacts should not hide the result
+	var artifacts []byte
+	if outputPath != "" {
+		artifacts, err = collectArtifacts(outputPath,
+			int64(configuration.Configuration.Worker.Artifacts.MaxSize),
+			configuration.Configuration.Worker.Artifacts.MaxFiles)
+		if err != nil {
+			DefaultLogger.WithFields(logrus.Fields{
+				"submissionID": msg.SubmissionID,
+				"image":        msg.DockerImage,
+			}).Warn(err)
+		}
+	}
 
 	DefaultLogger.WithFields(logrus.Fields{
 		"submissionID":      msg.SubmissionID,
 		"exitcode":          exit,
 		"image":             msg.DockerImage,
 		"resultEndpointURL": msg.ResultEndpointURL,
+		"resultQueue":       msg.ResultQueue,
+		"artifacts":         len(artifacts),
 	}).Info("send result to backend")
 
-	// run request
-	client := newHTTPClientSingleRequest()
-	resp, err := client.Do(r)
-	if err != nil {
+	if err := sendResult(msg, workerResp, artifacts); err != nil {
 		DefaultLogger.WithFields(logrus.Fields{
 			"action":            "send result to backend",
 			"submissionID":      msg.SubmissionID,
 			"ResultEndpointURL": msg.ResultEndpointURL,
 			"stdout":            stdout,
 			"exitcode":          exit,
-			"resp":              resp,
 			"image":             msg.DockerImage,
 		}).Warn(err)
 
 		return err
 	}
+
+	// the staged submission is only used by this job
+	if msg.StagedSubmissionFile != "" {
+		helper.FileDelete(stagedPath(msg.StagedSubmissionFile))
+	}
+
+	return nil
+}
+
+// stagedPath is the location of a staged file on the worker.
+func stagedPath(name string) string {
+	return filepath.Join(configuration.Configuration.Worker.StagingDirectory, filepath.Base(name))
+}
+
+// fetchFile copies a file from the staging directory if it was staged by the
+// server or downloads it otherwise. The server removes staged files after a
+// while, these are downloaded as well.
+func fetchFile(url string, staged string, accessToken string, dst string) error {
+	if staged != "" && helper.FileExists(stagedPath(staged)) {
+		return helper.FileCopy(stagedPath(staged), dst)
+	}
+
+	r, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	r.Header.Add("Authorization", "Bearer "+accessToken)
+
+	return downloadFile(r, dst)
+}
+
+// fetchFramework places the framework of a job at dst. Frameworks are taken
+// from the cache if the server has sent their checksum.
+func fetchFramework(msg *shared.SubmissionAMQPWorkerRequest, dst string) error {
+	fetch := func(dst string) error {
+		return fetchFile(msg.FrameworkFileURL, msg.StagedFrameworkFile, msg.AccessToken, dst)
+	}
+
+	if DefaultFrameworkCache == nil || msg.FrameworkSha256 == "" {
+		return fetch(dst)
+	}
+	return DefaultFrameworkCache.Get(msg.FrameworkSha256, dst, fetch)
+}
+
+// sendResult hands the result and the artifacts back to the server, either
+// over the result queue or as HTTP requests.
+func sendResult(msg *shared.SubmissionAMQPWorkerRequest, workerResp *app.GradeFromWorkerRequest, artifacts []byte) error {
+	if msg.ResultQueue != "" {
+		body, err := json.Marshal(&shared.SubmissionAMQPWorkerResult{
+			AccessToken:          msg.AccessToken,
+			ResultEndpointURL:    msg.ResultEndpointURL,
+			Worker:               workerResp.Worker,
+			Log:                  workerResp.Log,
+			Status:               workerResp.Status,
+			EnqueuedAt:           workerResp.EnqueuedAt,
+			StartedAt:            workerResp.StartedAt,
+			FinishedAt:           workerResp.FinishedAt,
+			ArtifactsEndpointURL: msg.ArtifactsEndpointURL,
+			Artifacts:            artifacts,
+		})
+		if err != nil {
+			return err
+		}
+
+		cfg := service.NewConfig(&configuration.Configuration.Server.Services.RabbitMQ)
+		return service.Transient(service.PublishResult(cfg, msg.ResultQueue, body))
+	}
+
+	// artifacts are uploaded first, such that they are complete once the
+	// result is visible
+	if len(artifacts) > 0 {
+		if err := uploadArtifacts(msg, artifacts); err != nil {
+			DefaultLogger.WithFields(logrus.Fields{
+				"submissionID":         msg.SubmissionID,
+				"ArtifactsEndpointURL": msg.ArtifactsEndpointURL,
+			}).Warn(err)
+		}
+	}
+
+	// we use a HTTP Request to send the answer
+	r := tape.BuildDataRequest("POST", msg.ResultEndpointURL, tape.ToH(workerResp))
+	r.Header.Add("Authorization", "Bearer "+msg.AccessToken)
+
+	// run request
+	client := newHTTPClientSingleRequest()
+	resp, err := client.Do(r)
+	if err != nil {
+		return service.Transient(err)
+	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return service.Transient(fmt.Errorf("server failed to take result with status %d", resp.StatusCode))
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("server rejected result with status %d", resp.StatusCode)
+	}
 	return nil
 }
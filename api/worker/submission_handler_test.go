@@ -0,0 +1,99 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/service"
+)
+
+func TestSubmissionHandler(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("downloadFile", func() {
+
+		var dir string
+		var status int
+		var server *httptest.Server
+
+		download := func() error {
+			r, err := http.NewRequest("GET", server.URL, nil)
+			g.Assert(err).Equal(nil)
+			return downloadFile(r, filepath.Join(dir, "framework.zip"))
+		}
+
+		g.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "infomark-download")
+			g.Assert(err).Equal(nil)
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+				w.Write([]byte("content"))
+			}))
+		})
+
+		g.AfterEach(func() {
+			server.Close()
+			os.RemoveAll(dir)
+		})
+
+		g.It("Should store the file", func() {
+			status = http.StatusOK
+			g.Assert(download()).Equal(nil)
+
+			content, err := ioutil.ReadFile(filepath.Join(dir, "framework.zip"))
+			g.Assert(err).Equal(nil)
+			g.Assert(string(content)).Equal("content")
+		})
+
+		g.It("Should retry the job if the server fails", func() {
+			status = http.StatusBadGateway
+			err := download()
+			g.Assert(err != nil).IsTrue()
+			g.Assert(service.IsTransient(err)).IsTrue()
+			g.Assert(helper.FileExists(filepath.Join(dir, "framework.zip"))).IsFalse()
+		})
+
+		g.It("Should drop the job if the server refuses the download", func() {
+			status = http.StatusUnauthorized
+			err := download()
+			g.Assert(err != nil).IsTrue()
+			g.Assert(service.IsTransient(err)).IsFalse()
+			g.Assert(helper.FileExists(filepath.Join(dir, "framework.zip"))).IsFalse()
+		})
+
+		g.It("Should retry the job if the server is not reachable", func() {
+			server.Close()
+			err := download()
+			g.Assert(err != nil).IsTrue()
+			g.Assert(service.IsTransient(err)).IsTrue()
+		})
+
+	})
+}
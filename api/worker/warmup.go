@@ -0,0 +1,73 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"encoding/json"
+
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/service"
+	"github.com/sirupsen/logrus"
+)
+
+// HandleBroadcast acts on messages sent to all workers. Requested docker
+// images are pulled in advance, such that the first job of a task does not
+// wait for the download.
+func HandleBroadcast(body []byte) error {
+	msg := &shared.WorkerBroadcast{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return err
+	}
+
+	if len(msg.PullImages) == 0 {
+		return nil
+	}
+
+	if configuration.Configuration.Worker.Void {
+		DefaultLogger.WithFields(logrus.Fields{"images": msg.PullImages}).Info("void worker skips pulling images")
+		return nil
+	}
+
+	ds, err := service.NewDockerServiceWithTimeout(configuration.Configuration.Worker.Docker.Timeout)
+	if err != nil {
+		return err
+	}
+	defer ds.Client.Close()
+
+	pullImages(ds, msg.PullImages)
+	return nil
+}
+
+// imagePuller downloads docker images.
+type imagePuller interface {
+	Pull(image string) (string, error)
+}
+
+// pullImages pulls all images, even if some of them fail.
+func pullImages(puller imagePuller, images []string) {
+	for _, image := range images {
+		DefaultLogger.WithFields(logrus.Fields{"image": image}).Info("pull image")
+		if _, err := puller.Pull(image); err != nil {
+			// other images might still be available
+			DefaultLogger.WithFields(logrus.Fields{"image": image}).Warn(err)
+		}
+	}
+}
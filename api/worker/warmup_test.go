@@ -0,0 +1,80 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package background
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// fakePuller records the pulled images instead of talking to docker.
+type fakePuller struct {
+	pulled []string
+	broken map[string]bool
+}
+
+func (p *fakePuller) Pull(image string) (string, error) {
+	p.pulled = append(p.pulled, image)
+	if p.broken[image] {
+		return "", errors.New("manifest unknown")
+	}
+	return image, nil
+}
+
+func TestWarmup(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Broadcast", func() {
+
+		g.It("Should pull all images even if one fails", func() {
+			puller := &fakePuller{broken: map[string]bool{"missing:1": true}}
+			pullImages(puller, []string{"python:3", "missing:1", "gcc:9"})
+			g.Assert(puller.pulled).Equal([]string{"python:3", "missing:1", "gcc:9"})
+		})
+
+		g.It("Should ignore broadcasts without images", func() {
+			body, err := json.Marshal(&shared.WorkerBroadcast{})
+			g.Assert(err).Equal(nil)
+			g.Assert(HandleBroadcast(body)).Equal(nil)
+		})
+
+		g.It("Should skip pulling on void workers", func() {
+			previous := configuration.Configuration
+			defer func() { configuration.Configuration = previous }()
+
+			configuration.Configuration = &configuration.ConfigurationSchema{}
+			configuration.Configuration.Worker.Void = true
+
+			body, err := json.Marshal(&shared.WorkerBroadcast{PullImages: []string{"python:3"}})
+			g.Assert(err).Equal(nil)
+			g.Assert(HandleBroadcast(body)).Equal(nil)
+		})
+
+		g.It("Should reject malformed broadcasts", func() {
+			g.Assert(HandleBroadcast([]byte("{")) != nil).IsTrue()
+		})
+
+	})
+}
@@ -0,0 +1,119 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+)
+
+var (
+	// ErrInvalidCredentials means no authenticator accepted the credentials.
+	ErrInvalidCredentials = errors.New("credentials are wrong")
+	// ErrNoAccount means the credentials are correct but there is no account
+	// and none may be created.
+	ErrNoAccount = errors.New("there is no account for these credentials")
+)
+
+// UserStore is the part of the user store the authenticators need.
+type UserStore interface {
+	FindByEmail(email string) (*model.User, error)
+	FindByIdentity(provider string, subject string) (*model.User, error)
+	Create(p *model.User) (*model.User, error)
+	Update(p *model.User) error
+	LinkIdentity(userID int64, provider string, subject string) error
+}
+
+// Authenticator checks the email and password of a login.
+type Authenticator interface {
+	Authenticate(email string, password string) (*model.User, error)
+}
+
+// Chain asks its authenticators in order. The first one accepting the
+// credentials wins.
+type Chain []Authenticator
+
+// NewChain creates the authenticators named in the configuration.
+func NewChain(config *configuration.AuthenticationConfiguration, users UserStore) (Chain, error) {
+	names := config.Authenticators
+	if len(names) == 0 {
+		names = []string{"password"}
+	}
+
+	chain := Chain{}
+	for _, name := range names {
+		switch name {
+		case "password":
+			chain = append(chain, &PasswordAuthenticator{Users: users})
+		case "ldap":
+			chain = append(chain, &LDAPAuthenticator{Users: users, Config: &config.LDAP})
+		default:
+			return nil, fmt.Errorf("unknown authenticator %q", name)
+		}
+	}
+	return chain, nil
+}
+
+// Authenticate returns the user of the first authenticator accepting the
+// credentials. Otherwise the first error other than ErrInvalidCredentials
+// is returned, e.g. an unreachable directory.
+func (c Chain) Authenticate(email string, password string) (*model.User, error) {
+	var failure error
+	for _, authenticator := range c {
+		user, err := authenticator.Authenticate(email, password)
+		if err == nil {
+			return user, nil
+		}
+		if err != ErrInvalidCredentials && failure == nil {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return nil, failure
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// PasswordAuthenticator checks the password hash of local accounts.
+type PasswordAuthenticator struct {
+	Users UserStore
+}
+
+// Authenticate implements Authenticator.
+func (a *PasswordAuthenticator) Authenticate(email string, password string) (*model.User, error) {
+	user, err := a.Users.FindByEmail(email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if !auth.CheckPasswordHash(password, user.EncryptedPassword) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
@@ -0,0 +1,266 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/auth/ldap/ldaptest"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// memoryUsers is a user store without database.
+type memoryUsers struct {
+	users      []*model.User
+	identities map[string]int64
+}
+
+func (s *memoryUsers) FindByEmail(email string) (*model.User, error) {
+	for _, user := range s.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memoryUsers) FindByIdentity(provider string, subject string) (*model.User, error) {
+	id, ok := s.identities[provider+"/"+subject]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	for _, user := range s.users {
+		if user.ID == id {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memoryUsers) Create(p *model.User) (*model.User, error) {
+	created := *p
+	created.ID = int64(len(s.users) + 1)
+	s.users = append(s.users, &created)
+	copied := created
+	return &copied, nil
+}
+
+func (s *memoryUsers) Update(p *model.User) error {
+	for i, user := range s.users {
+		if user.ID == p.ID {
+			updated := *p
+			s.users[i] = &updated
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *memoryUsers) LinkIdentity(userID int64, provider string, subject string) error {
+	s.identities[provider+"/"+subject] = userID
+	return nil
+}
+
+func TestChain(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	directory, err := ldaptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer directory.Close()
+
+	directory.RequireTLS = true
+	directory.AddEntry("cn=infomark,ou=services,dc=uni,dc=de", "service-secret", nil)
+	directory.AddEntry("uid=jdoe,ou=people,dc=uni,dc=de", "directory-secret", map[string][]string{
+		"objectClass":  {"inetOrgPerson"},
+		"mail":         {"Jane.Doe@uni.de"},
+		"givenName":    {"Jane"},
+		"sn":           {"Doe"},
+		"employeeType": {"student"},
+		"studentID":    {"4711"},
+	})
+	directory.AddEntry("uid=staff,ou=people,dc=uni,dc=de", "staff-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"mail":        {"staff@uni.de"},
+		"givenName":   {"Sam"},
+	})
+
+	rootCA, err := ioutil.TempFile("", "ldaptest-*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(rootCA.Name())
+	rootCA.Write(directory.CertificatePEM)
+	rootCA.Close()
+
+	var users *memoryUsers
+	var config *configuration.AuthenticationConfiguration
+
+	g.Describe("Chain", func() {
+
+		g.BeforeEach(func() {
+			encryptedPassword, err := auth.HashPassword("local-secret")
+			g.Assert(err).Equal(nil)
+
+			users = &memoryUsers{
+				users: []*model.User{
+					{ID: 1, Email: "staff@uni.de", FirstName: "Staff", EncryptedPassword: encryptedPassword, ConfirmEmailToken: null.StringFrom("token")},
+				},
+				identities: map[string]int64{},
+			}
+
+			config = &configuration.AuthenticationConfiguration{}
+			config.Authenticators = []string{"password", "ldap"}
+			config.LDAP.URL = directory.URL
+			config.LDAP.StartTLS = true
+			config.LDAP.RootCA = rootCA.Name()
+			config.LDAP.Timeout = time.Second
+			config.LDAP.BindDN = "cn=infomark,ou=services,dc=uni,dc=de"
+			config.LDAP.BindPassword = "service-secret"
+			config.LDAP.BaseDN = "ou=people,dc=uni,dc=de"
+			config.LDAP.UserFilter = "(&(objectClass=inetOrgPerson)(mail=%s))"
+			config.LDAP.CreateAccounts = true
+			config.LDAP.Attributes.FirstName = "givenName"
+			config.LDAP.Attributes.LastName = "sn"
+			config.LDAP.Attributes.Email = "mail"
+			config.LDAP.Attributes.StudentNumber = "studentID"
+		})
+
+		g.It("Should default to local passwords", func() {
+			config.Authenticators = nil
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+			g.Assert(len(chain)).Equal(1)
+
+			config.Authenticators = []string{"kerberos"}
+			_, err = authenticate.NewChain(config, users)
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should accept local passwords first", func() {
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+
+			user, err := chain.Authenticate("staff@uni.de", "local-secret")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.ID).Equal(int64(1))
+			g.Assert(user.FirstName).Equal("Staff")
+		})
+
+		g.It("Should create accounts for directory users", func() {
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+
+			user, err := chain.Authenticate("jane.doe@uni.de", "directory-secret")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.ID).Equal(int64(2))
+			g.Assert(user.Email).Equal("jane.doe@uni.de")
+			g.Assert(user.FirstName).Equal("Jane")
+			g.Assert(user.LastName).Equal("Doe")
+			g.Assert(user.StudentNumber).Equal("4711")
+			g.Assert(user.ConfirmEmailToken.Valid).IsFalse()
+			g.Assert(user.Root).IsFalse()
+
+			// the next login uses the linked identity
+			user, err = chain.Authenticate("jane.doe@uni.de", "directory-secret")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.ID).Equal(int64(2))
+			g.Assert(len(users.users)).Equal(2)
+		})
+
+		g.It("Should link existing accounts by email", func() {
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+
+			user, err := chain.Authenticate("staff@uni.de", "staff-secret")
+			g.Assert(err).Equal(nil)
+			g.Assert(user.ID).Equal(int64(1))
+			g.Assert(user.FirstName).Equal("Sam")
+			g.Assert(user.ConfirmEmailToken.Valid).IsFalse()
+			g.Assert(users.identities["ldap/uid=staff,ou=people,dc=uni,dc=de"]).Equal(int64(1))
+
+			// the local password still works
+			_, err = chain.Authenticate("staff@uni.de", "local-secret")
+			g.Assert(err).Equal(nil)
+		})
+
+		g.It("Should reject wrong passwords", func() {
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+
+			for _, password := range []string{"wrong", ""} {
+				_, err = chain.Authenticate("jane.doe@uni.de", password)
+				g.Assert(err).Equal(authenticate.ErrInvalidCredentials)
+			}
+
+			_, err = chain.Authenticate("nobody@uni.de", "directory-secret")
+			g.Assert(err).Equal(authenticate.ErrInvalidCredentials)
+
+			// filter injection must not find another entry
+			_, err = chain.Authenticate("*", "directory-secret")
+			g.Assert(err).Equal(authenticate.ErrInvalidCredentials)
+			g.Assert(len(users.users)).Equal(1)
+		})
+
+		g.It("Should not create accounts when disabled", func() {
+			config.LDAP.CreateAccounts = false
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+
+			_, err = chain.Authenticate("jane.doe@uni.de", "directory-secret")
+			g.Assert(err).Equal(authenticate.ErrNoAccount)
+			g.Assert(len(users.users)).Equal(1)
+		})
+
+		g.It("Should report an unreachable directory", func() {
+			config.LDAP.StartTLS = false
+			chain, err := authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+
+			// the directory refuses binds without TLS
+			_, err = chain.Authenticate("jane.doe@uni.de", "directory-secret")
+			g.Assert(err != nil).IsTrue()
+			g.Assert(err == authenticate.ErrInvalidCredentials).IsFalse()
+
+			config.LDAP.URL = "ldap://127.0.0.1:1"
+			chain, err = authenticate.NewChain(config, users)
+			g.Assert(err).Equal(nil)
+			_, err = chain.Authenticate("jane.doe@uni.de", "directory-secret")
+			g.Assert(err != nil).IsTrue()
+
+			// local accounts still work
+			_, err = chain.Authenticate("staff@uni.de", "local-secret")
+			g.Assert(err).Equal(nil)
+		})
+	})
+
+}
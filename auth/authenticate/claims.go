@@ -21,7 +21,10 @@ package authenticate
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/alexedwards/scs"
 	jwt "github.com/dgrijalva/jwt-go"
@@ -30,9 +33,12 @@ import (
 // AccessClaims represent the claims parsed from JWT access token.
 type AccessClaims struct {
 	jwt.StandardClaims
-	AccessNotRefresh bool  `json:"anr"`      // to distinguish between access and refresh code
-	LoginID          int64 `json:"login_id"` // the id to get user information
-	Root             bool  `json:"root"`     // a global flag to bypass all permission checks
+	AccessNotRefresh bool  `json:"anr"`                        // to distinguish between access and refresh code
+	LoginID          int64 `json:"login_id"`                   // the id to get user information
+	Root             bool  `json:"root"`                       // a global flag to bypass all permission checks
+	SetupTwoFactor   bool  `json:"setup_two_factor,omitempty"` // login is restricted until a second factor is set up
+	SessionID        int64 `json:"sid,omitempty"`              // the registered session, which can be revoked
+	ImpersonationID  int64 `json:"imp,omitempty"`              // a root admin acts as the login
 }
 
 func NewAccessClaims(loginId int64, root bool) AccessClaims {
@@ -48,6 +54,8 @@ type RefreshClaims struct {
 	jwt.StandardClaims
 	AccessNotRefresh bool  `json:"anr"`
 	LoginID          int64 `json:"login_id"`
+	SetupTwoFactor   bool  `json:"setup_two_factor,omitempty"`
+	SessionID        int64 `json:"sid,omitempty"`
 }
 
 func NewRefreshClaims(loginId int64) RefreshClaims {
@@ -57,6 +65,87 @@ func NewRefreshClaims(loginId int64) RefreshClaims {
 	}
 }
 
+// JobClaims represent the claims parsed from a JWT job token. Background
+// workers get a job token for each job, which only grants access to the
+// resources of this job, e.g. downloading the submission and posting the result.
+type JobClaims struct {
+	jwt.StandardClaims
+	Resources []string `json:"resources"` // requests like "GET /api/v1/..." allowed by this token
+}
+
+func NewJobClaims(resources ...string) JobClaims {
+	return JobClaims{
+		Resources: resources,
+	}
+}
+
+// twoFactorSetupResources are the only requests a login may issue while it
+// still has to set up a second factor.
+var twoFactorSetupResources = []string{
+	"GET /api/v1/me",
+	"GET /api/v1/account",
+	"DELETE /api/v1/auth/sessions",
+}
+
+// PermitsDuringTwoFactorSetup checks whether a request is still allowed for a
+// login which has to set up a second factor first.
+func (ret *AccessClaims) PermitsDuringTwoFactorSetup(r *http.Request) bool {
+	if !ret.SetupTwoFactor {
+		return true
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/v1/account/two_factor") {
+		return true
+	}
+	requested := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+	for _, resource := range twoFactorSetupResources {
+		if resource == requested {
+			return true
+		}
+	}
+	return false
+}
+
+// JobResource describes a request to an URL, which can be granted by a job token.
+func JobResource(method string, rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s", method, u.Path), nil
+}
+
+// Permits checks whether the job token grants access to the request.
+func (ret *JobClaims) Permits(r *http.Request) bool {
+	requested := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+	for _, resource := range ret.Resources {
+		if resource == requested {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse job claims from a JWT token string
+func (ret *JobClaims) ParseJobClaimsFromToken(secret string, tokenStr string) error {
+
+	// verify the token
+	token, err := jwt.ParseWithClaims(tokenStr, &JobClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return jobSecret(secret), nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if claims, ok := token.Claims.(*JobClaims); ok && token.Valid {
+		ret.Resources = claims.Resources
+		ret.StandardClaims = claims.StandardClaims
+		return nil
+	}
+
+	return errors.New("token is invalid")
+}
+
 // Parse refresh claims from a token string
 func (ret *RefreshClaims) ParseRefreshClaimsFromToken(secret string, tokenStr string) error {
 
@@ -74,6 +163,8 @@ func (ret *RefreshClaims) ParseRefreshClaimsFromToken(secret string, tokenStr st
 		if !claims.AccessNotRefresh {
 			ret.LoginID = claims.LoginID
 			ret.AccessNotRefresh = claims.AccessNotRefresh
+			ret.SetupTwoFactor = claims.SetupTwoFactor
+			ret.SessionID = claims.SessionID
 			return nil
 		} else {
 			return errors.New("token is an access token, but refresh token was required")
@@ -103,6 +194,9 @@ func (ret *AccessClaims) ParseAccessClaimsFromToken(secret string, tokenStr stri
 			ret.LoginID = claims.LoginID
 			ret.AccessNotRefresh = claims.AccessNotRefresh
 			ret.Root = claims.Root
+			ret.SetupTwoFactor = claims.SetupTwoFactor
+			ret.SessionID = claims.SessionID
+			ret.ImpersonationID = claims.ImpersonationID
 			return nil
 		} else {
 			return errors.New("token is an refresh token, but access token was required")
@@ -126,11 +220,26 @@ func (ret *AccessClaims) ParseRefreshClaimsFromSession(manager *scs.Manager, r *
 	if err != nil {
 		return err
 	}
+	setupTwoFactor, err := session.GetBool("setup_two_factor")
+	if err != nil {
+		return err
+	}
+	sessionID, err := session.GetInt64("session_id")
+	if err != nil {
+		return err
+	}
+	impersonationID, err := session.GetInt64("impersonation_id")
+	if err != nil {
+		return err
+	}
 
 	ret.LoginID = loginId
 	// cookie based authentification is access-token only
 	ret.AccessNotRefresh = true
 	ret.Root = root
+	ret.SetupTwoFactor = setupTwoFactor
+	ret.SessionID = sessionID
+	ret.ImpersonationID = impersonationID
 	return nil
 }
 
@@ -147,6 +256,18 @@ func (ret *AccessClaims) WriteToSession(manager *scs.Manager, w http.ResponseWri
 		panic("hh")
 	}
 	// fmt.Println("Wrote ret.Root", ret.Root)
+	err = session.PutBool(w, "setup_two_factor", ret.SetupTwoFactor)
+	if err != nil {
+		panic("hh")
+	}
+	err = session.PutInt64(w, "session_id", ret.SessionID)
+	if err != nil {
+		panic("hh")
+	}
+	err = session.PutInt64(w, "impersonation_id", ret.ImpersonationID)
+	if err != nil {
+		panic("hh")
+	}
 
 	return w
 }
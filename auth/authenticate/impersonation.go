@@ -0,0 +1,97 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/infomark-org/infomark/model"
+)
+
+// ImpersonationStore is the part of the impersonation store the middleware
+// needs.
+type ImpersonationStore interface {
+	Get(impersonationID int64) (*model.Impersonation, error)
+	LogRequest(p *model.ImpersonationRequest) error
+}
+
+// protectedDuringImpersonation are the prefixes of requests changing the
+// account itself, like its password or email address. An impersonating admin
+// can only read them.
+var protectedDuringImpersonation = []string{
+	"/api/v1/account",
+	"/api/v1/me",
+}
+
+// ValidateImpersonation checks that an impersonation has been neither stopped
+// nor expired.
+func ValidateImpersonation(impersonations ImpersonationStore, impersonationID int64, loginID int64) (*model.Impersonation, error) {
+	impersonation, err := impersonations.Get(impersonationID)
+	if err != nil || impersonation.UserID != loginID {
+		return nil, errors.New("impersonation is invalid")
+	}
+	if !impersonation.Active(time.Now()) {
+		return nil, errors.New("impersonation has ended")
+	}
+	return impersonation, nil
+}
+
+// LogImpersonatedRequests records every request made during an impersonation.
+func LogImpersonatedRequests(impersonations ImpersonationStore, impersonationID int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		// the audit entry is written after the response, a failure cannot be
+		// reported to the client anymore
+		impersonations.LogRequest(&model.ImpersonationRequest{
+			ImpersonationID: impersonationID,
+			Method:          r.Method,
+			Path:            r.URL.Path,
+			Status:          status,
+		})
+	})
+}
+
+// PermitsDuringImpersonation checks whether a request is allowed while a root
+// admin acts as the login.
+func (ret *AccessClaims) PermitsDuringImpersonation(r *http.Request) bool {
+	if ret.ImpersonationID == 0 {
+		return true
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	for _, prefix := range protectedDuringImpersonation {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return false
+		}
+	}
+	return true
+}
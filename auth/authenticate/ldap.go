@@ -0,0 +1,256 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// ldapProvider is the provider name of directory identities.
+const ldapProvider = "ldap"
+
+// LDAPAuthenticator looks up the entry of a login in a directory and binds
+// as this entry with the given password.
+type LDAPAuthenticator struct {
+	Users  UserStore
+	Config *configuration.LDAPConfiguration
+}
+
+// Authenticate implements Authenticator.
+func (a *LDAPAuthenticator) Authenticate(email string, password string) (*model.User, error) {
+	// many servers accept a DN without password as unauthenticated bind
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	tlsConfig, err := a.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.DialURL(a.Config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.Config.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(a.Config.Timeout)
+
+	if a.Config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	// the search account may be anonymous
+	if a.Config.BindPassword == "" {
+		err = conn.UnauthenticatedBind(a.Config.BindDN)
+	} else {
+		err = conn.Bind(a.Config.BindDN, a.Config.BindPassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.Config.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0, // no size limit
+		int(a.Config.Timeout.Seconds()),
+		false, // types only
+		strings.Replace(a.Config.UserFilter, "%s", ldap.EscapeFilter(email), -1),
+		a.attributes(),
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	// unknown or ambiguous
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return a.user(entry, email)
+}
+
+// tlsConfig is used for ldaps:// and StartTLS. The certificate is checked
+// against the host of the URL.
+func (a *LDAPAuthenticator) tlsConfig() (*tls.Config, error) {
+	u, err := url.Parse(a.Config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: a.Config.InsecureSkipVerify,
+	}
+
+	if a.Config.RootCA != "" {
+		certificates, err := ioutil.ReadFile(a.Config.RootCA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(certificates) {
+			return nil, errors.New("root_ca contains no certificate")
+		}
+	}
+	return config, nil
+}
+
+// attributes lists the mapped attributes to fetch.
+func (a *LDAPAuthenticator) attributes() []string {
+	attributes := []string{}
+	mapping := a.Config.Attributes
+	for _, name := range []string{mapping.FirstName, mapping.LastName, mapping.Email, mapping.StudentNumber, mapping.Semester, mapping.Subject} {
+		if name != "" {
+			attributes = append(attributes, name)
+		}
+	}
+	return attributes
+}
+
+// user returns the account linked to a directory entry. Unknown entries are
+// linked to the account with the same email address or get a new account if
+// this is allowed.
+func (a *LDAPAuthenticator) user(entry *ldap.Entry, email string) (*model.User, error) {
+	subject := strings.ToLower(entry.DN)
+
+	user, err := a.Users.FindByIdentity(ldapProvider, subject)
+	switch {
+	case err == nil:
+		if a.apply(user, entry) {
+			if err := a.Users.Update(user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	// the directory is trusted with the address of its entries
+	if a.Config.Attributes.Email != "" {
+		if mail := entry.GetEqualFoldAttributeValue(a.Config.Attributes.Email); mail != "" {
+			email = mail
+		}
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	user, err = a.Users.FindByEmail(email)
+	switch {
+	case err == nil:
+		a.apply(user, entry)
+		user.ConfirmEmailToken = null.String{}
+		if err := a.Users.Update(user); err != nil {
+			return nil, err
+		}
+
+	case err == sql.ErrNoRows:
+		if !a.Config.CreateAccounts {
+			return nil, ErrNoAccount
+		}
+
+		// the password is never used, the user logs in through the directory
+		encryptedPassword, err := auth.HashPassword(auth.GenerateToken(32))
+		if err != nil {
+			return nil, err
+		}
+
+		user = &model.User{
+			Email:             email,
+			Language:          "en",
+			EncryptedPassword: encryptedPassword,
+			ConfirmEmailToken: null.String{},
+			Root:              false,
+		}
+		a.apply(user, entry)
+
+		user, err = a.Users.Create(user)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, err
+	}
+
+	if err := a.Users.LinkIdentity(user.ID, ldapProvider, subject); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// apply copies the mapped attributes into the profile of a user and reports
+// whether anything changed. The email address is not synchronized.
+func (a *LDAPAuthenticator) apply(user *model.User, entry *ldap.Entry) bool {
+	changed := false
+	mapping := a.Config.Attributes
+
+	setString := func(field *string, name string) {
+		if name == "" {
+			return
+		}
+		if value := strings.TrimSpace(entry.GetEqualFoldAttributeValue(name)); value != "" && value != *field {
+			*field = value
+			changed = true
+		}
+	}
+
+	setString(&user.FirstName, mapping.FirstName)
+	setString(&user.LastName, mapping.LastName)
+	setString(&user.StudentNumber, mapping.StudentNumber)
+	setString(&user.Subject, mapping.Subject)
+
+	if mapping.Semester != "" {
+		semester, err := strconv.Atoi(entry.GetEqualFoldAttributeValue(mapping.Semester))
+		if err == nil && semester > 0 && semester != user.Semester {
+			user.Semester = semester
+			changed = true
+		}
+	}
+
+	return changed
+}
@@ -21,6 +21,7 @@ package authenticate
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -41,22 +42,36 @@ import (
 // RequiredValidAccessClaimsMiddleware tries to get information about the identity which
 // issues a request by looking into the authorization header and then into
 // the cookie.
-func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.ServerConfigurationSchema) func(http.Handler) http.Handler {
+func RequiredValidAccessClaims(manager *scs.Manager, tokens PersonalAccessTokenStore, sessions SessionStore, impersonations ImpersonationStore, config *configuration.ServerConfigurationSchema) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			accessClaims := &AccessClaims{}
+			// logins are bound to a registered session, personal access tokens
+			// and job tokens are validated on their own
+			withinSession := true
 
 			// first we test the JWT autorization
 			if HasHeaderToken(r) {
 				// parse token from from header
 				tokenStr := jwtauth.TokenFromHeader(r)
 
-				// ok, there is a access token in the header
-				err := accessClaims.ParseAccessClaimsFromToken(config.Authentication.JWT.Secret, tokenStr)
-				if err != nil {
-					// fmt.Println(err)
-					render.Render(w, r, auth.ErrUnauthorized)
-					return
+				if IsPersonalAccessToken(tokenStr) {
+					// a token a user has created for scripts
+					if err := accessClaims.ParseAccessClaimsFromPersonalAccessToken(tokens, tokenStr, r); err != nil {
+						render.Render(w, r, auth.ErrUnauthorizedWithDetails(err))
+						return
+					}
+					withinSession = false
+				} else if err := accessClaims.ParseAccessClaimsFromToken(config.Authentication.JWT.Secret, tokenStr); err != nil {
+					// it might be a job token of a background worker, which acts
+					// as the system itself (id 1) but only for the resources of the job
+					jobClaims := &JobClaims{}
+					if jobErr := jobClaims.ParseJobClaimsFromToken(config.Authentication.JWT.Secret, tokenStr); jobErr != nil || !jobClaims.Permits(r) {
+						render.Render(w, r, auth.ErrUnauthorized)
+						return
+					}
+					*accessClaims = NewAccessClaims(1, true)
+					withinSession = false
 				}
 
 			} else {
@@ -70,6 +85,14 @@ func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.Serve
 						return
 					}
 
+					// every cookie session is registered, so it can be revoked. Cookies
+					// of older versions are dropped and the user has to log in again.
+					if accessClaims.SessionID == 0 {
+						accessClaims.DestroyInSession(manager, w, r)
+						render.Render(w, r, auth.ErrUnauthenticatedWithDetails(errSessionMissing))
+						return
+					}
+
 					// session is valid --> we will extend the session
 					w = accessClaims.UpdateSession(manager, w, r)
 				} else {
@@ -80,9 +103,43 @@ func RequiredValidAccessClaims(manager *scs.Manager, config *configuration.Serve
 				}
 			}
 
+			// a root admin acting as the login does so within its own session
+			sessionOwnerID := accessClaims.LoginID
+			if accessClaims.ImpersonationID != 0 {
+				impersonation, err := ValidateImpersonation(impersonations, accessClaims.ImpersonationID, accessClaims.LoginID)
+				if err != nil {
+					render.Render(w, r, auth.ErrUnauthenticatedWithDetails(err))
+					return
+				}
+				if !accessClaims.PermitsDuringImpersonation(r) {
+					render.Render(w, r, auth.ErrForbiddenWithDetails(errors.New("the account cannot be changed during an impersonation")))
+					return
+				}
+				sessionOwnerID = impersonation.RootID
+			}
+
+			// the registered session might have been revoked in the meantime,
+			// access tokens without any session are rejected
+			if withinSession {
+				if err := ValidateSession(sessions, accessClaims.SessionID, sessionOwnerID, r); err != nil {
+					render.Render(w, r, auth.ErrUnauthenticatedWithDetails(err))
+					return
+				}
+			}
+
+			// a login which still has to set up its second factor may only do that
+			if !accessClaims.PermitsDuringTwoFactorSetup(r) {
+				render.Render(w, r, auth.ErrUnauthorizedWithDetails(errors.New("two-factor authentication must be set up first")))
+				return
+			}
+
 			// nothing given
 			// serve next
 			ctx := context.WithValue(r.Context(), symbol.CtxKeyAccessClaims, accessClaims)
+			if accessClaims.ImpersonationID != 0 {
+				LogImpersonatedRequests(impersonations, accessClaims.ImpersonationID, next).ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
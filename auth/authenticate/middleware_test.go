@@ -0,0 +1,185 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs"
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+)
+
+// memorySessions is a session store without database.
+type memorySessions struct {
+	sessions map[int64]*model.Session
+}
+
+func (s *memorySessions) Get(sessionID int64) (*model.Session, error) {
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (s *memorySessions) Touch(sessionID int64, ip string) error {
+	return nil
+}
+
+func TestRequiredValidAccessClaims(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("RequiredValidAccessClaims", func() {
+
+		var manager *scs.Manager
+		var sessions *memorySessions
+		var tokens *memoryTokens
+
+		// cookies runs a handler which writes the session cookie
+		cookies := func(write func(w http.ResponseWriter, r *http.Request)) []*http.Cookie {
+			w := httptest.NewRecorder()
+			write(w, httptest.NewRequest("POST", "/api/v1/auth/sessions", nil))
+			return w.Result().Cookies()
+		}
+
+		config := &configuration.ServerConfigurationSchema{}
+		config.Authentication.JWT.Secret = "secret"
+		config.Authentication.JWT.AccessExpiry = 15 * time.Minute
+
+		handle := func(r *http.Request) *httptest.ResponseRecorder {
+			middleware := authenticate.RequiredValidAccessClaims(manager, tokens, sessions, nil, config)
+			handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			return w
+		}
+
+		serve := func(cookies []*http.Cookie) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", "/api/v1/me", nil)
+			for _, cookie := range cookies {
+				r.AddCookie(cookie)
+			}
+			return handle(r)
+		}
+
+		serveToken := func(path string, token string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("GET", path, nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			return handle(r)
+		}
+
+		// serveBearer sends an access token with the given claims in the header
+		serveBearer := func(claims authenticate.AccessClaims) *httptest.ResponseRecorder {
+			token, err := authenticate.NewTokenAuth(&config.Authentication, 0).CreateAccessJWT(claims)
+			g.Assert(err).Equal(nil)
+			return serveToken("/api/v1/me", token)
+		}
+
+		g.BeforeEach(func() {
+			manager = scs.NewCookieManager("u46IpCV9y5Vlur8YvODJEhgOY8m9JVE4")
+			sessions = &memorySessions{sessions: map[int64]*model.Session{
+				3: {ID: 3, UserID: 1, ExpiresAt: time.Now().Add(time.Hour)},
+			}}
+			tokens = &memoryTokens{}
+		})
+
+		g.It("Should accept a cookie of a registered session", func() {
+			claims := &authenticate.AccessClaims{LoginID: 1, SessionID: 3}
+			w := serve(cookies(func(w http.ResponseWriter, r *http.Request) {
+				claims.WriteToSession(manager, w, r)
+			}))
+			g.Assert(w.Code).Equal(http.StatusOK)
+		})
+
+		g.It("Should reject a cookie of a revoked session", func() {
+			claims := &authenticate.AccessClaims{LoginID: 1, SessionID: 3}
+			login := cookies(func(w http.ResponseWriter, r *http.Request) {
+				claims.WriteToSession(manager, w, r)
+			})
+
+			delete(sessions.sessions, 3)
+			g.Assert(serve(login).Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should drop a cookie without a registered session", func() {
+			// older versions only stored the login
+			login := cookies(func(w http.ResponseWriter, r *http.Request) {
+				session := manager.Load(r)
+				g.Assert(session.PutInt64(w, "login_id", 1)).Equal(nil)
+				g.Assert(session.PutBool(w, "root", true)).Equal(nil)
+			})
+
+			w := serve(login)
+			g.Assert(w.Code).Equal(http.StatusUnauthorized)
+
+			// the browser is told to forget the cookie
+			dropped := false
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.MaxAge < 0 {
+					dropped = true
+				}
+			}
+			g.Assert(dropped).IsTrue()
+		})
+
+		g.It("Should accept an access token of a registered session", func() {
+			claims := authenticate.NewAccessClaims(1, false)
+			claims.SessionID = 3
+			g.Assert(serveBearer(claims).Code).Equal(http.StatusOK)
+
+			delete(sessions.sessions, 3)
+			g.Assert(serveBearer(claims).Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should reject an access token without a session", func() {
+			claims := authenticate.NewAccessClaims(1, true)
+			g.Assert(serveBearer(claims).Code).Equal(http.StatusUnauthorized)
+		})
+
+		g.It("Should restrict personal access tokens until a second factor is set up", func() {
+			plainToken, tokenHash := authenticate.NewPersonalAccessToken()
+			token := &model.PersonalAccessToken{
+				ID:             1,
+				UserID:         1,
+				TokenHash:      tokenHash,
+				ExpiresAt:      time.Now().Add(time.Hour),
+				SetupTwoFactor: true,
+			}
+			tokens.tokens = append(tokens.tokens, token)
+
+			g.Assert(serveToken("/api/v1/courses", plainToken).Code).Equal(http.StatusUnauthorized)
+			g.Assert(serveToken("/api/v1/me", plainToken).Code).Equal(http.StatusOK)
+
+			token.SetupTwoFactor = false
+			g.Assert(serveToken("/api/v1/courses", plainToken).Code).Equal(http.StatusOK)
+		})
+
+	})
+}
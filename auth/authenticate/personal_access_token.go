@@ -0,0 +1,97 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/model"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens in the
+// authorization header apart from JWTs.
+const PersonalAccessTokenPrefix = "infomark_"
+
+// PersonalAccessTokenStore is the part of the token store the middleware
+// needs.
+type PersonalAccessTokenStore interface {
+	FindByHash(tokenHash string) (*model.PersonalAccessToken, error)
+	Touch(tokenID int64) error
+}
+
+// NewPersonalAccessToken generates a token. Only its hash should be stored,
+// the token itself is shown once to the user.
+func NewPersonalAccessToken() (token string, tokenHash string) {
+	token = PersonalAccessTokenPrefix + auth.GenerateToken(20)
+	return token, HashPersonalAccessToken(token)
+}
+
+// HashPersonalAccessToken hashes a token for the lookup. The tokens are
+// random enough that a fast hash without salt suffices.
+func HashPersonalAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsPersonalAccessToken tests whether a token from the header is a personal
+// access token.
+func IsPersonalAccessToken(tokenStr string) bool {
+	return strings.HasPrefix(tokenStr, PersonalAccessTokenPrefix)
+}
+
+// ParseAccessClaimsFromPersonalAccessToken checks a personal access token and
+// whether its scope covers the request.
+func (ret *AccessClaims) ParseAccessClaimsFromPersonalAccessToken(tokens PersonalAccessTokenStore, tokenStr string, r *http.Request) error {
+	token, err := tokens.FindByHash(HashPersonalAccessToken(tokenStr))
+	if err != nil {
+		return errors.New("token is invalid")
+	}
+
+	if !token.ExpiresAt.After(time.Now()) {
+		return errors.New("token is expired")
+	}
+
+	if token.ReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return errors.New("token is read-only")
+	}
+
+	if token.CourseID.Valid {
+		coursePath := fmt.Sprintf("/api/v1/courses/%d", token.CourseID.Int64)
+		if r.URL.Path != coursePath && !strings.HasPrefix(r.URL.Path, coursePath+"/") {
+			return fmt.Errorf("token is limited to course %d", token.CourseID.Int64)
+		}
+	}
+
+	// the timestamp is informative only, a failed update does not block
+	tokens.Touch(token.ID)
+
+	ret.LoginID = token.UserID
+	ret.AccessNotRefresh = true
+	ret.Root = token.Root
+	ret.SetupTwoFactor = token.SetupTwoFactor
+	return nil
+}
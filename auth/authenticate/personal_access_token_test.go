@@ -0,0 +1,139 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate_test
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// memoryTokens is a token store without database.
+type memoryTokens struct {
+	tokens  []*model.PersonalAccessToken
+	touched []int64
+}
+
+func (s *memoryTokens) FindByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	for _, token := range s.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memoryTokens) Touch(tokenID int64) error {
+	s.touched = append(s.touched, tokenID)
+	return nil
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("PersonalAccessToken", func() {
+
+		var tokens *memoryTokens
+
+		add := func(token *model.PersonalAccessToken) string {
+			plainToken, tokenHash := authenticate.NewPersonalAccessToken()
+			token.ID = int64(len(tokens.tokens) + 1)
+			token.TokenHash = tokenHash
+			if token.ExpiresAt.IsZero() {
+				token.ExpiresAt = time.Now().Add(time.Hour)
+			}
+			tokens.tokens = append(tokens.tokens, token)
+			return plainToken
+		}
+
+		parse := func(plainToken string, method string, path string) (*authenticate.AccessClaims, error) {
+			claims := &authenticate.AccessClaims{}
+			err := claims.ParseAccessClaimsFromPersonalAccessToken(tokens, plainToken, httptest.NewRequest(method, path, nil))
+			return claims, err
+		}
+
+		g.BeforeEach(func() {
+			tokens = &memoryTokens{}
+		})
+
+		g.It("Should be told apart from JWTs", func() {
+			plainToken, tokenHash := authenticate.NewPersonalAccessToken()
+			g.Assert(authenticate.IsPersonalAccessToken(plainToken)).IsTrue()
+			g.Assert(authenticate.IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.x")).IsFalse()
+			g.Assert(tokenHash == plainToken).IsFalse()
+			g.Assert(len(tokenHash)).Equal(64)
+		})
+
+		g.It("Should act as the owner", func() {
+			plainToken := add(&model.PersonalAccessToken{UserID: 7, Root: true})
+
+			claims, err := parse(plainToken, "POST", "/api/v1/courses")
+			g.Assert(err).Equal(nil)
+			g.Assert(claims.LoginID).Equal(int64(7))
+			g.Assert(claims.Root).IsTrue()
+			g.Assert(claims.AccessNotRefresh).IsTrue()
+			g.Assert(tokens.touched).Equal([]int64{1})
+
+			_, err = parse(plainToken+"0", "GET", "/api/v1/me")
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should reject expired tokens", func() {
+			plainToken := add(&model.PersonalAccessToken{UserID: 7, ExpiresAt: time.Now().Add(-time.Second)})
+
+			_, err := parse(plainToken, "GET", "/api/v1/me")
+			g.Assert(err != nil).IsTrue()
+			g.Assert(len(tokens.touched)).Equal(0)
+		})
+
+		g.It("Should restrict read-only tokens", func() {
+			plainToken := add(&model.PersonalAccessToken{UserID: 7, ReadOnly: true})
+
+			_, err := parse(plainToken, "GET", "/api/v1/me")
+			g.Assert(err).Equal(nil)
+			_, err = parse(plainToken, "HEAD", "/api/v1/me")
+			g.Assert(err).Equal(nil)
+
+			for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+				_, err = parse(plainToken, method, "/api/v1/me")
+				g.Assert(err != nil).IsTrue()
+			}
+		})
+
+		g.It("Should restrict course-limited tokens", func() {
+			plainToken := add(&model.PersonalAccessToken{UserID: 7, CourseID: null.IntFrom(1)})
+
+			for _, path := range []string{"/api/v1/courses/1", "/api/v1/courses/1/sheets/3"} {
+				_, err := parse(plainToken, "GET", path)
+				g.Assert(err).Equal(nil)
+			}
+			for _, path := range []string{"/api/v1/courses/12", "/api/v1/courses", "/api/v1/me", "/api/v1/users/1"} {
+				_, err := parse(plainToken, "GET", path)
+				g.Assert(err != nil).IsTrue()
+			}
+		})
+	})
+}
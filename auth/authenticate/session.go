@@ -0,0 +1,59 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+// SessionStore is the part of the session store the middleware needs.
+type SessionStore interface {
+	Get(sessionID int64) (*model.Session, error)
+	Touch(sessionID int64, ip string) error
+}
+
+// errSessionMissing rejects logins of older versions, which have not been
+// registered and hence could not be revoked.
+var errSessionMissing = errors.New("login is not registered, please log in again")
+
+// ValidateSession checks that a session of a login has neither been revoked
+// nor expired and records its usage.
+func ValidateSession(sessions SessionStore, sessionID int64, loginID int64, r *http.Request) error {
+	if sessionID == 0 {
+		return errSessionMissing
+	}
+
+	session, err := sessions.Get(sessionID)
+	if err != nil || session.UserID != loginID {
+		return errors.New("session has been revoked")
+	}
+
+	if !session.ExpiresAt.After(time.Now()) {
+		return errors.New("session is expired")
+	}
+
+	// the timestamp is informative only, a failed update does not block
+	sessions.Touch(session.ID, NewLoginLimiterKeyFromIP(r).Key())
+	return nil
+}
@@ -20,6 +20,8 @@
 package authenticate
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"net/http"
 	"time"
 
@@ -32,14 +34,57 @@ type TokenAuth struct {
 	JwtAuth          *jwtauth.JWTAuth
 	JwtAccessExpiry  time.Duration
 	JwtRefreshExpiry time.Duration
+
+	JobAuth           *jwtauth.JWTAuth
+	JwtJobExpiry      time.Duration
+	JwtJobQueueExpiry time.Duration
+}
+
+// DefaultJobTimeout is the time the container of a job may run if the
+// timeout of the workers is not configured.
+const DefaultJobTimeout = 5 * time.Minute
+
+// JobExpirySlack covers downloading the files and uploading the results of a
+// job besides the runtime of its container.
+const JobExpirySlack = 5 * time.Minute
+
+// DefaultJobQueueExpiry is the time a job may wait in the queue if not
+// configured. Bulk jobs only start once all other jobs are done.
+const DefaultJobQueueExpiry = 6 * time.Hour
+
+// MaxJobQueueExpiry bounds the configured wait in the queue, such that a
+// leaked job token cannot be used for long.
+const MaxJobQueueExpiry = 24 * time.Hour
+
+// jobSecret derives the key for signing job tokens. Using a different key
+// guarantees that job tokens are never accepted as access or refresh tokens.
+func jobSecret(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("infomark-job-token"))
+	return mac.Sum(nil)
 }
 
-// NewTokenAuth configures and returns a JWT authentication instance.
-func NewTokenAuth(config *configuration.AuthenticationConfiguration) *TokenAuth {
+// NewTokenAuth configures and returns a JWT authentication instance. Job
+// tokens expire with the jobs, which the workers stop after jobTimeout.
+func NewTokenAuth(config *configuration.AuthenticationConfiguration, jobTimeout time.Duration) *TokenAuth {
+	if jobTimeout <= 0 {
+		jobTimeout = DefaultJobTimeout
+	}
+	jobQueueExpiry := config.JWT.JobQueueExpiry
+	if jobQueueExpiry <= 0 {
+		jobQueueExpiry = DefaultJobQueueExpiry
+	}
+	if jobQueueExpiry > MaxJobQueueExpiry {
+		jobQueueExpiry = MaxJobQueueExpiry
+	}
+
 	return &TokenAuth{
-		JwtAuth:          jwtauth.New("HS256", []byte(config.JWT.Secret), nil),
-		JwtAccessExpiry:  config.JWT.AccessExpiry,
-		JwtRefreshExpiry: config.JWT.RefreshExpiry,
+		JwtAuth:           jwtauth.New("HS256", []byte(config.JWT.Secret), nil),
+		JwtAccessExpiry:   config.JWT.AccessExpiry,
+		JwtRefreshExpiry:  config.JWT.RefreshExpiry,
+		JobAuth:           jwtauth.New("HS256", jobSecret(config.JWT.Secret), nil),
+		JwtJobExpiry:      jobTimeout + JobExpirySlack,
+		JwtJobQueueExpiry: jobQueueExpiry,
 	}
 
 }
@@ -51,8 +96,9 @@ func (a *TokenAuth) Verifier() func(http.Handler) http.Handler {
 
 // CreateAccessJWT returns an access token for provided account claims.
 func (a *TokenAuth) CreateAccessJWT(claims AccessClaims) (string, error) {
-	claims.StandardClaims.IssuedAt = time.Now().UTC().Unix()
-	claims.StandardClaims.ExpiresAt = time.Now().UTC().Unix() + int64(a.JwtAccessExpiry)
+	now := time.Now().UTC()
+	claims.StandardClaims.IssuedAt = now.Unix()
+	claims.StandardClaims.ExpiresAt = now.Add(a.JwtAccessExpiry).Unix()
 
 	_, tokenString, err := a.JwtAuth.Encode(claims)
 	return tokenString, err
@@ -61,9 +107,23 @@ func (a *TokenAuth) CreateAccessJWT(claims AccessClaims) (string, error) {
 // CreateRefreshJWT returns a refresh token for provided token Claims.
 func (a *TokenAuth) CreateRefreshJWT(claims RefreshClaims) (string, error) {
 
-	claims.StandardClaims.IssuedAt = time.Now().UTC().Unix()
-	claims.StandardClaims.ExpiresAt = time.Now().UTC().Unix() + int64(a.JwtRefreshExpiry)
+	now := time.Now().UTC()
+	claims.StandardClaims.IssuedAt = now.Unix()
+	claims.StandardClaims.ExpiresAt = now.Add(a.JwtRefreshExpiry).Unix()
 
 	_, tokenString, err := a.JwtAuth.Encode(claims)
 	return tokenString, err
 }
+
+// CreateJobJWT returns a job token for provided job claims. The token is
+// issued when the job is enqueued, but workers use it only once the job
+// has started. Hence, it stays valid for the longest wait in the queue plus
+// the runtime of the job. Jobs waiting longer fail.
+func (a *TokenAuth) CreateJobJWT(claims JobClaims) (string, error) {
+	now := time.Now().UTC()
+	claims.StandardClaims.IssuedAt = now.Unix()
+	claims.StandardClaims.ExpiresAt = now.Add(a.JwtJobQueueExpiry + a.JwtJobExpiry).Unix()
+
+	_, tokenString, err := a.JobAuth.Encode(claims)
+	return tokenString, err
+}
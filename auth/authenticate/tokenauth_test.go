@@ -0,0 +1,81 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authenticate_test
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+)
+
+func TestTokenAuth(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("TokenAuth", func() {
+
+		var config *configuration.AuthenticationConfiguration
+
+		// jobTokenLifetime returns how long a new job token is valid
+		jobTokenLifetime := func(tokenAuth *authenticate.TokenAuth) time.Duration {
+			token, err := tokenAuth.CreateJobJWT(authenticate.NewJobClaims("GET /api/v1/courses/1/submissions/1/file"))
+			g.Assert(err).Equal(nil)
+
+			claims := &authenticate.JobClaims{}
+			g.Assert(claims.ParseJobClaimsFromToken(config.JWT.Secret, token)).Equal(nil)
+			return time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second
+		}
+
+		g.BeforeEach(func() {
+			config = &configuration.AuthenticationConfiguration{}
+			config.JWT.Secret = "secret"
+		})
+
+		g.It("Should let access tokens expire after the configured time", func() {
+			config.JWT.AccessExpiry = 15 * time.Minute
+			token, err := authenticate.NewTokenAuth(config, 0).CreateAccessJWT(authenticate.NewAccessClaims(1, false))
+			g.Assert(err).Equal(nil)
+
+			claims := &authenticate.AccessClaims{}
+			_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+				return []byte(config.JWT.Secret), nil
+			})
+			g.Assert(err).Equal(nil)
+			g.Assert(time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second).Equal(15 * time.Minute)
+		})
+
+		g.It("Should let job tokens expire with the job", func() {
+			config.JWT.JobQueueExpiry = time.Hour
+			tokenAuth := authenticate.NewTokenAuth(config, 10*time.Minute)
+			g.Assert(jobTokenLifetime(tokenAuth)).Equal(time.Hour + 10*time.Minute + authenticate.JobExpirySlack)
+		})
+
+		g.It("Should bound the wait in the queue", func() {
+			config.JWT.JobQueueExpiry = 7 * 24 * time.Hour
+			tokenAuth := authenticate.NewTokenAuth(config, 0)
+			g.Assert(jobTokenLifetime(tokenAuth)).Equal(
+				authenticate.MaxJobQueueExpiry + authenticate.DefaultJobTimeout + authenticate.JobExpirySlack)
+		})
+
+	})
+}
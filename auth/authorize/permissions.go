@@ -0,0 +1,191 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package authorize
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/infomark-org/infomark/auth"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+// Permission names an action within a course. Course roles are sets of
+// permissions.
+type Permission string
+
+const (
+	PermissionCourseEdit      Permission = "course.edit"      // edit, clone and delete the course
+	PermissionCourseEmail     Permission = "course.email"     // send emails to all participants
+	PermissionEnrollmentsEdit Permission = "enrollments.edit" // change roles and remove participants
+	PermissionRolesEdit       Permission = "roles.edit"       // define the roles of the course
+	PermissionSheetsEdit      Permission = "sheets.edit"
+	PermissionTasksEdit       Permission = "tasks.edit" // including test files and reference solutions
+	PermissionMaterialsEdit   Permission = "materials.edit"
+	PermissionExamsEdit       Permission = "exams.edit" // including the exam enrollments
+	PermissionGroupsEdit      Permission = "groups.edit"
+	PermissionGroupsEmail     Permission = "groups.email"
+	PermissionSubmissionsView Permission = "submissions.view"
+	PermissionGradesView      Permission = "grades.view"
+	PermissionGradesEditOwn   Permission = "grades.edit_own" // grades in groups the member tutors
+	PermissionGradesEdit      Permission = "grades.edit"     // all grades of the course
+	PermissionGradesResults   Permission = "grades.results"  // test results and artifacts
+)
+
+// AllPermissions lists every known permission.
+var AllPermissions = PermissionSet{
+	PermissionCourseEdit,
+	PermissionCourseEmail,
+	PermissionEnrollmentsEdit,
+	PermissionRolesEdit,
+	PermissionSheetsEdit,
+	PermissionTasksEdit,
+	PermissionMaterialsEdit,
+	PermissionExamsEdit,
+	PermissionGroupsEdit,
+	PermissionGroupsEmail,
+	PermissionSubmissionsView,
+	PermissionGradesView,
+	PermissionGradesEditOwn,
+	PermissionGradesEdit,
+	PermissionGradesResults,
+}
+
+// PermissionSet is the set of permissions a member has in a course.
+type PermissionSet []Permission
+
+// Has tells whether the set contains the permission.
+func (set PermissionSet) Has(permission Permission) bool {
+	for _, p := range set {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPermissionSet converts permission names as stored in the database.
+func NewPermissionSet(names []string) PermissionSet {
+	set := PermissionSet{}
+	for _, name := range names {
+		set = append(set, Permission(name))
+	}
+	return set
+}
+
+// Strings returns the permission names as stored in the database.
+func (set PermissionSet) Strings() []string {
+	names := []string{}
+	for _, p := range set {
+		names = append(names, string(p))
+	}
+	return names
+}
+
+// ValidPermission tells whether a permission name is known.
+func ValidPermission(name string) bool {
+	return AllPermissions.Has(Permission(name))
+}
+
+// RolePresets are permission sets for common staff roles. Courses can use
+// them as a starting point for their own roles.
+var RolePresets = map[string]PermissionSet{
+	// can edit all grades but not the tasks
+	"head_tutor": {
+		PermissionGroupsEmail,
+		PermissionSubmissionsView,
+		PermissionGradesView,
+		PermissionGradesEdit,
+	},
+	// only grades the groups assigned to the member
+	"grader": {
+		PermissionSubmissionsView,
+		PermissionGradesView,
+		PermissionGradesEditOwn,
+	},
+	// read-only, e.g. the examination office
+	"observer": {
+		PermissionSubmissionsView,
+		PermissionGradesView,
+	},
+}
+
+// RolePresetBaseRoles are the fixed course roles members of a preset get
+// unless a course chooses another one. Observers do not act on groups, so
+// they do not need the base role of a tutor, which handlers rely on to show
+// staff-only data.
+var RolePresetBaseRoles = map[string]CourseRole{
+	"head_tutor": TUTOR,
+	"grader":     TUTOR,
+	"observer":   STUDENT,
+}
+
+// Permissions maps the fixed course roles onto permission sets. Members
+// without a role of the course get the permissions of their course role.
+func (r CourseRole) Permissions() PermissionSet {
+	switch r {
+	case ADMIN:
+		return AllPermissions
+	case TUTOR:
+		return PermissionSet{
+			PermissionGroupsEmail,
+			PermissionSubmissionsView,
+			PermissionGradesView,
+			PermissionGradesEdit,
+		}
+	default:
+		return PermissionSet{}
+	}
+}
+
+// RequiresCoursePermission middleware restricts access to members of a course
+// having one of the permissions.
+func RequiresCoursePermission(permissions ...Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		hfn := func(w http.ResponseWriter, r *http.Request) {
+			for _, permission := range permissions {
+				if HasCoursePermission(permission, r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			render.Render(w, r, auth.ErrUnauthorized)
+		}
+		return http.HandlerFunc(hfn)
+	}
+}
+
+// HasCoursePermission tells whether the request identity has a permission in
+// the course of the request.
+func HasCoursePermission(permission Permission, r *http.Request) bool {
+	// global root can lever out this check
+	accessClaims := r.Context().Value(symbol.CtxKeyAccessClaims).(*authenticate.AccessClaims)
+	if accessClaims.Root {
+		return true
+	}
+
+	givenPermissions, ok := r.Context().Value(symbol.CtxKeyCoursePermissions).(PermissionSet)
+	if !ok {
+		return false
+	}
+
+	return givenPermissions.Has(permission)
+}
@@ -75,6 +75,18 @@ func ErrUnauthorizedWithDetails(err error) render.Renderer {
 	}
 }
 
+// ErrForbiddenWithDetails renders status 403 Forbidden with custom error message.
+// The identity is known, but the action is not allowed for it.
+func ErrForbiddenWithDetails(err error) render.Renderer {
+	// StatusForbidden                     = 403 // RFC 7231, 6.5.3
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     http.StatusText(http.StatusForbidden),
+		ErrorText:      err.Error(),
+	}
+}
+
 var (
 	// ErrUnauthenticated means no credentials are given
 	ErrUnauthenticated = &ErrResponse{HTTPStatusCode: http.StatusUnauthorized, StatusText: http.StatusText(http.StatusUnauthorized)}
@@ -0,0 +1,413 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package ldaptest provides an in-process directory server for tests. It
+// understands simple binds, searches and StartTLS.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// startTLSOID names the extended operation which upgrades a connection.
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Server is a directory listening on a random local port.
+type Server struct {
+	// URL to connect to, e.g. "ldap://127.0.0.1:34567".
+	URL string
+	// CertificatePEM is the self-signed certificate offered after StartTLS.
+	CertificatePEM []byte
+
+	// RequireTLS refuses binds before StartTLS.
+	RequireTLS bool
+	// AllowAnonymous permits searches without a bind.
+	AllowAnonymous bool
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu      sync.Mutex
+	entries []*entry
+	binds   []string
+}
+
+type entry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// NewServer starts a directory without entries.
+func NewServer() (*Server, error) {
+	certificate, certificatePEM, err := selfSignedCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		URL:            "ldap://" + listener.Addr().String(),
+		CertificatePEM: certificatePEM,
+		listener:       listener,
+		tlsConfig:      &tls.Config{Certificates: []tls.Certificate{certificate}},
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// CertPool trusts the certificate of the server.
+func (s *Server) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(s.CertificatePEM)
+	return pool
+}
+
+// AddEntry adds an entry. Entries with a password can bind.
+func (s *Server) AddEntry(dn string, password string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &entry{dn: dn, password: password, attributes: attributes})
+}
+
+// Binds lists the DNs of all successful binds.
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.binds...)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle answers the requests of a single connection.
+func (s *Server) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	secure := false
+	bound := false
+
+	for {
+		message, err := ber.ReadPacket(conn)
+		if err != nil || len(message.Children) < 2 {
+			return
+		}
+		id, _ := message.Children[0].Value.(int64)
+		request := message.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(request, secure)
+			bound = code == ldap.LDAPResultSuccess && len(request.Children) > 1 && request.Children[1].Data.Len() > 0
+			respond(conn, id, result(ldap.ApplicationBindResponse, code))
+
+		case ldap.ApplicationSearchRequest:
+			if !bound && !s.AllowAnonymous {
+				respond(conn, id, result(ldap.ApplicationSearchResultDone, 50))
+				continue
+			}
+			for _, found := range s.search(request) {
+				respond(conn, id, found)
+			}
+			respond(conn, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+
+		case ldap.ApplicationExtendedRequest:
+			if secure || len(request.Children) < 1 || string(request.Children[0].Data.Bytes()) != startTLSOID {
+				respond(conn, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError))
+				continue
+			}
+			respond(conn, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess))
+
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			secure = true
+
+		default:
+			// unbind or anything we do not understand
+			return
+		}
+	}
+}
+
+// bind checks the credentials of a simple bind.
+func (s *Server) bind(request *ber.Packet, secure bool) int {
+	if len(request.Children) < 3 || request.Children[2].ClassType != ber.ClassContext || request.Children[2].Tag != 0 {
+		return ldap.LDAPResultProtocolError
+	}
+	dn := string(request.Children[1].Data.Bytes())
+	password := string(request.Children[2].Data.Bytes())
+
+	if s.RequireTLS && !secure {
+		return ldap.LDAPResultConfidentialityRequired
+	}
+	if dn == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	// unauthenticated binds (DN without password) are refused
+	if password == "" {
+		return ldap.LDAPResultUnwillingToPerform
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+			s.binds = append(s.binds, e.dn)
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+// search returns the SearchResultEntry packets of all matching entries.
+func (s *Server) search(request *ber.Packet) []*ber.Packet {
+	if len(request.Children) < 8 {
+		return nil
+	}
+	baseDN := strings.ToLower(string(request.Children[0].Data.Bytes()))
+	scope, _ := request.Children[1].Value.(int64)
+	filter := request.Children[6]
+
+	requested := []string{}
+	for _, attribute := range request.Children[7].Children {
+		requested = append(requested, string(attribute.Data.Bytes()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := []*ber.Packet{}
+	for _, e := range s.entries {
+		if !inScope(strings.ToLower(e.dn), baseDN, scope) || !matches(filter, e) {
+			continue
+		}
+
+		packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+		attributes := ber.NewSequence("Attributes")
+		for name, values := range e.attributes {
+			if !wanted(requested, name) {
+				continue
+			}
+			attribute := ber.NewSequence("Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		packet.AppendChild(attributes)
+		found = append(found, packet)
+	}
+	return found
+}
+
+func inScope(dn string, baseDN string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == baseDN
+	case ldap.ScopeSingleLevel:
+		i := strings.IndexByte(dn, ',')
+		return i >= 0 && dn[i+1:] == baseDN
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+func wanted(requested []string, name string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	for _, candidate := range requested {
+		if candidate == "*" || strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *entry) values(name string) []string {
+	for attribute, values := range e.attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// matches evaluates a filter against an entry. Values are compared without
+// case as most directory attributes are.
+func matches(filter *ber.Packet, e *entry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(child, e) {
+				return false
+			}
+		}
+		return true
+
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(child, e) {
+				return true
+			}
+		}
+		return false
+
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matches(filter.Children[0], e)
+
+	case ldap.FilterPresent:
+		return len(e.values(string(filter.Data.Bytes()))) > 0
+
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		if len(filter.Children) < 2 {
+			return false
+		}
+		expected := strings.ToLower(string(filter.Children[1].Data.Bytes()))
+		for _, value := range e.values(string(filter.Children[0].Data.Bytes())) {
+			value = strings.ToLower(value)
+			switch {
+			case filter.Tag == ldap.FilterGreaterOrEqual && value >= expected,
+				filter.Tag == ldap.FilterLessOrEqual && value <= expected,
+				value == expected:
+				return true
+			}
+		}
+		return false
+
+	case ldap.FilterSubstrings:
+		if len(filter.Children) < 2 {
+			return false
+		}
+		for _, value := range e.values(string(filter.Children[0].Data.Bytes())) {
+			if matchesSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchesSubstrings(value string, substrings []*ber.Packet) bool {
+	for _, substring := range substrings {
+		part := strings.ToLower(string(substring.Data.Bytes()))
+		switch substring.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, part) {
+				return false
+			}
+			value = value[len(part):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, part) {
+				return false
+			}
+			value = value[:len(value)-len(part)]
+		default:
+			i := strings.Index(value, part)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(part):]
+		}
+	}
+	return true
+}
+
+// result builds a response operation carrying an LDAPResult.
+func result(tag ber.Tag, code int) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return packet
+}
+
+func respond(conn net.Conn, id int64, operation *ber.Packet) {
+	message := ber.NewSequence("LDAP Message")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	message.AppendChild(operation)
+	conn.Write(message.Bytes())
+}
+
+// selfSignedCertificate creates a certificate for 127.0.0.1 and localhost.
+func selfSignedCertificate() (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
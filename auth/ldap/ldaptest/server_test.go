@@ -0,0 +1,139 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package ldaptest_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/franela/goblin"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/infomark-org/infomark/auth/ldap/ldaptest"
+)
+
+func TestServer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	directory, err := ldaptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer directory.Close()
+
+	directory.AddEntry("cn=search,dc=uni,dc=de", "search-secret", map[string][]string{
+		"objectClass": {"applicationProcess"},
+	})
+	directory.AddEntry("uid=alice,ou=people,dc=uni,dc=de", "alice-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"mail":        {"Alice@uni.de"},
+		"givenName":   {"Alice"},
+		"sn":          {"Liddell"},
+	})
+	directory.AddEntry("uid=bob,ou=people,dc=uni,dc=de", "bob-secret", map[string][]string{
+		"objectClass": {"inetOrgPerson"},
+		"mail":        {"bob@uni.de"},
+	})
+
+	dial := func() *ldap.Conn {
+		conn, err := ldap.DialURL(directory.URL)
+		g.Assert(err).Equal(nil)
+		return conn
+	}
+
+	search := func(conn *ldap.Conn, baseDN string, filter string, attributes ...string) ([]*ldap.Entry, error) {
+		result, err := conn.Search(ldap.NewSearchRequest(
+			baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false, filter, attributes, nil))
+		if err != nil {
+			return nil, err
+		}
+		return result.Entries, nil
+	}
+
+	g.Describe("Server", func() {
+
+		g.It("Should bind with a password", func() {
+			conn := dial()
+			defer conn.Close()
+
+			g.Assert(conn.Bind("uid=alice,ou=people,dc=uni,dc=de", "alice-secret")).Equal(nil)
+
+			err := conn.Bind("uid=alice,ou=people,dc=uni,dc=de", "wrong")
+			g.Assert(ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials)).IsTrue()
+
+			// a DN without password must not count as login
+			err = conn.UnauthenticatedBind("uid=alice,ou=people,dc=uni,dc=de")
+			g.Assert(err != nil).IsTrue()
+			g.Assert(ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials)).IsFalse()
+		})
+
+		g.It("Should search entries", func() {
+			conn := dial()
+			defer conn.Close()
+
+			g.Assert(conn.Bind("cn=search,dc=uni,dc=de", "search-secret")).Equal(nil)
+
+			entries, err := search(conn, "ou=people,dc=uni,dc=de",
+				"(&(objectClass=inetOrgPerson)(mail=alice@uni.de))", "givenName", "mail")
+			g.Assert(err).Equal(nil)
+			g.Assert(len(entries)).Equal(1)
+			g.Assert(entries[0].DN).Equal("uid=alice,ou=people,dc=uni,dc=de")
+			g.Assert(entries[0].GetEqualFoldAttributeValue("givenname")).Equal("Alice")
+			g.Assert(entries[0].GetEqualFoldAttributeValue("mail")).Equal("Alice@uni.de")
+			g.Assert(entries[0].GetEqualFoldAttributeValue("sn")).Equal("")
+
+			entries, err = search(conn, "dc=uni,dc=de", "(objectClass=inetOrgPerson)")
+			g.Assert(err).Equal(nil)
+			g.Assert(len(entries)).Equal(2)
+
+			entries, err = search(conn, "dc=uni,dc=de", "(&(objectClass=inetOrgPerson)(!(mail=bob@uni.de)))")
+			g.Assert(err).Equal(nil)
+			g.Assert(len(entries)).Equal(1)
+		})
+
+		g.It("Should refuse searches without bind", func() {
+			conn := dial()
+			defer conn.Close()
+
+			_, err := search(conn, "dc=uni,dc=de", "(objectClass=*)")
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should upgrade the connection with StartTLS", func() {
+			directory.RequireTLS = true
+			defer func() { directory.RequireTLS = false }()
+
+			conn := dial()
+			defer conn.Close()
+
+			err := conn.Bind("uid=bob,ou=people,dc=uni,dc=de", "bob-secret")
+			g.Assert(err != nil).IsTrue()
+
+			g.Assert(conn.StartTLS(&tls.Config{ServerName: "127.0.0.1", RootCAs: directory.CertPool()})).Equal(nil)
+			g.Assert(conn.Bind("uid=bob,ou=people,dc=uni,dc=de", "bob-secret")).Equal(nil)
+		})
+
+		g.It("Should verify the certificate on StartTLS", func() {
+			conn := dial()
+			defer conn.Close()
+
+			g.Assert(conn.StartTLS(&tls.Config{ServerName: "127.0.0.1"}) != nil).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,104 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package oidc
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Claims are the verified claims of an ID token.
+type Claims map[string]interface{}
+
+// String returns a claim as string. Missing claims are empty.
+func (c Claims) String(name string) string {
+	switch value := c[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// Int returns a claim as integer. Missing or malformed claims are 0.
+func (c Claims) Int(name string) int {
+	value, err := strconv.Atoi(c.String(name))
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// Bool returns a boolean claim. Some providers send "true" as string.
+func (c Claims) Bool(name string) bool {
+	switch value := c[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+// Subject identifies the user at the provider.
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// time returns a timestamp given in seconds since the epoch.
+func (c Claims) time(name string) (time.Time, bool) {
+	seconds, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// authorizedParty checks the client the token was requested by. It has to be
+// given if the token is meant for several audiences.
+func (c Claims) authorizedParty(clientID string) bool {
+	azp, ok := c["azp"].(string)
+	if !ok {
+		aud, several := c["aud"].([]interface{})
+		return !several || len(aud) == 1
+	}
+	return azp == clientID
+}
+
+// hasAudience checks whether the token was issued for a client. The audience
+// is either a single string or a list.
+func (c Claims) hasAudience(clientID string) bool {
+	switch aud := c["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, candidate := range aud {
+			if candidate == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
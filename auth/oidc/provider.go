@@ -0,0 +1,248 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package oidc implements the authorization code flow of OpenID Connect for a
+// single provider (the identity provider of a university).
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Discovery is the part of the provider metadata we need.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// DefaultMaxAge is the age up to which ID tokens are accepted. They are
+// verified right after they have been issued.
+const DefaultMaxAge = 5 * time.Minute
+
+// clockSkew tolerates clocks of the provider running ahead of ours.
+const clockSkew = time.Minute
+
+// Provider is an OpenID Connect provider our server is registered at as
+// client. The metadata and the signing keys are fetched on first use.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+	// ID tokens issued longer ago are rejected
+	MaxAge time.Duration
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// NewProvider creates a provider. Scopes default to "openid profile email".
+func NewProvider(issuer string, clientID string, clientSecret string, redirectURL string, scopes []string) *Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		MaxAge:       DefaultMaxAge,
+	}
+}
+
+// getJSON fetches a JSON document from the provider.
+func (p *Provider) getJSON(url string, dst interface{}) error {
+	resp, err := p.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// Discover fetches the metadata of the provider. A successful discovery is
+// cached.
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := &Discovery{}
+	if err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, err
+	}
+
+	// see https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc: issuer %s does not match the configured issuer %s", discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc: provider metadata is incomplete")
+	}
+
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// AuthCodeURL is the URL of the provider the browser is sent to for the login.
+func (p *Provider) AuthCodeURL(state string, nonce string) (string, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", p.ClientID)
+	values.Set("redirect_uri", p.RedirectURL)
+	values.Set("scope", strings.Join(p.Scopes, " "))
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + values.Encode(), nil
+}
+
+// tokenResponse is the answer of the token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+}
+
+// Exchange redeems the authorization code at the token endpoint and returns
+// the raw ID token. The token still needs to be verified.
+func (p *Provider) Exchange(code string) (string, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return "", err
+	}
+
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", p.RedirectURL)
+
+	r, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	r.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := p.Client.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	token := &tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("oidc: token endpoint returned status %d: %s", resp.StatusCode, token.Error)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("oidc: token response contains no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// Verify checks the signature and the claims of an ID token issued recently
+// for our client. The nonce is only checked if it is not empty.
+func (p *Provider) Verify(rawIDToken string, nonce string) (Claims, error) {
+	discovery, err := p.Discover()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("oidc: unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(discovery, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := Claims(token.Claims.(jwt.MapClaims))
+
+	if strings.TrimSuffix(claims.String("iss"), "/") != p.Issuer {
+		return nil, errors.New("oidc: id token was issued by another provider")
+	}
+	if !claims.hasAudience(p.ClientID) {
+		return nil, errors.New("oidc: id token was issued for another client")
+	}
+	if !claims.authorizedParty(p.ClientID) {
+		return nil, errors.New("oidc: id token was requested by another client")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("oidc: id token does not expire")
+	}
+	issuedAt, ok := claims.time("iat")
+	if !ok {
+		return nil, errors.New("oidc: id token has no issue time")
+	}
+	if now := time.Now(); issuedAt.Before(now.Add(-p.MaxAge)) || issuedAt.After(now.Add(clockSkew)) {
+		return nil, errors.New("oidc: id token is not fresh")
+	}
+	if claims.String("sub") == "" {
+		return nil, errors.New("oidc: id token has no subject")
+	}
+	if nonce != "" && claims.String("nonce") != nonce {
+		return nil, errors.New("oidc: nonce of id token does not match")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,138 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package oidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/oidc"
+	"github.com/infomark-org/infomark/auth/oidc/oidctest"
+)
+
+func TestProvider(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	idp, err := oidctest.NewServer("infomark", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	redirectURL := "http://localhost/api/v1/auth/oidc/callback"
+
+	g.Describe("Provider", func() {
+
+		g.It("Should discover the provider", func() {
+			p := oidc.NewProvider(idp.URL+"/", "infomark", "secret", redirectURL, nil)
+			discovery, err := p.Discover()
+			g.Assert(err).Equal(nil)
+			g.Assert(discovery.TokenEndpoint).Equal(idp.URL + "/token")
+
+			p = oidc.NewProvider("http://127.0.0.1:1", "infomark", "secret", redirectURL, nil)
+			_, err = p.Discover()
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should run the authorization code flow", func() {
+			idp.Claims = map[string]interface{}{"sub": "alice", "email": "alice@uni.de"}
+			p := oidc.NewProvider(idp.URL, "infomark", "secret", redirectURL, nil)
+
+			authURL, err := p.AuthCodeURL("some-state", "some-nonce")
+			g.Assert(err).Equal(nil)
+
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			resp, err := client.Get(authURL)
+			g.Assert(err).Equal(nil)
+			resp.Body.Close()
+			g.Assert(resp.StatusCode).Equal(http.StatusFound)
+
+			callback, err := url.Parse(resp.Header.Get("Location"))
+			g.Assert(err).Equal(nil)
+			g.Assert(callback.Query().Get("state")).Equal("some-state")
+
+			rawIDToken, err := p.Exchange(callback.Query().Get("code"))
+			g.Assert(err).Equal(nil)
+
+			claims, err := p.Verify(rawIDToken, "some-nonce")
+			g.Assert(err).Equal(nil)
+			g.Assert(claims.Subject()).Equal("alice")
+			g.Assert(claims.String("email")).Equal("alice@uni.de")
+
+			// the nonce binds the token to the login
+			_, err = p.Verify(rawIDToken, "other-nonce")
+			g.Assert(err != nil).IsTrue()
+
+			// codes can only be redeemed once
+			_, err = p.Exchange(callback.Query().Get("code"))
+			g.Assert(err != nil).IsTrue()
+		})
+
+		g.It("Should reject invalid id tokens", func() {
+			p := oidc.NewProvider(idp.URL, "infomark", "secret", redirectURL, nil)
+
+			for _, claims := range []map[string]interface{}{
+				{"sub": "alice", "aud": "other-client"},
+				{"sub": "alice", "iss": "https://evil.example.com"},
+				{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()},
+				{"sub": ""},
+				{"sub": "alice", "iat": time.Now().Add(-time.Hour).Unix()},
+				{"sub": "alice", "iat": time.Now().Add(time.Hour).Unix()},
+				{"sub": "alice", "iat": nil},
+				{"sub": "alice", "aud": []string{"other-client", "infomark"}},
+				{"sub": "alice", "azp": "other-client"},
+			} {
+				token, err := idp.IDToken(claims)
+				g.Assert(err).Equal(nil)
+
+				_, err = p.Verify(token, "")
+				g.Assert(err != nil).IsTrue()
+			}
+
+			token, err := idp.IDToken(map[string]interface{}{
+				"sub": "alice",
+				"aud": []string{"other-client", "infomark"},
+				"azp": "infomark",
+			})
+			g.Assert(err).Equal(nil)
+
+			_, err = p.Verify(token, "")
+			g.Assert(err).Equal(nil)
+		})
+
+		g.It("Should reject tokens signed by another key", func() {
+			other, err := oidctest.NewServer("infomark", "secret")
+			g.Assert(err).Equal(nil)
+			defer other.Close()
+
+			token, err := other.IDToken(map[string]interface{}{"sub": "alice", "iss": idp.URL})
+			g.Assert(err).Equal(nil)
+
+			p := oidc.NewProvider(idp.URL, "infomark", "secret", redirectURL, nil)
+			_, err = p.Verify(token, "")
+			g.Assert(err != nil).IsTrue()
+		})
+	})
+}
@@ -0,0 +1,91 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/auth/totp"
+)
+
+func TestTOTP(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	// the SHA1 secret of the test vectors in RFC 6238
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	g.Describe("TOTP", func() {
+
+		g.It("Should match the test vectors of RFC 6238", func() {
+			for unix, code := range map[int64]string{
+				59:          "287082",
+				1111111109:  "081804",
+				1111111111:  "050471",
+				1234567890:  "005924",
+				2000000000:  "279037",
+				20000000000: "353130",
+			} {
+				actual, err := totp.Code(secret, totp.Counter(time.Unix(unix, 0)))
+				g.Assert(err).Equal(nil)
+				g.Assert(actual).Equal(code)
+			}
+		})
+
+		g.It("Should accept codes of neighbouring periods", func() {
+			now := time.Unix(1234567890, 0)
+			code, err := totp.Code(secret, totp.Counter(now))
+			g.Assert(err).Equal(nil)
+
+			counter, ok := totp.Validate(secret, code, now)
+			g.Assert(ok).IsTrue()
+			g.Assert(counter).Equal(totp.Counter(now))
+
+			_, ok = totp.Validate(secret, code[:3]+" "+code[3:], now.Add(totp.Period))
+			g.Assert(ok).IsTrue()
+
+			_, ok = totp.Validate(secret, code, now.Add(3*totp.Period))
+			g.Assert(ok).IsFalse()
+
+			_, ok = totp.Validate(secret, "12345", now)
+			g.Assert(ok).IsFalse()
+		})
+
+		g.It("Should generate secrets and provisioning URIs", func() {
+			generated, err := totp.GenerateSecret()
+			g.Assert(err).Equal(nil)
+			g.Assert(len(generated)).Equal(32)
+
+			_, err = totp.Code(generated, 1)
+			g.Assert(err).Equal(nil)
+
+			uri, err := url.Parse(totp.ProvisioningURI("InfoMark", "jane@uni.de", generated))
+			g.Assert(err).Equal(nil)
+			g.Assert(uri.Scheme).Equal("otpauth")
+			g.Assert(uri.Host).Equal("totp")
+			g.Assert(uri.Path).Equal("/InfoMark:jane@uni.de")
+			g.Assert(uri.Query().Get("secret")).Equal(generated)
+			g.Assert(uri.Query().Get("issuer")).Equal("InfoMark")
+		})
+	})
+}
@@ -47,6 +47,7 @@ func init() {
 	ConsoleCmd.AddCommand(console.GroupCmd)
 	ConsoleCmd.AddCommand(console.DatabaseCmd)
 	ConsoleCmd.AddCommand(console.ConfigurationCmd)
+	ConsoleCmd.AddCommand(console.WorkerCmd)
 
 	UtilsCmd.AddCommand(UtilsCompletionCmd)
 	UtilsCmd.AddCommand(UtilsDocCmd)
@@ -55,10 +55,12 @@ var AdminAddCmd = &cobra.Command{
 			log.Fatalf("user with id %v not found\n", userID)
 		}
 
+		before := *user
 		user.Root = true
 		if err := stores.User.Update(user); err != nil {
 			panic(err)
 		}
+		auditConsole(stores, "admin add", "user", user.ID, &before, user)
 
 		fmt.Printf("The user %s %s (id:%v) has now global admin privileges\n",
 			user.FirstName, user.LastName, user.ID)
@@ -81,10 +83,12 @@ var AdminRemoveCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("user with id %v not found\n", userID)
 		}
+		before := *user
 		user.Root = false
 		if err := stores.User.Update(user); err != nil {
 			panic(err)
 		}
+		auditConsole(stores, "admin remove", "user", user.ID, &before, user)
 
 		fmt.Printf("user %s %s (%v) is not an admin anymore\n", user.FirstName, user.LastName, user.ID)
 
@@ -93,6 +93,7 @@ func GenerateExampleConfiguration(domain string, root_path string) *configuratio
 	config.Server.HTTP.Limits.MaxRequestJSON = 2 * bytefmt.Megabyte
 	config.Server.HTTP.Limits.MaxAvatar = 1 * bytefmt.Megabyte
 	config.Server.HTTP.Limits.MaxSubmission = 4 * bytefmt.Megabyte
+	config.Server.HTTP.Limits.MaxArtifacts = 10 * bytefmt.Megabyte
 
 	config.Server.Debugging.Enabled = false
 	config.Server.Debugging.LoginID = int64(1)
@@ -101,10 +102,13 @@ func GenerateExampleConfiguration(domain string, root_path string) *configuratio
 	config.Server.Debugging.Fixtures = root_path + "/fixtures"
 
 	config.Server.DistributeJobs = true
+	config.Server.Jobs.ResultTransport = "http"
+	config.Server.Jobs.WorkerTimeout = 2 * time.Minute
 
 	config.Server.Authentication.JWT.Secret = auth.GenerateToken(32)
 	config.Server.Authentication.JWT.AccessExpiry = 15 * time.Minute
 	config.Server.Authentication.JWT.RefreshExpiry = DurationFromString("10h")
+	config.Server.Authentication.JWT.JobQueueExpiry = 6 * time.Hour
 	config.Server.Authentication.Session.Secret = auth.GenerateToken(32)
 	config.Server.Authentication.Session.Cookies.Secure = config.Server.HTTP.UseHTTPS
 	config.Server.Authentication.Session.Cookies.Lifetime = DurationFromString("24h")
@@ -112,12 +116,44 @@ func GenerateExampleConfiguration(domain string, root_path string) *configuratio
 	config.Server.Authentication.Password.MinLength = 7
 
 	config.Server.Authentication.TotalRequestsPerMinute = 100
+	config.Server.Authentication.Lockout.MaxFailedLogins = 5
+	config.Server.Authentication.Lockout.Duration = DurationFromString("1m")
+	config.Server.Authentication.Lockout.MaxDuration = DurationFromString("1h")
+	config.Server.Authentication.Impersonation.MaxDuration = DurationFromString("30m")
+	config.Server.Authentication.OIDC.Enabled = false
+	config.Server.Authentication.OIDC.Scopes = []string{"openid", "profile", "email"}
+	config.Server.Authentication.OIDC.CreateAccounts = true
+	config.Server.Authentication.OIDC.Claims.FirstName = "given_name"
+	config.Server.Authentication.OIDC.Claims.LastName = "family_name"
+	config.Server.Authentication.OIDC.Claims.Email = "email"
+	config.Server.Authentication.Authenticators = []string{"password"}
+	config.Server.Authentication.LDAP.StartTLS = true
+	config.Server.Authentication.LDAP.Timeout = DurationFromString("10s")
+	config.Server.Authentication.LDAP.UserFilter = "(&(objectClass=inetOrgPerson)(mail=%s))"
+	config.Server.Authentication.LDAP.CreateAccounts = true
+	config.Server.Authentication.LDAP.Attributes.FirstName = "givenName"
+	config.Server.Authentication.LDAP.Attributes.LastName = "sn"
+	config.Server.Authentication.LDAP.Attributes.Email = "mail"
+	config.Server.Authentication.TwoFactor.Issuer = "InfoMark"
+	config.Server.Authentication.TwoFactor.RequiredFor = []string{}
 	config.Server.Cronjobs.ZipSubmissionsIntervall = DurationFromString("5m")
+	config.Server.Cronjobs.DeadlineReminderBefore = DurationFromString("24h")
+	config.Server.Cronjobs.DeadlineRemindersIntervall = DurationFromString("15m")
 
 	config.Server.Email.Send = false
+	config.Server.Email.Mailer = "sendmail"
 	config.Server.Email.SendmailBinary = "/usr/sbin/sendmail"
+	config.Server.Email.SMTP.Host = "localhost"
+	config.Server.Email.SMTP.Port = 587
+	config.Server.Email.SMTP.Encryption = "starttls"
+	config.Server.Email.SMTP.Timeout = DurationFromString("30s")
+	config.Server.Email.SMTP.IdleTimeout = DurationFromString("30s")
 	config.Server.Email.From = fmt.Sprintf("no-reply@%s", config.Server.HTTP.Domain)
 	config.Server.Email.ChannelSize = 300
+	config.Server.Email.Queue.RatePerMinute = 60
+	config.Server.Email.Queue.MaxAttempts = 5
+	config.Server.Email.Queue.RetryBackoff = DurationFromString("1m")
+	config.Server.Email.Queue.PollInterval = DurationFromString("1m")
 
 	config.Server.Services.Redis.Host = "localhost"
 	config.Server.Services.Redis.Port = 6379
@@ -146,6 +182,10 @@ func GenerateExampleConfiguration(domain string, root_path string) *configuratio
 	config.Worker.Services.RabbitMQ = config.Server.Services.RabbitMQ
 	config.Worker.Workdir = "/tmp"
 	config.Worker.Void = false
+	config.Worker.FrameworkCacheSize = bytefmt.Gigabyte
+	config.Worker.Artifacts.MaxSize = 10 * bytefmt.Megabyte
+	config.Worker.Artifacts.MaxFiles = 20
+	config.Worker.HeartbeatInterval = 30 * time.Second
 	config.Worker.Docker.MaxMemory = 500 * bytefmt.Megabyte
 	config.Worker.Docker.Timeout = 5 * time.Second
 	return config
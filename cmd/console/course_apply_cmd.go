@@ -0,0 +1,539 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package console
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/infomark-org/infomark/api/app"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/auth/authenticate"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/configuration/bytefmt"
+	"github.com/infomark-org/infomark/model"
+	"github.com/spf13/cobra"
+	null "gopkg.in/guregu/null.v3"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// CourseLayoutFilename is the name of the layout file within the directory
+// passed to "course apply".
+const CourseLayoutFilename = "course.yml"
+
+// CourseLayout is the declarative description of the sheets, tasks and
+// materials of a course. All paths are relative to the layout file.
+type CourseLayout struct {
+	Sheets    []SheetLayout    `yaml:"sheets"`
+	Materials []MaterialLayout `yaml:"materials"`
+}
+
+// normalize converts all dates to UTC, as the database stores timestamps
+// without time zone.
+func (l *CourseLayout) normalize() {
+	for k := range l.Sheets {
+		l.Sheets[k].PublishAt = l.Sheets[k].PublishAt.UTC()
+		l.Sheets[k].DueAt = l.Sheets[k].DueAt.UTC()
+	}
+	for k := range l.Materials {
+		l.Materials[k].PublishAt = l.Materials[k].PublishAt.UTC()
+		l.Materials[k].LectureAt = l.Materials[k].LectureAt.UTC()
+	}
+}
+
+// SheetLayout describes a single exercise sheet. Sheets are identified by name.
+type SheetLayout struct {
+	Name      string       `yaml:"name"`
+	PublishAt time.Time    `yaml:"publish_at"`
+	DueAt     time.Time    `yaml:"due_at"`
+	File      string       `yaml:"file"`
+	Tasks     []TaskLayout `yaml:"tasks"`
+}
+
+// TaskLayout describes a single task. Tasks are identified by name within
+// their sheet. Test directories are zipped before they are uploaded.
+type TaskLayout struct {
+	Name               string           `yaml:"name"`
+	MaxPoints          int              `yaml:"max_points"`
+	PublicDockerImage  string           `yaml:"public_docker_image"`
+	PrivateDockerImage string           `yaml:"private_docker_image"`
+	CPULimit           float64          `yaml:"cpu_limit"`
+	MemoryLimit        bytefmt.ByteSize `yaml:"memory_limit"`
+	PublicTests        string           `yaml:"public_tests"`
+	PrivateTests       string           `yaml:"private_tests"`
+	ReferenceSolution  string           `yaml:"reference_solution"`
+}
+
+// MaterialLayout describes a single material. Materials are identified by name.
+type MaterialLayout struct {
+	Name         string    `yaml:"name"`
+	Kind         int       `yaml:"kind"`
+	RequiredRole int       `yaml:"required_role"`
+	PublishAt    time.Time `yaml:"publish_at"`
+	LectureAt    time.Time `yaml:"lecture_at"`
+	File         string    `yaml:"file"`
+}
+
+// layoutStep is a single change of a plan.
+type layoutStep struct {
+	Description string
+	Apply       func() error
+}
+
+// layoutPlanner computes the steps required to bring a course in sync with a
+// layout.
+type layoutPlanner struct {
+	stores   *app.Stores
+	courseID int64
+	dir      string
+	steps    []layoutStep
+	// tasks which need to validate their reference solution again
+	references map[*model.Task]bool
+}
+
+func newLayoutPlanner(stores *app.Stores, courseID int64, dir string) *layoutPlanner {
+	return &layoutPlanner{
+		stores:     stores,
+		courseID:   courseID,
+		dir:        dir,
+		references: make(map[*model.Task]bool),
+	}
+}
+
+// plan computes all steps without changing anything.
+func (p *layoutPlanner) plan(layout *CourseLayout) error {
+	if err := p.planSheets(layout.Sheets); err != nil {
+		return err
+	}
+	return p.planMaterials(layout.Materials)
+}
+
+// apply executes all planned steps in order.
+func (p *layoutPlanner) apply() error {
+	for _, step := range p.steps {
+		if err := step.Apply(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *layoutPlanner) add(description string, apply func() error) {
+	p.steps = append(p.steps, layoutStep{Description: description, Apply: apply})
+}
+
+// layoutFile is the content of a file (or zipped directory) referenced in a
+// layout.
+type layoutFile struct {
+	Data      []byte
+	Extension string
+	Filename  string
+}
+
+func (f *layoutFile) Sha256() string {
+	return fmt.Sprintf("%x", sha256.Sum256(f.Data))
+}
+
+// readLayoutFile reads a file or zips a directory given relative to the layout.
+func (p *layoutPlanner) readLayoutFile(relPath string) (*layoutFile, error) {
+	path := filepath.Join(p.dir, relPath)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return &layoutFile{Data: data, Extension: filepath.Ext(path), Filename: filepath.Base(path)}, nil
+	}
+
+	data, err := zipDirectory(path)
+	if err != nil {
+		return nil, err
+	}
+	return &layoutFile{Data: data, Extension: ".zip", Filename: filepath.Base(path) + ".zip"}, nil
+}
+
+// zipDirectory creates a zip archive of a directory. The archive does not
+// depend on modification times, such that unchanged directories always result
+// in the same checksum.
+func zipDirectory(root string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		header.Modified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		_, err = io.Copy(fw, in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// planFile adds a step to upload a file if it differs from the stored one.
+// It reports whether an upload has been planned.
+func (p *layoutPlanner) planFile(what string, relPath string, hnd func() *helper.FileHandle) (bool, error) {
+	if relPath == "" {
+		return false, nil
+	}
+
+	file, err := p.readLayoutFile(relPath)
+	if err != nil {
+		return false, err
+	}
+
+	// the handle might not exist yet when the entry is created by this plan
+	if current := hnd(); current.ID != 0 && current.Exists() {
+		sha, err := current.Sha256()
+		if err != nil {
+			return false, err
+		}
+		if sha == file.Sha256() {
+			return false, nil
+		}
+	}
+
+	p.add(fmt.Sprintf("upload %s from %s", what, relPath), func() error {
+		target := hnd()
+		if target.Exists() {
+			if err := target.Delete(); err != nil {
+				return err
+			}
+		}
+		return target.WriteFromReader(bytes.NewReader(file.Data), file.Extension)
+	})
+	return true, nil
+}
+
+func (p *layoutPlanner) planSheets(layouts []SheetLayout) error {
+	sheets, err := p.stores.Sheet.SheetsOfCourse(p.courseID)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]model.Sheet)
+	for _, sheet := range sheets {
+		existing[sheet.Name] = sheet
+	}
+
+	for _, layout := range layouts {
+		layout := layout
+		// named already for the plan of its tasks
+		sheet := &model.Sheet{Name: layout.Name}
+
+		if current, ok := existing[layout.Name]; ok {
+			*sheet = current
+			if !sheet.PublishAt.Equal(layout.PublishAt) || !sheet.DueAt.Equal(layout.DueAt) {
+				p.add(fmt.Sprintf("update sheet %q (id %d)", layout.Name, sheet.ID), func() error {
+					sheet.PublishAt = layout.PublishAt
+					sheet.DueAt = layout.DueAt
+					return p.stores.Sheet.Update(sheet)
+				})
+			}
+		} else {
+			p.add(fmt.Sprintf("create sheet %q", layout.Name), func() error {
+				created, err := p.stores.Sheet.Create(&model.Sheet{
+					Name:      layout.Name,
+					PublishAt: layout.PublishAt,
+					DueAt:     layout.DueAt,
+				}, p.courseID)
+				if err != nil {
+					return err
+				}
+				*sheet = *created
+				return nil
+			})
+		}
+
+		if _, err := p.planFile(fmt.Sprintf("file of sheet %q", layout.Name), layout.File,
+			func() *helper.FileHandle { return helper.NewSheetFileHandle(sheet.ID) }); err != nil {
+			return err
+		}
+
+		if err := p.planTasks(sheet, layout.Tasks); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *layoutPlanner) planTasks(sheet *model.Sheet, layouts []TaskLayout) error {
+	existing := make(map[string]model.Task)
+	if sheet.ID != 0 {
+		tasks, err := p.stores.Task.TasksOfSheet(sheet.ID)
+		if err != nil {
+			return err
+		}
+		for _, t := range tasks {
+			// the listing of a sheet does not contain all columns
+			task, err := p.stores.Task.Get(t.ID)
+			if err != nil {
+				return err
+			}
+			existing[task.Name] = *task
+		}
+	}
+
+	for _, layout := range layouts {
+		layout := layout
+		task := &model.Task{}
+
+		wanted := model.Task{
+			Name:               layout.Name,
+			MaxPoints:          layout.MaxPoints,
+			PublicDockerImage:  null.NewString(layout.PublicDockerImage, layout.PublicDockerImage != ""),
+			PrivateDockerImage: null.NewString(layout.PrivateDockerImage, layout.PrivateDockerImage != ""),
+			CPULimit:           layout.CPULimit,
+			MemoryLimit:        int64(layout.MemoryLimit),
+		}
+
+		if current, ok := existing[layout.Name]; ok {
+			*task = current
+			if task.MaxPoints != wanted.MaxPoints ||
+				task.PublicDockerImage != wanted.PublicDockerImage ||
+				task.PrivateDockerImage != wanted.PrivateDockerImage ||
+				task.CPULimit != wanted.CPULimit ||
+				task.MemoryLimit != wanted.MemoryLimit {
+				if task.PublicDockerImage != wanted.PublicDockerImage ||
+					task.PrivateDockerImage != wanted.PrivateDockerImage {
+					p.references[task] = true
+				}
+				p.add(fmt.Sprintf("update task %q (id %d) of sheet %q", layout.Name, task.ID, sheet.Name), func() error {
+					task.MaxPoints = wanted.MaxPoints
+					task.PublicDockerImage = wanted.PublicDockerImage
+					task.PrivateDockerImage = wanted.PrivateDockerImage
+					task.CPULimit = wanted.CPULimit
+					task.MemoryLimit = wanted.MemoryLimit
+					return p.stores.Task.Update(task)
+				})
+			}
+		} else {
+			p.add(fmt.Sprintf("create task %q of sheet %q", layout.Name, sheet.Name), func() error {
+				created, err := p.stores.Task.Create(&wanted, sheet.ID)
+				if err != nil {
+					return err
+				}
+				*task = *created
+				return nil
+			})
+		}
+
+		files := []struct {
+			what    string
+			relPath string
+			hnd     func() *helper.FileHandle
+		}{
+			{"public tests", layout.PublicTests, func() *helper.FileHandle { return helper.NewPublicTestFileHandle(task.ID) }},
+			{"private tests", layout.PrivateTests, func() *helper.FileHandle { return helper.NewPrivateTestFileHandle(task.ID) }},
+			{"reference solution", layout.ReferenceSolution, func() *helper.FileHandle { return helper.NewReferenceSolutionFileHandle(task.ID) }},
+		}
+
+		for _, file := range files {
+			planned, err := p.planFile(fmt.Sprintf("%s of task %q", file.what, layout.Name), file.relPath, file.hnd)
+			if err != nil {
+				return err
+			}
+			if planned {
+				p.references[task] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *layoutPlanner) planMaterials(layouts []MaterialLayout) error {
+	// admins see all materials
+	materials, err := p.stores.Material.MaterialsOfCourse(p.courseID, 2)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]model.Material)
+	for _, material := range materials {
+		existing[material.Name] = material
+	}
+
+	for _, layout := range layouts {
+		layout := layout
+		material := &model.Material{}
+
+		filename := ""
+		if layout.File != "" {
+			file, err := p.readLayoutFile(layout.File)
+			if err != nil {
+				return err
+			}
+			filename = file.Filename
+		}
+
+		if current, ok := existing[layout.Name]; ok {
+			*material = current
+			if material.Kind != layout.Kind ||
+				material.RequiredRole != layout.RequiredRole ||
+				(filename != "" && material.Filename != filename) ||
+				!material.PublishAt.Equal(layout.PublishAt) ||
+				!material.LectureAt.Equal(layout.LectureAt) {
+				p.add(fmt.Sprintf("update material %q (id %d)", layout.Name, material.ID), func() error {
+					material.Kind = layout.Kind
+					material.RequiredRole = layout.RequiredRole
+					material.PublishAt = layout.PublishAt
+					material.LectureAt = layout.LectureAt
+					if filename != "" {
+						material.Filename = filename
+					}
+					return p.stores.Material.Update(material)
+				})
+			}
+		} else {
+			p.add(fmt.Sprintf("create material %q", layout.Name), func() error {
+				created, err := p.stores.Material.Create(&model.Material{
+					Name:         layout.Name,
+					Kind:         layout.Kind,
+					Filename:     filename,
+					PublishAt:    layout.PublishAt,
+					LectureAt:    layout.LectureAt,
+					RequiredRole: layout.RequiredRole,
+				}, p.courseID)
+				if err != nil {
+					return err
+				}
+				*material = *created
+				return nil
+			})
+		}
+
+		if _, err := p.planFile(fmt.Sprintf("file of material %q", layout.Name), layout.File,
+			func() *helper.FileHandle { return helper.NewMaterialFileHandle(material.ID) }); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var applyDryRun bool
+
+var CourseApplyCmd = &cobra.Command{
+	Use:   "apply [courseID] [dir]",
+	Short: "sync sheets, tasks and materials of a course with a YAML layout",
+	Long: `Reads the layout "course.yml" from the given directory, compares it with the
+current state of the course and prints the required changes. Sheets, tasks and
+materials are identified by their names. Entries which are not part of the
+layout are kept untouched. Test directories are zipped and uploaded as
+public/private test files. Running the command twice has no further effect.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		courseID := MustInt64Parameter(args[0], "courseID")
+		dir := args[1]
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, CourseLayoutFilename))
+		failWhenSmallestWhiff(err)
+
+		layout := &CourseLayout{}
+		err = yaml.Unmarshal(content, layout)
+		failWhenSmallestWhiff(err)
+		layout.normalize()
+
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		course, err := stores.Course.Get(courseID)
+		failWhenSmallestWhiff(err)
+
+		planner := newLayoutPlanner(stores, course.ID, dir)
+		failWhenSmallestWhiff(planner.plan(layout))
+
+		if len(planner.steps) == 0 {
+			fmt.Printf("course %v (%s) is up to date\n", course.ID, course.Name)
+			return
+		}
+
+		fmt.Printf("plan for course %v (%s):\n", course.ID, course.Name)
+		for _, step := range planner.steps {
+			fmt.Printf("  - %s\n", step.Description)
+		}
+
+		if applyDryRun {
+			return
+		}
+
+		failWhenSmallestWhiff(planner.apply())
+		fmt.Printf("applied %d changes\n", len(planner.steps))
+
+		if len(planner.references) > 0 {
+			app.InitSubmissionProducer()
+			tokenAuth := authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication, configuration.Configuration.Worker.Docker.Timeout)
+
+			for task := range planner.references {
+				failWhenSmallestWhiff(app.EnqueueReferenceSolution(stores, tokenAuth, course.ID, task))
+			}
+			fmt.Printf("validating reference solutions of %d tasks\n", len(planner.references))
+		}
+	},
+}
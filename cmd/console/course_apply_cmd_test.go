@@ -0,0 +1,263 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package console
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/api/app"
+	"github.com/infomark-org/infomark/api/helper"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/model"
+)
+
+// The fake stores keep the entries of a single course in memory. Embedding
+// the interfaces satisfies all methods which are not used by the planner.
+
+type fakeSheetStore struct {
+	app.SheetStore
+	sheets []model.Sheet
+}
+
+func (s *fakeSheetStore) SheetsOfCourse(courseID int64) ([]model.Sheet, error) {
+	return append([]model.Sheet{}, s.sheets...), nil
+}
+
+func (s *fakeSheetStore) Create(p *model.Sheet, courseID int64) (*model.Sheet, error) {
+	created := *p
+	created.ID = int64(len(s.sheets) + 1)
+	s.sheets = append(s.sheets, created)
+	return &created, nil
+}
+
+func (s *fakeSheetStore) Update(p *model.Sheet) error {
+	s.sheets[p.ID-1] = *p
+	return nil
+}
+
+type fakeTaskStore struct {
+	app.TaskStore
+	tasks   []model.Task
+	sheetOf map[int64]int64
+}
+
+func (s *fakeTaskStore) TasksOfSheet(sheetID int64) ([]model.Task, error) {
+	tasks := []model.Task{}
+	for _, task := range s.tasks {
+		if s.sheetOf[task.ID] == sheetID {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *fakeTaskStore) Get(taskID int64) (*model.Task, error) {
+	task := s.tasks[taskID-1]
+	return &task, nil
+}
+
+func (s *fakeTaskStore) Create(p *model.Task, sheetID int64) (*model.Task, error) {
+	created := *p
+	created.ID = int64(len(s.tasks) + 1)
+	s.tasks = append(s.tasks, created)
+	s.sheetOf[created.ID] = sheetID
+	return &created, nil
+}
+
+func (s *fakeTaskStore) Update(p *model.Task) error {
+	s.tasks[p.ID-1] = *p
+	return nil
+}
+
+type fakeMaterialStore struct {
+	app.MaterialStore
+	materials []model.Material
+}
+
+func (s *fakeMaterialStore) MaterialsOfCourse(courseID int64, requiredRole int) ([]model.Material, error) {
+	return append([]model.Material{}, s.materials...), nil
+}
+
+func (s *fakeMaterialStore) Create(p *model.Material, courseID int64) (*model.Material, error) {
+	created := *p
+	created.ID = int64(len(s.materials) + 1)
+	s.materials = append(s.materials, created)
+	return &created, nil
+}
+
+func (s *fakeMaterialStore) Update(p *model.Material) error {
+	s.materials[p.ID-1] = *p
+	return nil
+}
+
+func descriptions(p *layoutPlanner) []string {
+	result := []string{}
+	for _, step := range p.steps {
+		result = append(result, step.Description)
+	}
+	return result
+}
+
+func TestCourseApply(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	var dir string
+	var sheets *fakeSheetStore
+	var tasks *fakeTaskStore
+	var materials *fakeMaterialStore
+	var stores *app.Stores
+	var layout *CourseLayout
+
+	write := func(name string, content string) {
+		path := filepath.Join(dir, name)
+		g.Assert(os.MkdirAll(filepath.Dir(path), 0755)).Equal(nil)
+		g.Assert(ioutil.WriteFile(path, []byte(content), 0644)).Equal(nil)
+	}
+
+	plan := func() *layoutPlanner {
+		planner := newLayoutPlanner(stores, 1, filepath.Join(dir, "layout"))
+		g.Assert(planner.plan(layout)).Equal(nil)
+		return planner
+	}
+
+	g.Describe("Course apply", func() {
+
+		g.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "course-apply")
+			g.Assert(err).Equal(nil)
+
+			for _, sub := range []string{"sheets", "tasks", "materials"} {
+				g.Assert(os.MkdirAll(filepath.Join(dir, "uploads", sub), 0755)).Equal(nil)
+			}
+			configuration.Configuration = &configuration.ConfigurationSchema{}
+			configuration.Configuration.Server.Paths.Uploads = filepath.Join(dir, "uploads")
+
+			write("layout/sheet1.zip", "sheet 1")
+			write("layout/task1/public/test.py", "assert True")
+			write("layout/slides.pdf", "slides")
+
+			sheets = &fakeSheetStore{}
+			tasks = &fakeTaskStore{sheetOf: make(map[int64]int64)}
+			materials = &fakeMaterialStore{}
+			stores = &app.Stores{Sheet: sheets, Task: tasks, Material: materials}
+
+			publishAt := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+			layout = &CourseLayout{
+				Sheets: []SheetLayout{{
+					Name:      "Sheet 1",
+					PublishAt: publishAt,
+					DueAt:     publishAt.Add(7 * 24 * time.Hour),
+					File:      "sheet1.zip",
+					Tasks: []TaskLayout{{
+						Name:              "Task 1",
+						MaxPoints:         10,
+						PublicDockerImage: "python:3",
+						PublicTests:       "task1/public",
+					}},
+				}},
+				Materials: []MaterialLayout{{
+					Name:      "Slides",
+					PublishAt: publishAt,
+					LectureAt: publishAt,
+					File:      "slides.pdf",
+				}},
+			}
+		})
+
+		g.AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		g.It("Should only print the plan in a dry run", func() {
+			planner := plan()
+
+			g.Assert(descriptions(planner)).Equal([]string{
+				`create sheet "Sheet 1"`,
+				`upload file of sheet "Sheet 1" from sheet1.zip`,
+				`create task "Task 1" of sheet "Sheet 1"`,
+				`upload public tests of task "Task 1" from task1/public`,
+				`create material "Slides"`,
+				`upload file of material "Slides" from slides.pdf`,
+			})
+			g.Assert(len(planner.references)).Equal(1)
+
+			// planning alone does not change anything
+			g.Assert(len(sheets.sheets)).Equal(0)
+			g.Assert(len(tasks.tasks)).Equal(0)
+			g.Assert(len(materials.materials)).Equal(0)
+			g.Assert(helper.NewSheetFileHandle(1).Exists()).IsFalse()
+		})
+
+		g.It("Should have no effect when applied twice", func() {
+			g.Assert(plan().apply()).Equal(nil)
+
+			g.Assert(len(sheets.sheets)).Equal(1)
+			g.Assert(len(tasks.tasks)).Equal(1)
+			g.Assert(tasks.sheetOf[1]).Equal(int64(1))
+			g.Assert(materials.materials[0].Filename).Equal("slides.pdf")
+			g.Assert(helper.NewSheetFileHandle(1).Exists()).IsTrue()
+			g.Assert(helper.NewPublicTestFileHandle(1).Exists()).IsTrue()
+			g.Assert(helper.NewMaterialFileHandle(1).Exists()).IsTrue()
+
+			planner := plan()
+			g.Assert(len(planner.steps)).Equal(0)
+			g.Assert(len(planner.references)).Equal(0)
+		})
+
+		g.It("Should only update what has changed", func() {
+			g.Assert(plan().apply()).Equal(nil)
+
+			layout.Sheets[0].DueAt = layout.Sheets[0].DueAt.Add(24 * time.Hour)
+			layout.Sheets[0].Tasks[0].MaxPoints = 12
+
+			planner := plan()
+			g.Assert(descriptions(planner)).Equal([]string{
+				`update sheet "Sheet 1" (id 1)`,
+				`update task "Task 1" (id 1) of sheet "Sheet 1"`,
+			})
+			// points do not affect the reference solution
+			g.Assert(len(planner.references)).Equal(0)
+
+			g.Assert(planner.apply()).Equal(nil)
+			g.Assert(sheets.sheets[0].DueAt.Equal(layout.Sheets[0].DueAt)).IsTrue()
+			g.Assert(tasks.tasks[0].MaxPoints).Equal(12)
+			g.Assert(len(plan().steps)).Equal(0)
+		})
+
+		g.It("Should validate the reference solution again when tests change", func() {
+			g.Assert(plan().apply()).Equal(nil)
+
+			write("layout/task1/public/test.py", "assert 1 == 1")
+
+			planner := plan()
+			g.Assert(descriptions(planner)).Equal([]string{
+				`upload public tests of task "Task 1" from task1/public`,
+			})
+			g.Assert(len(planner.references)).Equal(1)
+		})
+
+	})
+}
@@ -20,17 +20,44 @@
 package console
 
 import (
+	"archive/zip"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
+	"github.com/infomark-org/infomark/api/app"
 	"github.com/infomark-org/infomark/configuration"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	CourseCmd.AddCommand(UserEnrollInCourse)
+
+	CourseCloneCmd.Flags().StringVarP(&cloneName, "name", "n", "", "name of the new course")
+	CourseCloneCmd.Flags().BoolVarP(&cloneGroups, "groups", "g", false, "copy groups (without members)")
+	CourseCmd.AddCommand(CourseCloneCmd)
+
+	CourseExportCmd.Flags().StringVarP(&exportFile, "output", "o", "", "path of the archive (default: course-<courseID>.zip)")
+	CourseCmd.AddCommand(CourseExportCmd)
+
+	CourseImportCmd.Flags().BoolVarP(&importAnonymize, "anonymize", "a", false, "replace personal data of students")
+	CourseImportCmd.Flags().BoolVarP(&importWithoutStudents, "without-students", "w", false, "skip all data of students")
+	CourseImportCmd.Flags().BoolVarP(&importKeepRoles, "keep-roles", "r", false, "enroll tutors and admins with their roles from the archive")
+	CourseCmd.AddCommand(CourseImportCmd)
+
+	CourseApplyCmd.Flags().BoolVarP(&applyDryRun, "dry-run", "d", false, "only print the plan")
+	CourseCmd.AddCommand(CourseApplyCmd)
 }
 
+var cloneName string
+var cloneGroups bool
+
+var exportFile string
+var importAnonymize bool
+var importWithoutStudents bool
+var importKeepRoles bool
+
 var CourseCmd = &cobra.Command{
 	Use:   "course",
 	Short: "Management of cours assignment",
@@ -75,8 +102,103 @@ var UserEnrollInCourse = &cobra.Command{
 		if err := stores.Course.Enroll(course.ID, user.ID, role); err != nil {
 			panic(err)
 		}
+		auditConsole(stores, "course enroll", "enrollment", user.ID, nil, map[string]int64{
+			"course_id": course.ID,
+			"user_id":   user.ID,
+			"role":      role,
+		})
 
 		fmt.Printf("user %s %s is now enrolled in course %v with role %v\n",
 			user.FirstName, user.LastName, course.ID, role)
 	},
 }
+
+var CourseCloneCmd = &cobra.Command{
+	Use:   "clone [courseID] [offsetDays]",
+	Short: "copy a course into a new semester",
+	Long: `Copies sheets, tasks, materials, exams and all their files into a new course.
+All dates are shifted by the given number of days. Enrollments, submissions
+and grades are never copied.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		courseID := MustInt64Parameter(args[0], "courseID")
+		offsetDays := MustInt64Parameter(args[1], "offsetDays")
+
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		course, err := stores.Course.Get(courseID)
+		if err != nil {
+			log.Fatalf("course with id %v not found\n", courseID)
+		}
+
+		newCourse, err := app.CloneCourse(stores, course.ID, app.CourseCloneOptions{
+			Name:       cloneName,
+			Offset:     time.Duration(offsetDays) * 24 * time.Hour,
+			WithGroups: cloneGroups,
+		})
+		failWhenSmallestWhiff(err)
+
+		fmt.Printf("course %v (%s) has been cloned into course %v (%s)\n",
+			course.ID, course.Name, newCourse.ID, newCourse.Name)
+	},
+}
+
+var CourseExportCmd = &cobra.Command{
+	Use:   "export [courseID]",
+	Short: "export a course into a portable archive",
+	Long: `Writes a zip archive containing a manifest and JSON documents for the course,
+sheets, tasks, materials, exams, groups, enrollments, submissions and grades
+together with all referenced files.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		courseID := MustInt64Parameter(args[0], "courseID")
+
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		if exportFile == "" {
+			exportFile = fmt.Sprintf("course-%d.zip", courseID)
+		}
+
+		f, err := os.Create(exportFile)
+		failWhenSmallestWhiff(err)
+		defer f.Close()
+
+		err = app.ExportCourseArchive(stores, courseID, f)
+		failWhenSmallestWhiff(err)
+
+		fmt.Printf("course %v has been exported to %s\n", courseID, exportFile)
+	},
+}
+
+var CourseImportCmd = &cobra.Command{
+	Use:   "import [archive]",
+	Short: "import a course from a portable archive",
+	Long: `Creates a new course from an archive written by "course export".
+All ids are remapped. Users are matched by their email address and created if
+they do not exist yet. Created users need to reset their password. Everybody
+is enrolled as student unless the roles of the archive are confirmed by
+"--keep-roles".`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		zr, err := zip.OpenReader(args[0])
+		failWhenSmallestWhiff(err)
+		defer zr.Close()
+
+		course, err := app.ImportCourseArchive(stores, &zr.Reader, app.CourseArchiveImportOptions{
+			Anonymize:       importAnonymize,
+			WithoutStudents: importWithoutStudents,
+			KeepRoles:       importKeepRoles,
+		})
+		failWhenSmallestWhiff(err)
+
+		fmt.Printf("archive %s has been imported as course %v (%s)\n", args[0], course.ID, course.Name)
+	},
+}
@@ -188,6 +188,10 @@ already enrolled in another group`,
 
 		group, err := stores.Group.Get(groupID)
 		failWhenSmallestWhiff(err)
+		auditConsole(stores, "group enroll", "user", user.ID, nil, map[string]int64{
+			"course_id": course.ID,
+			"group_id":  group.ID,
+		})
 
 		fmt.Printf("user %s %s (id: %v) is now enrolled in group (%v) %s\n",
 			user.FirstName,
@@ -56,6 +56,13 @@ func MustConnectAndStores() (*sqlx.DB, *app.Stores) {
 	return db, stores
 }
 
+// auditConsole appends a console command to the audit log. Before and after
+// are the states of the target, nil if there is none.
+func auditConsole(stores *app.Stores, action string, targetType string, targetID int64, before interface{}, after interface{}) {
+	err := app.RecordConsoleAction(stores, "console "+action, targetType, targetID, before, after)
+	failWhenSmallestWhiff(err)
+}
+
 func MustInt64Parameter(argStr string, name string) int64 {
 	argInt, err := strconv.Atoi(argStr)
 	if err != nil {
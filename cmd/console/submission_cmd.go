@@ -20,11 +20,12 @@
 package console
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
+	"github.com/infomark-org/infomark/api/app"
 	"github.com/infomark-org/infomark/api/helper"
 	"github.com/infomark-org/infomark/api/shared"
 	"github.com/infomark-org/infomark/auth/authenticate"
@@ -38,10 +39,13 @@ import (
 func init() {
 	SubmissionCmd.AddCommand(SubmissionTriggerCmd)
 	SubmissionCmd.AddCommand(SubmissionTriggerAllCmd)
+	SubmissionRunCmd.Flags().StringVarP(&runOutput, "output", "o", "", "directory to keep the files the tests write to /data/output")
 	SubmissionCmd.AddCommand(SubmissionRunCmd)
 
 }
 
+var runOutput string
+
 // SubmissionCmd is the command all submission related actions.
 var SubmissionCmd = &cobra.Command{
 	Use:   "submission",
@@ -84,29 +88,24 @@ var SubmissionTriggerCmd = &cobra.Command{
 		sha256, err := helper.NewSubmissionFileHandle(submission.ID).Sha256()
 		failWhenSmallestWhiff(err)
 
-		tokenManager := authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication)
+		tokenManager := authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication, configuration.Configuration.Worker.Docker.Timeout)
 
-		accessToken, err := tokenManager.CreateAccessJWT(
-			authenticate.NewAccessClaims(1, true))
-		failWhenSmallestWhiff(err)
+		producer, _ := service.NewProducer(cfg)
+		submissionHnd := helper.NewSubmissionFileHandle(submission.ID)
 
-		bodyPublic, err := json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
+		requestPublic := shared.NewSubmissionAMQPWorkerRequest(
 			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public"))
-		if err != nil {
-			log.Fatalf("json.Marshal: %s", err)
-		}
+			configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public")
+		requestPublic.LimitResources(task)
+		failWhenSmallestWhiff(app.PublishJob(producer, tokenManager, requestPublic,
+			submissionHnd, helper.NewPublicTestFileHandle(task.ID), service.PublicPriority))
 
-		bodyPrivate, err := json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
+		requestPrivate := shared.NewSubmissionAMQPWorkerRequest(
 			course.ID, task.ID, submission.ID, grade.ID,
-			accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private"))
-		if err != nil {
-			log.Fatalf("json.Marshal: %s", err)
-		}
-
-		producer, _ := service.NewProducer(cfg)
-		producer.Publish(bodyPublic)
-		producer.Publish(bodyPrivate)
+			configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private")
+		requestPrivate.LimitResources(task)
+		failWhenSmallestWhiff(app.PublishJob(producer, tokenManager, requestPrivate,
+			submissionHnd, helper.NewPrivateTestFileHandle(task.ID), service.PrivatePriority))
 
 	},
 }
@@ -130,6 +129,12 @@ var SubmissionRunCmd = &cobra.Command{
 		task, err := stores.Task.Get(submission.TaskID)
 		failWhenSmallestWhiff(err)
 
+		// use the same limits as a worker without a budget of its own
+		limits := service.Resources{CPUs: task.CPULimit, Memory: task.MemoryLimit}.Or(service.Resources{
+			CPUs:   1,
+			Memory: int64(configuration.Configuration.Worker.Docker.MaxMemory),
+		})
+
 		log.Println("try starting docker...")
 
 		ds, err := service.NewDockerServiceWithTimeout(configuration.Configuration.Worker.Docker.Timeout)
@@ -157,7 +162,9 @@ var SubmissionRunCmd = &cobra.Command{
 					task.PublicDockerImage.String,
 					submissionHnd.Path(),
 					frameworkHnd.Path(),
-					int64(configuration.Configuration.Worker.Docker.MaxMemory),
+					limits.CPUs,
+					limits.Memory,
+					mustOutputDirectory(runOutput, "public"),
 				)
 				if err != nil {
 					log.Fatal(err)
@@ -187,7 +194,9 @@ var SubmissionRunCmd = &cobra.Command{
 					task.PrivateDockerImage.String,
 					submissionHnd.Path(),
 					frameworkHnd.Path(),
-					int64(configuration.Configuration.Worker.Docker.MaxMemory),
+					limits.CPUs,
+					limits.Memory,
+					mustOutputDirectory(runOutput, "private"),
 				)
 				if err != nil {
 					log.Fatal(err)
@@ -286,34 +295,52 @@ WHERE task_id = $1
 				sublog.Warn("Skip as sha cannot be computed")
 			}
 
-			tokenManager := authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication)
-
-			accessToken, err := tokenManager.CreateAccessJWT(
-				authenticate.NewAccessClaims(1, true))
-			failWhenSmallestWhiff(err)
+			tokenManager := authenticate.NewTokenAuth(&configuration.Configuration.Server.Authentication, configuration.Configuration.Worker.Docker.Timeout)
 
 			var (
-				body []byte
-				merr error
+				visibility string
+				image      string
+				framework  *helper.FileHandle
 			)
 
 			if args[1] == "public" {
-				body, merr = json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
-					course.ID, taskID, submissionWithGrade.ID, submissionWithGrade.GradeID,
-					accessToken, configuration.Configuration.Server.ExternalURL(), task.PublicDockerImage.String, sha256, "public"))
-
+				visibility = "public"
+				image = task.PublicDockerImage.String
+				framework = helper.NewPublicTestFileHandle(task.ID)
 			} else {
-				body, merr = json.Marshal(shared.NewSubmissionAMQPWorkerRequest(
-					course.ID, taskID, submissionWithGrade.ID, submissionWithGrade.GradeID,
-					accessToken, configuration.Configuration.Server.ExternalURL(), task.PrivateDockerImage.String, sha256, "private"))
-			}
-			if merr != nil {
-				log.Fatalf("json.Marshal: %s", merr)
+				visibility = "private"
+				image = task.PrivateDockerImage.String
+				framework = helper.NewPrivateTestFileHandle(task.ID)
 			}
 
-			producer.Publish(body)
+			request := shared.NewSubmissionAMQPWorkerRequest(
+				course.ID, taskID, submissionWithGrade.ID, submissionWithGrade.GradeID,
+				configuration.Configuration.Server.ExternalURL(), image, sha256, visibility)
+			request.LimitResources(task)
+
+			if err := app.PublishJob(producer, tokenManager, request, submissionHnd, framework, service.BulkPriority); err != nil {
+				sublog.Warn(err)
+			}
 
 		}
 
 	},
 }
+
+// mustOutputDirectory creates the directory which keeps the files the tests
+// write to /data/output. No directory is used if root is empty.
+func mustOutputDirectory(root string, visibility string) string {
+	if root == "" {
+		return ""
+	}
+
+	directory, err := filepath.Abs(filepath.Join(root, visibility))
+	failWhenSmallestWhiff(err)
+
+	failWhenSmallestWhiff(os.MkdirAll(directory, 0777))
+	// tests do not necessarily run as root within the container
+	failWhenSmallestWhiff(os.Chmod(directory, 0777))
+
+	log.Printf("keep output files in \"%v\"\n", directory)
+	return directory
+}
@@ -22,6 +22,7 @@ package console
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/infomark-org/infomark/configuration"
@@ -34,6 +35,9 @@ func init() {
 	UserCmd.AddCommand(UserFindCmd)
 	UserCmd.AddCommand(UserConfirmCmd)
 	UserCmd.AddCommand(UserSetEmailCmd)
+	UserCmd.AddCommand(UserResetTwoFactorCmd)
+	UserCmd.AddCommand(UserUnlockCmd)
+	UserCmd.AddCommand(UserAuthEventsCmd)
 }
 
 var UserCmd = &cobra.Command{
@@ -100,10 +104,12 @@ var UserConfirmCmd = &cobra.Command{
 			log.Fatalf("user with email %v not found\n", email)
 		}
 
+		before := *user
 		user.ConfirmEmailToken = null.String{}
 		if err := stores.User.Update(user); err != nil {
 			panic(err)
 		}
+		auditConsole(stores, "user confirm", "user", user.ID, &before, user)
 
 		fmt.Printf("email %s of user %s %s has been confirmed\n",
 			email, user.FirstName, user.LastName)
@@ -132,12 +138,100 @@ var UserSetEmailCmd = &cobra.Command{
 			return
 		}
 
+		before := *user
 		user.Email = email
 		if err := stores.User.Update(user); err != nil {
 			panic(err)
 		}
+		auditConsole(stores, "user set-email", "user", user.ID, &before, user)
 
 		fmt.Printf("email of user %s %s is now %s\n",
 			user.FirstName, user.LastName, user.Email)
 	},
 }
+
+var UserResetTwoFactorCmd = &cobra.Command{
+	Use:   "reset-2fa [userID]",
+	Short: "will remove the second factor",
+	Long:  `Will remove the TOTP second factor and all recovery codes of an user who lost access to them`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		userID := MustInt64Parameter(args[0], "userID")
+
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		user, err := stores.User.Get(userID)
+		if err != nil {
+			fmt.Printf("user with id %v not found\n", userID)
+			return
+		}
+
+		if err := stores.TwoFactor.Delete(user.ID); err != nil {
+			panic(err)
+		}
+		auditConsole(stores, "user reset-2fa", "user", user.ID, nil, nil)
+
+		fmt.Printf("second factor of user %s %s has been removed\n",
+			user.FirstName, user.LastName)
+	},
+}
+
+var UserUnlockCmd = &cobra.Command{
+	Use:   "unlock [userID]",
+	Short: "will unlock an account",
+	Long:  `Will forget all failed logins of an user and lift a lockout`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		userID := MustInt64Parameter(args[0], "userID")
+
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		user, err := stores.User.Get(userID)
+		if err != nil {
+			fmt.Printf("user with id %v not found\n", userID)
+			return
+		}
+
+		if err := stores.Lockout.Unlock(user.ID); err != nil {
+			panic(err)
+		}
+
+		if err := stores.AuthEvent.Create(&model.AuthEvent{
+			UserID: null.IntFrom(user.ID),
+			Email:  user.Email,
+			Kind:   model.AuthEventUnlocked,
+		}); err != nil {
+			panic(err)
+		}
+		auditConsole(stores, "user unlock", "user", user.ID, nil, nil)
+
+		fmt.Printf("account of user %s %s is unlocked\n",
+			user.FirstName, user.LastName)
+	},
+}
+
+var UserAuthEventsCmd = &cobra.Command{
+	Use:   "auth-events [userID]",
+	Short: "list recent logins of an user",
+	Long:  `List the latest logins, failed logins and lockouts of an user`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		userID := MustInt64Parameter(args[0], "userID")
+
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		events, err := stores.AuthEvent.RecentOfUser(userID, 50)
+		failWhenSmallestWhiff(err)
+
+		for _, event := range events {
+			fmt.Printf("%s %12s %40s %s\n",
+				event.CreatedAt.Format(time.RFC3339), event.Kind, event.IP, event.UserAgent)
+		}
+	},
+}
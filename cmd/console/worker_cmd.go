@@ -0,0 +1,83 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/infomark-org/infomark/api/shared"
+	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/service"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	WorkerWarmupCmd.Flags().BoolVarP(&warmupDryRun, "dry-run", "d", false, "only print the images")
+	WorkerCmd.AddCommand(WorkerWarmupCmd)
+}
+
+var warmupDryRun bool
+
+// WorkerCmd is the command for all worker related actions.
+var WorkerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Management of workers",
+}
+
+// WorkerWarmupCmd asks all running workers to pull the docker images of
+// active tasks.
+var WorkerWarmupCmd = &cobra.Command{
+	Use:   "warmup",
+	Short: "pre-pull docker images of active tasks on all workers",
+	Long: `will ask every running worker to pull all docker images which are used by
+tasks of open sheets in running courses`,
+	Args: cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		configuration.MustFindAndReadConfiguration()
+
+		_, stores := MustConnectAndStores()
+
+		images, err := stores.Task.GetActiveDockerImages()
+		failWhenSmallestWhiff(err)
+
+		for _, image := range images {
+			fmt.Println(image)
+		}
+
+		if len(images) == 0 {
+			fmt.Println("no active tasks use a docker image")
+			return
+		}
+
+		if warmupDryRun {
+			return
+		}
+
+		body, err := json.Marshal(&shared.WorkerBroadcast{PullImages: images})
+		failWhenSmallestWhiff(err)
+
+		cfg := service.NewConfig(&configuration.Configuration.Server.Services.RabbitMQ)
+		err = service.PublishBroadcast(cfg, body)
+		failWhenSmallestWhiff(err)
+
+		fmt.Printf("asked workers to pull %d images\n", len(images))
+	},
+}
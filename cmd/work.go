@@ -25,17 +25,27 @@ import (
 	"github.com/infomark-org/infomark/api"
 	background "github.com/infomark-org/infomark/api/worker"
 	"github.com/infomark-org/infomark/configuration"
+	"github.com/infomark-org/infomark/service"
 
 	"github.com/spf13/cobra"
 )
 
 var numWorkers = 1
+var workerImages []string
+var workerPulledImages bool
+var workerName string
 
 var workCmd = &cobra.Command{
 	Use:   "work",
 	Short: "start a worker",
 	Long: `Starts a background worker which will use docker to test submissions.
-Can be used with the flag "-n" to start multiple workers within one process.
+Can be used with the flag "-n" to run multiple jobs at the same time within
+one process. Jobs are only fetched when the resources they declare fit into the
+CPU and memory budget of the worker ("worker.resources" in the configuration).
+The flags "-i" and "-p" restrict the worker to jobs of the given or all locally
+pulled docker images to run dedicated worker pools.
+The worker announces itself to the server under the name given by "--name",
+which defaults to the hostname.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -47,6 +57,27 @@ Can be used with the flag "-n" to start multiple workers within one process.
 			background.DefaultSubmissionHandler = &background.RealSubmissionHandler{}
 		}
 
+		if workerName != "" {
+			configuration.Configuration.Worker.Name = workerName
+		}
+
+		configuration.Configuration.Worker.Images = append(configuration.Configuration.Worker.Images, workerImages...)
+		if workerPulledImages {
+			ds, err := service.NewDockerServiceWithTimeout(configuration.Configuration.Worker.Docker.Timeout)
+			if err != nil {
+				log.Fatal(err)
+			}
+			images, err := ds.PulledImages()
+			if err != nil {
+				log.Fatal(err)
+			}
+			ds.Client.Close()
+			if len(images) == 0 {
+				log.Fatal("there are no local docker images")
+			}
+			configuration.Configuration.Worker.Images = append(configuration.Configuration.Worker.Images, images...)
+		}
+
 		worker, err := api.NewWorker(numWorkers)
 		if err != nil {
 			log.Fatal(err)
@@ -57,6 +88,9 @@ Can be used with the flag "-n" to start multiple workers within one process.
 
 func init() {
 
-	workCmd.Flags().IntVarP(&numWorkers, "number", "n", 1, "number of workers within one routine")
+	workCmd.Flags().IntVarP(&numWorkers, "number", "n", 1, "maximal number of jobs running at the same time")
+	workCmd.Flags().StringSliceVarP(&workerImages, "image", "i", []string{}, "only test jobs for this docker image (repeatable)")
+	workCmd.Flags().BoolVarP(&workerPulledImages, "pulled", "p", false, "only test jobs for locally pulled docker images")
+	workCmd.Flags().StringVar(&workerName, "name", "", "name of the worker within the worker registry")
 	RootCmd.AddCommand(workCmd)
 }
@@ -51,6 +51,10 @@ type AuthenticationConfiguration struct {
 		Secret        string        `yaml:"secret"`
 		AccessExpiry  time.Duration `yaml:"access_expiry"`
 		RefreshExpiry time.Duration `yaml:"refresh_expiry"`
+		// job tokens for background workers stay valid while the job waits
+		// in the queue (at most 24h) and then while it runs (the timeout of
+		// the workers)
+		JobQueueExpiry time.Duration `yaml:"job_queue_expiry"`
 	} `yaml:"jwt"`
 	Session struct {
 		Secret  string `yaml:"secret"`
@@ -64,6 +68,102 @@ type AuthenticationConfiguration struct {
 		MinLength int `yaml:"min_length"`
 	} `yaml:"password"`
 	TotalRequestsPerMinute int64 `yaml:"total_requests_per_minute"`
+	// accounts are locked temporarily after failed logins in a row
+	Lockout struct {
+		// failed logins before the first lockout, 0 disables lockouts
+		MaxFailedLogins int `yaml:"max_failed_logins"`
+		// the lockout doubles with every further failed login
+		Duration    time.Duration `yaml:"duration"`
+		MaxDuration time.Duration `yaml:"max_duration"`
+	} `yaml:"lockout"`
+	// root admins acting as another user
+	Impersonation struct {
+		MaxDuration time.Duration `yaml:"max_duration"`
+	} `yaml:"impersonation"`
+	// single sign-on through an OpenID Connect provider
+	OIDC OIDCConfiguration `yaml:"oidc"`
+	// checked in this order at a password login, "password" (local accounts)
+	// and "ldap" (defaults to "password")
+	Authenticators []string `yaml:"authenticators"`
+	// password login against a directory
+	LDAP LDAPConfiguration `yaml:"ldap"`
+	// TOTP as second factor of password logins
+	TwoFactor struct {
+		// name of the site in authenticator apps
+		Issuer string `yaml:"issuer"`
+		// accounts which must use a second factor: "root", "admin" (course
+		// admins) and "tutor" (tutors and course admins)
+		RequiredFor []string `yaml:"required_for"`
+	} `yaml:"two_factor"`
+}
+
+type SMTPConfiguration struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// "none", "starttls" (usually port 587) or "tls" (usually port 465)
+	Encryption string `yaml:"encryption"`
+	// PEM file with the certificate authority of the server (defaults to the
+	// system pool)
+	RootCA             string `yaml:"root_ca"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// no authentication if empty
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// limits connecting and the delivery of each email
+	Timeout time.Duration `yaml:"timeout"`
+	// the connection is reused for emails sent within this time
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+type OIDCConfiguration struct {
+	Enabled      bool     `yaml:"enabled"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	// create accounts for unknown users on their first login
+	CreateAccounts bool `yaml:"create_accounts"`
+	// page the browser is sent to after the login (defaults to the external URL)
+	RedirectAfterLogin string `yaml:"redirect_after_login"`
+	// names of the claims holding the fields of an account, empty names
+	// leave the field untouched
+	Claims struct {
+		FirstName     string `yaml:"first_name"`
+		LastName      string `yaml:"last_name"`
+		Email         string `yaml:"email"`
+		StudentNumber string `yaml:"student_number"`
+		Semester      string `yaml:"semester"`
+		Subject       string `yaml:"subject"`
+	} `yaml:"claims"`
+}
+
+type LDAPConfiguration struct {
+	// ldap://host:389 or ldaps://host:636
+	URL      string `yaml:"url"`
+	StartTLS bool   `yaml:"start_tls"`
+	// PEM file with the certificate authority of the server (defaults to the
+	// system pool)
+	RootCA             string        `yaml:"root_ca"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+	Timeout            time.Duration `yaml:"timeout"`
+	// account used to look up the DN of a user, empty binds anonymously
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// %s is replaced by the email address of the login
+	UserFilter string `yaml:"user_filter"`
+	// create accounts for unknown users on their first login
+	CreateAccounts bool `yaml:"create_accounts"`
+	// names of the attributes holding the fields of an account, empty names
+	// leave the field untouched
+	Attributes struct {
+		FirstName     string `yaml:"first_name"`
+		LastName      string `yaml:"last_name"`
+		Email         string `yaml:"email"`
+		StudentNumber string `yaml:"student_number"`
+		Semester      string `yaml:"semester"`
+		Subject       string `yaml:"subject"`
+	} `yaml:"attributes"`
 }
 
 func (config *ServerConfigurationSchema) URL() string {
@@ -117,18 +217,43 @@ type ServerConfigurationSchema struct {
 			MaxRequestJSON bytefmt.ByteSize `yaml:"max_request_json"`
 			MaxAvatar      bytefmt.ByteSize `yaml:"max_avatar"`
 			MaxSubmission  bytefmt.ByteSize `yaml:"max_submission"`
+			MaxArtifacts   bytefmt.ByteSize `yaml:"max_artifacts"`
 		} `yaml:"limits"`
 	} `yaml:"http"`
-	DistributeJobs bool                        `yaml:"distribute_jobs"`
+	DistributeJobs bool `yaml:"distribute_jobs"`
+	Jobs           struct {
+		// how workers return results: "http" (default) or "amqp"
+		ResultTransport string `yaml:"result_transport"`
+		// directory shared with the workers to stage files instead of downloads
+		StagingDirectory string `yaml:"staging_directory"`
+		// workers without heartbeat within this time are considered stale
+		WorkerTimeout time.Duration `yaml:"worker_timeout"`
+	} `yaml:"jobs"`
 	Authentication AuthenticationConfiguration `yaml:"authentication"`
 	Cronjobs       struct {
 		ZipSubmissionsIntervall time.Duration `yaml:"zip_submissions_intervall"`
+		// students are reminded of sheets due within this time, 0 disables
+		// the reminders
+		DeadlineReminderBefore     time.Duration `yaml:"deadline_reminder_before"`
+		DeadlineRemindersIntervall time.Duration `yaml:"deadline_reminders_intervall"`
 	} `yaml:"cronjobs"`
 	Email struct {
-		Send           bool   `yaml:"send"`
-		SendmailBinary string `yaml:"sendmail_binary"`
-		From           string `yaml:"from"`
-		ChannelSize    int    `yaml:"channel_size"`
+		Send bool `yaml:"send"`
+		// how emails are delivered: "sendmail" (default) or "smtp"
+		Mailer         string            `yaml:"mailer"`
+		SendmailBinary string            `yaml:"sendmail_binary"`
+		SMTP           SMTPConfiguration `yaml:"smtp"`
+		From           string            `yaml:"from"`
+		ChannelSize    int               `yaml:"channel_size"`
+		// outgoing emails are stored and retried until they are sent
+		Queue struct {
+			// deliveries per minute, 0 means no limit
+			RatePerMinute int `yaml:"rate_per_minute"`
+			MaxAttempts   int `yaml:"max_attempts"`
+			// wait before the first retry, doubled for every further retry
+			RetryBackoff time.Duration `yaml:"retry_backoff"`
+			PollInterval time.Duration `yaml:"poll_interval"`
+		} `yaml:"queue"`
 	} `yaml:"email"`
 	Services struct {
 		Redis struct {
@@ -154,7 +279,22 @@ type ServerConfigurationSchema struct {
 	Paths PathsConfiguration `yaml:"paths"`
 }
 
+// ResultsOverAMQP tells whether workers return results over a reply queue
+// instead of HTTP callbacks.
+func (config *ServerConfigurationSchema) ResultsOverAMQP() bool {
+	return config.Jobs.ResultTransport == "amqp"
+}
+
+// SendEmailOverSMTP tells whether emails are delivered to a SMTP server
+// instead of the sendmail binary.
+func (config *ServerConfigurationSchema) SendEmailOverSMTP() bool {
+	return config.Email.Mailer == "smtp"
+}
+
 func (config *ServerConfigurationSchema) SendEmail() bool {
+	if config.SendEmailOverSMTP() {
+		return (config.Email.Send && config.Email.SMTP.Host != "")
+	}
 	return (config.Email.Send && config.Email.SendmailBinary != "")
 }
 
@@ -184,6 +324,11 @@ func (config *ServerConfigurationSchema) CronjobsZipSubmissionsIntervall() strin
 	return fmt.Sprintf("@ every %s", secs)
 }
 
+func (config *ServerConfigurationSchema) CronjobsDeadlineRemindersIntervall() string {
+	secs := config.Cronjobs.DeadlineRemindersIntervall
+	return fmt.Sprintf("@ every %s", secs)
+}
+
 type WorkerConfigurationSchema struct {
 	Version  int `json:"version"`
 	Services struct {
@@ -191,7 +336,29 @@ type WorkerConfigurationSchema struct {
 	} `yaml:"services"`
 	Workdir string `yaml:"workdir"`
 	Void    bool   `yaml:"void"`
-	Docker  struct {
+	// name within the worker registry (defaults to the hostname)
+	Name string `yaml:"name"`
+	// time between two heartbeats sent to the server
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	// budget for all jobs running at the same time (defaults to all cores
+	// and the memory of a container for each job)
+	Resources struct {
+		CPUs   float64          `yaml:"cpus"`
+		Memory bytefmt.ByteSize `yaml:"memory"`
+	} `yaml:"resources"`
+	// mount point of the staging directory shared with the server
+	StagingDirectory string `yaml:"staging_directory"`
+	// size of the cache of test frameworks within the workdir (0 disables it)
+	FrameworkCacheSize bytefmt.ByteSize `yaml:"framework_cache_size"`
+	// files the tests write to /data/output are uploaded as artifacts
+	// (a max size of 0 disables the collection)
+	Artifacts struct {
+		MaxSize  bytefmt.ByteSize `yaml:"max_size"`
+		MaxFiles int              `yaml:"max_files"`
+	} `yaml:"artifacts"`
+	// only consume jobs for these docker images (dedicated worker pool)
+	Images []string `yaml:"images"`
+	Docker struct {
 		MaxMemory bytefmt.ByteSize `yaml:"max_memory"`
 		Timeout   time.Duration    `yaml:"timeout"`
 	} `yaml:"docker"`
@@ -0,0 +1,105 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+type AuditStore struct {
+	db Queryer
+}
+
+func NewAuditStore(db Queryer) *AuditStore {
+	return &AuditStore{
+		db: db,
+	}
+}
+
+func (s *AuditStore) Get(entryID int64) (*model.AuditEntry, error) {
+	p := model.AuditEntry{}
+	err := s.db.Get(&p, "SELECT * FROM audit_log WHERE id = $1 LIMIT 1;", entryID)
+	return &p, err
+}
+
+// Create appends an entry to the audit log.
+func (s *AuditStore) Create(p *model.AuditEntry) (*model.AuditEntry, error) {
+	newID, err := Insert(s.db, "audit_log", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// GetFiltered returns the entries matching all given filters, the latest
+// first. Zero values and zero times match everything.
+func (s *AuditStore) GetFiltered(
+	actorID int64,
+	targetType string,
+	targetID int64,
+	action string,
+	source string,
+	from time.Time,
+	to time.Time,
+	limit int,
+	offset int,
+) ([]model.AuditEntry, error) {
+
+	p := []model.AuditEntry{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  audit_log
+WHERE
+  ($1 = 0 OR actor_id = $1)
+AND
+  ($2 = '' OR target_type = $2)
+AND
+  ($3 = 0 OR target_id = $3)
+AND
+  action LIKE $4
+AND
+  ($5 = '' OR source = $5)
+AND
+  ($6 = FALSE OR created_at >= $7)
+AND
+  ($8 = FALSE OR created_at < $9)
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $10
+OFFSET $11;
+    `,
+		actorID,        // $1
+		targetType,     // $2
+		targetID,       // $3
+		"%"+action+"%", // $4
+		source,         // $5
+		!from.IsZero(), // $6
+		from,           // $7
+		!to.IsZero(),   // $8
+		to,             // $9
+		limit,          // $10
+		offset,         // $11
+	)
+	return p, err
+}
@@ -0,0 +1,93 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type AuthEventStore struct {
+	db Queryer
+}
+
+func NewAuthEventStore(db Queryer) *AuthEventStore {
+	return &AuthEventStore{
+		db: db,
+	}
+}
+
+func (s *AuthEventStore) Create(p *model.AuthEvent) error {
+	_, err := Insert(s.db, "auth_events", p)
+	return err
+}
+
+// Recent returns the latest events of all accounts.
+func (s *AuthEventStore) Recent(limit int) ([]model.AuthEvent, error) {
+	p := []model.AuthEvent{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  auth_events
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $1;
+    `, limit)
+	return p, err
+}
+
+// RecentOfUser returns the latest events of an account.
+func (s *AuthEventStore) RecentOfUser(userID int64, limit int) ([]model.AuthEvent, error) {
+	p := []model.AuthEvent{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  auth_events
+WHERE
+  user_id = $1
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $2;
+    `, userID, limit)
+	return p, err
+}
+
+// KnownDevice tells whether a user has logged in from an IP address with a
+// user agent before and whether there has been any login at all.
+func (s *AuthEventStore) KnownDevice(userID int64, ip string, userAgent string) (known bool, anyLogin bool, err error) {
+	var counts struct {
+		Logins int `db:"logins"`
+		Known  int `db:"known"`
+	}
+
+	err = s.db.Get(&counts, `
+SELECT
+  COUNT(*) AS logins,
+  COUNT(*) FILTER (WHERE ip = $3 AND user_agent = $4) AS known
+FROM
+  auth_events
+WHERE
+  user_id = $1
+AND
+  kind = $2;
+    `, userID, model.AuthEventLogin, ip, userAgent)
+	return counts.Known > 0, counts.Logins > 0, err
+}
@@ -22,15 +22,14 @@ package database
 import (
 	"github.com/infomark-org/infomark/auth/authorize"
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
 type CourseStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewCourseStore(db *sqlx.DB) *CourseStore {
+func NewCourseStore(db Queryer) *CourseStore {
 	return &CourseStore{
 		db: db,
 	}
@@ -65,7 +64,8 @@ func (s *CourseStore) UpdateRole(courseID, userID int64, role int) error {
 UPDATE
   user_course
 SET
-  role = $3
+  role = $3,
+  course_role_id = NULL
 WHERE
   user_ID = $1
 AND
@@ -268,6 +268,25 @@ ORDER BY
 
 }
 
+// HighestRole returns the highest role a user has in any course.
+func (s *CourseStore) HighestRole(userID int64) (authorize.CourseRole, error) {
+	var role int
+
+	err := s.db.Get(&role, `
+SELECT
+  COALESCE(MAX(role), -1)
+FROM
+  user_course
+WHERE
+  user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return authorize.NOCOURSEROLE, err
+	}
+	return authorize.CourseRole(role), nil
+}
+
 func (s *CourseStore) RoleInCourse(userID int64, courseID int64) (authorize.CourseRole, error) {
 	var role_int int
 
@@ -0,0 +1,137 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+type DeadlineReminderStore struct {
+	db Queryer
+}
+
+func NewDeadlineReminderStore(db Queryer) *DeadlineReminderStore {
+	return &DeadlineReminderStore{
+		db: db,
+	}
+}
+
+// DueSheets returns the sheets students can access which are due after from
+// and not after to.
+func (s *DeadlineReminderStore) DueSheets(from time.Time, to time.Time) ([]model.DueSheet, error) {
+	p := []model.DueSheet{}
+	err := s.db.Select(&p, `
+SELECT
+  s.id sheet_id,
+  s.name sheet_name,
+  s.due_at,
+  c.id course_id,
+  c.name course_name
+FROM
+  sheets s
+INNER JOIN sheet_course sc ON sc.sheet_id = s.id
+INNER JOIN courses c ON c.id = sc.course_id
+WHERE`+sheetPublic+`
+AND
+  s.due_at > $1
+AND
+  s.due_at <= $2
+ORDER BY
+  s.due_at ASC, s.id ASC;
+    `, from, to)
+	return p, err
+}
+
+// Recipients returns the students of a course who have neither opted out
+// nor got a reminder for the sheet yet.
+func (s *DeadlineReminderStore) Recipients(sheetID int64, courseID int64) ([]model.User, error) {
+	p := []model.User{}
+	err := s.db.Select(&p, `
+SELECT
+  u.*
+FROM
+  users u
+INNER JOIN user_course uc ON uc.user_id = u.id
+WHERE
+  uc.course_id = $2
+AND
+  uc.role = 0
+AND
+  u.id NOT IN (
+    SELECT user_id FROM deadline_reminder_opt_outs WHERE course_id = $2
+  )
+AND
+  u.id NOT IN (
+    SELECT user_id FROM deadline_reminders WHERE sheet_id = $1
+  )
+ORDER BY
+  u.id ASC;
+    `, sheetID, courseID)
+	return p, err
+}
+
+// Claim records the reminder of a student for a sheet. It returns false if
+// the student has got the reminder already.
+func (s *DeadlineReminderStore) Claim(sheetID int64, userID int64) (bool, error) {
+	res, err := s.db.Exec(`
+INSERT INTO deadline_reminders
+  (sheet_id, user_id)
+VALUES
+  ($1, $2)
+ON CONFLICT (sheet_id, user_id) DO NOTHING;
+    `, sheetID, userID)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := res.RowsAffected()
+	return inserted == 1, err
+}
+
+// Enabled tells whether a student gets reminders in a course.
+func (s *DeadlineReminderStore) Enabled(courseID int64, userID int64) (bool, error) {
+	optedOut := false
+	err := s.db.Get(&optedOut, `
+SELECT EXISTS (
+  SELECT 1 FROM deadline_reminder_opt_outs WHERE course_id = $1 AND user_id = $2
+);
+    `, courseID, userID)
+	return !optedOut, err
+}
+
+// SetEnabled opts a student in or out of reminders in a course.
+func (s *DeadlineReminderStore) SetEnabled(courseID int64, userID int64, enabled bool) error {
+	if enabled {
+		_, err := s.db.Exec(`
+DELETE FROM deadline_reminder_opt_outs WHERE course_id = $1 AND user_id = $2;
+    `, courseID, userID)
+		return err
+	}
+
+	_, err := s.db.Exec(`
+INSERT INTO deadline_reminder_opt_outs
+  (course_id, user_id)
+VALUES
+  ($1, $2)
+ON CONFLICT (user_id, course_id) DO NOTHING;
+    `, courseID, userID)
+	return err
+}
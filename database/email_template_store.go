@@ -0,0 +1,93 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type EmailTemplateStore struct {
+	db Queryer
+}
+
+func NewEmailTemplateStore(db Queryer) *EmailTemplateStore {
+	return &EmailTemplateStore{
+		db: db,
+	}
+}
+
+func (s *EmailTemplateStore) Get(templateID int64) (*model.EmailTemplate, error) {
+	p := model.EmailTemplate{}
+	err := s.db.Get(&p, "SELECT * FROM email_templates WHERE id = $1 LIMIT 1;", templateID)
+	return &p, err
+}
+
+// Find returns the customized translation of an email for a course or the
+// instance (courseID 0).
+func (s *EmailTemplateStore) Find(courseID int64, name string, language string) (*model.EmailTemplate, error) {
+	p := model.EmailTemplate{}
+	err := s.db.Get(&p, `
+SELECT
+  *
+FROM
+  email_templates
+WHERE
+  COALESCE(course_id, 0) = $1
+AND
+  name = $2
+AND
+  language = $3
+LIMIT 1;
+    `, courseID, name, language)
+	return &p, err
+}
+
+// GetAll returns the customized translations of a course or the instance
+// (courseID 0).
+func (s *EmailTemplateStore) GetAll(courseID int64) ([]model.EmailTemplate, error) {
+	p := []model.EmailTemplate{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  email_templates
+WHERE
+  COALESCE(course_id, 0) = $1
+ORDER BY
+  name ASC, language ASC;
+    `, courseID)
+	return p, err
+}
+
+func (s *EmailTemplateStore) Create(p *model.EmailTemplate) (*model.EmailTemplate, error) {
+	newID, err := Insert(s.db, "email_templates", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *EmailTemplateStore) Update(p *model.EmailTemplate) error {
+	return Update(s.db, "email_templates", p.ID, p)
+}
+
+func (s *EmailTemplateStore) Delete(templateID int64) error {
+	return Delete(s.db, "email_templates", templateID)
+}
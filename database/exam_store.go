@@ -19,14 +19,13 @@ package database
 
 import (
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 )
 
 type ExamStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewExamStore(db *sqlx.DB) *ExamStore {
+func NewExamStore(db Queryer) *ExamStore {
 	return &ExamStore{
 		db: db,
 	}
@@ -0,0 +1,75 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type GradeArtifactStore struct {
+	db Queryer
+}
+
+func NewGradeArtifactStore(db Queryer) *GradeArtifactStore {
+	return &GradeArtifactStore{
+		db: db,
+	}
+}
+
+func (s *GradeArtifactStore) Get(artifactID int64) (*model.GradeArtifact, error) {
+	p := model.GradeArtifact{}
+	err := s.db.Get(&p, "SELECT * FROM grade_artifacts WHERE id = $1 LIMIT 1;", artifactID)
+	return &p, err
+}
+
+// ArtifactsOfGrade returns the artifacts of a grade. Students only get the
+// artifacts which are visible to them.
+func (s *GradeArtifactStore) ArtifactsOfGrade(gradeID int64, onlyVisibleToStudents bool) ([]model.GradeArtifact, error) {
+	p := []model.GradeArtifact{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  grade_artifacts
+WHERE
+  grade_id = $1
+AND
+  (visible_to_students OR NOT $2)
+ORDER BY
+  visibility DESC, name ASC;
+    `, gradeID, onlyVisibleToStudents)
+	return p, err
+}
+
+func (s *GradeArtifactStore) Create(p *model.GradeArtifact) (*model.GradeArtifact, error) {
+	newID, err := Insert(s.db, "grade_artifacts", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *GradeArtifactStore) Update(p *model.GradeArtifact) error {
+	return Update(s.db, "grade_artifacts", p.ID, p)
+}
+
+func (s *GradeArtifactStore) Delete(artifactID int64) error {
+	return Delete(s.db, "grade_artifacts", artifactID)
+}
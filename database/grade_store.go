@@ -22,14 +22,13 @@ package database
 import (
 	"github.com/infomark-org/infomark/model"
 	"github.com/infomark-org/infomark/symbol"
-	"github.com/jmoiron/sqlx"
 )
 
 type GradeStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewGradeStore(db *sqlx.DB) *GradeStore {
+func NewGradeStore(db Queryer) *GradeStore {
 	return &GradeStore{
 		db: db,
 	}
@@ -100,6 +99,22 @@ func (s *GradeStore) GetForSubmission(id int64) (*model.Grade, error) {
 	return &p, err
 }
 
+// GetAllOfTask returns the grades of all submissions to a task.
+func (s *GradeStore) GetAllOfTask(taskID int64) ([]model.Grade, error) {
+	p := []model.Grade{}
+	err := s.db.Select(&p, `
+SELECT
+  g.*
+FROM
+  grades g
+INNER JOIN submissions s ON s.id = g.submission_id
+WHERE
+  s.task_id = $1
+ORDER BY
+  g.id ASC`, taskID)
+	return p, err
+}
+
 func (s *GradeStore) GetOverviewGrades(courseID int64, groupID int64) ([]model.OverviewGrade, error) {
 	p := []model.OverviewGrade{}
 	err := s.db.Select(&p, `
@@ -293,3 +308,27 @@ WHERE
 
 	return task, err
 }
+
+// TutoredBy tells whether a grade belongs to a submission of a member of a
+// group the tutor is responsible for.
+func (s *GradeStore) TutoredBy(gradeID int64, tutorID int64) (bool, error) {
+	var tutored bool
+	err := s.db.Get(&tutored, `
+SELECT EXISTS (
+  SELECT
+    1
+  FROM
+    grades g
+  INNER JOIN submissions s ON s.id = g.submission_id
+  INNER JOIN task_sheet ts ON ts.task_id = s.task_id
+  INNER JOIN sheet_course sc ON sc.sheet_id = ts.sheet_id
+  INNER JOIN user_group ug ON ug.user_id = s.user_id
+  INNER JOIN groups gr ON gr.id = ug.group_id AND gr.course_id = sc.course_id
+  WHERE
+    g.id = $1
+  AND
+    gr.tutor_id = $2
+);
+    `, gradeID, tutorID)
+	return tutored, err
+}
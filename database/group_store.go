@@ -21,15 +21,14 @@ package database
 
 import (
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
 
 type GroupStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewGroupStore(db *sqlx.DB) *GroupStore {
+func NewGroupStore(db Queryer) *GroupStore {
 	return &GroupStore{
 		db: db,
 	}
@@ -0,0 +1,101 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type ImpersonationStore struct {
+	db Queryer
+}
+
+func NewImpersonationStore(db Queryer) *ImpersonationStore {
+	return &ImpersonationStore{
+		db: db,
+	}
+}
+
+func (s *ImpersonationStore) Get(impersonationID int64) (*model.Impersonation, error) {
+	p := model.Impersonation{}
+	err := s.db.Get(&p, "SELECT * FROM impersonations WHERE id = $1 LIMIT 1;", impersonationID)
+	return &p, err
+}
+
+// Recent returns the latest impersonations.
+func (s *ImpersonationStore) Recent(limit int) ([]model.Impersonation, error) {
+	p := []model.Impersonation{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  impersonations
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $1;
+    `, limit)
+	return p, err
+}
+
+func (s *ImpersonationStore) Create(p *model.Impersonation) (*model.Impersonation, error) {
+	newID, err := Insert(s.db, "impersonations", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// Stop ends an impersonation before it expires.
+func (s *ImpersonationStore) Stop(impersonationID int64) error {
+	_, err := s.db.Exec(`
+UPDATE
+  impersonations
+SET
+  stopped_at = NOW(),
+  updated_at = NOW()
+WHERE
+  id = $1
+AND
+  stopped_at IS NULL;
+    `, impersonationID)
+	return err
+}
+
+// LogRequest records a request made during an impersonation.
+func (s *ImpersonationStore) LogRequest(p *model.ImpersonationRequest) error {
+	_, err := Insert(s.db, "impersonation_requests", p)
+	return err
+}
+
+// RequestsOf returns all requests made during an impersonation.
+func (s *ImpersonationStore) RequestsOf(impersonationID int64) ([]model.ImpersonationRequest, error) {
+	p := []model.ImpersonationRequest{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  impersonation_requests
+WHERE
+  impersonation_id = $1
+ORDER BY
+  created_at ASC, id ASC;
+    `, impersonationID)
+	return p, err
+}
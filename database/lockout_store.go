@@ -0,0 +1,81 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+type LockoutStore struct {
+	db Queryer
+}
+
+func NewLockoutStore(db Queryer) *LockoutStore {
+	return &LockoutStore{
+		db: db,
+	}
+}
+
+func (s *LockoutStore) Get(userID int64) (*model.Lockout, error) {
+	p := model.Lockout{}
+	err := s.db.Get(&p, "SELECT * FROM user_lockouts WHERE user_id = $1 LIMIT 1;", userID)
+	return &p, err
+}
+
+// CountFailure adds a failed login and returns the number of failed logins
+// in a row.
+func (s *LockoutStore) CountFailure(userID int64) (int, error) {
+	var failures int
+	err := s.db.Get(&failures, `
+INSERT INTO user_lockouts
+  (user_id, failed_logins)
+VALUES
+  ($1, 1)
+ON CONFLICT (user_id) DO UPDATE
+SET
+  failed_logins = user_lockouts.failed_logins + 1,
+  updated_at = NOW()
+RETURNING
+  failed_logins;
+    `, userID)
+	return failures, err
+}
+
+// Lock rejects all logins of the account until the given time.
+func (s *LockoutStore) Lock(userID int64, until time.Time) error {
+	_, err := s.db.Exec(`
+UPDATE
+  user_lockouts
+SET
+  locked_until = $2,
+  updated_at = NOW()
+WHERE
+  user_id = $1;
+    `, userID, until)
+	return err
+}
+
+// Unlock forgets all failed logins of the account.
+func (s *LockoutStore) Unlock(userID int64) error {
+	_, err := s.db.Exec("DELETE FROM user_lockouts WHERE user_id = $1;", userID)
+	return err
+}
@@ -21,17 +21,16 @@ package database
 
 import (
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 )
 
 // MaterialStore is the store for materials (slides, additional material) for a
 // lecture.
 type MaterialStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
 // NewMaterialStore creates a new material store.
-func NewMaterialStore(db *sqlx.DB) *MaterialStore {
+func NewMaterialStore(db Queryer) *MaterialStore {
 	return &MaterialStore{
 		db: db,
 	}
@@ -45,6 +45,14 @@ type DB interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
+// Queryer is implemented by a database connection as well as by a
+// transaction, such that the stores can run within a transaction.
+type Queryer interface {
+	DB
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
 // DatabaseSyntax contains driver specific settings.
 type DatabaseSyntax struct {
 	Quote               string // the quote character for table and column names
@@ -0,0 +1,112 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+)
+
+type OutgoingEmailStore struct {
+	db Queryer
+}
+
+func NewOutgoingEmailStore(db Queryer) *OutgoingEmailStore {
+	return &OutgoingEmailStore{
+		db: db,
+	}
+}
+
+func (s *OutgoingEmailStore) Get(emailID int64) (*model.OutgoingEmail, error) {
+	p := model.OutgoingEmail{}
+	err := s.db.Get(&p, "SELECT * FROM outgoing_emails WHERE id = $1 LIMIT 1;", emailID)
+	return &p, err
+}
+
+func (s *OutgoingEmailStore) Create(p *model.OutgoingEmail) (*model.OutgoingEmail, error) {
+	newID, err := Insert(s.db, "outgoing_emails", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *OutgoingEmailStore) Update(p *model.OutgoingEmail) error {
+	return Update(s.db, "outgoing_emails", p.ID, p)
+}
+
+// ClaimDue returns pending emails whose next attempt is due, the oldest
+// first. Their next attempt is moved to claimedUntil at once, such that other
+// instances of the server skip them while they are being delivered.
+func (s *OutgoingEmailStore) ClaimDue(now time.Time, claimedUntil time.Time, limit int) ([]model.OutgoingEmail, error) {
+	p := []model.OutgoingEmail{}
+	err := s.db.Select(&p, `
+UPDATE
+  outgoing_emails
+SET
+  next_attempt_at = $2,
+  updated_at = NOW()
+WHERE
+  id IN (
+    SELECT
+      id
+    FROM
+      outgoing_emails
+    WHERE
+      status = 'pending'
+    AND
+      next_attempt_at <= $1
+    ORDER BY
+      next_attempt_at ASC, id ASC
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING
+  *;
+    `, now, claimedUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the sub-query
+	sort.Slice(p, func(i, j int) bool { return p[i].ID < p[j].ID })
+	return p, nil
+}
+
+// GetFiltered returns the emails with the given status (all for an empty
+// status), the latest first.
+func (s *OutgoingEmailStore) GetFiltered(status string, limit int, offset int) ([]model.OutgoingEmail, error) {
+	p := []model.OutgoingEmail{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  outgoing_emails
+WHERE
+  ($1 = '' OR status = $1)
+ORDER BY
+  created_at DESC, id DESC
+LIMIT $2
+OFFSET $3;
+    `, status, limit, offset)
+	return p, err
+}
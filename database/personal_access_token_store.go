@@ -0,0 +1,118 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type PersonalAccessTokenStore struct {
+	db Queryer
+}
+
+func NewPersonalAccessTokenStore(db Queryer) *PersonalAccessTokenStore {
+	return &PersonalAccessTokenStore{
+		db: db,
+	}
+}
+
+func (s *PersonalAccessTokenStore) Get(tokenID int64) (*model.PersonalAccessToken, error) {
+	p := model.PersonalAccessToken{}
+	err := s.db.Get(&p, `
+SELECT
+  t.*, u.root
+FROM
+  personal_access_tokens t
+INNER JOIN
+  users u ON u.id = t.user_id
+WHERE
+  t.id = $1
+LIMIT 1;
+    `, tokenID)
+	return &p, err
+}
+
+// FindByHash returns the token with the given hash regardless of its expiry.
+func (s *PersonalAccessTokenStore) FindByHash(tokenHash string) (*model.PersonalAccessToken, error) {
+	p := model.PersonalAccessToken{}
+	err := s.db.Get(&p, `
+SELECT
+  t.*, u.root
+FROM
+  personal_access_tokens t
+INNER JOIN
+  users u ON u.id = t.user_id
+WHERE
+  t.token_hash = $1
+LIMIT 1;
+    `, tokenHash)
+	return &p, err
+}
+
+func (s *PersonalAccessTokenStore) TokensOfUser(userID int64) ([]model.PersonalAccessToken, error) {
+	p := []model.PersonalAccessToken{}
+	err := s.db.Select(&p, `
+SELECT
+  t.*, u.root
+FROM
+  personal_access_tokens t
+INNER JOIN
+  users u ON u.id = t.user_id
+WHERE
+  t.user_id = $1
+ORDER BY
+  t.created_at DESC, t.id DESC;
+    `, userID)
+	return p, err
+}
+
+func (s *PersonalAccessTokenStore) Create(p *model.PersonalAccessToken) (*model.PersonalAccessToken, error) {
+	newID, err := Insert(s.db, "personal_access_tokens", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *PersonalAccessTokenStore) Delete(tokenID int64) error {
+	return Delete(s.db, "personal_access_tokens", tokenID)
+}
+
+// DeleteAllOfUser revokes all tokens of a user.
+func (s *PersonalAccessTokenStore) DeleteAllOfUser(userID int64) error {
+	_, err := s.db.Exec("DELETE FROM personal_access_tokens WHERE user_id = $1;", userID)
+	return err
+}
+
+// Touch records the usage of a token. To avoid a write on each request, the
+// timestamp is updated at most once per minute.
+func (s *PersonalAccessTokenStore) Touch(tokenID int64) error {
+	_, err := s.db.Exec(`
+UPDATE
+  personal_access_tokens
+SET
+  last_used_at = NOW()
+WHERE
+  id = $1
+AND
+  (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+    `, tokenID)
+	return err
+}
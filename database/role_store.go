@@ -0,0 +1,130 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/auth/authorize"
+	"github.com/infomark-org/infomark/model"
+)
+
+type RoleStore struct {
+	db Queryer
+}
+
+func NewRoleStore(db Queryer) *RoleStore {
+	return &RoleStore{
+		db: db,
+	}
+}
+
+func (s *RoleStore) Get(roleID int64) (*model.Role, error) {
+	p := model.Role{}
+	err := s.db.Get(&p, "SELECT * FROM course_roles WHERE id = $1 LIMIT 1;", roleID)
+	return &p, err
+}
+
+func (s *RoleStore) RolesOfCourse(courseID int64) ([]model.Role, error) {
+	p := []model.Role{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  course_roles
+WHERE
+  course_id = $1
+ORDER BY
+  name ASC;
+    `, courseID)
+	return p, err
+}
+
+func (s *RoleStore) Create(p *model.Role) (*model.Role, error) {
+	newID, err := Insert(s.db, "course_roles", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+// Update changes a role. Its members get the new base role right away.
+func (s *RoleStore) Update(p *model.Role) error {
+	if err := Update(s.db, "course_roles", p.ID, p); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`
+UPDATE
+  user_course
+SET
+  role = $2
+WHERE
+  course_role_id = $1;
+    `, p.ID, memberRole(p))
+	return err
+}
+
+// Delete removes a role. Its members keep their base role.
+func (s *RoleStore) Delete(roleID int64) error {
+	return Delete(s.db, "course_roles", roleID)
+}
+
+// RoleOfUserInCourse returns the role a member has in a course. It fails with
+// sql.ErrNoRows for members having one of the fixed course roles only.
+func (s *RoleStore) RoleOfUserInCourse(userID int64, courseID int64) (*model.Role, error) {
+	p := model.Role{}
+	err := s.db.Get(&p, `
+SELECT
+  r.*
+FROM
+  course_roles r
+INNER JOIN user_course uc ON uc.course_role_id = r.id
+WHERE
+  uc.user_id = $1
+AND
+  uc.course_id = $2
+LIMIT 1;
+    `, userID, courseID)
+	return &p, err
+}
+
+// Assign gives a member of a course a role together with its base role.
+func (s *RoleStore) Assign(userID int64, p *model.Role) error {
+	_, err := s.db.Exec(`
+UPDATE
+  user_course
+SET
+  role = $3,
+  course_role_id = $4
+WHERE
+  user_id = $1
+AND
+  course_id = $2;
+    `, userID, p.CourseID, memberRole(p), p.ID)
+	return err
+}
+
+// memberRole is the fixed course role the members of a role get. A role never
+// grants more than a tutor has, admins of a course are appointed explicitly.
+func memberRole(p *model.Role) authorize.CourseRole {
+	if p.BaseRole > int(authorize.TUTOR) {
+		return authorize.TUTOR
+	}
+	return authorize.CourseRole(p.BaseRole)
+}
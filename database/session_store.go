@@ -0,0 +1,114 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type SessionStore struct {
+	db Queryer
+}
+
+func NewSessionStore(db Queryer) *SessionStore {
+	return &SessionStore{
+		db: db,
+	}
+}
+
+func (s *SessionStore) Get(sessionID int64) (*model.Session, error) {
+	p := model.Session{}
+	err := s.db.Get(&p, "SELECT * FROM user_sessions WHERE id = $1 LIMIT 1;", sessionID)
+	return &p, err
+}
+
+// SessionsOfUser returns the sessions of a user which have not expired yet.
+func (s *SessionStore) SessionsOfUser(userID int64) ([]model.Session, error) {
+	p := []model.Session{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  user_sessions
+WHERE
+  user_id = $1
+AND
+  expires_at > NOW()
+ORDER BY
+  last_seen_at DESC, id DESC;
+    `, userID)
+	return p, err
+}
+
+// Create registers a new session. Expired sessions of the same user are
+// removed on this occasion.
+func (s *SessionStore) Create(p *model.Session) (*model.Session, error) {
+	if _, err := s.db.Exec(`
+DELETE FROM
+  user_sessions
+WHERE
+  user_id = $1
+AND
+  expires_at <= NOW();
+    `, p.UserID); err != nil {
+		return nil, err
+	}
+
+	newID, err := Insert(s.db, "user_sessions", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *SessionStore) Delete(sessionID int64) error {
+	return Delete(s.db, "user_sessions", sessionID)
+}
+
+// DeleteAllOfUser revokes all sessions of a user except the one given by
+// keepID, which can be 0 to revoke really all.
+func (s *SessionStore) DeleteAllOfUser(userID int64, keepID int64) error {
+	_, err := s.db.Exec(`
+DELETE FROM
+  user_sessions
+WHERE
+  user_id = $1
+AND
+  id <> $2;
+    `, userID, keepID)
+	return err
+}
+
+// Touch records the usage of a session. To avoid a write on each request, the
+// timestamp is updated at most once per minute.
+func (s *SessionStore) Touch(sessionID int64, ip string) error {
+	_, err := s.db.Exec(`
+UPDATE
+  user_sessions
+SET
+  last_seen_at = NOW(),
+  ip = $2
+WHERE
+  id = $1
+AND
+  last_seen_at < NOW() - INTERVAL '1 minute';
+    `, sessionID, ip)
+	return err
+}
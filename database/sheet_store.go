@@ -21,28 +21,68 @@ package database
 
 import (
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 )
 
 type SheetStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewSheetStore(db *sqlx.DB) *SheetStore {
+func NewSheetStore(db Queryer) *SheetStore {
 	return &SheetStore{
 		db: db,
 	}
 }
 
+// sheetTestsBrokenCondition tells whether the tests of a sheet "s" are broken.
+// They are broken if the reference solution of any task was pending or failed
+// before the sheet has been published, until it passes. Runs after the
+// publication do not take a published sheet down again.
+const sheetTestsBrokenCondition = `
+  EXISTS (
+    SELECT
+      1
+    FROM
+      task_sheet ts
+    INNER JOIN tasks t ON t.id = ts.task_id
+    WHERE
+      ts.sheet_id = s.id
+    AND
+      (t.reference_public_state IN (1, 3) OR t.reference_private_state IN (1, 3))
+    AND
+      (t.reference_blocked_at IS NULL OR t.reference_blocked_at < s.publish_at)
+  )`
+
+// sheetTestsBroken computes the column "tests_broken" for a sheet "s".
+const sheetTestsBroken = sheetTestsBrokenCondition + ` AS tests_broken`
+
+// sheetPublic tells whether students can access a sheet "s" at the time $1.
+// Like SheetPublic of the app it hides sheets whose tests are broken unless
+// the check is overridden.
+const sheetPublic = `
+  s.publish_at <= $1
+AND
+  (s.ignore_broken_tests OR NOT` + sheetTestsBrokenCondition + `)`
+
 func (s *SheetStore) Get(sheetID int64) (*model.Sheet, error) {
 	p := model.Sheet{ID: sheetID}
-	err := s.db.Get(&p, "SELECT * FROM sheets WHERE id = $1 LIMIT 1;", p.ID)
+	err := s.db.Get(&p, `
+SELECT
+  s.*,`+sheetTestsBroken+`
+FROM
+  sheets s
+WHERE
+  s.id = $1
+LIMIT 1;`, p.ID)
 	return &p, err
 }
 
 func (s *SheetStore) GetAll() ([]model.Sheet, error) {
 	p := []model.Sheet{}
-	err := s.db.Select(&p, "SELECT * FROM sheets;")
+	err := s.db.Select(&p, `
+SELECT
+  s.*,`+sheetTestsBroken+`
+FROM
+  sheets s;`)
 	return p, err
 }
 
@@ -81,7 +121,8 @@ func (s *SheetStore) SheetsOfCourse(courseID int64) ([]model.Sheet, error) {
 
 	err := s.db.Select(&p, `
 SELECT
-  s.id, s.created_at, s.updated_at, s.name, s.publish_at, s.due_at
+  s.id, s.created_at, s.updated_at, s.name, s.publish_at, s.due_at,
+  s.ignore_broken_tests,`+sheetTestsBroken+`
 FROM
   sheet_course sc
 INNER JOIN
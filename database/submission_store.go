@@ -20,15 +20,16 @@
 package database
 
 import (
+	"time"
+
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 )
 
 type SubmissionStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewSubmissionStore(db *sqlx.DB) *SubmissionStore {
+func NewSubmissionStore(db Queryer) *SubmissionStore {
 	return &SubmissionStore{
 		db: db,
 	}
@@ -64,6 +65,32 @@ func (s *SubmissionStore) Create(p *model.Submission) (*model.Submission, error)
 	return s.Get(newID)
 }
 
+// UpdateCreatedAt keeps the original time of a submission when importing it.
+func (s *SubmissionStore) UpdateCreatedAt(submissionID int64, createdAt time.Time) error {
+	_, err := s.db.Exec(`
+UPDATE
+  submissions
+SET
+  created_at = $2, updated_at = $2
+WHERE
+  id = $1;`, submissionID, createdAt)
+	return err
+}
+
+func (s *SubmissionStore) SubmissionsOfTask(taskID int64) ([]model.Submission, error) {
+	p := []model.Submission{}
+	err := s.db.Select(&p, `
+SELECT
+  *
+FROM
+  submissions
+WHERE
+  task_id = $1
+ORDER BY
+  id ASC;`, taskID)
+	return p, err
+}
+
 func (s *SubmissionStore) GetFiltered(filterCourseID, filterGroupID, filterUserID, filterSheetID, filterTaskID int64) ([]model.Submission, error) {
 
 	p := []model.Submission{}
@@ -20,15 +20,17 @@
 package database
 
 import (
+	"time"
+
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
+	"github.com/infomark-org/infomark/symbol"
 )
 
 type TaskStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewTaskStore(db *sqlx.DB) *TaskStore {
+func NewTaskStore(db Queryer) *TaskStore {
 	return &TaskStore{
 		db: db,
 	}
@@ -53,6 +55,54 @@ WHERE
 	return p, err
 }
 
+// GetActiveDockerImages returns all docker images used by tasks of sheets
+// which are still open in a running course.
+func (s *TaskStore) GetActiveDockerImages() ([]string, error) {
+	p := []string{}
+	err := s.db.Select(&p, `
+SELECT DISTINCT
+  images.image
+FROM (
+  SELECT
+    t.public_docker_image image,
+    s.due_at,
+    c.begins_at,
+    c.ends_at
+  FROM
+    tasks t
+  INNER JOIN task_sheet ts ON ts.task_id = t.id
+  INNER JOIN sheets s ON s.id = ts.sheet_id
+  INNER JOIN sheet_course sc ON sc.sheet_id = s.id
+  INNER JOIN courses c ON c.id = sc.course_id
+  UNION
+  SELECT
+    t.private_docker_image image,
+    s.due_at,
+    c.begins_at,
+    c.ends_at
+  FROM
+    tasks t
+  INNER JOIN task_sheet ts ON ts.task_id = t.id
+  INNER JOIN sheets s ON s.id = ts.sheet_id
+  INNER JOIN sheet_course sc ON sc.sheet_id = s.id
+  INNER JOIN courses c ON c.id = sc.course_id
+) images
+WHERE
+  images.image IS NOT NULL
+AND
+  images.image <> ''
+AND
+  images.due_at >= NOW()
+AND
+  images.begins_at <= NOW()
+AND
+  images.ends_at >= NOW()
+ORDER BY
+  images.image ASC;
+    `)
+	return p, err
+}
+
 func (s *TaskStore) Get(taskID int64) (*model.Task, error) {
 	p := model.Task{ID: taskID}
 	err := s.db.Get(&p, "SELECT * FROM tasks WHERE id = $1 LIMIT 1;", p.ID)
@@ -142,7 +192,7 @@ func (s *TaskStore) IdentifySheetOfTask(taskID int64) (*model.Sheet, error) {
 	err := s.db.Get(sheet,
 		`
 SELECT
-  s.*
+  s.*,`+sheetTestsBroken+`
 FROM
   task_sheet ts
 INNER JOIN sheets s ON s.id = ts.sheet_id
@@ -155,6 +205,42 @@ WHERE ts.task_id = $1`,
 	return sheet, err
 }
 
+// UpdatePublicReferenceInfo stores the result of testing the reference
+// solution against the public tests. The time the reference solution became
+// pending or failed is kept until it passes again, such that repeated runs
+// cannot publish a blocked sheet.
+func (s *TaskStore) UpdatePublicReferenceInfo(taskID int64, log string, state symbol.ReferenceState) error {
+	_, err := s.db.Exec(`
+UPDATE tasks
+SET
+  reference_public_state=$2,
+  reference_public_log=$3,
+  reference_blocked_at = CASE
+    WHEN $2 IN (1, 3) OR reference_private_state IN (1, 3) THEN COALESCE(reference_blocked_at, $4)
+    ELSE NULL
+  END
+WHERE
+  id = $1
+    `, taskID, state, log, time.Now().UTC())
+	return err
+}
+
+func (s *TaskStore) UpdatePrivateReferenceInfo(taskID int64, log string, state symbol.ReferenceState) error {
+	_, err := s.db.Exec(`
+UPDATE tasks
+SET
+  reference_private_state=$2,
+  reference_private_log=$3,
+  reference_blocked_at = CASE
+    WHEN $2 IN (1, 3) OR reference_public_state IN (1, 3) THEN COALESCE(reference_blocked_at, $4)
+    ELSE NULL
+  END
+WHERE
+  id = $1
+    `, taskID, state, log, time.Now().UTC())
+	return err
+}
+
 func (s *TaskStore) GetAverageRating(taskID int64) (float32, error) {
 	var averageRating float32
 	err := s.db.Get(&averageRating, `
@@ -0,0 +1,112 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/infomark-org/infomark/symbol"
+)
+
+type TestBatchStore struct {
+	db Queryer
+}
+
+func NewTestBatchStore(db Queryer) *TestBatchStore {
+	return &TestBatchStore{
+		db: db,
+	}
+}
+
+// testBatchSummary selects a test batch together with its progress and the
+// changes of the results compared to the state before the re-run.
+const testBatchSummary = `
+SELECT
+  b.*,
+  COUNT(r.id) total,
+  COUNT(r.finished_at) finished,
+  COUNT(r.id) FILTER (WHERE r.status_before = 0 AND r.status_after <> 0) passed_to_failed,
+  COUNT(r.id) FILTER (WHERE r.status_before <> 0 AND r.status_after = 0) failed_to_passed
+FROM
+  test_batches b
+LEFT JOIN test_batch_runs r ON r.test_batch_id = b.id
+`
+
+func (s *TestBatchStore) Get(batchID int64) (*model.TestBatch, error) {
+	p := model.TestBatch{}
+	err := s.db.Get(&p, testBatchSummary+`
+WHERE
+  b.id = $1
+GROUP BY
+  b.id
+LIMIT 1`, batchID)
+	return &p, err
+}
+
+func (s *TestBatchStore) BatchesOfTask(taskID int64) ([]model.TestBatch, error) {
+	p := []model.TestBatch{}
+	err := s.db.Select(&p, testBatchSummary+`
+WHERE
+  b.task_id = $1
+GROUP BY
+  b.id
+ORDER BY
+  b.created_at DESC`, taskID)
+	return p, err
+}
+
+func (s *TestBatchStore) Create(p *model.TestBatch) (*model.TestBatch, error) {
+	newID, err := Insert(s.db, "test_batches", p)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(newID)
+}
+
+func (s *TestBatchStore) CreateRun(p *model.TestBatchRun) (*model.TestBatchRun, error) {
+	newID, err := Insert(s.db, "test_batch_runs", p)
+	if err != nil {
+		return nil, err
+	}
+	p.ID = newID
+	return p, nil
+}
+
+func (s *TestBatchStore) RunsOfBatch(batchID int64) ([]model.TestBatchRun, error) {
+	p := []model.TestBatchRun{}
+	err := s.db.Select(&p, "SELECT * FROM test_batch_runs WHERE test_batch_id = $1 ORDER BY id ASC;", batchID)
+	return p, err
+}
+
+// FinishRun stores the result a worker has reported for a grade within a batch.
+func (s *TestBatchStore) FinishRun(batchID int64, gradeID int64, visibility string, status symbol.TestingResult) error {
+	_, err := s.db.Exec(`
+UPDATE test_batch_runs
+SET
+  status_after = $4,
+  finished_at = NOW()
+WHERE
+  test_batch_id = $1
+AND
+  grade_id = $2
+AND
+  visibility = $3
+    `, batchID, gradeID, visibility, status)
+	return err
+}
@@ -0,0 +1,131 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+	"github.com/lib/pq"
+)
+
+type TwoFactorStore struct {
+	db Queryer
+}
+
+func NewTwoFactorStore(db Queryer) *TwoFactorStore {
+	return &TwoFactorStore{
+		db: db,
+	}
+}
+
+// Get returns the second factor of a user.
+func (s *TwoFactorStore) Get(userID int64) (*model.TwoFactor, error) {
+	p := model.TwoFactor{}
+	err := s.db.Get(&p, "SELECT * FROM user_totp WHERE user_id = $1 LIMIT 1;", userID)
+	return &p, err
+}
+
+func (s *TwoFactorStore) Create(p *model.TwoFactor) (*model.TwoFactor, error) {
+	if _, err := Insert(s.db, "user_totp", p); err != nil {
+		return nil, err
+	}
+	return s.Get(p.UserID)
+}
+
+func (s *TwoFactorStore) Update(p *model.TwoFactor) error {
+	return Update(s.db, "user_totp", p.ID, p)
+}
+
+// Delete removes the second factor and the recovery codes of a user.
+func (s *TwoFactorStore) Delete(userID int64) error {
+	_, err := s.db.Exec(`
+WITH codes AS (
+  DELETE FROM user_recovery_codes WHERE user_id = $1
+)
+DELETE FROM
+  user_totp
+WHERE
+  user_id = $1;
+    `, userID)
+	return err
+}
+
+// UseCounter marks the time step of a code as used. It fails if this or a
+// later time step has been used before.
+func (s *TwoFactorStore) UseCounter(userID int64, counter int64) (bool, error) {
+	res, err := s.db.Exec(`
+UPDATE
+  user_totp
+SET
+  last_counter = $2
+WHERE
+  user_id = $1
+AND
+  last_counter < $2;
+    `, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected == 1, err
+}
+
+// ReplaceRecoveryCodes invalidates all recovery codes of a user and stores
+// the new ones.
+func (s *TwoFactorStore) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	_, err := s.db.Exec(`
+WITH old_codes AS (
+  DELETE FROM user_recovery_codes WHERE user_id = $1
+)
+INSERT INTO
+  user_recovery_codes (user_id, code_hash)
+SELECT
+  $1, unnest($2::TEXT[]);
+    `, userID, pq.Array(codeHashes))
+	return err
+}
+
+// UseRecoveryCode marks a recovery code as used. It fails if the code is
+// unknown or has been used before.
+func (s *TwoFactorStore) UseRecoveryCode(userID int64, codeHash string) (bool, error) {
+	res, err := s.db.Exec(`
+UPDATE
+  user_recovery_codes
+SET
+  used_at = NOW()
+WHERE
+  user_id = $1
+AND
+  code_hash = $2
+AND
+  used_at IS NULL;
+    `, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// UnusedRecoveryCodes counts the recovery codes a user has left.
+func (s *TwoFactorStore) UnusedRecoveryCodes(userID int64) (int, error) {
+	var count int
+	err := s.db.Get(&count, "SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL;", userID)
+	return count, err
+}
@@ -21,14 +21,13 @@ package database
 
 import (
 	"github.com/infomark-org/infomark/model"
-	"github.com/jmoiron/sqlx"
 )
 
 type UserStore struct {
-	db *sqlx.DB
+	db Queryer
 }
 
-func NewUserStore(db *sqlx.DB) *UserStore {
+func NewUserStore(db Queryer) *UserStore {
 	return &UserStore{
 		db: db,
 	}
@@ -46,6 +45,37 @@ func (s *UserStore) FindByEmail(email string) (*model.User, error) {
 	return &p, err
 }
 
+// FindByIdentity finds the user who has linked the account at an external
+// identity provider.
+func (s *UserStore) FindByIdentity(provider string, subject string) (*model.User, error) {
+	p := model.User{}
+	err := s.db.Get(&p, `
+SELECT
+  u.*
+FROM
+  users u
+INNER JOIN user_identities i ON i.user_id = u.id
+WHERE
+  i.provider = $1
+AND
+  i.subject = $2
+LIMIT 1;
+    `, provider, subject)
+	return &p, err
+}
+
+// LinkIdentity links an account at an external identity provider to a user.
+func (s *UserStore) LinkIdentity(userID int64, provider string, subject string) error {
+	_, err := s.db.Exec(`
+INSERT INTO user_identities
+  (user_id, provider, subject)
+VALUES
+  ($1, $2, $3)
+ON CONFLICT (provider, subject) DO NOTHING
+    `, userID, provider, subject)
+	return err
+}
+
 func (s *UserStore) Find(query string) ([]model.User, error) {
 	p := []model.User{}
 	err := s.db.Select(&p, `
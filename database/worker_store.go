@@ -0,0 +1,74 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"github.com/infomark-org/infomark/model"
+)
+
+type WorkerStore struct {
+	db Queryer
+}
+
+func NewWorkerStore(db Queryer) *WorkerStore {
+	return &WorkerStore{
+		db: db,
+	}
+}
+
+func (s *WorkerStore) Get(workerID int64) (*model.Worker, error) {
+	p := model.Worker{}
+	err := s.db.Get(&p, "SELECT * FROM workers WHERE id = $1 LIMIT 1;", workerID)
+	return &p, err
+}
+
+func (s *WorkerStore) GetAll() ([]model.Worker, error) {
+	p := []model.Worker{}
+	err := s.db.Select(&p, "SELECT * FROM workers ORDER BY name ASC;")
+	return p, err
+}
+
+// Heartbeat registers a worker by its name or refreshes its state.
+func (s *WorkerStore) Heartbeat(p *model.Worker) error {
+	_, err := s.db.Exec(`
+INSERT INTO workers
+  (name, hostname, version, capacity, cpus, memory, current_jobs, jobs, images, started_at, last_seen_at)
+VALUES
+  ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+ON CONFLICT (name) DO UPDATE
+SET
+  updated_at = NOW(),
+  hostname = EXCLUDED.hostname,
+  version = EXCLUDED.version,
+  capacity = EXCLUDED.capacity,
+  cpus = EXCLUDED.cpus,
+  memory = EXCLUDED.memory,
+  current_jobs = EXCLUDED.current_jobs,
+  jobs = EXCLUDED.jobs,
+  images = EXCLUDED.images,
+  started_at = EXCLUDED.started_at,
+  last_seen_at = NOW()
+    `, p.Name, p.Hostname, p.Version, p.Capacity, p.CPUs, p.Memory, p.CurrentJobs, p.Jobs, p.Images, p.StartedAt)
+	return err
+}
+
+func (s *WorkerStore) Delete(workerID int64) error {
+	return Delete(s.db, "workers", workerID)
+}
@@ -214,6 +214,15 @@ func main() {
 	f.WriteString("          schema:\n")
 	f.WriteString("            type: string\n")
 	f.WriteString("            format: binary\n")
+	f.WriteString("    File:\n")
+	f.WriteString("      description: A file of any type as a download.\n")
+	f.WriteString("      content:\n")
+	f.WriteString("        application/octet-stream:\n")
+	f.WriteString("          schema:\n")
+	f.WriteString("            type: string\n")
+	f.WriteString("            format: binary\n")
+	f.WriteString("    Redirect:\n")
+	f.WriteString("      description: The browser is sent to another page.\n")
 	f.WriteString("    OK:\n")
 	f.WriteString("      description: Post successfully delivered.\n")
 	f.WriteString("    NoContent:\n")
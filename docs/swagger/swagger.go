@@ -98,6 +98,17 @@ func SwaggerStructs(structDescr *Struct, depth int) string {
 					fieldDescr.Tag.Required = false
 				}
 
+				if x.X.(*ast.Ident).Name == "null" && x.Sel.Name == "Int" {
+					source = source + fmt.Sprintf("%s    type: integer\n", pre)
+					fieldDescr.Tag.Required = false
+				}
+
+				if x.X.(*ast.Ident).Name == "null" && x.Sel.Name == "Time" {
+					source = source + fmt.Sprintf("%s    type: string\n", pre)
+					source = source + fmt.Sprintf("%s    format: date-time\n", pre)
+					fieldDescr.Tag.Required = false
+				}
+
 				if x.X.(*ast.Ident).Name == "time" && x.Sel.Name == "Time" {
 					source = source + fmt.Sprintf("%s    type: string\n", pre)
 					source = source + fmt.Sprintf("%s    format: date-time\n", pre)
@@ -35,11 +35,10 @@ type Email struct {
 	To      string
 	Subject string
 	Body    string
+	// optional, sent as alternative to the plain text body
+	HTMLBody string
 }
 
-// OutgoingEmailsChannel is a light-weight go-routine to send emails
-var OutgoingEmailsChannel chan *Email
-
 // NewEmail creates a new email structure
 func NewEmail(from string, toEmail string, subject string, body string) *Email {
 	email := &Email{
@@ -115,9 +114,11 @@ var VoidMail = NewVoidMailer()
 // DefaultMail is the default instance used by infomark
 var DefaultMail Emailer
 
+// DefaultQueue delivers the stored emails, nil if no server is running
+var DefaultQueue *Queue
+
 func init() {
 	DefaultMail = TerminalMail
-	OutgoingEmailsChannel = make(chan *Email, 300)
 }
 
 // Send will drop any outgoing email
@@ -125,13 +126,6 @@ func (sm *VoidMailer) Send(e *Email) error {
 	return nil
 }
 
-// BackgroundSend will send emails enqueued in a channel
-func BackgroundSend(emails <-chan *Email) {
-	for email := range emails {
-		DefaultMail.Send(email)
-	}
-}
-
 // Send prints everything to stdout.
 func (sm *TerminalMailer) Send(e *Email) error {
 	fmt.Printf("From: %s\n", e.From)
@@ -140,6 +134,9 @@ func (sm *TerminalMailer) Send(e *Email) error {
 	fmt.Printf("Content-Type: text/plain; charset=\"utf-8\"\n")
 	fmt.Printf("\n")
 	fmt.Printf("%s", e.Body)
+	if e.HTMLBody != "" {
+		fmt.Printf("\n----------\n%s", e.HTMLBody)
+	}
 	return nil
 }
 
@@ -160,12 +157,7 @@ func (sm *SendMailer) Send(e *Email) error {
 		return err
 	}
 
-	pw.Write([]byte(fmt.Sprintf("From: %s\n", e.From)))
-	pw.Write([]byte(fmt.Sprintf("To: %s\n", e.To)))
-	pw.Write([]byte(fmt.Sprintf("Subject: %s\n", e.Subject)))
-	pw.Write([]byte("Content-Type: text/plain; charset=\"utf-8\"\n"))
-	pw.Write([]byte("\n")) // blank line separating headers from body
-	pw.Write([]byte(e.Body))
+	pw.Write(e.Message())
 
 	err = pw.Close()
 	if err != nil {
@@ -186,33 +178,3 @@ func FillTemplate(t *template.Template, data map[string]string) (string, error)
 	err := t.Execute(&tpl, data)
 	return tpl.String(), err
 }
-
-const (
-	confirmEmailTemplateSrcEN = `Hi {{.first_name}} {{.last_name}}!
-
-You must now confirm your email address to:
-   - Log into our system and upload your homework solutions
-   - Reset your password
-   - Receive account alerts
-
-Please use the following link to confirm your email address:
-
-{{.confirm_email_url}}/{{.confirm_email_address}}/{{.confirm_email_token}}
-
-`
-
-	requestPasswordTokenTemailTemplateSrcEN = `Hi {{.first_name}} {{.last_name}}!
-
-We got a request to change your password. You can change your password using the following link.
-
-{{.reset_password_url}}/{{.email_address}}/{{.reset_password_token}}
-
-If you have not requested the change, you can ignore this mail.
-
-Your password can only be changed manually by you.
-
-`
-)
-
-var ConfirmEmailTemplateEN *template.Template = template.Must(template.New("confirmEmailTemplateSrcEN").Parse(confirmEmailTemplateSrcEN))
-var RequestPasswordTokenTemailTemplateEN *template.Template = template.Must(template.New("requestPasswordTokenTemailTemplateSrcEN").Parse(requestPasswordTokenTemailTemplateSrcEN))
@@ -0,0 +1,250 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+// smtpServer records the emails delivered over a plain connection.
+type smtpServer struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	connections int
+	auths       []string
+	recipients  []string
+	messages    []string
+}
+
+func newSMTPServer() (*smtpServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	server := &smtpServer{listener: listener}
+	go server.serve()
+	return server, nil
+}
+
+func (s *smtpServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) Close() {
+	s.listener.Close()
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.connections++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			s.mu.Lock()
+			s.auths = append(s.auths, line)
+			s.mu.Unlock()
+			reply("235 authenticated")
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, line)
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Message", func() {
+
+		g.It("Should encode non-ASCII headers", func() {
+			e := NewEmail("InfoMark <no-reply@example.com>", "Jürgen Müller <jm@example.com>", "Übungsblatt 3 veröffentlicht", "Grüße\n")
+
+			msg, err := mail.ReadMessage(bytes.NewReader(e.Message()))
+			g.Assert(err).Equal(nil)
+
+			g.Assert(msg.Header.Get("Subject") == "Übungsblatt 3 veröffentlicht").IsFalse()
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			g.Assert(err).Equal(nil)
+			g.Assert(subject).Equal("Übungsblatt 3 veröffentlicht")
+
+			to, err := msg.Header.AddressList("To")
+			g.Assert(err).Equal(nil)
+			g.Assert(to[0].Name).Equal("Jürgen Müller")
+			g.Assert(to[0].Address).Equal("jm@example.com")
+
+			g.Assert(msg.Header.Get("MIME-Version")).Equal("1.0")
+			g.Assert(strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>")).IsTrue()
+		})
+
+		g.It("Should send plain text only without HTML body", func() {
+			e := NewEmail("no-reply@example.com", "jm@example.com", "Hi", "Grüße\nInfoMark\n")
+
+			msg, err := mail.ReadMessage(bytes.NewReader(e.Message()))
+			g.Assert(err).Equal(nil)
+			g.Assert(msg.Header.Get("Content-Type")).Equal(`text/plain; charset="utf-8"`)
+			g.Assert(msg.Header.Get("Content-Transfer-Encoding")).Equal("quoted-printable")
+
+			body, err := ioutil.ReadAll(msg.Body)
+			g.Assert(err).Equal(nil)
+			g.Assert(string(body)).Equal("Gr=C3=BC=C3=9Fe\r\nInfoMark\r\n")
+		})
+
+		g.It("Should send HTML as alternative to plain text", func() {
+			e := NewEmail("no-reply@example.com", "jm@example.com", "Hi", "Grüße")
+			e.HTMLBody = "<p>Grüße</p>"
+
+			msg, err := mail.ReadMessage(bytes.NewReader(e.Message()))
+			g.Assert(err).Equal(nil)
+
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			g.Assert(err).Equal(nil)
+			g.Assert(mediaType).Equal("multipart/alternative")
+
+			parts := multipart.NewReader(msg.Body, params["boundary"])
+
+			// the reader decodes quoted-printable parts
+			part, err := parts.NextPart()
+			g.Assert(err).Equal(nil)
+			g.Assert(part.Header.Get("Content-Type")).Equal(`text/plain; charset="utf-8"`)
+			body, _ := ioutil.ReadAll(part)
+			g.Assert(string(body)).Equal("Grüße")
+
+			part, err = parts.NextPart()
+			g.Assert(err).Equal(nil)
+			g.Assert(part.Header.Get("Content-Type")).Equal(`text/html; charset="utf-8"`)
+			body, _ = ioutil.ReadAll(part)
+			g.Assert(string(body)).Equal("<p>Grüße</p>")
+		})
+
+	})
+
+	g.Describe("SMTPMailer", func() {
+
+		g.It("Should deliver and reuse the connection", func() {
+			server, err := newSMTPServer()
+			g.Assert(err).Equal(nil)
+			defer server.Close()
+
+			mailer := NewSMTPMailer("localhost", server.Port(), SMTPEncryptionNone, "user", "secret")
+
+			g.Assert(mailer.Send(NewEmail("InfoMark <no-reply@example.com>", "a@example.com", "Erstes", "1"))).Equal(nil)
+			g.Assert(mailer.Send(NewEmail("InfoMark <no-reply@example.com>", "Bea <b@example.com>", "Zweites", "2"))).Equal(nil)
+			g.Assert(mailer.Close()).Equal(nil)
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			g.Assert(server.connections).Equal(1)
+			g.Assert(len(server.auths)).Equal(1)
+			g.Assert(server.recipients).Equal([]string{"RCPT TO:<a@example.com>", "RCPT TO:<b@example.com>"})
+			g.Assert(len(server.messages)).Equal(2)
+			g.Assert(strings.Contains(server.messages[1], "Subject: Zweites\r\n")).IsTrue()
+		})
+
+		g.It("Should reconnect after the idle timeout", func() {
+			server, err := newSMTPServer()
+			g.Assert(err).Equal(nil)
+			defer server.Close()
+
+			mailer := NewSMTPMailer("localhost", server.Port(), SMTPEncryptionNone, "", "")
+			mailer.IdleTimeout = 0
+
+			g.Assert(mailer.Send(NewEmail("no-reply@example.com", "a@example.com", "Erstes", "1"))).Equal(nil)
+			g.Assert(mailer.Send(NewEmail("no-reply@example.com", "b@example.com", "Zweites", "2"))).Equal(nil)
+			g.Assert(mailer.Close()).Equal(nil)
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			g.Assert(server.connections).Equal(2)
+			g.Assert(len(server.auths)).Equal(0)
+			g.Assert(len(server.messages)).Equal(2)
+		})
+
+		g.It("Should require STARTTLS if configured", func() {
+			server, err := newSMTPServer()
+			g.Assert(err).Equal(nil)
+			defer server.Close()
+
+			mailer := NewSMTPMailer("localhost", server.Port(), SMTPEncryptionStartTLS, "", "")
+			g.Assert(mailer.Send(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1")) != nil).IsTrue()
+		})
+
+	})
+}
@@ -0,0 +1,219 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"time"
+
+	"github.com/infomark-org/infomark/model"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// queueBatchSize is the number of due emails claimed at once.
+const queueBatchSize = 100
+
+// storeAttempts is the number of tries to store the outcome of a delivery.
+const storeAttempts = 3
+
+// storeRetryDelay is the time between these tries.
+var storeRetryDelay = time.Second
+
+// QueueStore persists the outgoing emails of a Queue.
+type QueueStore interface {
+	Create(p *model.OutgoingEmail) (*model.OutgoingEmail, error)
+	Update(p *model.OutgoingEmail) error
+	// ClaimDue returns due emails and moves their next attempt to
+	// claimedUntil, such that no other queue delivers them meanwhile.
+	ClaimDue(now time.Time, claimedUntil time.Time, limit int) ([]model.OutgoingEmail, error)
+}
+
+// Queue stores outgoing emails before delivering them, such that neither a
+// restart nor a failing mailer loses them. Failed deliveries are retried with
+// an exponential backoff until MaxAttempts is reached. Several instances of the
+// server can share the store, each email is claimed by one of them.
+type Queue struct {
+	Store QueueStore
+	// defaults to DefaultMail at the time of the delivery
+	Mailer Emailer
+	// deliveries per minute, 0 means no limit
+	RatePerMinute int
+	MaxAttempts   int
+	// wait before the first retry, doubled for every further retry
+	Backoff time.Duration
+	// check for due emails at least this often
+	PollInterval time.Duration
+	// claimed emails are handed out again after this time if their delivery
+	// did not finish, e.g. because the server stopped
+	Lease time.Duration
+	// reports errors of the store and the mailer
+	Log func(err error, e *model.OutgoingEmail)
+
+	wake chan struct{}
+}
+
+// NewQueue creates a queue which keeps its emails in a store.
+func NewQueue(store QueueStore) *Queue {
+	return &Queue{
+		Store:         store,
+		RatePerMinute: 0,
+		MaxAttempts:   5,
+		Backoff:       time.Minute,
+		PollInterval:  time.Minute,
+		Lease:         15 * time.Minute,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Persist stores an email as due in a store without waking any queue. Every
+// queue sharing the store delivers it eventually.
+func Persist(store QueueStore, e *Email) (*model.OutgoingEmail, error) {
+	return store.Create(&model.OutgoingEmail{
+		Sender:        e.From,
+		Recipient:     e.To,
+		Subject:       e.Subject,
+		Body:          e.Body,
+		HTMLBody:      e.HTMLBody,
+		Status:        model.OutgoingEmailPending,
+		NextAttemptAt: time.Now(),
+	})
+}
+
+// Enqueue stores an email for the delivery.
+func (q *Queue) Enqueue(e *Email) (*model.OutgoingEmail, error) {
+	p, err := Persist(q.Store, e)
+	if err != nil {
+		return nil, err
+	}
+	q.Wake()
+	return p, nil
+}
+
+// Wake triggers the delivery of due emails without waiting for the next
+// poll.
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due emails until stop is closed.
+func (q *Queue) Run(stop <-chan struct{}) {
+	// a batch has to be delivered long before its claim expires
+	batchSize := queueBatchSize
+	if q.RatePerMinute > 0 && q.RatePerMinute < batchSize {
+		batchSize = q.RatePerMinute
+	}
+
+	for {
+		now := time.Now()
+		emails, err := q.Store.ClaimDue(now, now.Add(q.Lease), batchSize)
+		if err != nil {
+			q.log(err, nil)
+		}
+
+		for k := range emails {
+			q.Deliver(&emails[k])
+
+			// stay within the rate limit
+			if q.RatePerMinute > 0 {
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Minute / time.Duration(q.RatePerMinute)):
+				}
+			}
+		}
+
+		// there might be more due emails
+		if len(emails) == batchSize {
+			continue
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-q.wake:
+		case <-time.After(q.PollInterval):
+		}
+	}
+}
+
+// Deliver sends a stored email and updates its status. It returns the error of
+// the mailer unless storing the status fails.
+func (q *Queue) Deliver(p *model.OutgoingEmail) error {
+	e := &Email{
+		From:     p.Sender,
+		To:       p.Recipient,
+		Subject:  p.Subject,
+		Body:     p.Body,
+		HTMLBody: p.HTMLBody,
+	}
+
+	sendErr := q.mailer().Send(e)
+	if sendErr == nil {
+		p.Status = model.OutgoingEmailSent
+		p.SentAt = null.TimeFrom(time.Now())
+		p.LastError = ""
+	} else {
+		q.log(sendErr, p)
+		p.Attempts++
+		p.LastError = sendErr.Error()
+		if p.Attempts >= q.MaxAttempts {
+			p.Status = model.OutgoingEmailFailed
+		} else {
+			p.NextAttemptAt = time.Now().Add(q.Backoff << uint(p.Attempts-1))
+		}
+	}
+
+	if err := q.update(p); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// update stores the outcome of a delivery. It is tried several times, since a
+// sent email would be sent again once its claim expires.
+func (q *Queue) update(p *model.OutgoingEmail) error {
+	var err error
+	for k := 0; k < storeAttempts; k++ {
+		if k > 0 {
+			time.Sleep(storeRetryDelay)
+		}
+		if err = q.Store.Update(p); err == nil {
+			return nil
+		}
+		q.log(err, p)
+	}
+	return err
+}
+
+func (q *Queue) mailer() Emailer {
+	if q.Mailer != nil {
+		return q.Mailer
+	}
+	return DefaultMail
+}
+
+func (q *Queue) log(err error, p *model.OutgoingEmail) {
+	if q.Log != nil {
+		q.Log(err, p)
+	}
+}
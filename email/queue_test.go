@@ -0,0 +1,236 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/infomark-org/infomark/model"
+)
+
+// memoryQueueStore keeps outgoing emails in memory.
+type memoryQueueStore struct {
+	mu     sync.Mutex
+	emails []model.OutgoingEmail
+	// number of updates which fail next
+	failUpdates int
+}
+
+func (s *memoryQueueStore) Create(p *model.OutgoingEmail) (*model.OutgoingEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.ID = int64(len(s.emails) + 1)
+	s.emails = append(s.emails, *p)
+	return p, nil
+}
+
+func (s *memoryQueueStore) Update(p *model.OutgoingEmail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failUpdates > 0 {
+		s.failUpdates--
+		return errors.New("database is gone")
+	}
+	s.emails[p.ID-1] = *p
+	return nil
+}
+
+func (s *memoryQueueStore) ClaimDue(now time.Time, claimedUntil time.Time, limit int) ([]model.OutgoingEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []model.OutgoingEmail{}
+	for k, p := range s.emails {
+		if p.Status == model.OutgoingEmailPending && !p.NextAttemptAt.After(now) && len(due) < limit {
+			s.emails[k].NextAttemptAt = claimedUntil
+			due = append(due, s.emails[k])
+		}
+	}
+	return due, nil
+}
+
+// status returns the status of the email with the given id.
+func (s *memoryQueueStore) status(emailID int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.emails[emailID-1].Status
+}
+
+// flakyMailer fails the first deliveries.
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	sent     []*Email
+}
+
+func (m *flakyMailer) Send(e *Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("connection refused")
+	}
+	m.sent = append(m.sent, e)
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	g.Describe("Queue", func() {
+
+		g.It("Should store emails synchronously", func() {
+			store := &memoryQueueStore{}
+			queue := NewQueue(store)
+
+			_, err := queue.Enqueue(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1"))
+			g.Assert(err).Equal(nil)
+			_, err = Persist(store, NewEmail("no-reply@example.com", "b@example.com", "Hi", "2"))
+			g.Assert(err).Equal(nil)
+
+			g.Assert(len(store.emails)).Equal(2)
+			g.Assert(store.emails[1].Recipient).Equal("b@example.com")
+			g.Assert(store.emails[1].Status).Equal(model.OutgoingEmailPending)
+		})
+
+		g.It("Should retry with backoff until it is sent", func() {
+			store := &memoryQueueStore{}
+			mailer := &flakyMailer{failures: 2}
+			queue := NewQueue(store)
+			queue.Mailer = mailer
+			queue.Backoff = time.Minute
+
+			p, err := queue.Enqueue(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1"))
+			g.Assert(err).Equal(nil)
+
+			g.Assert(queue.Deliver(p) != nil).IsTrue()
+			g.Assert(p.Status).Equal(model.OutgoingEmailPending)
+			g.Assert(p.Attempts).Equal(1)
+			g.Assert(p.LastError).Equal("connection refused")
+			g.Assert(p.NextAttemptAt.Sub(time.Now()) > 50*time.Second).IsTrue()
+
+			g.Assert(queue.Deliver(p) != nil).IsTrue()
+			g.Assert(p.NextAttemptAt.Sub(time.Now()) > 110*time.Second).IsTrue()
+
+			g.Assert(queue.Deliver(p)).Equal(nil)
+			g.Assert(store.emails[0].Status).Equal(model.OutgoingEmailSent)
+			g.Assert(store.emails[0].SentAt.Valid).IsTrue()
+			g.Assert(len(mailer.sent)).Equal(1)
+		})
+
+		g.It("Should give up after too many attempts", func() {
+			store := &memoryQueueStore{}
+			queue := NewQueue(store)
+			queue.Mailer = &flakyMailer{failures: 10}
+			queue.MaxAttempts = 2
+
+			p, err := queue.Enqueue(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1"))
+			g.Assert(err).Equal(nil)
+
+			queue.Deliver(p)
+			g.Assert(store.emails[0].Status).Equal(model.OutgoingEmailPending)
+			queue.Deliver(p)
+			g.Assert(store.emails[0].Status).Equal(model.OutgoingEmailFailed)
+			g.Assert(store.emails[0].Attempts).Equal(2)
+		})
+
+		g.It("Should keep trying to store a sent email", func() {
+			storeRetryDelay = time.Millisecond
+			store := &memoryQueueStore{}
+			mailer := &flakyMailer{}
+			queue := NewQueue(store)
+			queue.Mailer = mailer
+
+			p, err := queue.Enqueue(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1"))
+			g.Assert(err).Equal(nil)
+
+			store.failUpdates = storeAttempts - 1
+			g.Assert(queue.Deliver(p)).Equal(nil)
+			g.Assert(store.emails[0].Status).Equal(model.OutgoingEmailSent)
+			g.Assert(len(mailer.sent)).Equal(1)
+		})
+
+		g.It("Should deliver each email once with several queues", func() {
+			store := &memoryQueueStore{}
+			mailer := &flakyMailer{}
+
+			stop := make(chan struct{})
+			var running sync.WaitGroup
+			queues := []*Queue{}
+			for k := 0; k < 3; k++ {
+				queue := NewQueue(store)
+				queue.Mailer = mailer
+				queue.PollInterval = 5 * time.Millisecond
+				queues = append(queues, queue)
+			}
+
+			for k := 0; k < 20; k++ {
+				_, err := queues[0].Enqueue(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1"))
+				g.Assert(err).Equal(nil)
+			}
+
+			for _, queue := range queues {
+				running.Add(1)
+				go func(queue *Queue) {
+					defer running.Done()
+					queue.Run(stop)
+				}(queue)
+			}
+
+			for k := 0; k < 100 && store.status(20) == model.OutgoingEmailPending; k++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(stop)
+			running.Wait()
+
+			g.Assert(len(mailer.sent)).Equal(20)
+		})
+
+		g.It("Should deliver due emails when woken up", func() {
+			store := &memoryQueueStore{}
+			mailer := &flakyMailer{}
+			queue := NewQueue(store)
+			queue.Mailer = mailer
+			queue.PollInterval = time.Hour
+
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				queue.Run(stop)
+				close(done)
+			}()
+
+			p, err := queue.Enqueue(NewEmail("no-reply@example.com", "a@example.com", "Hi", "1"))
+			g.Assert(err).Equal(nil)
+			for k := 0; k < 100 && store.status(p.ID) == model.OutgoingEmailPending; k++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			close(stop)
+			<-done
+
+			g.Assert(len(mailer.sent)).Equal(1)
+			g.Assert(store.emails[0].Status).Equal(model.OutgoingEmailSent)
+		})
+
+	})
+}
@@ -0,0 +1,236 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"sync"
+	"time"
+
+	"github.com/infomark-org/infomark/configuration"
+)
+
+// Encryption of the connection to a SMTP server.
+const (
+	// SMTPEncryptionNone sends everything in plain text.
+	SMTPEncryptionNone = "none"
+	// SMTPEncryptionStartTLS upgrades a plain connection (usually port 587).
+	SMTPEncryptionStartTLS = "starttls"
+	// SMTPEncryptionTLS uses implicit TLS (usually port 465).
+	SMTPEncryptionTLS = "tls"
+)
+
+// SMTPMailer delivers emails to a SMTP server. The connection is kept open
+// and reused for further emails until it has been idle for IdleTimeout.
+type SMTPMailer struct {
+	Host       string
+	Port       int
+	Encryption string
+	// no authentication if empty
+	Username string
+	Password string
+	// used for implicit TLS and STARTTLS (defaults to verifying Host)
+	TLSConfig *tls.Config
+	// limits connecting and each delivery
+	Timeout     time.Duration
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+// NewSMTPMailer creates an object that will send emails over a SMTP server
+func NewSMTPMailer(host string, port int, encryption string, username string, password string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:        host,
+		Port:        port,
+		Encryption:  encryption,
+		Username:    username,
+		Password:    password,
+		Timeout:     30 * time.Second,
+		IdleTimeout: 30 * time.Second,
+	}
+}
+
+// NewSMTPMailerFromConfiguration creates a SMTP mailer as configured.
+func NewSMTPMailerFromConfiguration(config *configuration.SMTPConfiguration) (*SMTPMailer, error) {
+	sm := NewSMTPMailer(config.Host, config.Port, config.Encryption, config.User, config.Password)
+	if config.Timeout > 0 {
+		sm.Timeout = config.Timeout
+	}
+	if config.IdleTimeout > 0 {
+		sm.IdleTimeout = config.IdleTimeout
+	}
+
+	sm.TLSConfig = &tls.Config{
+		ServerName:         config.Host,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.RootCA != "" {
+		certificates, err := ioutil.ReadFile(config.RootCA)
+		if err != nil {
+			return nil, err
+		}
+		sm.TLSConfig.RootCAs = x509.NewCertPool()
+		if !sm.TLSConfig.RootCAs.AppendCertsFromPEM(certificates) {
+			return nil, errors.New("root_ca contains no certificate")
+		}
+	}
+	return sm, nil
+}
+
+// Send delivers an email over the SMTP server.
+func (sm *SMTPMailer) Send(e *Email) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if err := sm.prepare(); err != nil {
+		sm.reset()
+		return err
+	}
+
+	if err := sm.deliver(e); err != nil {
+		// the connection might be in an undefined state
+		sm.reset()
+		return err
+	}
+	sm.lastUsed = time.Now()
+	return nil
+}
+
+// Close ends the connection to the SMTP server if there is one.
+func (sm *SMTPMailer) Close() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.client == nil {
+		return nil
+	}
+	sm.conn.SetDeadline(time.Now().Add(sm.Timeout))
+	err := sm.client.Quit()
+	sm.reset()
+	return err
+}
+
+// prepare makes sure there is a connection which is ready for a new email.
+func (sm *SMTPMailer) prepare() error {
+	if sm.client != nil {
+		if time.Since(sm.lastUsed) < sm.IdleTimeout {
+			sm.conn.SetDeadline(time.Now().Add(sm.Timeout))
+			// the server might have dropped the connection in between
+			if sm.client.Reset() == nil {
+				return nil
+			}
+		}
+		sm.client.Quit()
+		sm.reset()
+	}
+	return sm.connect()
+}
+
+func (sm *SMTPMailer) connect() error {
+	addr := net.JoinHostPort(sm.Host, fmt.Sprintf("%d", sm.Port))
+	dialer := &net.Dialer{Timeout: sm.Timeout}
+
+	var conn net.Conn
+	var err error
+	switch sm.Encryption {
+	case SMTPEncryptionTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, sm.tlsConfig())
+	case SMTPEncryptionStartTLS, SMTPEncryptionNone, "":
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("unknown smtp encryption %q", sm.Encryption)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(sm.Timeout))
+
+	client, err := smtp.NewClient(conn, sm.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	sm.conn = conn
+	sm.client = client
+
+	if sm.Encryption == SMTPEncryptionStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(sm.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if sm.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		if err := client.Auth(smtp.PlainAuth("", sm.Username, sm.Password, sm.Host)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sm *SMTPMailer) deliver(e *Email) error {
+	if err := sm.client.Mail(recipient(e.From)); err != nil {
+		return err
+	}
+	if err := sm.client.Rcpt(recipient(e.To)); err != nil {
+		return err
+	}
+
+	w, err := sm.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.Message()); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// reset drops the connection without saying goodbye.
+func (sm *SMTPMailer) reset() {
+	if sm.conn != nil {
+		sm.conn.Close()
+	}
+	sm.conn = nil
+	sm.client = nil
+}
+
+func (sm *SMTPMailer) tlsConfig() *tls.Config {
+	if sm.TLSConfig != nil {
+		return sm.TLSConfig
+	}
+	return &tls.Config{ServerName: sm.Host}
+}
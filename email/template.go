@@ -0,0 +1,204 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// ErrUnknownTemplate is returned for emails without any translation.
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// DefaultLanguage is used for recipients without a translation in their
+// language.
+const DefaultLanguage = "en"
+
+// Template is the translation of an email into one language. The subject and
+// the plain text are text templates, the optional HTML variant is a HTML
+// template. All of them are filled with the same data.
+type Template struct {
+	Name     string
+	Language string
+	Subject  string
+	Text     string
+	HTML     string
+}
+
+// Render fills the placeholders of all variants.
+func (t *Template) Render(data map[string]string) (subject string, text string, html string, err error) {
+	if subject, err = renderText(t.Name+".subject", t.Subject, data); err != nil {
+		return "", "", "", err
+	}
+	if text, err = renderText(t.Name+".text", t.Text, data); err != nil {
+		return "", "", "", err
+	}
+	if t.HTML != "" {
+		tpl, err := htmltemplate.New(t.Name + ".html").Option("missingkey=zero").Parse(t.HTML)
+		if err != nil {
+			return "", "", "", err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return "", "", "", err
+		}
+		html = buf.String()
+	}
+	return subject, text, html, nil
+}
+
+// Validate checks whether all variants can be parsed.
+func (t *Template) Validate() error {
+	_, _, _, err := t.Render(map[string]string{})
+	return err
+}
+
+// NewEmail renders the template into an email.
+func (t *Template) NewEmail(from string, toEmail string, data map[string]string) (*Email, error) {
+	subject, text, html, err := t.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEmail(from, toEmail, subject, text)
+	e.HTMLBody = html
+	return e, nil
+}
+
+func renderText(name string, src string, data map[string]string) (string, error) {
+	tpl, err := texttemplate.New(name).Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// TemplateOverrides provides the templates which admins have customized for
+// the instance (course 0) or a course.
+type TemplateOverrides interface {
+	FindTemplate(courseID int64, name string, language string) (*Template, error)
+}
+
+// TemplateRegistry holds the built-in translations of all emails together
+// with sample data for previews.
+type TemplateRegistry struct {
+	templates map[string]map[string]*Template
+	samples   map[string]map[string]string
+}
+
+// NewTemplateRegistry creates an empty registry.
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{
+		templates: make(map[string]map[string]*Template),
+		samples:   make(map[string]map[string]string),
+	}
+}
+
+// Register adds an email with sample data and its translations. It panics on
+// templates which cannot be parsed like template.Must.
+func (r *TemplateRegistry) Register(name string, sample map[string]string, translations ...*Template) {
+	if _, ok := r.templates[name]; !ok {
+		r.templates[name] = make(map[string]*Template)
+	}
+	r.samples[name] = sample
+	for _, t := range translations {
+		t.Name = name
+		if err := t.Validate(); err != nil {
+			panic(err)
+		}
+		r.templates[name][t.Language] = t
+	}
+}
+
+// Names lists all registered emails.
+func (r *TemplateRegistry) Names() []string {
+	names := []string{}
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Languages lists the built-in translations of an email.
+func (r *TemplateRegistry) Languages(name string) []string {
+	languages := []string{}
+	for language := range r.templates[name] {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Has tells whether an email is registered.
+func (r *TemplateRegistry) Has(name string) bool {
+	_, ok := r.templates[name]
+	return ok
+}
+
+// Sample returns the data used to preview an email.
+func (r *TemplateRegistry) Sample(name string) map[string]string {
+	return r.samples[name]
+}
+
+// Builtin returns the built-in translation of an email, nil if there is none.
+func (r *TemplateRegistry) Builtin(name string, language string) *Template {
+	return r.templates[name][strings.ToLower(language)]
+}
+
+// Find returns the translation of an email for a recipient. Translations in
+// the language of the recipient take precedence over the default language.
+// Within a language, an override of the course (if courseID is not 0) comes
+// first, then an override of the instance and finally the built-in template.
+func (r *TemplateRegistry) Find(overrides TemplateOverrides, courseID int64, name string, language string) (*Template, error) {
+	languages := []string{strings.ToLower(language)}
+	if languages[0] != DefaultLanguage {
+		languages = append(languages, DefaultLanguage)
+	}
+
+	for _, language := range languages {
+		if overrides != nil {
+			levels := []int64{0}
+			if courseID != 0 {
+				levels = []int64{courseID, 0}
+			}
+			for _, level := range levels {
+				t, err := overrides.FindTemplate(level, name, language)
+				if err != nil {
+					return nil, err
+				}
+				if t != nil {
+					return t, nil
+				}
+			}
+		}
+		if t := r.Builtin(name, language); t != nil {
+			return t, nil
+		}
+	}
+	return nil, ErrUnknownTemplate
+}
@@ -0,0 +1,115 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+import (
+	"testing"
+
+	"github.com/franela/goblin"
+)
+
+// mapOverrides keeps customized translations by course, name and language.
+type mapOverrides map[int64]map[string]*Template
+
+func (o mapOverrides) FindTemplate(courseID int64, name string, language string) (*Template, error) {
+	return o[courseID][name+"/"+language], nil
+}
+
+func TestTemplate(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	registry := NewTemplateRegistry()
+	registry.Register("welcome",
+		map[string]string{"first_name": "Max"},
+		&Template{Language: "en", Subject: "Welcome", Text: "Hi {{.first_name}}"},
+		&Template{Language: "de", Subject: "Willkommen", Text: "Hallo {{.first_name}}"},
+	)
+
+	g.Describe("Template", func() {
+
+		g.It("Should pick the language of the recipient", func() {
+			tpl, err := registry.Find(nil, 0, "welcome", "de")
+			g.Assert(err).Equal(nil)
+			g.Assert(tpl.Subject).Equal("Willkommen")
+
+			// no translation into french
+			tpl, err = registry.Find(nil, 0, "welcome", "fr")
+			g.Assert(err).Equal(nil)
+			g.Assert(tpl.Subject).Equal("Welcome")
+
+			_, err = registry.Find(nil, 0, "farewell", "en")
+			g.Assert(err).Equal(ErrUnknownTemplate)
+		})
+
+		g.It("Should prefer overrides of the course and the instance", func() {
+			overrides := mapOverrides{
+				0: {
+					"welcome/de": &Template{Language: "de", Subject: "Willkommen bei InfoMark"},
+					"welcome/fr": &Template{Language: "fr", Subject: "Bienvenue"},
+				},
+				7: {
+					"welcome/de": &Template{Language: "de", Subject: "Willkommen in Info2"},
+				},
+			}
+
+			tpl, _ := registry.Find(overrides, 7, "welcome", "de")
+			g.Assert(tpl.Subject).Equal("Willkommen in Info2")
+
+			tpl, _ = registry.Find(overrides, 8, "welcome", "de")
+			g.Assert(tpl.Subject).Equal("Willkommen bei InfoMark")
+
+			tpl, _ = registry.Find(overrides, 7, "welcome", "fr")
+			g.Assert(tpl.Subject).Equal("Bienvenue")
+
+			// the language takes precedence over the level
+			tpl, _ = registry.Find(overrides, 7, "welcome", "en")
+			g.Assert(tpl.Subject).Equal("Welcome")
+		})
+
+		g.It("Should render plain text and HTML", func() {
+			tpl := &Template{
+				Name:    "welcome",
+				Subject: "Hi {{.first_name}}",
+				Text:    "Hi {{.first_name}} & {{.missing}}",
+				HTML:    "<p>Hi {{.first_name}}</p>",
+			}
+
+			e, err := tpl.NewEmail("no-reply@example.com", "a@example.com", map[string]string{"first_name": "<Max>"})
+			g.Assert(err).Equal(nil)
+			g.Assert(e.Subject).Equal("Hi <Max>")
+			g.Assert(e.Body).Equal("Hi <Max> & ")
+			g.Assert(e.HTMLBody).Equal("<p>Hi &lt;Max&gt;</p>")
+		})
+
+		g.It("Should reject invalid templates", func() {
+			tpl := &Template{Subject: "Hi", Text: "Hi {{.first_name"}
+			g.Assert(tpl.Validate() != nil).IsTrue()
+		})
+
+		g.It("Should translate all built-in emails into the default language", func() {
+			for _, name := range Templates.Names() {
+				g.Assert(Templates.Builtin(name, DefaultLanguage) != nil).IsTrue()
+				_, _, _, err := Templates.Builtin(name, DefaultLanguage).Render(Templates.Sample(name))
+				g.Assert(err).Equal(nil)
+			}
+		})
+
+	})
+}
@@ -0,0 +1,243 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package email
+
+// Names of the built-in emails.
+const (
+	ConfirmEmailTemplate         = "confirm_email"
+	RequestPasswordTokenTemplate = "request_password_token"
+	AccountLockedTemplate        = "account_locked"
+	NewLoginTemplate             = "new_login"
+	DeadlineReminderTemplate     = "deadline_reminder"
+)
+
+// Templates is the registry of all emails sent by infomark
+var Templates = NewTemplateRegistry()
+
+func init() {
+	Templates.Register(ConfirmEmailTemplate,
+		map[string]string{
+			"first_name":            "Max",
+			"last_name":             "Mustermann",
+			"confirm_email_url":     "https://infomark.example.com/#/confirmation",
+			"confirm_email_address": "max.mustermann@uni-tuebingen.de",
+			"confirm_email_token":   "af1ecf6f",
+		},
+		&Template{
+			Language: "en",
+			Subject:  "Confirm Account Instructions",
+			Text: `Hi {{.first_name}} {{.last_name}}!
+
+You must now confirm your email address to:
+   - Log into our system and upload your homework solutions
+   - Reset your password
+   - Receive account alerts
+
+Please use the following link to confirm your email address:
+
+{{.confirm_email_url}}/{{.confirm_email_address}}/{{.confirm_email_token}}
+
+`,
+		},
+		&Template{
+			Language: "de",
+			Subject:  "Bestätigung Ihres Kontos",
+			Text: `Hallo {{.first_name}} {{.last_name}}!
+
+Bitte bestätigen Sie Ihre E-Mail-Adresse, um
+   - sich anzumelden und Ihre Lösungen hochzuladen
+   - Ihr Passwort zurückzusetzen
+   - Benachrichtigungen zu Ihrem Konto zu erhalten
+
+Verwenden Sie dazu den folgenden Link:
+
+{{.confirm_email_url}}/{{.confirm_email_address}}/{{.confirm_email_token}}
+
+`,
+		},
+	)
+
+	Templates.Register(RequestPasswordTokenTemplate,
+		map[string]string{
+			"first_name":           "Max",
+			"last_name":            "Mustermann",
+			"email_address":        "max.mustermann@uni-tuebingen.de",
+			"reset_password_url":   "https://infomark.example.com/#/password_reset",
+			"reset_password_token": "af1ecf6f",
+		},
+		&Template{
+			Language: "en",
+			Subject:  "Password Reset Instructions",
+			Text: `Hi {{.first_name}} {{.last_name}}!
+
+We got a request to change your password. You can change your password using the following link.
+
+{{.reset_password_url}}/{{.email_address}}/{{.reset_password_token}}
+
+If you have not requested the change, you can ignore this mail.
+
+Your password can only be changed manually by you.
+
+`,
+		},
+		&Template{
+			Language: "de",
+			Subject:  "Zurücksetzen Ihres Passworts",
+			Text: `Hallo {{.first_name}} {{.last_name}}!
+
+Wir haben eine Anfrage erhalten, Ihr Passwort zu ändern. Sie können Ihr Passwort über den folgenden Link ändern.
+
+{{.reset_password_url}}/{{.email_address}}/{{.reset_password_token}}
+
+Falls Sie die Änderung nicht angefragt haben, können Sie diese E-Mail ignorieren.
+
+Ihr Passwort kann nur von Ihnen selbst geändert werden.
+
+`,
+		},
+	)
+
+	Templates.Register(AccountLockedTemplate,
+		map[string]string{
+			"first_name":    "Max",
+			"last_name":     "Mustermann",
+			"failed_logins": "5",
+			"ip":            "192.0.2.1",
+			"user_agent":    "Mozilla/5.0 (X11; Linux x86_64)",
+			"locked_until":  "Mon, 02 Jan 2006 15:04:05 UTC",
+		},
+		&Template{
+			Language: "en",
+			Subject:  "Your account has been locked",
+			Text: `Hi {{.first_name}} {{.last_name}}!
+
+There have been {{.failed_logins}} failed logins to your account in a row, the last one from
+   IP address: {{.ip}}
+   Browser:    {{.user_agent}}
+
+To protect your account, no login is possible until {{.locked_until}}.
+
+If these have not been your attempts, someone might try to guess your password.
+Please choose a strong password after the next login.
+
+`,
+		},
+		&Template{
+			Language: "de",
+			Subject:  "Ihr Konto wurde gesperrt",
+			Text: `Hallo {{.first_name}} {{.last_name}}!
+
+Es gab {{.failed_logins}} fehlgeschlagene Anmeldungen in Folge bei Ihrem Konto, die letzte von
+   IP-Adresse: {{.ip}}
+   Browser:    {{.user_agent}}
+
+Zum Schutz Ihres Kontos ist bis {{.locked_until}} keine Anmeldung möglich.
+
+Falls Sie das nicht waren, versucht womöglich jemand, Ihr Passwort zu erraten.
+Bitte wählen Sie nach der nächsten Anmeldung ein sicheres Passwort.
+
+`,
+		},
+	)
+
+	Templates.Register(NewLoginTemplate,
+		map[string]string{
+			"first_name": "Max",
+			"last_name":  "Mustermann",
+			"ip":         "192.0.2.1",
+			"user_agent": "Mozilla/5.0 (X11; Linux x86_64)",
+			"time":       "Mon, 02 Jan 2006 15:04:05 UTC",
+		},
+		&Template{
+			Language: "en",
+			Subject:  "New login to your account",
+			Text: `Hi {{.first_name}} {{.last_name}}!
+
+Your account has been used to log in from a new device:
+   IP address: {{.ip}}
+   Browser:    {{.user_agent}}
+   Time:       {{.time}}
+
+If this has been you, you can ignore this mail.
+
+Otherwise please change your password immediately. This will also log out all
+other devices.
+
+`,
+		},
+		&Template{
+			Language: "de",
+			Subject:  "Neue Anmeldung bei Ihrem Konto",
+			Text: `Hallo {{.first_name}} {{.last_name}}!
+
+Ihr Konto wurde für eine Anmeldung von einem neuen Gerät verwendet:
+   IP-Adresse: {{.ip}}
+   Browser:    {{.user_agent}}
+   Zeit:       {{.time}}
+
+Falls Sie das waren, können Sie diese E-Mail ignorieren.
+
+Andernfalls ändern Sie bitte sofort Ihr Passwort. Dadurch werden auch alle
+anderen Geräte abgemeldet.
+
+`,
+		},
+	)
+
+	Templates.Register(DeadlineReminderTemplate,
+		map[string]string{
+			"first_name":  "Max",
+			"last_name":   "Mustermann",
+			"course_name": "Info2",
+			"sheet_name":  "Blatt 3",
+			"due_at":      "Mon, 02 Jan 2006 15:04:05 UTC",
+			"tasks":       "   - Aufgabe 1\n   - Aufgabe 2",
+			"url":         "https://infomark.example.com",
+		},
+		&Template{
+			Language: "en",
+			Subject:  "[{{.course_name}}] {{.sheet_name}} is due soon",
+			Text: `Hi {{.first_name}} {{.last_name}}!
+
+The sheet "{{.sheet_name}}" of {{.course_name}} is due at {{.due_at}}.
+You have not uploaded a solution for these tasks yet:
+
+{{.tasks}}
+
+You can upload your solutions at {{.url}}
+
+`,
+		},
+		&Template{
+			Language: "de",
+			Subject:  "[{{.course_name}}] Abgabe von {{.sheet_name}} bald fällig",
+			Text: `Hallo {{.first_name}} {{.last_name}}!
+
+Das Blatt "{{.sheet_name}}" in {{.course_name}} muss bis {{.due_at}} abgegeben werden.
+Für diese Aufgaben haben Sie noch keine Lösung hochgeladen:
+
+{{.tasks}}
+
+Sie können Ihre Lösungen unter {{.url}} hochladen.
+
+`,
+		},
+	)
+}
@@ -0,0 +1,31 @@
+BEGIN;
+-- TOTP second factor of an account
+CREATE TABLE IF NOT EXISTS user_totp (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null UNIQUE,
+  -- base32, needed in plain text to compute the codes
+  secret TEXT not null,
+  -- set once the user has entered a first valid code
+  enabled BOOLEAN not null DEFAULT false,
+  -- time step of the last accepted code, a code cannot be used twice
+  last_counter BIGINT not null DEFAULT 0,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- one-time codes to log in without the authenticator app
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  -- hex encoded sha256 of the code
+  code_hash TEXT not null,
+  used_at TIMESTAMP,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+COMMIT;
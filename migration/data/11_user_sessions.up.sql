@@ -0,0 +1,19 @@
+BEGIN;
+-- logins of a user, either a cookie session or a refresh token; deleting a
+-- row revokes the login
+CREATE TABLE IF NOT EXISTS user_sessions (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  -- "session" (cookie) or "token" (refresh token)
+  kind TEXT not null,
+  user_agent TEXT not null DEFAULT '',
+  ip TEXT not null DEFAULT '',
+  last_seen_at TIMESTAMP not null DEFAULT current_timestamp,
+  expires_at TIMESTAMP not null,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+-- logins, failed logins and lockouts for admins to review
+CREATE TABLE IF NOT EXISTS auth_events (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  -- unknown for failed logins with an email address without account
+  user_id INT,
+  email TEXT not null,
+  -- "login", "login_failed", "locked" or "unlocked"
+  kind TEXT not null,
+  ip TEXT not null DEFAULT '',
+  user_agent TEXT not null DEFAULT '',
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX auth_events_user_id_created_at ON auth_events (user_id, created_at);
+
+-- failed logins in a row, which lock an account for a while
+CREATE TABLE IF NOT EXISTS user_lockouts (
+  user_id INT not null primary key,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  failed_logins INT not null DEFAULT 0,
+  locked_until TIMESTAMP,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+COMMIT;
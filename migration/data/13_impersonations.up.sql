@@ -0,0 +1,30 @@
+BEGIN;
+-- root admins acting as another user to debug their problems
+CREATE TABLE IF NOT EXISTS impersonations (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  root_id INT not null,
+  user_id INT not null,
+  reason TEXT not null,
+  expires_at TIMESTAMP not null,
+  stopped_at TIMESTAMP,
+
+  FOREIGN KEY (root_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- every request made during an impersonation
+CREATE TABLE IF NOT EXISTS impersonation_requests (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  impersonation_id INT not null,
+  method TEXT not null,
+  path TEXT not null,
+  status INT not null,
+
+  FOREIGN KEY (impersonation_id) REFERENCES impersonations (id) ON DELETE CASCADE
+);
+COMMIT;
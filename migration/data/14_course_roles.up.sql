@@ -0,0 +1,20 @@
+BEGIN;
+-- staff roles of a course as sets of named permissions
+CREATE TABLE IF NOT EXISTS course_roles (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  course_id INT not null,
+  name TEXT not null,
+  -- the fixed role members get for compatibility (0: student, 1:tutor, 2:admin)
+  base_role INT not null DEFAULT 1,
+  permissions TEXT[] not null DEFAULT '{}',
+
+  UNIQUE (course_id, name),
+  FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE
+);
+
+ALTER TABLE user_course ADD COLUMN IF NOT EXISTS course_role_id INT;
+ALTER TABLE user_course ADD FOREIGN KEY (course_role_id) REFERENCES course_roles (id) ON DELETE SET NULL;
+COMMIT;
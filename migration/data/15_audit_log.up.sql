@@ -0,0 +1,33 @@
+BEGIN;
+-- who changed what, written for all mutating requests and console commands
+CREATE TABLE IF NOT EXISTS audit_log (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  -- no foreign keys, the log outlives the accounts
+  actor_id INT,
+  impersonation_id INT,
+  -- "api" or "console"
+  source TEXT not null,
+  action TEXT not null,
+  path TEXT not null DEFAULT '',
+  status INT not null DEFAULT 0,
+  target_type TEXT not null DEFAULT '',
+  target_id INT,
+  before JSONB,
+  after JSONB
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_target ON audit_log (target_type, target_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'the audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+  BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+COMMIT;
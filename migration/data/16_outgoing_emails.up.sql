@@ -0,0 +1,23 @@
+BEGIN;
+-- emails waiting for delivery, retried until they are sent or failed too often
+CREATE TABLE IF NOT EXISTS outgoing_emails (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  sender TEXT not null,
+  recipient TEXT not null,
+  subject TEXT not null,
+  body TEXT not null,
+  html_body TEXT not null DEFAULT '',
+
+  -- "pending", "sent" or "failed"
+  status TEXT not null DEFAULT 'pending',
+  attempts INT not null DEFAULT 0,
+  last_error TEXT not null DEFAULT '',
+  next_attempt_at TIMESTAMP not null DEFAULT current_timestamp,
+  sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outgoing_emails_due ON outgoing_emails (status, next_attempt_at);
+COMMIT;
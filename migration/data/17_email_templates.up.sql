@@ -0,0 +1,19 @@
+BEGIN;
+-- translations of emails customized for the instance (no course) or a course
+CREATE TABLE IF NOT EXISTS email_templates (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  course_id INT,
+  name TEXT not null,
+  language char(2) not null,
+  subject TEXT not null,
+  text_body TEXT not null,
+  html_body TEXT not null DEFAULT '',
+
+  FOREIGN KEY (course_id) REFERENCES courses(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS email_templates_unique ON email_templates (COALESCE(course_id, 0), name, language);
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+-- reminders sent to students before the deadline of a sheet, at most one each
+CREATE TABLE IF NOT EXISTS deadline_reminders (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  sheet_id INT not null,
+  user_id INT not null,
+
+  UNIQUE (sheet_id, user_id),
+  FOREIGN KEY (sheet_id) REFERENCES sheets (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- students who do not want any reminders in a course
+CREATE TABLE IF NOT EXISTS deadline_reminder_opt_outs (
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  course_id INT not null,
+
+  PRIMARY KEY (user_id, course_id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+-- time the reference solution of a task started to fail, such that only
+-- failures before the publication of a sheet block the sheet
+ALTER TABLE tasks ADD COLUMN reference_failed_at TIMESTAMP DEFAULT NULL;
+
+-- published sheets stay published
+UPDATE tasks SET reference_failed_at = current_timestamp AT TIME ZONE 'UTC'
+WHERE reference_public_state = 3 OR reference_private_state = 3;
+COMMIT;
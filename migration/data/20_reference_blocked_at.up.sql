@@ -0,0 +1,9 @@
+BEGIN;
+-- pending reference solutions block unpublished sheets as well, hence the
+-- column holds the time since the reference solution has not passed
+ALTER TABLE tasks RENAME COLUMN reference_failed_at TO reference_blocked_at;
+
+-- published sheets stay published
+UPDATE tasks SET reference_blocked_at = current_timestamp AT TIME ZONE 'UTC'
+WHERE reference_blocked_at IS NULL AND (reference_public_state = 1 OR reference_private_state = 1);
+COMMIT;
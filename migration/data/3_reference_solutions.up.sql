@@ -0,0 +1,11 @@
+BEGIN;
+-- result of testing the reference solution against the testing frameworks
+-- 0: no reference solution, 1: pending, 2: passed, 3: failed
+ALTER TABLE tasks ADD COLUMN reference_public_state INT not null DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN reference_private_state INT not null DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN reference_public_log TEXT not null DEFAULT '';
+ALTER TABLE tasks ADD COLUMN reference_private_log TEXT not null DEFAULT '';
+
+-- publish sheets even if the tests of some tasks are broken
+ALTER TABLE sheets ADD COLUMN ignore_broken_tests BOOLEAN not null DEFAULT false;
+COMMIT;
@@ -0,0 +1,33 @@
+BEGIN;
+-- re-runs of the unit tests for all existing submissions of a task
+CREATE TABLE IF NOT EXISTS test_batches (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  task_id INT not null,
+  public BOOLEAN not null DEFAULT false,
+  private BOOLEAN not null DEFAULT false,
+
+  FOREIGN KEY (task_id) REFERENCES tasks (id) ON DELETE CASCADE
+);
+
+-- a single enqueued test of a batch
+CREATE TABLE IF NOT EXISTS test_batch_runs (
+  id SERIAL not null primary key,
+  test_batch_id INT not null,
+  grade_id INT not null,
+  -- public or private
+  visibility TEXT not null,
+
+  -- 0 means ok, 1 failed (just like return codes)
+  -- status_before is NULL when the test never finished before the re-run
+  status_before INT,
+  -- status_after is NULL until the worker has reported the result
+  status_after INT,
+  finished_at TIMESTAMP,
+
+  FOREIGN KEY (test_batch_id) REFERENCES test_batches (id) ON DELETE CASCADE,
+  FOREIGN KEY (grade_id) REFERENCES grades (id)            ON DELETE CASCADE
+);
+COMMIT;
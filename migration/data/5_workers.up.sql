@@ -0,0 +1,21 @@
+BEGIN;
+-- registry of background workers filled by their heartbeats
+CREATE TABLE IF NOT EXISTS workers (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  name TEXT not null UNIQUE,
+  hostname TEXT not null,
+  version TEXT not null,
+  -- number of jobs the worker can run at the same time
+  capacity INT not null DEFAULT 0,
+  current_jobs INT not null DEFAULT 0,
+  -- JSON list of the jobs the worker is running
+  jobs TEXT not null DEFAULT '[]',
+  images TEXT[] not null DEFAULT '{}',
+
+  started_at TIMESTAMP not null DEFAULT current_timestamp,
+  last_seen_at TIMESTAMP not null DEFAULT current_timestamp
+);
+COMMIT;
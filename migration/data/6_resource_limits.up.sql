@@ -0,0 +1,10 @@
+BEGIN;
+-- resources a single test run of a task needs on a worker
+-- 0 means the defaults of the worker are used
+ALTER TABLE tasks ADD COLUMN cpu_limit REAL not null DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN memory_limit BIGINT not null DEFAULT 0;
+
+-- budget a worker hands out to the jobs it is running
+ALTER TABLE workers ADD COLUMN cpus REAL not null DEFAULT 0;
+ALTER TABLE workers ADD COLUMN memory BIGINT not null DEFAULT 0;
+COMMIT;
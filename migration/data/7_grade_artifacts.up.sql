@@ -0,0 +1,19 @@
+BEGIN;
+-- files the unit tests have written to /data/output, e.g. coverage reports
+CREATE TABLE IF NOT EXISTS grade_artifacts (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  grade_id INT not null,
+  -- public or private
+  visibility TEXT not null,
+  -- path within the output directory
+  name TEXT not null,
+  size BIGINT not null DEFAULT 0,
+  -- tutors can always download artifacts, students only when this is set
+  visible_to_students BOOLEAN not null DEFAULT false,
+
+  FOREIGN KEY (grade_id) REFERENCES grades (id) ON DELETE CASCADE
+);
+COMMIT;
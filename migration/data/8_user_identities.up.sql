@@ -0,0 +1,16 @@
+BEGIN;
+-- accounts of users at external identity providers (single sign-on)
+CREATE TABLE IF NOT EXISTS user_identities (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  -- e.g. "oidc:https://idp.uni-tuebingen.de"
+  provider TEXT not null,
+  -- identifier of the user at the provider
+  subject TEXT not null,
+
+  UNIQUE (provider, subject),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+COMMIT;
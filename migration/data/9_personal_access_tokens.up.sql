@@ -0,0 +1,22 @@
+BEGIN;
+-- tokens users create for their scripts, only the hash is stored
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  id SERIAL not null primary key,
+  created_at TIMESTAMP not null DEFAULT current_timestamp,
+  updated_at TIMESTAMP not null DEFAULT current_timestamp,
+
+  user_id INT not null,
+  name TEXT not null,
+  -- hex encoded sha256 of the token
+  token_hash TEXT not null UNIQUE,
+  -- only GET requests are allowed
+  read_only BOOLEAN not null DEFAULT false,
+  -- only requests to this course are allowed
+  course_id INT,
+  expires_at TIMESTAMP not null,
+  last_used_at TIMESTAMP,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+  FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE
+);
+COMMIT;
@@ -1,8 +1,27 @@
 -- http://localhost:8081/#
 BEGIN;
+DROP TABLE IF EXISTS deadline_reminder_opt_outs;
+DROP TABLE IF EXISTS deadline_reminders;
+DROP TABLE IF EXISTS email_templates;
+DROP TABLE IF EXISTS outgoing_emails;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS impersonation_requests;
+DROP TABLE IF EXISTS impersonations;
+DROP TABLE IF EXISTS user_lockouts;
+DROP TABLE IF EXISTS auth_events;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS grade_artifacts;
+DROP TABLE IF EXISTS workers;
+DROP TABLE IF EXISTS test_batch_runs;
+DROP TABLE IF EXISTS test_batches;
 DROP TABLE IF EXISTS material_course;
 DROP TABLE IF EXISTS user_exam;
 DROP TABLE IF EXISTS user_course;
+DROP TABLE IF EXISTS course_roles;
 DROP TABLE IF EXISTS user_group;
 DROP TABLE IF EXISTS sheet_course;
 DROP TABLE IF EXISTS task_sheet;
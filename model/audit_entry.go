@@ -0,0 +1,51 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+const (
+	AuditSourceAPI     = "api"
+	AuditSourceConsole = "console"
+)
+
+// AuditEntry records an administrative action. Entries are never changed.
+type AuditEntry struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+
+	// nobody for console commands
+	ActorID         null.Int `db:"actor_id"`
+	ImpersonationID null.Int `db:"impersonation_id"`
+	Source          string   `db:"source"`
+	// the route like "PUT /api/v1/courses/{course_id}" or the console command
+	Action     string   `db:"action"`
+	Path       string   `db:"path"`
+	Status     int      `db:"status"`
+	TargetType string   `db:"target_type"`
+	TargetID   null.Int `db:"target_id"`
+	// JSON objects of the target before and after the action
+	Before null.String `db:"before"`
+	After  null.String `db:"after"`
+}
@@ -0,0 +1,55 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Kinds of authentication events.
+const (
+	AuthEventLogin       = "login"
+	AuthEventLoginFailed = "login_failed"
+	AuthEventLocked      = "locked"
+	AuthEventUnlocked    = "unlocked"
+)
+
+// AuthEvent records a login attempt or a change of the lockout of an account.
+type AuthEvent struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+
+	UserID    null.Int `db:"user_id"`
+	Email     string   `db:"email"`
+	Kind      string   `db:"kind"`
+	IP        string   `db:"ip"`
+	UserAgent string   `db:"user_agent"`
+}
+
+// Lockout counts the failed logins in a row of an account.
+type Lockout struct {
+	UserID    int64     `db:"user_id"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	FailedLogins int       `db:"failed_logins"`
+	LockedUntil  null.Time `db:"locked_until"`
+}
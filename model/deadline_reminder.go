@@ -0,0 +1,33 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+)
+
+// DueSheet is a published sheet whose deadline is coming up.
+type DueSheet struct {
+	SheetID    int64     `db:"sheet_id"`
+	SheetName  string    `db:"sheet_name"`
+	DueAt      time.Time `db:"due_at"`
+	CourseID   int64     `db:"course_id"`
+	CourseName string    `db:"course_name"`
+}
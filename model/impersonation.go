@@ -0,0 +1,55 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Impersonation lets a root admin act as another user for a limited time.
+type Impersonation struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	RootID    int64     `db:"root_id"`
+	UserID    int64     `db:"user_id"`
+	Reason    string    `db:"reason"`
+	ExpiresAt time.Time `db:"expires_at"`
+	StoppedAt null.Time `db:"stopped_at"`
+}
+
+// Active tells whether the impersonation can still be used.
+func (p *Impersonation) Active(now time.Time) bool {
+	return !p.StoppedAt.Valid && p.ExpiresAt.After(now)
+}
+
+// ImpersonationRequest is a request made during an impersonation.
+type ImpersonationRequest struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+
+	ImpersonationID int64  `db:"impersonation_id"`
+	Method          string `db:"method"`
+	Path            string `db:"path"`
+	Status          int    `db:"status"`
+}
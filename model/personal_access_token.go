@@ -0,0 +1,48 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// PersonalAccessToken lets scripts act on behalf of a user. Only the hash of
+// the token is stored.
+type PersonalAccessToken struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	UserID     int64     `db:"user_id"`
+	Name       string    `db:"name"`
+	TokenHash  string    `db:"token_hash"`
+	ReadOnly   bool      `db:"read_only"`
+	CourseID   null.Int  `db:"course_id"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	LastUsedAt null.Time `db:"last_used_at"`
+
+	// whether the owner is root
+	Root bool `db:"root,readonly"`
+	// whether the owner still has to set up a required second factor, this is
+	// not stored but derived from the configuration
+	SetupTwoFactor bool `db:"-"`
+}
@@ -33,6 +33,12 @@ type Sheet struct {
 	Name      string    `db:"name"`
 	PublishAt time.Time `db:"publish_at"`
 	DueAt     time.Time `db:"due_at"`
+
+	// IgnoreBrokenTests publishes the sheet even if the tests are broken.
+	IgnoreBrokenTests bool `db:"ignore_broken_tests"`
+	// TestsBroken is true if the reference solution of any task was pending
+	// or failed before the sheet has been published.
+	TestsBroken bool `db:"tests_broken,readonly"`
 }
 
 // SheetPoints contains the performance of a specific student
@@ -36,6 +36,19 @@ type Task struct {
 	MaxPoints          int         `db:"max_points"`
 	PublicDockerImage  null.String `db:"public_docker_image"`
 	PrivateDockerImage null.String `db:"private_docker_image"`
+
+	// resources of a single test run, zero values use the worker defaults
+	CPULimit    float64 `db:"cpu_limit"`
+	MemoryLimit int64   `db:"memory_limit"`
+
+	// results of testing the reference solution (see symbol.ReferenceState)
+	ReferencePublicState  int    `db:"reference_public_state"`
+	ReferencePrivateState int    `db:"reference_private_state"`
+	ReferencePublicLog    string `db:"reference_public_log"`
+	ReferencePrivateLog   string `db:"reference_private_log"`
+	// since when the reference solution has not passed, only set by the task
+	// store
+	ReferenceBlockedAt null.Time `db:"reference_blocked_at,readonly"`
 }
 
 // TaskRating contains the feedback of students to a task.
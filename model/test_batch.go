@@ -0,0 +1,55 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// TestBatch is a re-run of the unit tests for all existing submissions of a
+// task, e.g. after the testing framework has been changed.
+type TestBatch struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at,omitempty"`
+	UpdatedAt time.Time `db:"updated_at,omitempty"`
+
+	TaskID  int64 `db:"task_id"`
+	Public  bool  `db:"public"`
+	Private bool  `db:"private"`
+
+	// progress and summary of result changes
+	Total          int `db:"total,readonly"`
+	Finished       int `db:"finished,readonly"`
+	PassedToFailed int `db:"passed_to_failed,readonly"`
+	FailedToPassed int `db:"failed_to_passed,readonly"`
+}
+
+// TestBatchRun is a single enqueued test within a TestBatch.
+type TestBatchRun struct {
+	ID           int64     `db:"id"`
+	TestBatchID  int64     `db:"test_batch_id"`
+	GradeID      int64     `db:"grade_id"`
+	Visibility   string    `db:"visibility"`
+	StatusBefore null.Int  `db:"status_before"`
+	StatusAfter  null.Int  `db:"status_after"`
+	FinishedAt   null.Time `db:"finished_at"`
+}
@@ -0,0 +1,191 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// BroadcastExchange delivers messages to all running workers.
+const BroadcastExchange = "infomark-worker-broadcast"
+
+// declareBroadcastExchange declares the fanout exchange for broadcasts.
+func declareBroadcastExchange(channel *amqp.Channel) error {
+	if err := channel.ExchangeDeclare(
+		BroadcastExchange, // name
+		"fanout",          // type
+		true,              // durable
+		false,             // auto-deleted
+		false,             // internal
+		false,             // noWait
+		nil,               // arguments
+	); err != nil {
+		return fmt.Errorf("Exchange Declare: %s", err)
+	}
+	return nil
+}
+
+// PublishBroadcast sends a message to all workers which are running right
+// now. Workers which are started later do not get the message.
+func PublishBroadcast(cfg *Config, body []byte) error {
+	connection, err := amqp.Dial(cfg.Connection)
+	if err != nil {
+		return fmt.Errorf("Dial: %s", err)
+	}
+	defer connection.Close()
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return fmt.Errorf("Channel: %s", err)
+	}
+
+	if err := declareBroadcastExchange(channel); err != nil {
+		return err
+	}
+
+	if err = channel.Publish(
+		BroadcastExchange, // publish to an exchange
+		"",                // routing key is ignored by fanout exchanges
+		false,             // mandatory
+		false,             // immediate
+		amqp.Publishing{
+			Headers:         amqp.Table{},
+			ContentType:     "application/json",
+			ContentEncoding: "",
+			Body:            body,
+			DeliveryMode:    1, // 1=non-persistent, 2=persistent
+		},
+	); err != nil {
+		return fmt.Errorf("Exchange Publish: %s", err)
+	}
+
+	return nil
+}
+
+// BroadcastConsumer is an object which acts on broadcasts to the workers
+type BroadcastConsumer struct {
+	Config *Config
+
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	tag     string
+	done    chan error
+
+	handleFunc func(body []byte) error
+}
+
+// NewBroadcastConsumer creates a new consumer which can act on broadcasts
+func NewBroadcastConsumer(cfg *Config, handleFunc func(body []byte) error) *BroadcastConsumer {
+	return &BroadcastConsumer{
+		Config:     cfg,
+		tag:        cfg.Tag + "-broadcast",
+		done:       make(chan error),
+		handleFunc: handleFunc,
+	}
+}
+
+// Setup connects the consumer to an exclusive queue bound to the broadcast
+// exchange.
+func (c *BroadcastConsumer) Setup() (<-chan amqp.Delivery, error) {
+	var err error
+
+	log.WithFields(logrus.Fields{"exchange": BroadcastExchange}).Info("setup AMPQ connection for broadcasts")
+
+	c.conn, err = amqp.Dial(c.Config.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("Dial: %s", err)
+	}
+
+	c.channel, err = c.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("Channel: %s", err)
+	}
+
+	if err = declareBroadcastExchange(c.channel); err != nil {
+		return nil, err
+	}
+
+	// every worker gets its own queue, which vanishes with the worker
+	queue, err := c.channel.QueueDeclare(
+		"",    // let the server choose a name
+		false, // durable
+		true,  // delete when usused
+		true,  // exclusive
+		false, // noWait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Queue Declare: %s", err)
+	}
+
+	if err = c.channel.QueueBind(
+		queue.Name,        // name of the queue
+		"",                // bindingKey
+		BroadcastExchange, // sourceExchange
+		false,             // noWait
+		nil,               // arguments
+	); err != nil {
+		return nil, fmt.Errorf("Queue Bind: %s", err)
+	}
+
+	deliveries, err := c.channel.Consume(
+		queue.Name, // name
+		c.tag,      // consumerTag,
+		true,       // noAck
+		true,       // exclusive
+		false,      // noLocal
+		false,      // noWait
+		nil,        // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Queue Consume: %s", err)
+	}
+
+	return deliveries, nil
+}
+
+// Shutdown will gracefully stop the consumer
+func (c *BroadcastConsumer) Shutdown() error {
+	// will close() the deliveries channel
+	if err := c.channel.Cancel(c.tag, true); err != nil {
+		return fmt.Errorf("Consumer cancel failed: %s", err)
+	}
+
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("AMQP connection close error: %s", err)
+	}
+
+	// wait for handle() to exit
+	return <-c.done
+}
+
+// HandleLoop is the message loop of the consumer
+func (c *BroadcastConsumer) HandleLoop(deliveries <-chan amqp.Delivery) {
+	for d := range deliveries {
+		if err := c.handleFunc(d.Body); err != nil {
+			log.WithFields(logrus.Fields{"bytes": len(d.Body)}).Warn(err)
+		}
+	}
+	log.Info("handle: broadcast deliveries channel closed")
+	c.done <- nil
+}
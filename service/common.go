@@ -20,7 +20,10 @@
 package service
 
 import (
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/infomark-org/infomark/configuration"
 
@@ -35,28 +38,168 @@ type Worker interface {
 	HandleLoop(deliveries <-chan amqp.Delivery)
 }
 
+// Priorities of AMPQ messages. All queues are declared with MaxPriority, such
+// that workers handle fresh public tests first, private tests next and bulk
+// re-runs last.
+const (
+	MaxPriority     uint8 = 9
+	PublicPriority  uint8 = 8
+	PrivatePriority uint8 = 5
+	BulkPriority    uint8 = 1
+)
+
+// RetryDelay is the time before a message, which failed with a transient
+// error, is handed out again.
+var RetryDelay = 10 * time.Second
+
+// TransientError is a failure which might disappear when the message is
+// handled again later, e.g. because the server was not reachable. Such
+// messages are requeued instead of being dropped.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+// Transient marks an error as transient.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// IsTransient tells whether an error has been marked as transient.
+func IsTransient(err error) bool {
+	_, ok := err.(*TransientError)
+	return ok
+}
+
+// settle acknowledges a handled message. Messages which failed with a
+// transient error are requeued after RetryDelay, such that a failing server
+// is not flooded with retries.
+func settle(d amqp.Delivery, err error) {
+	if IsTransient(err) {
+		time.AfterFunc(RetryDelay, func() {
+			d.Nack(false, true)
+		})
+		return
+	}
+	d.Ack(false)
+}
+
 // Config contains the settings for AMPQ
+//
+// Jobs are published to Exchange using the docker image as routing key. A
+// dedicated worker pool for an image binds its own queue to this key. Jobs
+// for images without a dedicated pool cannot be routed and end up in the
+// FallbackExchange, which feeds the shared Queue.
 type Config struct {
-	Tag          string
-	Connection   string
-	Exchange     string
-	ExchangeType string
-	Queue        string
-	Key          string
+	Tag              string
+	Connection       string
+	Exchange         string
+	ExchangeType     string
+	FallbackExchange string
+	Queue            string
+	Key              string
+
+	// Images restricts a consumer to the jobs of these docker images. An empty
+	// list consumes all jobs without a dedicated worker pool.
+	Images []string
 }
 
+// NewConfig creates the AMPQ settings shared by the server and the workers.
+//
+// Versions without priorities used the queue "infomark-worker-submissions".
+// RabbitMQ refuses to declare an existing queue again with different
+// arguments, hence the prioritized queue got a new name. The old queue is not
+// used anymore and can be deleted after the upgrade once it is empty:
+//
+//	rabbitmqctl delete_queue infomark-worker-submissions --if-empty
 func NewConfig(config *configuration.RabbitMQConfiguration) *Config {
 	return &Config{
 
-		Tag:          "SimpleSubmission",
-		Connection:   config.URL(),
-		Exchange:     "infomark-worker-exchange",
-		ExchangeType: "direct",
-		Queue:        "infomark-worker-submissions",
-		Key:          config.Key,
+		Tag:              "SimpleSubmission",
+		Connection:       config.URL(),
+		Exchange:         "infomark-worker-jobs",
+		ExchangeType:     "direct",
+		FallbackExchange: "infomark-worker-fallback",
+		Queue:            "infomark-worker-prioritized-submissions",
+		Key:              config.Key,
 	}
 }
 
+// normalizeImage adds the implicit tag "latest" to a docker image name.
+func normalizeImage(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if strings.Contains(name, ":") || strings.Contains(name, "@") {
+		return image
+	}
+	return image + ":latest"
+}
+
+// ImageKey is the routing key of jobs for a docker image.
+func (c *Config) ImageKey(image string) string {
+	return fmt.Sprintf("%s.%s", c.Key, normalizeImage(image))
+}
+
+// ImageQueue is the name of the queue of a dedicated worker pool for a docker
+// image.
+func (c *Config) ImageQueue(image string) string {
+	return fmt.Sprintf("%s.%s", c.Queue, normalizeImage(image))
+}
+
+// bindings returns the queues a consumer reads from. The shared queue gets all
+// jobs without a dedicated worker pool.
+func (c *Config) bindings() []queueBinding {
+	if len(c.Images) == 0 {
+		return []queueBinding{
+			{queue: c.Queue, exchange: c.FallbackExchange, key: ""},
+		}
+	}
+
+	bindings := []queueBinding{}
+	for _, image := range c.Images {
+		bindings = append(bindings, queueBinding{
+			queue:    c.ImageQueue(image),
+			exchange: c.Exchange,
+			key:      c.ImageKey(image),
+		})
+	}
+	return bindings
+}
+
+// declareExchanges declares the job exchange and its fallback.
+func (c *Config) declareExchanges(channel *amqp.Channel) error {
+	if err := channel.ExchangeDeclare(
+		c.FallbackExchange, // name
+		"fanout",           // type
+		false,              // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // noWait
+		nil,                // arguments
+	); err != nil {
+		return fmt.Errorf("Exchange Declare: %s", err)
+	}
+
+	if err := channel.ExchangeDeclare(
+		c.Exchange,     // name
+		c.ExchangeType, // type
+		false,          // durable
+		false,          // auto-deleted
+		false,          // internal
+		false,          // noWait
+		amqp.Table{"alternate-exchange": c.FallbackExchange}, // arguments
+	); err != nil {
+		return fmt.Errorf("Exchange Declare: %s", err)
+	}
+
+	return nil
+}
+
 var log = logrus.New()
 
 func init() {
@@ -21,6 +21,7 @@ package service
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
@@ -35,8 +36,24 @@ type Consumer struct {
 	done    chan error
 
 	instanceID int
+	tags       []string
 
 	handleFunc func(body []byte) error
+
+	// jobs of scheduled consumers run concurrently within a budget
+	scheduler     *Scheduler
+	resourcesFunc func(body []byte) Resources
+	jobFunc       func(body []byte, resources Resources) error
+	typical       Resources
+	prefetchMu    sync.Mutex
+	prefetch      int
+}
+
+// queueBinding describes a queue a consumer reads from.
+type queueBinding struct {
+	queue    string
+	exchange string
+	key      string
 }
 
 // NewConsumer creates new consumer which can act on AMPQ messages
@@ -56,6 +73,28 @@ func NewConsumer(cfg *Config, handleFunc func(body []byte) error, instanceID int
 	return consumer, nil
 }
 
+// NewScheduledConsumer creates a consumer which runs several jobs at the same
+// time as long as the resources they declare fit into the budget of the
+// scheduler. Jobs are only fetched from the broker when there is room for
+// them. The typical resources of a job determine how many jobs are prefetched.
+func NewScheduledConsumer(
+	cfg *Config,
+	scheduler *Scheduler,
+	typical Resources,
+	resourcesFunc func(body []byte) Resources,
+	jobFunc func(body []byte, resources Resources) error,
+) *Consumer {
+	return &Consumer{
+		done:          make(chan error),
+		scheduler:     scheduler,
+		resourcesFunc: resourcesFunc,
+		jobFunc:       jobFunc,
+		typical:       typical,
+
+		Config: cfg,
+	}
+}
+
 // Setup connects a consumer to the AMPQ queue from the config
 func (c *Consumer) Setup() (<-chan amqp.Delivery, error) {
 	logger := log.WithFields(logrus.Fields{
@@ -91,63 +130,110 @@ func (c *Consumer) Setup() (<-chan amqp.Delivery, error) {
 		return nil, fmt.Errorf("Channel: %s", err)
 	}
 
+	if c.scheduler == nil {
+		// only fetch one job at a time, otherwise priorities would be pointless
+		if err = c.channel.Qos(1, 0, false); err != nil {
+			return nil, fmt.Errorf("Channel Qos: %s", err)
+		}
+	} else {
+		// only fetch as many jobs as fit into the budget
+		if err = c.updatePrefetch(); err != nil {
+			return nil, err
+		}
+	}
+
 	logger.Info("got Channel, declaring Exchange")
-	if err = c.channel.ExchangeDeclare(
-		c.Config.Exchange,     // name of the exchange
-		c.Config.ExchangeType, // type
-		false,                 // durable
-		false,                 // delete when complete
-		false,                 // internal
-		false,                 // noWait
-		nil,                   // arguments
-	); err != nil {
-		return nil, fmt.Errorf("Exchange Declare: %s", err)
-	}
-
-	logger.Info("declared Exchange, declaring Queue")
-	state, err := c.channel.QueueDeclare(
-		c.Config.Queue, // name of the queue
-		true,           // durable
-		false,          // delete when usused
-		false,          // exclusive
-		false,          // noWait
-		nil,            // arguments
-	)
-	if err != nil {
-		return nil, fmt.Errorf("Queue Declare: %s", err)
-	}
-
-	logger.WithFields(logrus.Fields{
-		"messages":  state.Messages,
-		"consumers": state.Consumers,
-	}).Info("declared Queue, binding to Exchange")
-
-	if err = c.channel.QueueBind(
-		c.Config.Queue,    // name of the queue
-		c.Config.Key,      // bindingKey
-		c.Config.Exchange, // sourceExchange
-		false,             // noWait
-		nil,               // arguments
-	); err != nil {
-		return nil, fmt.Errorf("Queue Bind: %s", err)
-	}
-
-	logger.Info("Queue bound to Exchange, starting Consume")
-	deliveries, err := c.channel.Consume(
-		c.Config.Queue, // name
-		c.Config.Tag,   // consumerTag,
-		false,          // noAck
-		false,          // exclusive
-		false,          // noLocal
-		false,          // noWait
-		nil,            // arguments
-	)
-	if err != nil {
-		return nil, fmt.Errorf("Queue Consume: %s", err)
+	if err = c.Config.declareExchanges(c.channel); err != nil {
+		return nil, err
+	}
+
+	bindings := c.Config.bindings()
+
+	// messages are ordered by their priority within the queue
+	queueArgs := amqp.Table{"x-max-priority": int32(MaxPriority)}
+
+	channels := []<-chan amqp.Delivery{}
+	for k, binding := range bindings {
+		logger.WithFields(logrus.Fields{"queue": binding.queue}).Info("declared Exchange, declaring Queue")
+		state, err := c.channel.QueueDeclare(
+			binding.queue, // name of the queue
+			true,          // durable
+			false,         // delete when usused
+			false,         // exclusive
+			false,         // noWait
+			queueArgs,     // arguments
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Queue Declare: %s", err)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"queue":     binding.queue,
+			"messages":  state.Messages,
+			"consumers": state.Consumers,
+		}).Info("declared Queue, binding to Exchange")
+
+		if err = c.channel.QueueBind(
+			binding.queue,    // name of the queue
+			binding.key,      // bindingKey
+			binding.exchange, // sourceExchange
+			false,            // noWait
+			nil,              // arguments
+		); err != nil {
+			return nil, fmt.Errorf("Queue Bind: %s", err)
+		}
+
+		// consumer tags have to be unique within a channel
+		tag := fmt.Sprintf("%s-%d", c.Config.Tag, k)
+
+		logger.WithFields(logrus.Fields{"queue": binding.queue}).Info("Queue bound to Exchange, starting Consume")
+		deliveries, err := c.channel.Consume(
+			binding.queue, // name
+			tag,           // consumerTag,
+			false,         // noAck
+			false,         // exclusive
+			false,         // noLocal
+			false,         // noWait
+			nil,           // arguments
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Queue Consume: %s", err)
+		}
+
+		c.tags = append(c.tags, tag)
+		channels = append(channels, deliveries)
+	}
+
+	return mergeDeliveries(channels), nil
+
+}
+
+// mergeDeliveries forwards the deliveries of several queues into a single
+// channel, which is closed when all queues are closed.
+func mergeDeliveries(channels []<-chan amqp.Delivery) <-chan amqp.Delivery {
+	if len(channels) == 1 {
+		return channels[0]
+	}
+
+	out := make(chan amqp.Delivery)
+	var wg sync.WaitGroup
+	wg.Add(len(channels))
+
+	for _, deliveries := range channels {
+		go func(deliveries <-chan amqp.Delivery) {
+			defer wg.Done()
+			for d := range deliveries {
+				out <- d
+			}
+		}(deliveries)
 	}
 
-	return deliveries, nil
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
 
+	return out
 }
 
 // Shutdown will gracefully stop a consumer
@@ -163,8 +249,20 @@ func (c *Consumer) Shutdown() error {
 	})
 
 	// will close() the deliveries channel
-	if err := c.channel.Cancel(c.Config.Tag, true); err != nil {
-		return fmt.Errorf("Consumer cancel failed: %s", err)
+	for _, tag := range c.tags {
+		if err := c.channel.Cancel(tag, true); err != nil {
+			return fmt.Errorf("Consumer cancel failed: %s", err)
+		}
+	}
+
+	if c.scheduler != nil {
+		// running jobs have to be acknowledged before the connection is closed
+		logger.WithFields(logrus.Fields{"running": c.scheduler.Running()}).Info("draining jobs")
+		c.scheduler.Drain()
+		if err := <-c.done; err != nil {
+			return err
+		}
+		c.done = nil
 	}
 
 	if err := c.conn.Close(); err != nil {
@@ -174,11 +272,18 @@ func (c *Consumer) Shutdown() error {
 	defer logger.Info("AMQP shutdown OK")
 
 	// wait for handle() to exit
+	if c.done == nil {
+		return nil
+	}
 	return <-c.done
 }
 
 // HandleLoop is the message loop of a consumer
 func (c *Consumer) HandleLoop(deliveries <-chan amqp.Delivery) {
+	if c.scheduler != nil {
+		c.scheduleLoop(deliveries)
+		return
+	}
 
 	logger := log.WithFields(logrus.Fields{
 		// "connection":   c.Config.Connection,
@@ -200,14 +305,80 @@ func (c *Consumer) HandleLoop(deliveries <-chan amqp.Delivery) {
 		//   d.Body,
 		// )
 
-		if err := c.handleFunc(d.Body); err != nil {
+		err := c.handleFunc(d.Body)
+		if err != nil {
 			fmt.Println(err)
-			d.Ack(false)
-		} else {
-			d.Ack(true)
 		}
+		settle(d, err)
+
+	}
+	logger.Info("handle: deliveries channel closed")
+	c.done <- nil
+}
+
+// updatePrefetch adapts the number of unacknowledged jobs the broker hands
+// out to the remaining budget.
+func (c *Consumer) updatePrefetch() error {
+	c.prefetchMu.Lock()
+	defer c.prefetchMu.Unlock()
+
+	prefetch := c.scheduler.Prefetch(c.typical)
+	if prefetch == c.prefetch {
+		return nil
+	}
+
+	// the limit is shared by the consumers of all queues of the channel
+	if err := c.channel.Qos(prefetch, 0, true); err != nil {
+		return fmt.Errorf("Channel Qos: %s", err)
+	}
+	c.prefetch = prefetch
+	return nil
+}
+
+// scheduleLoop is the message loop of a scheduled consumer. Each job runs in
+// its own go-routine as soon as its resources are available.
+func (c *Consumer) scheduleLoop(deliveries <-chan amqp.Delivery) {
+	logger := log.WithFields(logrus.Fields{
+		"exchange": c.Config.Exchange,
+		"queue":    c.Config.Queue,
+		"tag":      c.Config.Tag,
+	})
+
+	for d := range deliveries {
+		resources := c.scheduler.Fit(c.resourcesFunc(d.Body))
+
+		if !c.scheduler.Acquire(resources) {
+			// the worker is shutting down, another worker should run this job
+			d.Nack(false, true)
+			continue
+		}
+
+		logger.WithFields(logrus.Fields{
+			"bytes":  len(d.Body),
+			"cpus":   resources.CPUs,
+			"memory": resources.Memory,
+		}).Info("got delivery")
 
+		if err := c.updatePrefetch(); err != nil {
+			logger.Warn(err)
+		}
+
+		go func(d amqp.Delivery, resources Resources) {
+			defer func() {
+				c.scheduler.Release(resources)
+				if err := c.updatePrefetch(); err != nil {
+					logger.Warn(err)
+				}
+			}()
+
+			err := c.jobFunc(d.Body, resources)
+			if err != nil {
+				logger.Warn(err)
+			}
+			settle(d, err)
+		}(d, resources)
 	}
+
 	logger.Info("handle: deliveries channel closed")
 	c.done <- nil
 }
@@ -0,0 +1,167 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+	"github.com/streadway/amqp"
+)
+
+// acknowledger records how a delivery has been settled.
+type acknowledger struct {
+	settled chan string
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.settled <- "ack"
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		a.settled <- "requeue"
+	} else {
+		a.settled <- "nack"
+	}
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestConsumer(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	config := &Config{
+		Exchange:         "infomark-worker-jobs",
+		FallbackExchange: "infomark-worker-fallback",
+		Queue:            "infomark-worker-prioritized-submissions",
+		Key:              "job",
+	}
+
+	g.Describe("Routing", func() {
+
+		g.It("Should add the implicit tag to docker images", func() {
+			g.Assert(normalizeImage("python")).Equal("python:latest")
+			g.Assert(normalizeImage("python:3.7")).Equal("python:3.7")
+			g.Assert(normalizeImage("registry:5000/infomark/python")).Equal("registry:5000/infomark/python:latest")
+			g.Assert(normalizeImage("python@sha256:abc")).Equal("python@sha256:abc")
+		})
+
+		g.It("Should route jobs of an image to its dedicated queue", func() {
+			g.Assert(config.ImageKey("python")).Equal("job.python:latest")
+			g.Assert(config.ImageKey("python")).Equal(config.ImageKey("python:latest"))
+			g.Assert(config.ImageQueue("python")).Equal("infomark-worker-prioritized-submissions.python:latest")
+		})
+
+		g.It("Should consume from the shared queue without images", func() {
+			g.Assert(config.bindings()).Equal([]queueBinding{
+				{queue: "infomark-worker-prioritized-submissions", exchange: "infomark-worker-fallback", key: ""},
+			})
+		})
+
+		g.It("Should consume from one queue per image", func() {
+			dedicated := *config
+			dedicated.Images = []string{"python", "gcc:9"}
+
+			g.Assert(dedicated.bindings()).Equal([]queueBinding{
+				{queue: "infomark-worker-prioritized-submissions.python:latest", exchange: "infomark-worker-jobs", key: "job.python:latest"},
+				{queue: "infomark-worker-prioritized-submissions.gcc:9", exchange: "infomark-worker-jobs", key: "job.gcc:9"},
+			})
+		})
+
+	})
+
+	g.Describe("settle", func() {
+
+		var ack *acknowledger
+		var delivery amqp.Delivery
+
+		g.BeforeEach(func() {
+			RetryDelay = time.Millisecond
+			ack = &acknowledger{settled: make(chan string, 1)}
+			delivery = amqp.Delivery{Acknowledger: ack}
+		})
+
+		g.It("Should acknowledge handled messages", func() {
+			settle(delivery, nil)
+			g.Assert(<-ack.settled).Equal("ack")
+		})
+
+		g.It("Should drop messages which cannot be handled", func() {
+			settle(delivery, errors.New("malformed"))
+			g.Assert(<-ack.settled).Equal("ack")
+		})
+
+		g.It("Should requeue messages after transient errors", func() {
+			settle(delivery, Transient(errors.New("server unavailable")))
+			g.Assert(<-ack.settled).Equal("requeue")
+		})
+
+	})
+
+	g.Describe("mergeDeliveries", func() {
+
+		g.It("Should pass a single queue through", func() {
+			in := make(chan amqp.Delivery)
+			var ch <-chan amqp.Delivery = in
+			g.Assert(mergeDeliveries([]<-chan amqp.Delivery{in}) == ch).IsTrue()
+		})
+
+		g.It("Should forward all deliveries and close after all queues", func() {
+			a := make(chan amqp.Delivery)
+			b := make(chan amqp.Delivery)
+			out := mergeDeliveries([]<-chan amqp.Delivery{a, b})
+
+			go func() {
+				a <- amqp.Delivery{Body: []byte("a1")}
+				b <- amqp.Delivery{Body: []byte("b1")}
+				a <- amqp.Delivery{Body: []byte("a2")}
+				close(a)
+			}()
+
+			bodies := []string{}
+			for k := 0; k < 3; k++ {
+				bodies = append(bodies, string((<-out).Body))
+			}
+			sort.Strings(bodies)
+			g.Assert(bodies).Equal([]string{"a1", "a2", "b1"})
+
+			// b is still open
+			select {
+			case _, ok := <-out:
+				g.Assert(ok).IsTrue()
+				g.Fail("no delivery expected")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			close(b)
+			_, ok := <-out
+			g.Assert(ok).IsFalse()
+		})
+
+	})
+}
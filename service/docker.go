@@ -85,6 +85,26 @@ func (ds *DockerService) ListImages() {
 	}
 }
 
+// PulledImages returns the tags of all local docker images
+func (ds *DockerService) PulledImages() ([]string, error) {
+	ctx := context.Background()
+
+	images, err := ds.Client.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if tag != "<none>:<none>" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags, nil
+}
+
 // Pull pulls a docker image
 func (ds *DockerService) Pull(image string) (string, error) {
 	ctx := context.Background()
@@ -100,12 +120,15 @@ func (ds *DockerService) Pull(image string) (string, error) {
 
 }
 
-// Run executes a docker container and waits for the output
+// Run executes a docker container and waits for the output. The container
+// may use the given number of cores and bytes of memory.
 func (ds *DockerService) Run(
 	imageName string,
 	submissionZipFile string,
 	frameworkZipFile string,
+	cpus float64,
 	DockerMemoryBytes int64,
+	outputDirectory string,
 ) (string, int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), ds.Timeout)
 	defer cancel()
@@ -122,14 +145,15 @@ func (ds *DockerService) Run(
 	}
 
 	// See https://docs.docker.com/config/containers/resource_constraints/#cpu
-	// Each Worker gets something equivalent to 1 core. If you have 4 cores, this
-	// will allow each worker to get 100% (eg. 25% per core).
-	cpu_maximum := int64(100000)
+	// The quota is the share of the period the container may run, such that a
+	// quota of two periods is equivalent to 2 cores.
+	cpuPeriod := int64(100000)
+	cpuQuota := int64(cpus * float64(cpuPeriod))
 
 	hostCfg := &container.HostConfig{
 		Resources: container.Resources{
-			CPUPeriod:  cpu_maximum,
-			CPUQuota:   cpu_maximum,
+			CPUPeriod:  cpuPeriod,
+			CPUQuota:   cpuQuota,
 			Memory:     DockerMemoryBytes,
 			MemorySwap: 0,
 		},
@@ -149,6 +173,16 @@ func (ds *DockerService) Run(
 		},
 	}
 
+	// tests can write files to /data/output, which are collected afterwards
+	if outputDirectory != "" {
+		hostCfg.Mounts = append(hostCfg.Mounts, mount.Mount{
+			ReadOnly: false,
+			Type:     mount.TypeBind,
+			Source:   outputDirectory,
+			Target:   "/data/output",
+		})
+	}
+
 	resp, err := ds.Client.ContainerCreate(ctx, cfg, hostCfg, nil, "")
 	if err != nil {
 		return "", 0, err
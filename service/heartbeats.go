@@ -0,0 +1,52 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// HeartbeatQueue is the queue workers announce themselves to.
+const HeartbeatQueue = "infomark-worker-heartbeats"
+
+// PublishHeartbeat emits a heartbeat of a worker. Heartbeats are not
+// persisted and expire after the given time, as outdated heartbeats are
+// worthless.
+func PublishHeartbeat(cfg *Config, body []byte, ttl time.Duration) error {
+	return publishToQueue(cfg, HeartbeatQueue, amqp.Publishing{
+		Headers:         amqp.Table{},
+		ContentType:     "application/json",
+		ContentEncoding: "",
+		Body:            body,
+		DeliveryMode:    1, // 1=non-persistent, 2=persistent
+		Expiration:      fmt.Sprintf("%d", ttl.Milliseconds()),
+	})
+}
+
+// NewHeartbeatConsumer creates a new consumer which can act on heartbeats of
+// workers.
+func NewHeartbeatConsumer(cfg *Config, handleFunc func(body []byte) error) *ResultConsumer {
+	consumer := NewResultConsumer(cfg, handleFunc)
+	consumer.Queue = HeartbeatQueue
+	return consumer
+}
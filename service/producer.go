@@ -48,8 +48,19 @@ func NewProducer(cfg *Config) (*Producer, error) {
 	return producer, nil
 }
 
-// Publish emits an AMPQ message
+// Publish emits an AMPQ message with the configured routing key
 func (c *Producer) Publish(body []byte) error {
+	return c.publish(body, c.Config.Key, PublicPriority)
+}
+
+// PublishJob emits an AMPQ message for a job, which should be tested by
+// workers serving the given docker image. Messages with a higher priority
+// (0-9) are consumed first.
+func (c *Producer) PublishJob(body []byte, image string, priority uint8) error {
+	return c.publish(body, c.Config.ImageKey(image), priority)
+}
+
+func (c *Producer) publish(body []byte, key string, priority uint8) error {
 
 	// This function dials, connects, declares, publishes, and tears down,
 	// all in one go. In a real service, you probably want to maintain a
@@ -69,16 +80,8 @@ func (c *Producer) Publish(body []byte) error {
 	}
 
 	log.Printf("got Channel, declaring %q Exchange (%s)", c.Config.ExchangeType, c.Config.Exchange)
-	if err := channel.ExchangeDeclare(
-		c.Config.Exchange,     // name
-		c.Config.ExchangeType, // type
-		false,                 // durable
-		false,                 // auto-deleted
-		false,                 // internal
-		false,                 // noWait
-		nil,                   // arguments
-	); err != nil {
-		return fmt.Errorf("Exchange Declare: %s", err)
+	if err := c.Config.declareExchanges(channel); err != nil {
+		return err
 	}
 
 	// Prepare this message to be persistent.  Your publishing requirements may
@@ -88,14 +91,14 @@ func (c *Producer) Publish(body []byte) error {
 		ContentType:     "application/json",
 		ContentEncoding: "",
 		Body:            body,
-		DeliveryMode:    1, // 1=non-persistent, 2=persistent
-		Priority:        0, // 0-9
+		DeliveryMode:    1,        // 1=non-persistent, 2=persistent
+		Priority:        priority, // 0-9
 	}
 
 	log.Printf("declared Exchange, publishing %dB body (%s)", len(body), body)
 	if err = channel.Publish(
 		c.Config.Exchange, // publish to an exchange
-		c.Config.Key,      // routing to 0 or more queues
+		key,               // routing to 0 or more queues
 		false,             // mandatory
 		false,             // immediate
 		msg,
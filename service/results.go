@@ -0,0 +1,176 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// ResultQueue is the queue workers publish their results to, when results
+// are not posted over HTTP.
+const ResultQueue = "infomark-worker-results"
+
+// declareResultQueue declares the durable queue for results of workers.
+func declareResultQueue(channel *amqp.Channel, queue string) error {
+	if _, err := channel.QueueDeclare(
+		queue, // name of the queue
+		true,  // durable
+		false, // delete when usused
+		false, // exclusive
+		false, // noWait
+		nil,   // arguments
+	); err != nil {
+		return fmt.Errorf("Queue Declare: %s", err)
+	}
+	return nil
+}
+
+// PublishResult emits the result of a job to a result queue
+func PublishResult(cfg *Config, queue string, body []byte) error {
+	return publishToQueue(cfg, queue, amqp.Publishing{
+		Headers:         amqp.Table{},
+		ContentType:     "application/json",
+		ContentEncoding: "",
+		Body:            body,
+		DeliveryMode:    2, // 1=non-persistent, 2=persistent
+	})
+}
+
+// publishToQueue sends a single message directly to a durable queue.
+func publishToQueue(cfg *Config, queue string, msg amqp.Publishing) error {
+	connection, err := amqp.Dial(cfg.Connection)
+	if err != nil {
+		return fmt.Errorf("Dial: %s", err)
+	}
+	defer connection.Close()
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return fmt.Errorf("Channel: %s", err)
+	}
+
+	if err := declareResultQueue(channel, queue); err != nil {
+		return err
+	}
+
+	// the default exchange routes messages to the queue of the same name
+	if err = channel.Publish(
+		"",    // publish to the default exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		msg,
+	); err != nil {
+		return fmt.Errorf("Exchange Publish: %s", err)
+	}
+
+	return nil
+}
+
+// ResultConsumer is an object which acts on results of workers
+type ResultConsumer struct {
+	Config *Config
+	Queue  string
+
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	done    chan error
+
+	handleFunc func(body []byte) error
+}
+
+// NewResultConsumer creates a new consumer which can act on results of workers
+func NewResultConsumer(cfg *Config, handleFunc func(body []byte) error) *ResultConsumer {
+	return &ResultConsumer{
+		Config:     cfg,
+		Queue:      ResultQueue,
+		done:       make(chan error),
+		handleFunc: handleFunc,
+	}
+}
+
+// Setup connects the consumer to the result queue
+func (c *ResultConsumer) Setup() (<-chan amqp.Delivery, error) {
+	var err error
+
+	log.WithFields(logrus.Fields{"queue": c.Queue}).Info("setup AMPQ connection for results")
+
+	c.conn, err = amqp.Dial(c.Config.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("Dial: %s", err)
+	}
+
+	c.channel, err = c.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("Channel: %s", err)
+	}
+
+	if err = declareResultQueue(c.channel, c.Queue); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := c.channel.Consume(
+		c.Queue,      // name
+		c.Config.Tag, // consumerTag,
+		false,        // noAck
+		false,        // exclusive
+		false,        // noLocal
+		false,        // noWait
+		nil,          // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Queue Consume: %s", err)
+	}
+
+	return deliveries, nil
+}
+
+// Shutdown will gracefully stop the consumer
+func (c *ResultConsumer) Shutdown() error {
+	// will close() the deliveries channel
+	if err := c.channel.Cancel(c.Config.Tag, true); err != nil {
+		return fmt.Errorf("Consumer cancel failed: %s", err)
+	}
+
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("AMQP connection close error: %s", err)
+	}
+
+	// wait for handle() to exit
+	return <-c.done
+}
+
+// HandleLoop is the message loop of the consumer
+func (c *ResultConsumer) HandleLoop(deliveries <-chan amqp.Delivery) {
+	for d := range deliveries {
+		err := c.handleFunc(d.Body)
+		if err != nil {
+			log.WithFields(logrus.Fields{"bytes": len(d.Body)}).Warn(err)
+		}
+		// only transient errors are retried, a malformed result will not get
+		// better by retrying
+		settle(d, err)
+	}
+	log.Info("handle: result deliveries channel closed")
+	c.done <- nil
+}
@@ -0,0 +1,169 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"sync"
+)
+
+// epsilon absorbs rounding errors when cores are added and subtracted.
+const epsilon = 1e-9
+
+// Resources describes a number of cores and bytes of memory.
+type Resources struct {
+	CPUs   float64
+	Memory int64
+}
+
+// Or replaces zero values by the values of the fallback.
+func (r Resources) Or(fallback Resources) Resources {
+	if r.CPUs <= 0 {
+		r.CPUs = fallback.CPUs
+	}
+	if r.Memory <= 0 {
+		r.Memory = fallback.Memory
+	}
+	return r
+}
+
+// Fits tells whether r fits into the available resources.
+func (r Resources) Fits(available Resources) bool {
+	return r.CPUs <= available.CPUs+epsilon && r.Memory <= available.Memory
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{CPUs: r.CPUs + o.CPUs, Memory: r.Memory + o.Memory}
+}
+
+func (r Resources) sub(o Resources) Resources {
+	return Resources{CPUs: r.CPUs - o.CPUs, Memory: r.Memory - o.Memory}
+}
+
+// Scheduler hands out a budget of resources to jobs, such that the jobs
+// running at the same time never exceed the budget of the worker.
+type Scheduler struct {
+	Budget Resources
+	Slots  int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	used     Resources
+	running  int
+	draining bool
+	jobs     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for at most the given number of jobs
+// running at the same time within the budget.
+func NewScheduler(budget Resources, slots int) *Scheduler {
+	if slots < 1 {
+		slots = 1
+	}
+	s := &Scheduler{
+		Budget: budget,
+		Slots:  slots,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Fit clamps the resources of a job to the budget. A job which needs more
+// than the entire budget runs alone with the entire budget instead of never.
+func (s *Scheduler) Fit(r Resources) Resources {
+	if r.CPUs > s.Budget.CPUs {
+		r.CPUs = s.Budget.CPUs
+	}
+	if r.Memory > s.Budget.Memory {
+		r.Memory = s.Budget.Memory
+	}
+	return r
+}
+
+// Acquire blocks until the resources are available and reserves them. It
+// returns false without reserving anything if the scheduler is draining.
+func (s *Scheduler) Acquire(r Resources) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for !s.draining && !(s.running < s.Slots && r.Fits(s.Budget.sub(s.used))) {
+		s.cond.Wait()
+	}
+	if s.draining {
+		return false
+	}
+
+	s.used = s.used.add(r)
+	s.running++
+	s.jobs.Add(1)
+	return true
+}
+
+// Release returns the resources of a finished job.
+func (s *Scheduler) Release(r Resources) {
+	s.mu.Lock()
+	s.used = s.used.sub(r)
+	s.running--
+	s.mu.Unlock()
+
+	s.jobs.Done()
+	s.cond.Broadcast()
+}
+
+// Prefetch is the number of unacknowledged jobs a worker should hold: the
+// running jobs and as many jobs of the given size as fit into the remaining
+// budget. It is at least one.
+func (s *Scheduler) Prefetch(typical Resources) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	free := s.Budget.sub(s.used)
+	fitting := 0
+	for s.running+fitting < s.Slots && typical.Fits(free) {
+		free = free.sub(typical)
+		fitting++
+		if typical.CPUs <= 0 && typical.Memory <= 0 {
+			// jobs without any demand are only limited by the slots
+			fitting = s.Slots - s.running
+			break
+		}
+	}
+
+	if s.running+fitting < 1 {
+		return 1
+	}
+	return s.running + fitting
+}
+
+// Running returns the number of running jobs.
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Drain refuses all further jobs and waits until the running jobs are done.
+func (s *Scheduler) Drain() {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+
+	s.jobs.Wait()
+}
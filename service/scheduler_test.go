@@ -0,0 +1,117 @@
+// InfoMark - a platform for managing courses with
+//            distributing exercise sheets and testing exercise submissions
+// Copyright (C) 2019 ComputerGraphics Tuebingen
+//               2020-present InfoMark.org
+// Authors: Patrick Wieschollek
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/franela/goblin"
+)
+
+func TestScheduler(t *testing.T) {
+	g := goblin.Goblin(t)
+
+	small := Resources{CPUs: 1, Memory: 100}
+	large := Resources{CPUs: 3, Memory: 300}
+
+	g.Describe("Scheduler", func() {
+
+		g.It("Should use fallback values for undeclared resources", func() {
+			r := Resources{CPUs: 0, Memory: 50}.Or(small)
+			g.Assert(r).Equal(Resources{CPUs: 1, Memory: 50})
+		})
+
+		g.It("Should clamp jobs to the budget", func() {
+			s := NewScheduler(Resources{CPUs: 2, Memory: 200}, 4)
+			g.Assert(s.Fit(large)).Equal(Resources{CPUs: 2, Memory: 200})
+			g.Assert(s.Fit(small)).Equal(small)
+		})
+
+		g.It("Should prefetch as many jobs as fit into the budget", func() {
+			s := NewScheduler(Resources{CPUs: 4, Memory: 1000}, 8)
+			g.Assert(s.Prefetch(small)).Equal(4)
+
+			g.Assert(s.Acquire(large)).IsTrue()
+			g.Assert(s.Prefetch(small)).Equal(2)
+
+			g.Assert(s.Acquire(small)).IsTrue()
+			// no room left, only the running jobs are held
+			g.Assert(s.Prefetch(small)).Equal(2)
+
+			s.Release(large)
+			g.Assert(s.Prefetch(small)).Equal(4)
+		})
+
+		g.It("Should respect the number of slots", func() {
+			s := NewScheduler(Resources{CPUs: 16, Memory: 10000}, 2)
+			g.Assert(s.Prefetch(small)).Equal(2)
+		})
+
+		g.It("Should block until resources are released", func() {
+			s := NewScheduler(Resources{CPUs: 4, Memory: 1000}, 4)
+			g.Assert(s.Acquire(large)).IsTrue()
+
+			acquired := make(chan bool)
+			go func() {
+				acquired <- s.Acquire(large)
+			}()
+
+			select {
+			case <-acquired:
+				g.Fail("job should not fit into the remaining budget")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			s.Release(large)
+			g.Assert(<-acquired).IsTrue()
+			g.Assert(s.Running()).Equal(1)
+		})
+
+		g.It("Should drain running jobs and refuse waiting jobs", func() {
+			s := NewScheduler(Resources{CPUs: 4, Memory: 1000}, 4)
+			g.Assert(s.Acquire(large)).IsTrue()
+
+			acquired := make(chan bool)
+			go func() {
+				acquired <- s.Acquire(large)
+			}()
+
+			drained := make(chan struct{})
+			go func() {
+				s.Drain()
+				close(drained)
+			}()
+
+			g.Assert(<-acquired).IsFalse()
+
+			select {
+			case <-drained:
+				g.Fail("drain should wait for the running job")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			s.Release(large)
+			<-drained
+			g.Assert(s.Running()).Equal(0)
+		})
+
+	})
+}
@@ -22,22 +22,36 @@ package symbol
 type key int
 
 // to replace
-//   context.WithValue(ctx, "course", course)
+//
+//	context.WithValue(ctx, "course", course)
+//
 // and
-//   r.Context().Value(symbol.CtxKeyCourse)
+//
+//	r.Context().Value(symbol.CtxKeyCourse)
+//
 // TODO(): create a shared context-key package
 const (
-	CtxKeyAccessClaims key = iota // must be 0 to work with the auth-package
-	CtxKeyGroup        key = iota
-	CtxKeyMaterial     key = iota
-	CtxKeyCourse       key = iota
-	CtxKeyCourseRole   key = iota
-	CtxKeyUser         key = iota
-	CtxKeyTask         key = iota
-	CtxKeySubmission   key = iota
-	CtxKeySheet        key = iota
-	CtxKeyGrade        key = iota
-	CtxKeyExam         key = iota
+	CtxKeyAccessClaims      key = iota // must be 0 to work with the auth-package
+	CtxKeyGroup             key = iota
+	CtxKeyMaterial          key = iota
+	CtxKeyCourse            key = iota
+	CtxKeyCourseRole        key = iota
+	CtxKeyUser              key = iota
+	CtxKeyTask              key = iota
+	CtxKeySubmission        key = iota
+	CtxKeySheet             key = iota
+	CtxKeyGrade             key = iota
+	CtxKeyExam              key = iota
+	CtxKeyTestBatch         key = iota
+	CtxKeyWorker            key = iota
+	CtxKeyArtifact          key = iota
+	CtxKeyAccessToken       key = iota
+	CtxKeySession           key = iota
+	CtxKeyImpersonation     key = iota
+	CtxKeyCoursePermissions key = iota
+	CtxKeyRole              key = iota
+	CtxKeyAudit             key = iota
+	CtxKeyOutgoingEmail     key = iota
 	// ...
 )
 
@@ -64,3 +78,13 @@ func (t TestingResult) AsInt64() int64 {
 	}
 	return 1
 }
+
+type ReferenceState int
+
+// these are the states of testing the reference solution of a task
+const (
+	ReferenceStateNone    ReferenceState = 0 // no reference solution or no tests
+	ReferenceStatePending ReferenceState = 1 // reference solution is being tested
+	ReferenceStatePassed  ReferenceState = 2 // reference solution passed the tests
+	ReferenceStateFailed  ReferenceState = 3 // reference solution failed, tests are broken
+)